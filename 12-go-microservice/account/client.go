@@ -4,17 +4,25 @@ import (
 	"context"
 
 	"github.com/leminkhoa/go-grpc-graphql-microservice/account/pb"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
+// Only idempotent reads are retried, retrying a write could apply it twice
+var retryableMethods = []string{
+	"GetAccount",
+	"GetAccounts",
+	"GetAccountsPage",
+	"GetAddresses",
+}
+
 type Client struct {
 	conn    *grpc.ClientConn
 	service pb.AccountServiceClient
 }
 
-func NewClient(url string) (*Client, error) {
-	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewClient(url string, cfg resilience.Config) (*Client, error) {
+	conn, err := resilience.Dial(url, pb.AccountService_ServiceDesc.ServiceName, retryableMethods, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -31,19 +39,37 @@ func (c *Client) Close() {
 	c.conn.Close()
 }
 
-func (c *Client) PostAccount(ctx context.Context, name string) (*Account, error) {
+func (c *Client) PostAccount(ctx context.Context, name string, email string, displayName string) (*Account, error) {
 	r, err := c.service.PostAccount(
 		ctx,
-		&pb.PostAccountRequest{Name: name},
+		&pb.PostAccountRequest{
+			Name:        name,
+			Email:       email,
+			DisplayName: displayName,
+		},
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Account{
-		ID:   r.Account.Id,
-		Name: r.Account.Name,
-	}, nil
+	return accountFromProto(r.Account), nil
+}
+
+func (c *Client) UpdateAccount(ctx context.Context, id string, name string, email string, displayName string) (*Account, error) {
+	r, err := c.service.UpdateAccount(
+		ctx,
+		&pb.UpdateAccountRequest{
+			Id:          id,
+			Name:        name,
+			Email:       email,
+			DisplayName: displayName,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return accountFromProto(r.Account), nil
 }
 
 func (c *Client) GetAccount(ctx context.Context, id string) (*Account, error) {
@@ -55,10 +81,7 @@ func (c *Client) GetAccount(ctx context.Context, id string) (*Account, error) {
 		return nil, err
 	}
 
-	return &Account{
-		ID:   r.Account.Id,
-		Name: r.Account.Name,
-	}, nil
+	return accountFromProto(r.Account), nil
 }
 
 func (c *Client) GetAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error) {
@@ -76,11 +99,132 @@ func (c *Client) GetAccounts(ctx context.Context, skip uint64, take uint64) ([]A
 
 	var accounts []Account
 	for _, a := range r.Accounts {
-		accounts = append(accounts, Account{
-			ID:   a.Id,
-			Name: a.Name,
-		})
+		accounts = append(accounts, *accountFromProto(a))
 	}
 	return accounts, nil
 
 }
+
+func (c *Client) GetAccountsPage(ctx context.Context, after string, first uint64) (*AccountPage, error) {
+	r, err := c.service.GetAccountsPage(
+		ctx,
+		&pb.GetAccountsPageRequest{
+			After: after,
+			First: first,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AccountPage{
+		TotalCount:  r.TotalCount,
+		HasNextPage: r.HasNextPage,
+	}
+	for _, a := range r.Accounts {
+		page.Accounts = append(page.Accounts, *accountFromProto(a))
+	}
+	return page, nil
+}
+
+func (c *Client) PostAddress(ctx context.Context, accountID string, a Address) (*Address, error) {
+	r, err := c.service.PostAddress(
+		ctx,
+		&pb.PostAddressRequest{
+			AccountId: accountID,
+			Address:   addressToProto(a),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	address := addressFromProto(r.Address)
+	address.AccountID = accountID
+	return &address, nil
+}
+
+func (c *Client) UpdateAddress(ctx context.Context, accountID string, a Address) (*Address, error) {
+	r, err := c.service.UpdateAddress(
+		ctx,
+		&pb.UpdateAddressRequest{
+			AccountId: accountID,
+			Address:   addressToProto(a),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	address := addressFromProto(r.Address)
+	address.AccountID = accountID
+	return &address, nil
+}
+
+func (c *Client) DeleteAddress(ctx context.Context, accountID string, id string) error {
+	_, err := c.service.DeleteAddress(
+		ctx,
+		&pb.DeleteAddressRequest{
+			AccountId: accountID,
+			Id:        id,
+		},
+	)
+
+	return err
+}
+
+func (c *Client) GetAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	r, err := c.service.GetAddresses(
+		ctx,
+		&pb.GetAddressesRequest{AccountId: accountID},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := []Address{}
+	for _, a := range r.Addresses {
+		address := addressFromProto(a)
+		address.AccountID = accountID
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+func accountFromProto(a *pb.Account) *Account {
+	account := &Account{
+		ID:          a.GetId(),
+		Name:        a.GetName(),
+		Email:       a.GetEmail(),
+		DisplayName: a.GetDisplayName(),
+		Addresses:   []Address{},
+	}
+	account.CreatedAt.UnmarshalBinary(a.GetCreatedAt())
+	account.UpdatedAt.UnmarshalBinary(a.GetUpdatedAt())
+	for _, address := range a.GetAddresses() {
+		res := addressFromProto(address)
+		res.AccountID = account.ID
+		account.Addresses = append(account.Addresses, res)
+	}
+
+	return account
+}
+
+func addressFromProto(a *pb.AccountAddress) Address {
+	address := Address{
+		ID:         a.GetId(),
+		Type:       AddressType(a.GetType()),
+		Name:       a.GetName(),
+		Line1:      a.GetLine1(),
+		Line2:      a.GetLine2(),
+		City:       a.GetCity(),
+		State:      a.GetState(),
+		PostalCode: a.GetPostalCode(),
+		Country:    a.GetCountry(),
+		IsDefault:  a.GetIsDefault(),
+	}
+	address.CreatedAt.UnmarshalBinary(a.GetCreatedAt())
+	address.UpdatedAt.UnmarshalBinary(a.GetUpdatedAt())
+
+	return address
+}
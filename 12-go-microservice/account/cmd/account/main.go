@@ -2,42 +2,47 @@ package main
 
 import (
 	"log"
-	"time"
 
-	"github.com/kelseyhightower/envconfig"
 	"github.com/leminkhoa/go-grpc-graphql-microservice/account"
-	"github.com/tinrab/retry"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
 )
 
 type Config struct {
-	DatabaseURL string `envconfig:"DATABASE_URL"`
+	bootstrap.Config
+	Database bootstrap.DatabaseConfig `envconfig:"DATABASE"`
+	HTTPPort int                      `envconfig:"HTTP_PORT" default:"8090"`
+}
+
+func (c Config) Validate() error {
+	return bootstrap.ValidatePort("HTTP_PORT", c.HTTPPort)
 }
 
 func main() {
 	var cfg Config
-	err := envconfig.Process("", &cfg)
-
-	if err != nil {
+	if err := bootstrap.Load(&cfg); err != nil {
 		log.Fatal(err)
 	}
+	bootstrap.Banner("account", &cfg)
 
-	var r account.Repository
-	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
-		r, err = account.NewPostgresRepository(cfg.DatabaseURL)
-		if err != nil {
-			log.Println(err)
-		}
-
-		return
+	r, err := bootstrap.WaitFor(cfg.Startup, "database", func() (account.Repository, error) {
+		return account.NewPostgresRepository(cfg.Database)
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer r.Close()
 
-	log.Println("Listening on port 8080...")
+	log.Printf("Listening on port %d, REST/JSON on port %d...", cfg.Port, cfg.HTTPPort)
 
 	// Create an account service wrapping repository
 	s := account.NewService(r)
 
+	// The REST/JSON gateway forwards to the gRPC server below
+	go func() {
+		log.Fatal(account.ListenHTTP(cfg.Port, cfg.HTTPPort))
+	}()
+
 	// Create a server and listen to service
-	log.Fatal(account.ListenGRPC(s, 8080))
+	log.Fatal(account.ListenGRPC(s, cfg.Port))
 
 }
@@ -3,15 +3,36 @@ package account
 import (
 	"context"
 	"database/sql"
+	"errors"
 
-	_ "github.com/lib/pq"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAccountNotFound = errors.New("account not found")
+	ErrAddressNotFound = errors.New("address not found")
+	ErrEmailTaken      = errors.New("email is already used by another account")
+)
+
+const (
+	uniqueViolation     = pq.ErrorCode("23505")
+	foreignKeyViolation = pq.ErrorCode("23503")
 )
 
 type Repository interface {
 	Close()
 	PutAccount(ctx context.Context, a Account) error
+	UpdateAccount(ctx context.Context, a Account) error
 	GetAccountByID(ctx context.Context, id string) (*Account, error)
 	ListAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error)
+	ListAccountsAfter(ctx context.Context, after string, first uint64) ([]Account, error)
+	CountAccounts(ctx context.Context) (uint64, error)
+	PutAddress(ctx context.Context, a Address) error
+	UpdateAddress(ctx context.Context, a Address) error
+	DeleteAddress(ctx context.Context, accountID string, id string) error
+	GetAddressByID(ctx context.Context, accountID string, id string) (*Address, error)
+	GetAddressesForAccounts(ctx context.Context, accountIDs []string) ([]Address, error)
 }
 
 type postgresRepository struct {
@@ -26,17 +47,68 @@ func (r *postgresRepository) Ping() error {
 	return r.db.Ping()
 }
 
+// constraintError turns constraint violations into the errors of this package
+func constraintError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case uniqueViolation:
+			return ErrEmailTaken
+		case foreignKeyViolation:
+			return ErrAccountNotFound
+		}
+	}
+	return err
+}
+
 func (r *postgresRepository) PutAccount(ctx context.Context, a Account) error {
-	_, err := r.db.ExecContext(ctx, "INSERT INTO accounts(id, name) VALUES($1, $2)", a.ID, a.Name)
+	_, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO accounts(id, name, email, display_name, created_at, updated_at) VALUES($1, $2, $3, $4, $5, $6)",
+		a.ID,
+		a.Name,
+		a.Email,
+		a.DisplayName,
+		a.CreatedAt,
+		a.UpdatedAt,
+	)
 
-	return err
+	return constraintError(err)
+}
+
+func (r *postgresRepository) UpdateAccount(ctx context.Context, a Account) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		"UPDATE accounts SET name = $2, email = $3, display_name = $4, updated_at = $5 WHERE id = $1",
+		a.ID,
+		a.Name,
+		a.Email,
+		a.DisplayName,
+		a.UpdatedAt,
+	)
+	if err != nil {
+		return constraintError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAccountNotFound
+	}
+
+	return nil
 }
 
 func (r *postgresRepository) GetAccountByID(ctx context.Context, id string) (*Account, error) {
-	row := r.db.QueryRowContext(ctx, "SELECT id, name FROM accounts WHERE id = $1", id)
+	row := r.db.QueryRowContext(ctx, "SELECT id, name, email, display_name, created_at, updated_at FROM accounts WHERE id = $1", id)
 
 	a := &Account{}
-	if err := row.Scan(&a.ID, &a.Name); err != nil {
+	if err := row.Scan(&a.ID, &a.Name, &a.Email, &a.DisplayName, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
 		return nil, err
 	}
 
@@ -46,9 +118,13 @@ func (r *postgresRepository) GetAccountByID(ctx context.Context, id string) (*Ac
 func (r *postgresRepository) ListAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error) {
 	rows, err := r.db.QueryContext(
 		ctx,
-		`SELECT 
-			id, 
-			name 
+		`SELECT
+			id,
+			name,
+			email,
+			display_name,
+			created_at,
+			updated_at
 		FROM accounts
 		ORDER BY id DESC OFFSET $1 LIMIT $2
 		`,
@@ -61,29 +137,314 @@ func (r *postgresRepository) ListAccounts(ctx context.Context, skip uint64, take
 
 	defer rows.Close()
 
+	return scanAccounts(rows)
+}
+
+// ListAccountsAfter uses keyset pagination, so deep pages cost the same as the first one
+func (r *postgresRepository) ListAccountsAfter(ctx context.Context, after string, first uint64) ([]Account, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT
+			id,
+			name,
+			email,
+			display_name,
+			created_at,
+			updated_at
+		FROM accounts
+		WHERE $1 = '' OR id < $1
+		ORDER BY id DESC LIMIT $2
+		`,
+		after,
+		first,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanAccounts(rows)
+}
+
+func scanAccounts(rows *sql.Rows) ([]Account, error) {
 	accounts := []Account{}
 
 	for rows.Next() {
-		a := &Account{}
-		if err = rows.Scan(a.ID, a.Name); err == nil {
-			accounts = append(accounts, *a)
+		a := Account{}
+		if err := rows.Scan(&a.ID, &a.Name, &a.Email, &a.DisplayName, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, err
 		}
+		accounts = append(accounts, a)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
 	return accounts, nil
 }
 
-func NewPostgresRepository(url string) (Repository, error) {
-	db, err := sql.Open("postgres", url)
+func (r *postgresRepository) CountAccounts(ctx context.Context) (uint64, error) {
+	var count uint64
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM accounts").Scan(&count)
+
+	return count, err
+}
+
+// PutAddress stores a new address, a default address replaces the previous default of its type
+func (r *postgresRepository) PutAddress(ctx context.Context, a Address) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if a.IsDefault {
+		if err = clearDefaultAddress(ctx, tx, a); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`
+		INSERT INTO account_addresses(id, account_id, type, name, line1, line2, city, state, postal_code, country, is_default, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		`,
+		a.ID,
+		a.AccountID,
+		a.Type,
+		a.Name,
+		a.Line1,
+		a.Line2,
+		a.City,
+		a.State,
+		a.PostalCode,
+		a.Country,
+		a.IsDefault,
+		a.CreatedAt,
+		a.UpdatedAt,
+	)
+	if err != nil {
+		return constraintError(err)
+	}
+
+	return nil
+}
+
+// UpdateAddress saves an address, a default address replaces the previous default of its type
+func (r *postgresRepository) UpdateAddress(ctx context.Context, a Address) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if a.IsDefault {
+		if err = clearDefaultAddress(ctx, tx, a); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.ExecContext(
+		ctx,
+		`
+		UPDATE account_addresses
+		SET type = $3, name = $4, line1 = $5, line2 = $6, city = $7, state = $8, postal_code = $9, country = $10, is_default = $11, updated_at = $12
+		WHERE id = $1 AND account_id = $2
+		`,
+		a.ID,
+		a.AccountID,
+		a.Type,
+		a.Name,
+		a.Line1,
+		a.Line2,
+		a.City,
+		a.State,
+		a.PostalCode,
+		a.Country,
+		a.IsDefault,
+		a.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAddressNotFound
+	}
+
+	return nil
+}
+
+func clearDefaultAddress(ctx context.Context, tx *sql.Tx, a Address) error {
+	_, err := tx.ExecContext(
+		ctx,
+		"UPDATE account_addresses SET is_default = FALSE WHERE account_id = $1 AND type = $2 AND id <> $3 AND is_default",
+		a.AccountID,
+		a.Type,
+		a.ID,
+	)
+
+	return err
+}
+
+// DeleteAddress removes an address. When it was the default one, the oldest
+// remaining address of its type becomes the default.
+func (r *postgresRepository) DeleteAddress(ctx context.Context, accountID string, id string) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	var addressType string
+	var wasDefault bool
+	err = tx.QueryRowContext(
+		ctx,
+		"DELETE FROM account_addresses WHERE id = $1 AND account_id = $2 RETURNING type, is_default",
+		id,
+		accountID,
+	).Scan(&addressType, &wasDefault)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAddressNotFound
+		}
+		return err
+	}
+
+	if !wasDefault {
+		return nil
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`
+		UPDATE account_addresses SET is_default = TRUE
+		WHERE id = (
+			SELECT id FROM account_addresses
+			WHERE account_id = $1 AND type = $2
+			ORDER BY created_at, id LIMIT 1
+		)
+		`,
+		accountID,
+		addressType,
+	)
+
+	return err
+}
+
+func (r *postgresRepository) GetAddressByID(ctx context.Context, accountID string, id string) (*Address, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT id, account_id, type, name, line1, line2, city, state, postal_code, country, is_default, created_at, updated_at
+		FROM account_addresses
+		WHERE id = $1 AND account_id = $2
+		`,
+		id,
+		accountID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	addresses, err := scanAddresses(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addresses) == 0 {
+		return nil, ErrAddressNotFound
+	}
+
+	return &addresses[0], nil
+}
+
+// GetAddressesForAccounts returns the addresses of all the accounts, defaults first
+func (r *postgresRepository) GetAddressesForAccounts(ctx context.Context, accountIDs []string) ([]Address, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT id, account_id, type, name, line1, line2, city, state, postal_code, country, is_default, created_at, updated_at
+		FROM account_addresses
+		WHERE account_id = ANY($1)
+		ORDER BY is_default DESC, created_at, id
+		`,
+		pq.Array(accountIDs),
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.Ping()
+	defer rows.Close()
+
+	return scanAddresses(rows)
+}
+
+func scanAddresses(rows *sql.Rows) ([]Address, error) {
+	addresses := []Address{}
+
+	for rows.Next() {
+		a := Address{}
+		err := rows.Scan(
+			&a.ID,
+			&a.AccountID,
+			&a.Type,
+			&a.Name,
+			&a.Line1,
+			&a.Line2,
+			&a.City,
+			&a.State,
+			&a.PostalCode,
+			&a.Country,
+			&a.IsDefault,
+			&a.CreatedAt,
+			&a.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return addresses, nil
+}
+
+func NewPostgresRepository(cfg bootstrap.DatabaseConfig) (Repository, error) {
+	db, err := cfg.Open("postgres")
 	if err != nil {
 		return nil, err
 	}
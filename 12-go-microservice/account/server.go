@@ -2,12 +2,18 @@ package account
 
 import (
 	"context"
+	_ "embed"
+	"errors"
 	"fmt"
+	"log"
 	"net"
 
 	"github.com/leminkhoa/go-grpc-graphql-microservice/account/pb"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/rest"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type grpcServer struct {
@@ -28,28 +34,42 @@ func ListenGRPC(s Service, port int) error {
 
 }
 
+//go:embed pb/account.swagger.json
+var openAPI []byte
+
+// ListenHTTP serves the REST/JSON API, forwarding each request to the gRPC
+// server listening on grpcPort
+func ListenHTTP(grpcPort int, port int) error {
+	return rest.Listen(port, fmt.Sprintf("localhost:%d", grpcPort), openAPI, pb.RegisterAccountServiceHandlerFromEndpoint)
+}
+
 func (s *grpcServer) PostAccount(ctx context.Context, r *pb.PostAccountRequest) (*pb.PostAccountResponse, error) {
-	a, err := s.service.PostAccount(ctx, r.Name)
+	a, err := s.service.PostAccount(ctx, r.Name, r.Email, r.DisplayName)
 	if err != nil {
-		return nil, err
+		log.Println(err)
+		return nil, accountError(err)
+	}
+
+	return &pb.PostAccountResponse{Account: accountToProto(*a)}, nil
+}
+
+func (s *grpcServer) UpdateAccount(ctx context.Context, r *pb.UpdateAccountRequest) (*pb.UpdateAccountResponse, error) {
+	a, err := s.service.UpdateAccount(ctx, r.Id, r.Name, r.Email, r.DisplayName)
+	if err != nil {
+		log.Println(err)
+		return nil, accountError(err)
 	}
 
-	return &pb.PostAccountResponse{Account: &pb.Account{
-		Id:   a.ID,
-		Name: a.Name,
-	}}, nil
+	return &pb.UpdateAccountResponse{Account: accountToProto(*a)}, nil
 }
 
 func (s *grpcServer) GetAccount(ctx context.Context, r *pb.GetAccountRequest) (*pb.GetAccountResponse, error) {
 	a, err := s.service.GetAccount(ctx, r.Id)
 	if err != nil {
-		return nil, err
+		return nil, accountError(err)
 	}
 
-	return &pb.GetAccountResponse{Account: &pb.Account{
-		Id:   a.ID,
-		Name: a.Name,
-	}}, nil
+	return &pb.GetAccountResponse{Account: accountToProto(*a)}, nil
 }
 
 func (s *grpcServer) GetAccounts(ctx context.Context, r *pb.GetAccountsRequest) (*pb.GetAccountsResponse, error) {
@@ -60,13 +80,118 @@ func (s *grpcServer) GetAccounts(ctx context.Context, r *pb.GetAccountsRequest)
 	accounts := []*pb.Account{}
 
 	for _, p := range res {
-		accounts = append(
-			accounts,
-			&pb.Account{
-				Id:   p.ID,
-				Name: p.Name,
-			},
-		)
+		accounts = append(accounts, accountToProto(p))
 	}
 	return &pb.GetAccountsResponse{Accounts: accounts}, nil
 }
+
+func (s *grpcServer) GetAccountsPage(ctx context.Context, r *pb.GetAccountsPageRequest) (*pb.GetAccountsPageResponse, error) {
+	page, err := s.service.GetAccountsPage(ctx, r.After, r.First)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []*pb.Account{}
+	for _, a := range page.Accounts {
+		accounts = append(accounts, accountToProto(a))
+	}
+
+	return &pb.GetAccountsPageResponse{
+		Accounts:    accounts,
+		TotalCount:  page.TotalCount,
+		HasNextPage: page.HasNextPage,
+	}, nil
+}
+
+func (s *grpcServer) PostAddress(ctx context.Context, r *pb.PostAddressRequest) (*pb.PostAddressResponse, error) {
+	a, err := s.service.PostAddress(ctx, r.AccountId, addressFromProto(r.GetAddress()))
+	if err != nil {
+		log.Println(err)
+		return nil, accountError(err)
+	}
+
+	return &pb.PostAddressResponse{Address: addressToProto(*a)}, nil
+}
+
+func (s *grpcServer) UpdateAddress(ctx context.Context, r *pb.UpdateAddressRequest) (*pb.UpdateAddressResponse, error) {
+	a, err := s.service.UpdateAddress(ctx, r.AccountId, addressFromProto(r.GetAddress()))
+	if err != nil {
+		log.Println(err)
+		return nil, accountError(err)
+	}
+
+	return &pb.UpdateAddressResponse{Address: addressToProto(*a)}, nil
+}
+
+func (s *grpcServer) DeleteAddress(ctx context.Context, r *pb.DeleteAddressRequest) (*pb.DeleteAddressResponse, error) {
+	if err := s.service.DeleteAddress(ctx, r.AccountId, r.Id); err != nil {
+		log.Println(err)
+		return nil, accountError(err)
+	}
+
+	return &pb.DeleteAddressResponse{}, nil
+}
+
+func (s *grpcServer) GetAddresses(ctx context.Context, r *pb.GetAddressesRequest) (*pb.GetAddressesResponse, error) {
+	addresses, err := s.service.GetAddresses(ctx, r.AccountId)
+	if err != nil {
+		return nil, accountError(err)
+	}
+
+	res := &pb.GetAddressesResponse{Addresses: []*pb.AccountAddress{}}
+	for _, a := range addresses {
+		res.Addresses = append(res.Addresses, addressToProto(a))
+	}
+
+	return res, nil
+}
+
+// accountError maps service errors to gRPC status codes so clients can tell them apart
+func accountError(err error) error {
+	switch {
+	case errors.Is(err, ErrAccountNotFound), errors.Is(err, ErrAddressNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidAccount), errors.Is(err, ErrInvalidAddress):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrEmailTaken):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return err
+	}
+}
+
+func accountToProto(a Account) *pb.Account {
+	res := &pb.Account{
+		Id:          a.ID,
+		Name:        a.Name,
+		Email:       a.Email,
+		DisplayName: a.DisplayName,
+		Addresses:   []*pb.AccountAddress{},
+	}
+	res.CreatedAt, _ = a.CreatedAt.MarshalBinary()
+	res.UpdatedAt, _ = a.UpdatedAt.MarshalBinary()
+	for _, address := range a.Addresses {
+		res.Addresses = append(res.Addresses, addressToProto(address))
+	}
+
+	return res
+}
+
+func addressToProto(a Address) *pb.AccountAddress {
+	res := &pb.AccountAddress{
+		Id:         a.ID,
+		Type:       string(a.Type),
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		State:      a.State,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+		IsDefault:  a.IsDefault,
+	}
+	res.CreatedAt, _ = a.CreatedAt.MarshalBinary()
+	res.UpdatedAt, _ = a.UpdatedAt.MarshalBinary()
+
+	return res
+}
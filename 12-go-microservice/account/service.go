@@ -2,19 +2,73 @@ package account
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/segmentio/ksuid"
 )
 
+var (
+	ErrInvalidAccount = errors.New("invalid account")
+	ErrInvalidAddress = errors.New("invalid address")
+)
+
 type Service interface {
-	PostAccount(ctx context.Context, name string) (*Account, error)
+	PostAccount(ctx context.Context, name string, email string, displayName string) (*Account, error)
+	UpdateAccount(ctx context.Context, id string, name string, email string, displayName string) (*Account, error)
 	GetAccount(ctx context.Context, id string) (*Account, error)
 	GetAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error)
+	GetAccountsPage(ctx context.Context, after string, first uint64) (*AccountPage, error)
+	PostAddress(ctx context.Context, accountID string, a Address) (*Address, error)
+	UpdateAddress(ctx context.Context, accountID string, a Address) (*Address, error)
+	DeleteAddress(ctx context.Context, accountID string, id string) error
+	GetAddresses(ctx context.Context, accountID string) ([]Address, error)
 }
 
 type Account struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"displayName"`
+	Addresses   []Address `json:"addresses"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type AddressType string
+
+const (
+	AddressBilling  AddressType = "billing"
+	AddressShipping AddressType = "shipping"
+)
+
+// Address is an address saved on an account. An account has at most one
+// default address of each type.
+type Address struct {
+	ID         string      `json:"id"`
+	AccountID  string      `json:"accountId"`
+	Type       AddressType `json:"type"`
+	Name       string      `json:"name"`
+	Line1      string      `json:"line1"`
+	Line2      string      `json:"line2"`
+	City       string      `json:"city"`
+	State      string      `json:"state"`
+	PostalCode string      `json:"postalCode"`
+	Country    string      `json:"country"`
+	IsDefault  bool        `json:"isDefault"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	UpdatedAt  time.Time   `json:"updatedAt"`
+}
+
+// AccountPage is a cursor based page of accounts, the cursor of an account is its ID
+type AccountPage struct {
+	Accounts    []Account
+	TotalCount  uint64
+	HasNextPage bool
 }
 
 type accountService struct {
@@ -27,11 +81,81 @@ func NewService(r Repository) Service {
 	}
 }
 
-func (s *accountService) PostAccount(ctx context.Context, name string) (*Account, error) {
+// validate normalizes the profile fields and checks they fit the accounts table
+func (a *Account) validate() error {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Email = strings.ToLower(strings.TrimSpace(a.Email))
+	a.DisplayName = strings.TrimSpace(a.DisplayName)
+	if a.DisplayName == "" {
+		a.DisplayName = a.Name
+	}
+
+	if a.Name == "" || utf8.RuneCountInString(a.Name) > 24 {
+		return fmt.Errorf("%w: name must be between 1 and 24 characters", ErrInvalidAccount)
+	}
+	if utf8.RuneCountInString(a.DisplayName) > 64 {
+		return fmt.Errorf("%w: display name must be at most 64 characters", ErrInvalidAccount)
+	}
+	// Only bare addresses are accepted, not "Name <email>"
+	if e, err := mail.ParseAddress(a.Email); err != nil || e.Address != a.Email || len(a.Email) > 254 {
+		return fmt.Errorf("%w: %q is not a valid email", ErrInvalidAccount, a.Email)
+	}
+
+	return nil
+}
+
+// validate normalizes the address fields and checks they fit the account_addresses table
+func (a *Address) validate() error {
+	fields := []struct {
+		name     string
+		value    *string
+		required bool
+		max      int
+	}{
+		{"name", &a.Name, true, 64},
+		{"line1", &a.Line1, true, 128},
+		{"line2", &a.Line2, false, 128},
+		{"city", &a.City, true, 64},
+		{"state", &a.State, false, 64},
+		{"postal code", &a.PostalCode, true, 16},
+	}
+	for _, f := range fields {
+		*f.value = strings.TrimSpace(*f.value)
+		if f.required && *f.value == "" {
+			return fmt.Errorf("%w: %s is required", ErrInvalidAddress, f.name)
+		}
+		if utf8.RuneCountInString(*f.value) > f.max {
+			return fmt.Errorf("%w: %s must be at most %d characters", ErrInvalidAddress, f.name, f.max)
+		}
+	}
+
+	if a.Type != AddressBilling && a.Type != AddressShipping {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidAddress, a.Type)
+	}
+
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	if len(a.Country) != 2 || strings.Trim(a.Country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return fmt.Errorf("%w: country must be a two letter ISO code", ErrInvalidAddress)
+	}
+
+	return nil
+}
+
+func (s *accountService) PostAccount(ctx context.Context, name string, email string, displayName string) (*Account, error) {
+	now := time.Now().UTC()
 	a := &Account{
-		ID:   ksuid.New().String(),
-		Name: name,
+		ID:          ksuid.New().String(),
+		Name:        name,
+		Email:       email,
+		DisplayName: displayName,
+		Addresses:   []Address{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+
 	if err := s.repository.PutAccount(ctx, *a); err != nil {
 		return nil, err
 	}
@@ -39,13 +163,180 @@ func (s *accountService) PostAccount(ctx context.Context, name string) (*Account
 	return a, nil
 }
 
+func (s *accountService) UpdateAccount(ctx context.Context, id string, name string, email string, displayName string) (*Account, error) {
+	a, err := s.GetAccount(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Name = name
+	a.Email = email
+	a.DisplayName = displayName
+	a.UpdatedAt = time.Now().UTC()
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.UpdateAccount(ctx, *a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
 func (s *accountService) GetAccount(ctx context.Context, id string) (*Account, error) {
-	return s.repository.GetAccountByID(ctx, id)
+	a, err := s.repository.GetAccountByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []Account{*a}
+	if err := s.attachAddresses(ctx, accounts); err != nil {
+		return nil, err
+	}
+
+	return &accounts[0], nil
 }
 
 func (s *accountService) GetAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error) {
 	if take > 100 || (skip == 0 && take == 0) {
 		take = 100
 	}
-	return s.repository.ListAccounts(ctx, skip, take)
+
+	accounts, err := s.repository.ListAccounts(ctx, skip, take)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attachAddresses(ctx, accounts); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+func (s *accountService) GetAccountsPage(ctx context.Context, after string, first uint64) (*AccountPage, error) {
+	if first == 0 || first > 100 {
+		first = 100
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	accounts, err := s.repository.ListAccountsAfter(ctx, after, first+1)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.repository.CountAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AccountPage{
+		Accounts:   accounts,
+		TotalCount: count,
+	}
+	if uint64(len(accounts)) > first {
+		page.Accounts = accounts[:first]
+		page.HasNextPage = true
+	}
+
+	if err := s.attachAddresses(ctx, page.Accounts); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// PostAddress saves a new address. The first address of a type becomes the default one.
+func (s *accountService) PostAddress(ctx context.Context, accountID string, a Address) (*Address, error) {
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+
+	addresses, err := s.GetAddresses(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	hasDefault := false
+	for _, existing := range addresses {
+		if existing.Type == a.Type && existing.IsDefault {
+			hasDefault = true
+		}
+	}
+
+	now := time.Now().UTC()
+	a.ID = ksuid.New().String()
+	a.AccountID = accountID
+	a.IsDefault = a.IsDefault || !hasDefault
+	a.CreatedAt = now
+	a.UpdatedAt = now
+
+	if err := s.repository.PutAddress(ctx, a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *accountService) UpdateAddress(ctx context.Context, accountID string, a Address) (*Address, error) {
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repository.GetAddressByID(ctx, accountID, a.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	a.AccountID = accountID
+	a.CreatedAt = existing.CreatedAt
+	a.UpdatedAt = time.Now().UTC()
+
+	if err := s.repository.UpdateAddress(ctx, a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *accountService) DeleteAddress(ctx context.Context, accountID string, id string) error {
+	return s.repository.DeleteAddress(ctx, accountID, id)
+}
+
+func (s *accountService) GetAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	a, err := s.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.Addresses, nil
+}
+
+// attachAddresses loads the addresses of all accounts with a single query
+func (s *accountService) attachAddresses(ctx context.Context, accounts []Account) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	accountIDs := []string{}
+	for _, a := range accounts {
+		accountIDs = append(accountIDs, a.ID)
+	}
+
+	addresses, err := s.repository.GetAddressesForAccounts(ctx, accountIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range accounts {
+		accounts[i].Addresses = []Address{}
+		for _, a := range addresses {
+			if a.AccountID == accounts[i].ID {
+				accounts[i].Addresses = append(accounts[i].Addresses, a)
+			}
+		}
+	}
+
+	return nil
 }
@@ -1,4 +1,32 @@
 CREATE TABLE IF NOT EXISTS accounts (
   id CHAR(27) PRIMARY KEY,
-  name VARCHAR(24) NOT NULL
-);
\ No newline at end of file
+  name VARCHAR(24) NOT NULL,
+  email VARCHAR(254) NOT NULL,
+  display_name VARCHAR(64) NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+-- Emails are stored lower case, so the index makes them unique regardless of case
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_email ON accounts (email);
+
+CREATE TABLE IF NOT EXISTS account_addresses (
+  id CHAR(27) PRIMARY KEY,
+  account_id CHAR(27) NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+  type VARCHAR(16) NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  line1 VARCHAR(128) NOT NULL,
+  line2 VARCHAR(128) NOT NULL DEFAULT '',
+  city VARCHAR(64) NOT NULL,
+  state VARCHAR(64) NOT NULL DEFAULT '',
+  postal_code VARCHAR(16) NOT NULL,
+  country VARCHAR(2) NOT NULL,
+  is_default BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS account_addresses_account_id ON account_addresses (account_id);
+
+-- An account has at most one default address of each type
+CREATE UNIQUE INDEX IF NOT EXISTS account_addresses_default ON account_addresses (account_id, type) WHERE is_default;
@@ -0,0 +1,127 @@
+package bootstrap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid config")
+)
+
+// Config holds the settings every server shares. Binaries embed it in their
+// own Config next to their specific settings.
+type Config struct {
+	Port    int           `envconfig:"PORT" default:"8080"`
+	Startup StartupConfig `envconfig:"STARTUP"`
+}
+
+// StartupConfig bounds how long a binary waits for its dependencies, such as
+// its database, before giving up
+type StartupConfig struct {
+	Timeout    time.Duration `envconfig:"TIMEOUT" default:"2m"`
+	MinBackoff time.Duration `envconfig:"MIN_BACKOFF" default:"500ms"`
+	MaxBackoff time.Duration `envconfig:"MAX_BACKOFF" default:"10s"`
+}
+
+func (c Config) Validate() error {
+	if err := ValidatePort("PORT", c.Port); err != nil {
+		return err
+	}
+	return c.Startup.Validate()
+}
+
+func (c StartupConfig) Validate() error {
+	if c.Timeout <= 0 || c.MinBackoff <= 0 {
+		return fmt.Errorf("%w: STARTUP_TIMEOUT and STARTUP_MIN_BACKOFF must be positive", ErrInvalidConfig)
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		return fmt.Errorf("%w: STARTUP_MAX_BACKOFF is below STARTUP_MIN_BACKOFF", ErrInvalidConfig)
+	}
+	return nil
+}
+
+func ValidatePort(key string, port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%w: %s %d is not a valid port", ErrInvalidConfig, key, port)
+	}
+	return nil
+}
+
+type validator interface {
+	Validate() error
+}
+
+// Load fills spec from the environment, after reading the optional file named
+// by CONFIG_FILE. Variables already set in the environment win over the file.
+// Then spec and each of its fields that has a Validate method are validated.
+func Load(spec interface{}) error {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path); err != nil {
+			return err
+		}
+	}
+
+	if err := envconfig.Process("", spec); err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(spec).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+		if f, ok := v.Field(i).Addr().Interface().(validator); ok {
+			if err := f.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s, ok := spec.(validator); ok {
+		return s.Validate()
+	}
+	return nil
+}
+
+// loadFile reads KEY=VALUE lines into the environment. Blank lines and lines
+// starting with # are skipped, and values may be quoted.
+func loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return fmt.Errorf("%w: %s:%d is not a KEY=VALUE line", ErrInvalidConfig, path, n)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+
+	return scanner.Err()
+}
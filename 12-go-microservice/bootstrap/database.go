@@ -0,0 +1,56 @@
+package bootstrap
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// DatabaseConfig is read from DATABASE_URL and the DATABASE_* pool settings
+type DatabaseConfig struct {
+	URL             string        `envconfig:"URL"`
+	MaxOpenConns    int           `envconfig:"MAX_OPEN_CONNS" default:"10"`
+	MaxIdleConns    int           `envconfig:"MAX_IDLE_CONNS" default:"5"`
+	ConnMaxLifetime time.Duration `envconfig:"CONN_MAX_LIFETIME" default:"30m"`
+	ConnectTimeout  time.Duration `envconfig:"CONNECT_TIMEOUT" default:"5s"`
+}
+
+func (c DatabaseConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("%w: DATABASE_URL is required", ErrInvalidConfig)
+	}
+	if _, err := url.Parse(c.URL); err != nil {
+		return fmt.Errorf("%w: DATABASE_URL: %v", ErrInvalidConfig, err)
+	}
+	if c.MaxOpenConns < 1 || c.MaxIdleConns < 0 || c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("%w: DATABASE_MAX_IDLE_CONNS must be between 0 and DATABASE_MAX_OPEN_CONNS, which must be positive", ErrInvalidConfig)
+	}
+	if c.ConnMaxLifetime < 0 || c.ConnectTimeout <= 0 {
+		return fmt.Errorf("%w: DATABASE_CONN_MAX_LIFETIME and DATABASE_CONNECT_TIMEOUT must be positive", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Open connects to the database with the pool settings applied, and checks it
+// is reachable within the connect timeout
+func (c DatabaseConfig) Open(driver string) (*sql.DB, error) {
+	db, err := sql.Open(driver, c.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.ConnectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,68 @@
+package bootstrap
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+var bannerTemplate = template.Must(template.New("banner").Funcs(template.FuncMap{
+	"value": settingValue,
+}).Parse("{{range .}}  {{.Key}}={{value .Field .Tags}}\n{{end}}"))
+
+// Banner logs the name of the binary and the settings it runs with. Passwords
+// in URLs and fields tagged secret:"true" are masked.
+func Banner(name string, spec interface{}) {
+	var b strings.Builder
+	if err := envconfig.Usaget("", spec, &b, bannerTemplate); err != nil {
+		log.Println(err)
+	}
+	log.Printf("Starting %s (%s)\n%s", name, runtime.Version(), strings.TrimSuffix(b.String(), "\n"))
+}
+
+func settingValue(v reflect.Value, tags reflect.StructTag) string {
+	if tags.Get("secret") == "true" {
+		if v.IsZero() {
+			return ""
+		}
+		return "********"
+	}
+
+	s := fmt.Sprint(v.Interface())
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return s
+}
+
+// WaitFor calls connect until it succeeds, backing off exponentially with
+// jitter between attempts. Once the startup timeout is over it gives up with
+// the last error, so a binary fails visibly instead of hanging forever.
+func WaitFor[T any](cfg StartupConfig, dependency string, connect func() (T, error)) (T, error) {
+	deadline := time.Now().Add(cfg.Timeout)
+	backoff := cfg.MinBackoff
+
+	for {
+		res, err := connect()
+		if err == nil {
+			return res, nil
+		}
+
+		sleep := backoff/2 + rand.N(backoff/2+1)
+		if time.Now().Add(sleep).After(deadline) {
+			return res, fmt.Errorf("%s not ready after %s: %w", dependency, cfg.Timeout, err)
+		}
+
+		log.Printf("Waiting for %s, retrying in %s: %v", dependency, sleep.Round(time.Millisecond), err)
+		time.Sleep(sleep)
+		backoff = min(backoff*2, cfg.MaxBackoff)
+	}
+}
@@ -0,0 +1,139 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+)
+
+var (
+	ErrConsumerActive = errors.New("consumer is already subscribed")
+	ErrInvalidSubject = errors.New("invalid subject")
+)
+
+// Message is an event on a subject. ID identifies the event across
+// redeliveries, Sequence is its position in the broker and is only set on
+// delivered messages.
+type Message struct {
+	Subject  string
+	ID       string
+	Data     []byte
+	Sequence uint64
+}
+
+// Handler processes a delivered message. Returning an error redelivers the
+// message after a backoff, so handlers must be idempotent.
+type Handler func(ctx context.Context, m Message) error
+
+// Broker publishes messages and delivers them at least once to named
+// consumers. The broker keeps the offset of each consumer, so a consumer
+// that subscribes again resumes after the last message it handled.
+//
+// Subjects are at least two dot separated tokens, the first one groups the
+// subjects stored together. Subscriptions may use NATS wildcards after the
+// first token, * for one token and > for the remaining ones, e.g. orders.>.
+type Broker interface {
+	Publish(ctx context.Context, m Message) error
+	// Subscribe delivers messages matching subject to handle, in order and
+	// one at a time, until ctx is done
+	Subscribe(ctx context.Context, consumer string, subject string, handle Handler) error
+	Close()
+}
+
+// Config is read from the BROKER_* variables. The memory driver only reaches
+// consumers in the same process and loses messages on restart.
+type Config struct {
+	Driver string `envconfig:"DRIVER" default:"memory"`
+	// Memory driver: messages kept for consumers, the oldest are dropped first
+	MaxMessages int `envconfig:"MAX_MESSAGES" default:"10000"`
+	// NATS driver, JetStream must be enabled on the server
+	URL string `envconfig:"URL" default:"nats://localhost:4222"`
+	// Runs a NATS server inside the process instead of connecting to URL
+	Embedded bool   `envconfig:"EMBEDDED"`
+	StoreDir string `envconfig:"STORE_DIR"`
+	// Delay before a failed message is redelivered
+	RetryBackoff time.Duration `envconfig:"RETRY_BACKOFF" default:"5s"`
+	// A message whose handler has not returned by then is redelivered
+	AckWait time.Duration `envconfig:"ACK_WAIT" default:"30s"`
+}
+
+func (c Config) Validate() error {
+	switch c.Driver {
+	case "memory":
+		if c.MaxMessages < 1 {
+			return fmt.Errorf("%w: BROKER_MAX_MESSAGES must be positive", bootstrap.ErrInvalidConfig)
+		}
+	case "nats":
+		if !c.Embedded && c.URL == "" {
+			return fmt.Errorf("%w: BROKER_URL is required unless BROKER_EMBEDDED is set", bootstrap.ErrInvalidConfig)
+		}
+	default:
+		return fmt.Errorf("%w: BROKER_DRIVER %q must be memory or nats", bootstrap.ErrInvalidConfig, c.Driver)
+	}
+	if c.RetryBackoff <= 0 || c.AckWait <= 0 {
+		return fmt.Errorf("%w: BROKER_RETRY_BACKOFF and BROKER_ACK_WAIT must be positive", bootstrap.ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Open creates the broker of the configured driver
+func Open(cfg Config) (Broker, error) {
+	if cfg.Driver == "nats" {
+		return NewNATSBroker(cfg)
+	}
+	return NewMemoryBroker(cfg), nil
+}
+
+// validSubject reports whether subject is a publishable subject, or a
+// subscription subject when wildcards are allowed
+func validSubject(subject string, wildcards bool) bool {
+	tokens := strings.Split(subject, ".")
+	if len(tokens) < 2 {
+		return false
+	}
+	for i, t := range tokens {
+		switch {
+		case t == "":
+			return false
+		case t == "*" || t == ">":
+			if !wildcards || i == 0 || (t == ">" && i != len(tokens)-1) {
+				return false
+			}
+		case strings.ContainsAny(t, "*> \t\r\n"):
+			return false
+		}
+	}
+	return true
+}
+
+// matchSubject reports whether subject matches the subscription pattern
+func matchSubject(pattern string, subject string) bool {
+	p := strings.Split(pattern, ".")
+	s := strings.Split(subject, ".")
+	for i, t := range p {
+		if t == ">" {
+			return len(s) > i
+		}
+		if i >= len(s) || (t != "*" && t != s[i]) {
+			return false
+		}
+	}
+	return len(p) == len(s)
+}
+
+// sleep waits for d or until ctx is done, reporting whether it waited
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,53 @@
+package broker
+
+import "testing"
+
+func TestValidSubject(t *testing.T) {
+	tests := []struct {
+		subject   string
+		wildcards bool
+		want      bool
+	}{
+		{"orders.created", false, true},
+		{"orders.shipment.updated", false, true},
+		{"orders", false, false},
+		{"orders..created", false, false},
+		{"orders.*", false, false},
+		{"orders.*", true, true},
+		{"orders.>", true, true},
+		{"orders.>.created", true, false},
+		{"*.created", true, false},
+		{"orders.cre*ted", true, false},
+		{"orders.new order", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := validSubject(tt.subject, tt.wildcards); got != tt.want {
+			t.Errorf("validSubject(%q, %v) = %v, want %v", tt.subject, tt.wildcards, got, tt.want)
+		}
+	}
+}
+
+func TestMatchSubject(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+		want    bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.paid", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.shipment.created", false},
+		{"orders.>", "orders.created", true},
+		{"orders.>", "orders.shipment.created", true},
+		{"orders.>", "payments.created", false},
+		{"orders.*.created", "orders.shipment.created", true},
+		{"orders.*.created", "orders.shipment", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchSubject(tt.pattern, tt.subject); got != tt.want {
+			t.Errorf("matchSubject(%q, %q) = %v, want %v", tt.pattern, tt.subject, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package broker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// memoryBroker keeps the last messages in a slice. Offsets are sequences, so
+// a consumer that falls behind the oldest kept message resumes from it. Like
+// JetStream, a message published again with the ID of a kept one is dropped.
+type memoryBroker struct {
+	maxMessages  int
+	retryBackoff time.Duration
+
+	mu       sync.Mutex
+	messages []Message
+	ids      map[string]bool
+	lastSeq  uint64
+	offsets  map[string]uint64
+	active   map[string]bool
+	// Closed and replaced on every publish to wake up waiting consumers
+	published chan struct{}
+	closed    chan struct{}
+}
+
+func NewMemoryBroker(cfg Config) Broker {
+	return &memoryBroker{
+		maxMessages:  cfg.MaxMessages,
+		retryBackoff: cfg.RetryBackoff,
+		ids:          map[string]bool{},
+		offsets:      map[string]uint64{},
+		active:       map[string]bool{},
+		published:    make(chan struct{}),
+		closed:       make(chan struct{}),
+	}
+}
+
+func (b *memoryBroker) Publish(ctx context.Context, m Message) error {
+	if !validSubject(m.Subject, false) {
+		return ErrInvalidSubject
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if m.ID != "" {
+		if b.ids[m.ID] {
+			return nil
+		}
+		b.ids[m.ID] = true
+	}
+
+	b.lastSeq++
+	m.Sequence = b.lastSeq
+	b.messages = append(b.messages, m)
+	if len(b.messages) > b.maxMessages {
+		dropped := len(b.messages) - b.maxMessages
+		for _, old := range b.messages[:dropped] {
+			delete(b.ids, old.ID)
+		}
+		b.messages = b.messages[dropped:]
+	}
+
+	close(b.published)
+	b.published = make(chan struct{})
+	return nil
+}
+
+func (b *memoryBroker) Subscribe(ctx context.Context, consumer string, subject string, handle Handler) error {
+	if !validSubject(subject, true) {
+		return ErrInvalidSubject
+	}
+
+	b.mu.Lock()
+	if b.active[consumer] {
+		b.mu.Unlock()
+		return ErrConsumerActive
+	}
+	b.active[consumer] = true
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.active, consumer)
+		b.mu.Unlock()
+	}()
+
+	for {
+		m, ok, published := b.next(consumer, subject)
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-b.closed:
+				return nil
+			case <-published:
+			}
+			continue
+		}
+
+		if err := handle(ctx, m); err != nil {
+			log.Printf("Consumer %s failed to handle message %s, retrying in %s: %v", consumer, m.ID, b.retryBackoff, err)
+			if !sleep(ctx, b.retryBackoff) {
+				return nil
+			}
+			continue
+		}
+
+		b.mu.Lock()
+		b.offsets[consumer] = m.Sequence
+		b.mu.Unlock()
+	}
+}
+
+// next returns the first message after the offset of consumer that matches
+// subject. Skipped messages move the offset forward. Without one, the
+// returned channel is closed on the next publish.
+func (b *memoryBroker) next(consumer string, subject string) (Message, bool, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, m := range b.messages {
+		if m.Sequence <= b.offsets[consumer] {
+			continue
+		}
+		if matchSubject(subject, m.Subject) {
+			return m, true, nil
+		}
+		b.offsets[consumer] = m.Sequence
+	}
+	return Message{}, false, b.published
+}
+
+func (b *memoryBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.closed:
+	default:
+		close(b.closed)
+	}
+}
@@ -0,0 +1,189 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestMemoryBroker(maxMessages int) Broker {
+	return NewMemoryBroker(Config{MaxMessages: maxMessages, RetryBackoff: time.Millisecond})
+}
+
+func publish(t *testing.T, b Broker, messages ...Message) {
+	t.Helper()
+	for _, m := range messages {
+		if err := b.Publish(context.Background(), m); err != nil {
+			t.Fatalf("Publish(%s): %v", m.ID, err)
+		}
+	}
+}
+
+// receive subscribes consumer until n messages were handled, returning their IDs
+func receive(t *testing.T, b Broker, consumer string, subject string, n int, handle Handler) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	ids := []string{}
+	err := b.Subscribe(ctx, consumer, subject, func(ctx context.Context, m Message) error {
+		if handle != nil {
+			if err := handle(ctx, m); err != nil {
+				return err
+			}
+		}
+		ids = append(ids, m.ID)
+		if len(ids) == n {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if len(ids) != n {
+		t.Fatalf("received %v, want %d messages", ids, n)
+	}
+	return ids
+}
+
+func equalIDs(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemoryBrokerDelivery(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxMessages int
+		subject     string
+		published   []Message
+		want        []string
+	}{
+		{
+			name:        "in order",
+			maxMessages: 10,
+			subject:     "orders.>",
+			published:   []Message{{Subject: "orders.created", ID: "1"}, {Subject: "orders.paid", ID: "2"}},
+			want:        []string{"1", "2"},
+		},
+		{
+			name:        "filtered by subject",
+			maxMessages: 10,
+			subject:     "orders.paid",
+			published:   []Message{{Subject: "orders.created", ID: "1"}, {Subject: "orders.paid", ID: "2"}, {Subject: "orders.paid", ID: "3"}},
+			want:        []string{"2", "3"},
+		},
+		{
+			name:        "duplicate IDs dropped",
+			maxMessages: 10,
+			subject:     "orders.>",
+			published:   []Message{{Subject: "orders.created", ID: "1"}, {Subject: "orders.created", ID: "1"}, {Subject: "orders.paid", ID: "2"}},
+			want:        []string{"1", "2"},
+		},
+		{
+			name:        "oldest dropped",
+			maxMessages: 2,
+			subject:     "orders.>",
+			published:   []Message{{Subject: "orders.created", ID: "1"}, {Subject: "orders.created", ID: "2"}, {Subject: "orders.created", ID: "3"}},
+			want:        []string{"2", "3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestMemoryBroker(tt.maxMessages)
+			defer b.Close()
+
+			publish(t, b, tt.published...)
+			if got := receive(t, b, "test", tt.subject, len(tt.want), nil); !equalIDs(got, tt.want...) {
+				t.Errorf("received %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerResumesAfterOffset(t *testing.T) {
+	b := newTestMemoryBroker(10)
+	defer b.Close()
+
+	publish(t, b, Message{Subject: "orders.created", ID: "1"}, Message{Subject: "orders.created", ID: "2"})
+	receive(t, b, "test", "orders.>", 2, nil)
+
+	publish(t, b, Message{Subject: "orders.created", ID: "3"})
+	if got := receive(t, b, "test", "orders.>", 1, nil); !equalIDs(got, "3") {
+		t.Errorf("resubscribed consumer received %v, want [3]", got)
+	}
+	if got := receive(t, b, "other", "orders.>", 3, nil); !equalIDs(got, "1", "2", "3") {
+		t.Errorf("new consumer received %v, want [1 2 3]", got)
+	}
+}
+
+func TestMemoryBrokerRedeliversFailedMessages(t *testing.T) {
+	b := newTestMemoryBroker(10)
+	defer b.Close()
+
+	publish(t, b, Message{Subject: "orders.created", ID: "1"}, Message{Subject: "orders.created", ID: "2"})
+
+	failures := 2
+	got := receive(t, b, "test", "orders.>", 2, func(ctx context.Context, m Message) error {
+		if m.ID == "1" && failures > 0 {
+			failures--
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if !equalIDs(got, "1", "2") || failures != 0 {
+		t.Errorf("received %v with %d failures left, want [1 2] after 2 failures", got, failures)
+	}
+}
+
+func TestMemoryBrokerWakesWaitingConsumer(t *testing.T) {
+	b := newTestMemoryBroker(10)
+	defer b.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.Publish(context.Background(), Message{Subject: "orders.created", ID: "1"})
+	}()
+	if got := receive(t, b, "test", "orders.>", 1, nil); !equalIDs(got, "1") {
+		t.Errorf("received %v, want [1]", got)
+	}
+}
+
+func TestMemoryBrokerRejects(t *testing.T) {
+	b := newTestMemoryBroker(10)
+	defer b.Close()
+	ctx := context.Background()
+
+	if err := b.Publish(ctx, Message{Subject: "orders.*"}); !errors.Is(err, ErrInvalidSubject) {
+		t.Errorf("Publish with a wildcard = %v, want ErrInvalidSubject", err)
+	}
+	if err := b.Subscribe(ctx, "test", "orders", nil); !errors.Is(err, ErrInvalidSubject) {
+		t.Errorf("Subscribe to a single token = %v, want ErrInvalidSubject", err)
+	}
+
+	subscribed := make(chan struct{})
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		b.Subscribe(ctx, "test", "orders.>", func(context.Context, Message) error {
+			close(subscribed)
+			return nil
+		})
+	}()
+	publish(t, b, Message{Subject: "orders.created", ID: "1"})
+	<-subscribed
+
+	if err := b.Subscribe(ctx, "test", "orders.>", nil); !errors.Is(err, ErrConsumerActive) {
+		t.Errorf("second Subscribe = %v, want ErrConsumerActive", err)
+	}
+}
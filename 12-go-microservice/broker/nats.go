@@ -0,0 +1,210 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsBroker stores messages in JetStream. Each first subject token gets its
+// own stream, e.g. ORDERS for orders.>, and consumers are durable JetStream
+// consumers that hold the offsets.
+type natsBroker struct {
+	conn     *nats.Conn
+	js       jetstream.JetStream
+	embedded *server.Server
+	cfg      Config
+
+	mu      sync.Mutex
+	streams map[string]bool
+}
+
+// NewNATSBroker connects to the server at cfg.URL, or to a server started in
+// the process when cfg.Embedded is set
+func NewNATSBroker(cfg Config) (Broker, error) {
+	b := &natsBroker{
+		cfg:     cfg,
+		streams: map[string]bool{},
+	}
+
+	url := cfg.URL
+	if cfg.Embedded {
+		s, err := startEmbeddedServer(cfg.StoreDir)
+		if err != nil {
+			return nil, err
+		}
+		b.embedded = s
+		url = s.ClientURL()
+	}
+
+	conn, err := nats.Connect(url, nats.MaxReconnects(-1))
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	b.conn = conn
+
+	b.js, err = jetstream.New(conn)
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// startEmbeddedServer runs a JetStream enabled server on a random local port.
+// Messages are kept in storeDir, or in a temporary directory when empty.
+func startEmbeddedServer(storeDir string) (*server.Server, error) {
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  storeDir,
+		NoSigs:    true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go s.Start()
+	if !s.ReadyForConnections(10 * time.Second) {
+		s.Shutdown()
+		return nil, errors.New("embedded NATS server did not start")
+	}
+
+	log.Printf("Embedded NATS server listening on %s", s.ClientURL())
+	return s, nil
+}
+
+func (b *natsBroker) Publish(ctx context.Context, m Message) error {
+	if !validSubject(m.Subject, false) {
+		return ErrInvalidSubject
+	}
+
+	stream, err := b.stream(ctx, m.Subject)
+	if err != nil {
+		return err
+	}
+
+	// JetStream drops a message published again with the same ID
+	opts := []jetstream.PublishOpt{jetstream.WithExpectStream(stream)}
+	if m.ID != "" {
+		opts = append(opts, jetstream.WithMsgID(m.ID))
+	}
+	_, err = b.js.Publish(ctx, m.Subject, m.Data, opts...)
+	return err
+}
+
+func (b *natsBroker) Subscribe(ctx context.Context, consumer string, subject string, handle Handler) error {
+	if !validSubject(subject, true) {
+		return ErrInvalidSubject
+	}
+
+	stream, err := b.stream(ctx, subject)
+	if err != nil {
+		return err
+	}
+
+	// One unacknowledged message at a time keeps deliveries in order
+	c, err := b.js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:       consumer,
+		FilterSubject: subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       b.cfg.AckWait,
+		MaxAckPending: 1,
+	})
+	if err != nil {
+		return err
+	}
+
+	it, err := c.Messages()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		it.Stop()
+	}()
+
+	for {
+		msg, err := it.Next()
+		if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		m := Message{
+			Subject: msg.Subject(),
+			ID:      msg.Headers().Get(jetstream.MsgIDHeader),
+			Data:    msg.Data(),
+		}
+		if meta, err := msg.Metadata(); err == nil {
+			m.Sequence = meta.Sequence.Stream
+		}
+
+		if err := handle(ctx, m); err != nil {
+			log.Printf("Consumer %s failed to handle message %s, retrying in %s: %v", consumer, m.ID, b.cfg.RetryBackoff, err)
+			if err := msg.NakWithDelay(b.cfg.RetryBackoff); err != nil {
+				log.Printf("Error rejecting message %s: %v", m.ID, err)
+			}
+			continue
+		}
+
+		// Acknowledged even when the handler stopped the subscription
+		ackCtx, cancel := context.WithTimeout(context.Background(), b.cfg.AckWait)
+		err = msg.DoubleAck(ackCtx)
+		cancel()
+		if err != nil {
+			// The message is redelivered once the ack wait is over
+			log.Printf("Error acknowledging message %s: %v", m.ID, err)
+		}
+	}
+}
+
+// stream creates the stream of the first token of subject if needed, and
+// returns its name
+func (b *natsBroker) stream(ctx context.Context, subject string) (string, error) {
+	prefix, _, _ := strings.Cut(subject, ".")
+	name := strings.ToUpper(prefix)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.streams[name] {
+		return name, nil
+	}
+
+	_, err := b.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     name,
+		Subjects: []string{prefix + ".>"},
+		Storage:  jetstream.FileStorage,
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating stream %s: %w", name, err)
+	}
+
+	b.streams[name] = true
+	return name, nil
+}
+
+func (b *natsBroker) Close() {
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	if b.embedded != nil {
+		b.embedded.Shutdown()
+		b.embedded.WaitForShutdown()
+	}
+}
@@ -0,0 +1,186 @@
+package cart
+
+import (
+	"context"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/cart/pb"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+	"google.golang.org/grpc"
+)
+
+// Only idempotent reads are retried, retrying a write could apply it twice
+var retryableMethods = []string{
+	"GetCart",
+}
+
+type Client struct {
+	conn    *grpc.ClientConn
+	service pb.CartServiceClient
+}
+
+func NewClient(url string, cfg resilience.Config) (*Client, error) {
+	conn, err := resilience.Dial(url, pb.CartService_ServiceDesc.ServiceName, retryableMethods, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := pb.NewCartServiceClient(conn)
+	return &Client{conn, c}, nil
+}
+
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+func (c *Client) GetCart(ctx context.Context, accountID string) (*Cart, error) {
+	r, err := c.service.GetCart(ctx, &pb.GetCartRequest{
+		AccountId: accountID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cartFromProto(r.Cart), nil
+}
+
+func (c *Client) AddToCart(ctx context.Context, accountID string, productID string, variantID string, quantity uint32) (*Cart, error) {
+	r, err := c.service.AddToCart(ctx, &pb.AddToCartRequest{
+		AccountId: accountID,
+		ProductId: productID,
+		VariantId: variantID,
+		Quantity:  quantity,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cartFromProto(r.Cart), nil
+}
+
+func (c *Client) RemoveFromCart(ctx context.Context, accountID string, productID string, variantID string, quantity uint32) (*Cart, error) {
+	r, err := c.service.RemoveFromCart(ctx, &pb.RemoveFromCartRequest{
+		AccountId: accountID,
+		ProductId: productID,
+		VariantId: variantID,
+		Quantity:  quantity,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cartFromProto(r.Cart), nil
+}
+
+func (c *Client) Checkout(ctx context.Context, accountID string, shippingAddress *order.Address, couponCode string) (*order.Order, error) {
+	req := &pb.CheckoutRequest{
+		AccountId:  accountID,
+		CouponCode: couponCode,
+	}
+	if a := shippingAddress; a != nil {
+		req.ShippingAddress = &pb.CheckoutRequest_ShippingAddress{
+			Name:       a.Name,
+			Line1:      a.Line1,
+			Line2:      a.Line2,
+			City:       a.City,
+			State:      a.State,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+	}
+
+	r, err := c.service.Checkout(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// A freshly placed order is not paid yet
+	o := &order.Order{
+		ID:              r.OrderId,
+		AccountID:       accountID,
+		Subtotal:        r.Subtotal,
+		TaxTotal:        r.TaxTotal,
+		TaxInclusive:    r.TaxInclusive,
+		TaxJurisdiction: r.TaxJurisdiction,
+		TotalPrice:      r.TotalPrice,
+		PaymentStatus:   order.PaymentPending,
+		ShippingAddress: shippingAddress,
+		Products:        []order.OrderedProduct{},
+		Discounts:       []order.Discount{},
+		Taxes:           []order.TaxLine{},
+		Shipments:       []order.Shipment{},
+	}
+	o.CreatedAt = time.Time{}
+	o.CreatedAt.UnmarshalBinary(r.CreatedAt)
+
+	for _, p := range r.Products {
+		op := order.OrderedProduct{
+			ID:          p.ProductId,
+			VariantID:   p.VariantId,
+			SKU:         p.Sku,
+			Options:     []order.VariantOption{},
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Quantity:    p.Quantity,
+		}
+		for _, opt := range p.Options {
+			op.Options = append(op.Options, order.VariantOption{Name: opt.Name, Value: opt.Value})
+		}
+		o.Products = append(o.Products, op)
+	}
+
+	for _, d := range r.Discounts {
+		o.Discounts = append(o.Discounts, order.Discount{
+			OrderID:     r.OrderId,
+			PromotionID: d.PromotionId,
+			Code:        d.Code,
+			ProductID:   d.ProductId,
+			Description: d.Description,
+			Amount:      d.Amount,
+		})
+	}
+
+	for _, t := range r.Taxes {
+		o.Taxes = append(o.Taxes, order.TaxLine{
+			OrderID:       r.OrderId,
+			ProductID:     t.ProductId,
+			Category:      t.Category,
+			Rate:          t.Rate,
+			TaxableAmount: t.TaxableAmount,
+			Amount:        t.Amount,
+		})
+	}
+
+	return o, nil
+}
+
+func cartFromProto(cartProto *pb.Cart) *Cart {
+	c := &Cart{
+		AccountID:  cartProto.AccountId,
+		Items:      []CartItem{},
+		TotalPrice: cartProto.TotalPrice,
+	}
+	for _, item := range cartProto.Items {
+		c.Items = append(c.Items, cartItemFromProto(item))
+	}
+	return c
+}
+
+func cartItemFromProto(item *pb.Cart_CartItem) CartItem {
+	res := CartItem{
+		ProductID:   item.ProductId,
+		VariantID:   item.VariantId,
+		SKU:         item.Sku,
+		Options:     []catalog.VariantOption{},
+		Name:        item.Name,
+		Description: item.Description,
+		Price:       item.Price,
+		Quantity:    item.Quantity,
+	}
+	for _, o := range item.Options {
+		res.Options = append(res.Options, catalog.VariantOption{Name: o.Name, Value: o.Value})
+	}
+	return res
+}
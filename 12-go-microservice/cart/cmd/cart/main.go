@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/cart"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+)
+
+type Config struct {
+	bootstrap.Config
+	Database   bootstrap.DatabaseConfig `envconfig:"DATABASE"`
+	CatalogURL string                   `envconfig:"CATALOG_SERVICE_URL" required:"true"`
+	OrderURL   string                   `envconfig:"ORDER_SERVICE_URL" required:"true"`
+
+	RPC resilience.Config `envconfig:"RPC"`
+}
+
+func main() {
+	var cfg Config
+	if err := bootstrap.Load(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	bootstrap.Banner("cart", &cfg)
+
+	// Repository
+	r, err := bootstrap.WaitFor(cfg.Startup, "database", func() (cart.Repository, error) {
+		return cart.NewPostgresRepository(cfg.Database)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+	log.Printf("Listening on port %d...", cfg.Port)
+
+	// Service
+	s := cart.NewService(r)
+	log.Fatal(cart.ListenGRPC(s, cfg.CatalogURL, cfg.OrderURL, cfg.RPC, cfg.Port))
+}
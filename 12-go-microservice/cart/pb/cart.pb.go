@@ -0,0 +1,1135 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v6.30.2
+// source: cart.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Cart struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     string                 `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	Items         []*Cart_CartItem       `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	TotalPrice    float64                `protobuf:"fixed64,3,opt,name=totalPrice,proto3" json:"totalPrice,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Cart) Reset() {
+	*x = Cart{}
+	mi := &file_cart_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Cart) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Cart) ProtoMessage() {}
+
+func (x *Cart) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Cart.ProtoReflect.Descriptor instead.
+func (*Cart) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Cart) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+func (x *Cart) GetItems() []*Cart_CartItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *Cart) GetTotalPrice() float64 {
+	if x != nil {
+		return x.TotalPrice
+	}
+	return 0
+}
+
+type GetCartRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     string                 `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCartRequest) Reset() {
+	*x = GetCartRequest{}
+	mi := &file_cart_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCartRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCartRequest) ProtoMessage() {}
+
+func (x *GetCartRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCartRequest.ProtoReflect.Descriptor instead.
+func (*GetCartRequest) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetCartRequest) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+type GetCartResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cart          *Cart                  `protobuf:"bytes,1,opt,name=cart,proto3" json:"cart,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCartResponse) Reset() {
+	*x = GetCartResponse{}
+	mi := &file_cart_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCartResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCartResponse) ProtoMessage() {}
+
+func (x *GetCartResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCartResponse.ProtoReflect.Descriptor instead.
+func (*GetCartResponse) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetCartResponse) GetCart() *Cart {
+	if x != nil {
+		return x.Cart
+	}
+	return nil
+}
+
+type AddToCartRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     string                 `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	ProductId     string                 `protobuf:"bytes,2,opt,name=productId,proto3" json:"productId,omitempty"`
+	Quantity      uint32                 `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	VariantId     string                 `protobuf:"bytes,4,opt,name=variantId,proto3" json:"variantId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddToCartRequest) Reset() {
+	*x = AddToCartRequest{}
+	mi := &file_cart_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddToCartRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddToCartRequest) ProtoMessage() {}
+
+func (x *AddToCartRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddToCartRequest.ProtoReflect.Descriptor instead.
+func (*AddToCartRequest) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *AddToCartRequest) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+func (x *AddToCartRequest) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *AddToCartRequest) GetQuantity() uint32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *AddToCartRequest) GetVariantId() string {
+	if x != nil {
+		return x.VariantId
+	}
+	return ""
+}
+
+type AddToCartResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cart          *Cart                  `protobuf:"bytes,1,opt,name=cart,proto3" json:"cart,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddToCartResponse) Reset() {
+	*x = AddToCartResponse{}
+	mi := &file_cart_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddToCartResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddToCartResponse) ProtoMessage() {}
+
+func (x *AddToCartResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddToCartResponse.ProtoReflect.Descriptor instead.
+func (*AddToCartResponse) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AddToCartResponse) GetCart() *Cart {
+	if x != nil {
+		return x.Cart
+	}
+	return nil
+}
+
+type RemoveFromCartRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     string                 `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	ProductId     string                 `protobuf:"bytes,2,opt,name=productId,proto3" json:"productId,omitempty"`
+	Quantity      uint32                 `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	VariantId     string                 `protobuf:"bytes,4,opt,name=variantId,proto3" json:"variantId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveFromCartRequest) Reset() {
+	*x = RemoveFromCartRequest{}
+	mi := &file_cart_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveFromCartRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveFromCartRequest) ProtoMessage() {}
+
+func (x *RemoveFromCartRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveFromCartRequest.ProtoReflect.Descriptor instead.
+func (*RemoveFromCartRequest) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RemoveFromCartRequest) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+func (x *RemoveFromCartRequest) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *RemoveFromCartRequest) GetQuantity() uint32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *RemoveFromCartRequest) GetVariantId() string {
+	if x != nil {
+		return x.VariantId
+	}
+	return ""
+}
+
+type RemoveFromCartResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cart          *Cart                  `protobuf:"bytes,1,opt,name=cart,proto3" json:"cart,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveFromCartResponse) Reset() {
+	*x = RemoveFromCartResponse{}
+	mi := &file_cart_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveFromCartResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveFromCartResponse) ProtoMessage() {}
+
+func (x *RemoveFromCartResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveFromCartResponse.ProtoReflect.Descriptor instead.
+func (*RemoveFromCartResponse) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *RemoveFromCartResponse) GetCart() *Cart {
+	if x != nil {
+		return x.Cart
+	}
+	return nil
+}
+
+type CheckoutRequest struct {
+	state           protoimpl.MessageState           `protogen:"open.v1"`
+	AccountId       string                           `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	ShippingAddress *CheckoutRequest_ShippingAddress `protobuf:"bytes,2,opt,name=shippingAddress,proto3" json:"shippingAddress,omitempty"`
+	CouponCode      string                           `protobuf:"bytes,3,opt,name=couponCode,proto3" json:"couponCode,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *CheckoutRequest) Reset() {
+	*x = CheckoutRequest{}
+	mi := &file_cart_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutRequest) ProtoMessage() {}
+
+func (x *CheckoutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutRequest.ProtoReflect.Descriptor instead.
+func (*CheckoutRequest) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CheckoutRequest) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+func (x *CheckoutRequest) GetShippingAddress() *CheckoutRequest_ShippingAddress {
+	if x != nil {
+		return x.ShippingAddress
+	}
+	return nil
+}
+
+func (x *CheckoutRequest) GetCouponCode() string {
+	if x != nil {
+		return x.CouponCode
+	}
+	return ""
+}
+
+type CheckoutResponse struct {
+	state           protoimpl.MessageState       `protogen:"open.v1"`
+	OrderId         string                       `protobuf:"bytes,1,opt,name=orderId,proto3" json:"orderId,omitempty"`
+	CreatedAt       []byte                       `protobuf:"bytes,2,opt,name=createdAt,proto3" json:"createdAt,omitempty"`
+	TotalPrice      float64                      `protobuf:"fixed64,3,opt,name=totalPrice,proto3" json:"totalPrice,omitempty"`
+	Products        []*Cart_CartItem             `protobuf:"bytes,4,rep,name=products,proto3" json:"products,omitempty"`
+	Discounts       []*CheckoutResponse_Discount `protobuf:"bytes,5,rep,name=discounts,proto3" json:"discounts,omitempty"`
+	Subtotal        float64                      `protobuf:"fixed64,6,opt,name=subtotal,proto3" json:"subtotal,omitempty"`
+	TaxTotal        float64                      `protobuf:"fixed64,7,opt,name=taxTotal,proto3" json:"taxTotal,omitempty"`
+	TaxInclusive    bool                         `protobuf:"varint,8,opt,name=taxInclusive,proto3" json:"taxInclusive,omitempty"`
+	TaxJurisdiction string                       `protobuf:"bytes,9,opt,name=taxJurisdiction,proto3" json:"taxJurisdiction,omitempty"`
+	Taxes           []*CheckoutResponse_TaxLine  `protobuf:"bytes,10,rep,name=taxes,proto3" json:"taxes,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *CheckoutResponse) Reset() {
+	*x = CheckoutResponse{}
+	mi := &file_cart_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutResponse) ProtoMessage() {}
+
+func (x *CheckoutResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutResponse.ProtoReflect.Descriptor instead.
+func (*CheckoutResponse) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CheckoutResponse) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *CheckoutResponse) GetCreatedAt() []byte {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *CheckoutResponse) GetTotalPrice() float64 {
+	if x != nil {
+		return x.TotalPrice
+	}
+	return 0
+}
+
+func (x *CheckoutResponse) GetProducts() []*Cart_CartItem {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+func (x *CheckoutResponse) GetDiscounts() []*CheckoutResponse_Discount {
+	if x != nil {
+		return x.Discounts
+	}
+	return nil
+}
+
+func (x *CheckoutResponse) GetSubtotal() float64 {
+	if x != nil {
+		return x.Subtotal
+	}
+	return 0
+}
+
+func (x *CheckoutResponse) GetTaxTotal() float64 {
+	if x != nil {
+		return x.TaxTotal
+	}
+	return 0
+}
+
+func (x *CheckoutResponse) GetTaxInclusive() bool {
+	if x != nil {
+		return x.TaxInclusive
+	}
+	return false
+}
+
+func (x *CheckoutResponse) GetTaxJurisdiction() string {
+	if x != nil {
+		return x.TaxJurisdiction
+	}
+	return ""
+}
+
+func (x *CheckoutResponse) GetTaxes() []*CheckoutResponse_TaxLine {
+	if x != nil {
+		return x.Taxes
+	}
+	return nil
+}
+
+type Cart_CartItem struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	ProductId   string                 `protobuf:"bytes,1,opt,name=productId,proto3" json:"productId,omitempty"`
+	Name        string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Description string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	Price       float64                `protobuf:"fixed64,4,opt,name=price,proto3" json:"price,omitempty"`
+	Quantity    uint32                 `protobuf:"varint,5,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// Empty for products without variants
+	VariantId     string                         `protobuf:"bytes,6,opt,name=variantId,proto3" json:"variantId,omitempty"`
+	Sku           string                         `protobuf:"bytes,7,opt,name=sku,proto3" json:"sku,omitempty"`
+	Options       []*Cart_CartItem_VariantOption `protobuf:"bytes,8,rep,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Cart_CartItem) Reset() {
+	*x = Cart_CartItem{}
+	mi := &file_cart_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Cart_CartItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Cart_CartItem) ProtoMessage() {}
+
+func (x *Cart_CartItem) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Cart_CartItem.ProtoReflect.Descriptor instead.
+func (*Cart_CartItem) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{0, 0}
+}
+
+func (x *Cart_CartItem) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *Cart_CartItem) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Cart_CartItem) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Cart_CartItem) GetPrice() float64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+func (x *Cart_CartItem) GetQuantity() uint32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Cart_CartItem) GetVariantId() string {
+	if x != nil {
+		return x.VariantId
+	}
+	return ""
+}
+
+func (x *Cart_CartItem) GetSku() string {
+	if x != nil {
+		return x.Sku
+	}
+	return ""
+}
+
+func (x *Cart_CartItem) GetOptions() []*Cart_CartItem_VariantOption {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type Cart_CartItem_VariantOption struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Cart_CartItem_VariantOption) Reset() {
+	*x = Cart_CartItem_VariantOption{}
+	mi := &file_cart_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Cart_CartItem_VariantOption) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Cart_CartItem_VariantOption) ProtoMessage() {}
+
+func (x *Cart_CartItem_VariantOption) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Cart_CartItem_VariantOption.ProtoReflect.Descriptor instead.
+func (*Cart_CartItem_VariantOption) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{0, 0, 0}
+}
+
+func (x *Cart_CartItem_VariantOption) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Cart_CartItem_VariantOption) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type CheckoutRequest_ShippingAddress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Line1         string                 `protobuf:"bytes,2,opt,name=line1,proto3" json:"line1,omitempty"`
+	Line2         string                 `protobuf:"bytes,3,opt,name=line2,proto3" json:"line2,omitempty"`
+	City          string                 `protobuf:"bytes,4,opt,name=city,proto3" json:"city,omitempty"`
+	State         string                 `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	PostalCode    string                 `protobuf:"bytes,6,opt,name=postalCode,proto3" json:"postalCode,omitempty"`
+	Country       string                 `protobuf:"bytes,7,opt,name=country,proto3" json:"country,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckoutRequest_ShippingAddress) Reset() {
+	*x = CheckoutRequest_ShippingAddress{}
+	mi := &file_cart_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutRequest_ShippingAddress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutRequest_ShippingAddress) ProtoMessage() {}
+
+func (x *CheckoutRequest_ShippingAddress) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutRequest_ShippingAddress.ProtoReflect.Descriptor instead.
+func (*CheckoutRequest_ShippingAddress) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{7, 0}
+}
+
+func (x *CheckoutRequest_ShippingAddress) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CheckoutRequest_ShippingAddress) GetLine1() string {
+	if x != nil {
+		return x.Line1
+	}
+	return ""
+}
+
+func (x *CheckoutRequest_ShippingAddress) GetLine2() string {
+	if x != nil {
+		return x.Line2
+	}
+	return ""
+}
+
+func (x *CheckoutRequest_ShippingAddress) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *CheckoutRequest_ShippingAddress) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *CheckoutRequest_ShippingAddress) GetPostalCode() string {
+	if x != nil {
+		return x.PostalCode
+	}
+	return ""
+}
+
+func (x *CheckoutRequest_ShippingAddress) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+type CheckoutResponse_Discount struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PromotionId   string                 `protobuf:"bytes,1,opt,name=promotionId,proto3" json:"promotionId,omitempty"`
+	Code          string                 `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	ProductId     string                 `protobuf:"bytes,3,opt,name=productId,proto3" json:"productId,omitempty"`
+	Description   string                 `protobuf:"bytes,4,opt,name=description,proto3" json:"description,omitempty"`
+	Amount        float64                `protobuf:"fixed64,5,opt,name=amount,proto3" json:"amount,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckoutResponse_Discount) Reset() {
+	*x = CheckoutResponse_Discount{}
+	mi := &file_cart_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutResponse_Discount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutResponse_Discount) ProtoMessage() {}
+
+func (x *CheckoutResponse_Discount) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutResponse_Discount.ProtoReflect.Descriptor instead.
+func (*CheckoutResponse_Discount) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{8, 0}
+}
+
+func (x *CheckoutResponse_Discount) GetPromotionId() string {
+	if x != nil {
+		return x.PromotionId
+	}
+	return ""
+}
+
+func (x *CheckoutResponse_Discount) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *CheckoutResponse_Discount) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *CheckoutResponse_Discount) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *CheckoutResponse_Discount) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+type CheckoutResponse_TaxLine struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=productId,proto3" json:"productId,omitempty"`
+	Category      string                 `protobuf:"bytes,2,opt,name=category,proto3" json:"category,omitempty"`
+	Rate          float64                `protobuf:"fixed64,3,opt,name=rate,proto3" json:"rate,omitempty"`
+	TaxableAmount float64                `protobuf:"fixed64,4,opt,name=taxableAmount,proto3" json:"taxableAmount,omitempty"`
+	Amount        float64                `protobuf:"fixed64,5,opt,name=amount,proto3" json:"amount,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckoutResponse_TaxLine) Reset() {
+	*x = CheckoutResponse_TaxLine{}
+	mi := &file_cart_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutResponse_TaxLine) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutResponse_TaxLine) ProtoMessage() {}
+
+func (x *CheckoutResponse_TaxLine) ProtoReflect() protoreflect.Message {
+	mi := &file_cart_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutResponse_TaxLine.ProtoReflect.Descriptor instead.
+func (*CheckoutResponse_TaxLine) Descriptor() ([]byte, []int) {
+	return file_cart_proto_rawDescGZIP(), []int{8, 1}
+}
+
+func (x *CheckoutResponse_TaxLine) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *CheckoutResponse_TaxLine) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+func (x *CheckoutResponse_TaxLine) GetRate() float64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+func (x *CheckoutResponse_TaxLine) GetTaxableAmount() float64 {
+	if x != nil {
+		return x.TaxableAmount
+	}
+	return 0
+}
+
+func (x *CheckoutResponse_TaxLine) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+var File_cart_proto protoreflect.FileDescriptor
+
+const file_cart_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"cart.proto\x12\x02pb\"\xa6\x03\n" +
+	"\x04Cart\x12\x1c\n" +
+	"\taccountId\x18\x01 \x01(\tR\taccountId\x12'\n" +
+	"\x05items\x18\x02 \x03(\v2\x11.pb.Cart.CartItemR\x05items\x12\x1e\n" +
+	"\n" +
+	"totalPrice\x18\x03 \x01(\x01R\n" +
+	"totalPrice\x1a\xb6\x02\n" +
+	"\bCartItem\x12\x1c\n" +
+	"\tproductId\x18\x01 \x01(\tR\tproductId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x12\x14\n" +
+	"\x05price\x18\x04 \x01(\x01R\x05price\x12\x1a\n" +
+	"\bquantity\x18\x05 \x01(\rR\bquantity\x12\x1c\n" +
+	"\tvariantId\x18\x06 \x01(\tR\tvariantId\x12\x10\n" +
+	"\x03sku\x18\a \x01(\tR\x03sku\x129\n" +
+	"\aoptions\x18\b \x03(\v2\x1f.pb.Cart.CartItem.VariantOptionR\aoptions\x1a9\n" +
+	"\rVariantOption\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\".\n" +
+	"\x0eGetCartRequest\x12\x1c\n" +
+	"\taccountId\x18\x01 \x01(\tR\taccountId\"/\n" +
+	"\x0fGetCartResponse\x12\x1c\n" +
+	"\x04cart\x18\x01 \x01(\v2\b.pb.CartR\x04cart\"\x88\x01\n" +
+	"\x10AddToCartRequest\x12\x1c\n" +
+	"\taccountId\x18\x01 \x01(\tR\taccountId\x12\x1c\n" +
+	"\tproductId\x18\x02 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bquantity\x18\x03 \x01(\rR\bquantity\x12\x1c\n" +
+	"\tvariantId\x18\x04 \x01(\tR\tvariantId\"1\n" +
+	"\x11AddToCartResponse\x12\x1c\n" +
+	"\x04cart\x18\x01 \x01(\v2\b.pb.CartR\x04cart\"\x8d\x01\n" +
+	"\x15RemoveFromCartRequest\x12\x1c\n" +
+	"\taccountId\x18\x01 \x01(\tR\taccountId\x12\x1c\n" +
+	"\tproductId\x18\x02 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bquantity\x18\x03 \x01(\rR\bquantity\x12\x1c\n" +
+	"\tvariantId\x18\x04 \x01(\tR\tvariantId\"6\n" +
+	"\x16RemoveFromCartResponse\x12\x1c\n" +
+	"\x04cart\x18\x01 \x01(\v2\b.pb.CartR\x04cart\"\xd6\x02\n" +
+	"\x0fCheckoutRequest\x12\x1c\n" +
+	"\taccountId\x18\x01 \x01(\tR\taccountId\x12M\n" +
+	"\x0fshippingAddress\x18\x02 \x01(\v2#.pb.CheckoutRequest.ShippingAddressR\x0fshippingAddress\x12\x1e\n" +
+	"\n" +
+	"couponCode\x18\x03 \x01(\tR\n" +
+	"couponCode\x1a\xb5\x01\n" +
+	"\x0fShippingAddress\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05line1\x18\x02 \x01(\tR\x05line1\x12\x14\n" +
+	"\x05line2\x18\x03 \x01(\tR\x05line2\x12\x12\n" +
+	"\x04city\x18\x04 \x01(\tR\x04city\x12\x14\n" +
+	"\x05state\x18\x05 \x01(\tR\x05state\x12\x1e\n" +
+	"\n" +
+	"postalCode\x18\x06 \x01(\tR\n" +
+	"postalCode\x12\x18\n" +
+	"\acountry\x18\a \x01(\tR\acountry\"\xc3\x05\n" +
+	"\x10CheckoutResponse\x12\x18\n" +
+	"\aorderId\x18\x01 \x01(\tR\aorderId\x12\x1c\n" +
+	"\tcreatedAt\x18\x02 \x01(\fR\tcreatedAt\x12\x1e\n" +
+	"\n" +
+	"totalPrice\x18\x03 \x01(\x01R\n" +
+	"totalPrice\x12-\n" +
+	"\bproducts\x18\x04 \x03(\v2\x11.pb.Cart.CartItemR\bproducts\x12;\n" +
+	"\tdiscounts\x18\x05 \x03(\v2\x1d.pb.CheckoutResponse.DiscountR\tdiscounts\x12\x1a\n" +
+	"\bsubtotal\x18\x06 \x01(\x01R\bsubtotal\x12\x1a\n" +
+	"\btaxTotal\x18\a \x01(\x01R\btaxTotal\x12\"\n" +
+	"\ftaxInclusive\x18\b \x01(\bR\ftaxInclusive\x12(\n" +
+	"\x0ftaxJurisdiction\x18\t \x01(\tR\x0ftaxJurisdiction\x122\n" +
+	"\x05taxes\x18\n" +
+	" \x03(\v2\x1c.pb.CheckoutResponse.TaxLineR\x05taxes\x1a\x98\x01\n" +
+	"\bDiscount\x12 \n" +
+	"\vpromotionId\x18\x01 \x01(\tR\vpromotionId\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12\x1c\n" +
+	"\tproductId\x18\x03 \x01(\tR\tproductId\x12 \n" +
+	"\vdescription\x18\x04 \x01(\tR\vdescription\x12\x16\n" +
+	"\x06amount\x18\x05 \x01(\x01R\x06amount\x1a\x95\x01\n" +
+	"\aTaxLine\x12\x1c\n" +
+	"\tproductId\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bcategory\x18\x02 \x01(\tR\bcategory\x12\x12\n" +
+	"\x04rate\x18\x03 \x01(\x01R\x04rate\x12$\n" +
+	"\rtaxableAmount\x18\x04 \x01(\x01R\rtaxableAmount\x12\x16\n" +
+	"\x06amount\x18\x05 \x01(\x01R\x06amount2\x83\x02\n" +
+	"\vCartService\x124\n" +
+	"\aGetCart\x12\x12.pb.GetCartRequest\x1a\x13.pb.GetCartResponse\"\x00\x12:\n" +
+	"\tAddToCart\x12\x14.pb.AddToCartRequest\x1a\x15.pb.AddToCartResponse\"\x00\x12I\n" +
+	"\x0eRemoveFromCart\x12\x19.pb.RemoveFromCartRequest\x1a\x1a.pb.RemoveFromCartResponse\"\x00\x127\n" +
+	"\bCheckout\x12\x13.pb.CheckoutRequest\x1a\x14.pb.CheckoutResponse\"\x00B\x06Z\x04./pbb\x06proto3"
+
+var (
+	file_cart_proto_rawDescOnce sync.Once
+	file_cart_proto_rawDescData []byte
+)
+
+func file_cart_proto_rawDescGZIP() []byte {
+	file_cart_proto_rawDescOnce.Do(func() {
+		file_cart_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_cart_proto_rawDesc), len(file_cart_proto_rawDesc)))
+	})
+	return file_cart_proto_rawDescData
+}
+
+var file_cart_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_cart_proto_goTypes = []any{
+	(*Cart)(nil),                            // 0: pb.Cart
+	(*GetCartRequest)(nil),                  // 1: pb.GetCartRequest
+	(*GetCartResponse)(nil),                 // 2: pb.GetCartResponse
+	(*AddToCartRequest)(nil),                // 3: pb.AddToCartRequest
+	(*AddToCartResponse)(nil),               // 4: pb.AddToCartResponse
+	(*RemoveFromCartRequest)(nil),           // 5: pb.RemoveFromCartRequest
+	(*RemoveFromCartResponse)(nil),          // 6: pb.RemoveFromCartResponse
+	(*CheckoutRequest)(nil),                 // 7: pb.CheckoutRequest
+	(*CheckoutResponse)(nil),                // 8: pb.CheckoutResponse
+	(*Cart_CartItem)(nil),                   // 9: pb.Cart.CartItem
+	(*Cart_CartItem_VariantOption)(nil),     // 10: pb.Cart.CartItem.VariantOption
+	(*CheckoutRequest_ShippingAddress)(nil), // 11: pb.CheckoutRequest.ShippingAddress
+	(*CheckoutResponse_Discount)(nil),       // 12: pb.CheckoutResponse.Discount
+	(*CheckoutResponse_TaxLine)(nil),        // 13: pb.CheckoutResponse.TaxLine
+}
+var file_cart_proto_depIdxs = []int32{
+	9,  // 0: pb.Cart.items:type_name -> pb.Cart.CartItem
+	0,  // 1: pb.GetCartResponse.cart:type_name -> pb.Cart
+	0,  // 2: pb.AddToCartResponse.cart:type_name -> pb.Cart
+	0,  // 3: pb.RemoveFromCartResponse.cart:type_name -> pb.Cart
+	11, // 4: pb.CheckoutRequest.shippingAddress:type_name -> pb.CheckoutRequest.ShippingAddress
+	9,  // 5: pb.CheckoutResponse.products:type_name -> pb.Cart.CartItem
+	12, // 6: pb.CheckoutResponse.discounts:type_name -> pb.CheckoutResponse.Discount
+	13, // 7: pb.CheckoutResponse.taxes:type_name -> pb.CheckoutResponse.TaxLine
+	10, // 8: pb.Cart.CartItem.options:type_name -> pb.Cart.CartItem.VariantOption
+	1,  // 9: pb.CartService.GetCart:input_type -> pb.GetCartRequest
+	3,  // 10: pb.CartService.AddToCart:input_type -> pb.AddToCartRequest
+	5,  // 11: pb.CartService.RemoveFromCart:input_type -> pb.RemoveFromCartRequest
+	7,  // 12: pb.CartService.Checkout:input_type -> pb.CheckoutRequest
+	2,  // 13: pb.CartService.GetCart:output_type -> pb.GetCartResponse
+	4,  // 14: pb.CartService.AddToCart:output_type -> pb.AddToCartResponse
+	6,  // 15: pb.CartService.RemoveFromCart:output_type -> pb.RemoveFromCartResponse
+	8,  // 16: pb.CartService.Checkout:output_type -> pb.CheckoutResponse
+	13, // [13:17] is the sub-list for method output_type
+	9,  // [9:13] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_cart_proto_init() }
+func file_cart_proto_init() {
+	if File_cart_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_cart_proto_rawDesc), len(file_cart_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_cart_proto_goTypes,
+		DependencyIndexes: file_cart_proto_depIdxs,
+		MessageInfos:      file_cart_proto_msgTypes,
+	}.Build()
+	File_cart_proto = out.File
+	file_cart_proto_goTypes = nil
+	file_cart_proto_depIdxs = nil
+}
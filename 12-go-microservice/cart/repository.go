@@ -0,0 +1,191 @@
+package cart
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	_ "github.com/lib/pq"
+)
+
+type Repository interface {
+	Close()
+	GetCartItems(ctx context.Context, accountID string) (uint64, []CartItem, error)
+	AddItem(ctx context.Context, accountID string, productID string, variantID string, quantity uint32) error
+	RemoveItem(ctx context.Context, accountID string, productID string, variantID string, quantity uint32) error
+	RemoveItems(ctx context.Context, accountID string, items []CartItem) error
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func (r *postgresRepository) Close() {
+	r.db.Close()
+}
+
+// GetCartItems returns the version of the cart along with its items
+func (r *postgresRepository) GetCartItems(ctx context.Context, accountID string) (uint64, []CartItem, error) {
+	// Both are read from the same snapshot, so the version matches the items
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer tx.Rollback()
+
+	var version uint64
+	err = tx.QueryRowContext(ctx, "SELECT version FROM carts WHERE account_id = $1", accountID).Scan(&version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, nil, err
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`
+		SELECT
+			product_id,
+			variant_id,
+			quantity
+		FROM cart_items
+		WHERE account_id = $1
+		ORDER BY added_at
+		`,
+		accountID,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer rows.Close()
+
+	items := []CartItem{}
+	for rows.Next() {
+		item := CartItem{}
+		if err = rows.Scan(&item.ProductID, &item.VariantID, &item.Quantity); err != nil {
+			return 0, nil, err
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	return version, items, nil
+}
+
+// bumpVersion records a change to the items of the cart
+func bumpVersion(ctx context.Context, tx *sql.Tx, accountID string) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`
+		INSERT INTO carts(account_id, version) VALUES ($1, 1)
+		ON CONFLICT (account_id) DO UPDATE SET version = carts.version + 1
+		`,
+		accountID,
+	)
+	return err
+}
+
+// AddItem adds quantity to the cart line of the product variant, creating it if needed
+func (r *postgresRepository) AddItem(ctx context.Context, accountID string, productID string, variantID string, quantity uint32) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`
+		INSERT INTO cart_items(account_id, product_id, variant_id, quantity, added_at)
+			VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (account_id, product_id, variant_id)
+			DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity
+		`,
+		accountID,
+		productID,
+		variantID,
+		quantity,
+	)
+	if err != nil {
+		return err
+	}
+
+	return bumpVersion(ctx, tx, accountID)
+}
+
+// RemoveItem takes quantity off the cart line of the product variant, the
+// line is deleted when nothing is left or when quantity is 0
+func (r *postgresRepository) RemoveItem(ctx context.Context, accountID string, productID string, variantID string, quantity uint32) error {
+	return r.RemoveItems(ctx, accountID, []CartItem{{ProductID: productID, VariantID: variantID, Quantity: quantity}})
+}
+
+// RemoveItems takes the quantity of each item off its cart line, like RemoveItem
+func (r *postgresRepository) RemoveItems(ctx context.Context, accountID string, items []CartItem) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	for _, item := range items {
+		// Delete first, otherwise a line decremented below quantity would be deleted too
+		_, err = tx.ExecContext(
+			ctx,
+			`
+			DELETE FROM cart_items
+			WHERE account_id = $1 AND product_id = $2 AND variant_id = $3 AND ($4 = 0 OR quantity <= $4)
+			`,
+			accountID,
+			item.ProductID,
+			item.VariantID,
+			item.Quantity,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`
+			UPDATE cart_items SET quantity = quantity - $4
+			WHERE account_id = $1 AND product_id = $2 AND variant_id = $3 AND quantity > $4
+			`,
+			accountID,
+			item.ProductID,
+			item.VariantID,
+			item.Quantity,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return bumpVersion(ctx, tx, accountID)
+}
+
+func NewPostgresRepository(cfg bootstrap.DatabaseConfig) (Repository, error) {
+	db, err := cfg.Open("postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresRepository{db}, nil
+}
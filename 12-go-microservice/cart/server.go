@@ -0,0 +1,274 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/cart/pb"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+type grpcServer struct {
+	pb.UnimplementedCartServiceServer
+	service       Service
+	catalogClient *catalog.Client
+	orderClient   *order.Client
+}
+
+func ListenGRPC(s Service, catalogURL, orderURL string, rpc resilience.Config, port int) error {
+	catalogClient, err := catalog.NewClient(catalogURL, rpc)
+	if err != nil {
+		return err
+	}
+
+	orderClient, err := order.NewClient(orderURL, rpc)
+	if err != nil {
+		catalogClient.Close()
+		return err
+	}
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		catalogClient.Close()
+		orderClient.Close()
+		return err
+	}
+
+	serv := grpc.NewServer()
+	pb.RegisterCartServiceServer(serv, &grpcServer{
+		service:       s,
+		catalogClient: catalogClient,
+		orderClient:   orderClient,
+	})
+	reflection.Register(serv)
+	return serv.Serve(lis)
+}
+
+func (s *grpcServer) GetCart(ctx context.Context, r *pb.GetCartRequest) (*pb.GetCartResponse, error) {
+	c, err := s.service.GetCart(ctx, r.AccountId)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	cartProto, err := s.priceCart(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetCartResponse{Cart: cartProto}, nil
+}
+
+func (s *grpcServer) AddToCart(ctx context.Context, r *pb.AddToCartRequest) (*pb.AddToCartResponse, error) {
+	// Only products that exist in the catalog can be added
+	p, err := s.catalogClient.GetProduct(ctx, r.ProductId)
+	if err != nil {
+		log.Printf("Error getting product %s: %v", r.ProductId, err)
+		return nil, errors.New("product not found")
+	}
+
+	if len(p.Variants) > 0 {
+		if _, ok := p.Variant(r.VariantId); !ok {
+			return nil, ErrInvalidVariant
+		}
+	} else if r.VariantId != "" {
+		return nil, ErrInvalidVariant
+	}
+
+	c, err := s.service.AddItem(ctx, r.AccountId, r.ProductId, r.VariantId, r.Quantity)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	cartProto, err := s.priceCart(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.AddToCartResponse{Cart: cartProto}, nil
+}
+
+func (s *grpcServer) RemoveFromCart(ctx context.Context, r *pb.RemoveFromCartRequest) (*pb.RemoveFromCartResponse, error) {
+	c, err := s.service.RemoveItem(ctx, r.AccountId, r.ProductId, r.VariantId, r.Quantity)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	cartProto, err := s.priceCart(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.RemoveFromCartResponse{Cart: cartProto}, nil
+}
+
+// Checkout places an order with the content of the cart and empties it
+func (s *grpcServer) Checkout(ctx context.Context, r *pb.CheckoutRequest) (*pb.CheckoutResponse, error) {
+	c, err := s.service.GetCart(ctx, r.AccountId)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	if len(c.Items) == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	products := []order.OrderedProduct{}
+	for _, item := range c.Items {
+		products = append(products, order.OrderedProduct{
+			ID:        item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	// The order service prices the products itself, so the order always uses current prices
+	var shippingAddress *order.Address
+	if a := r.ShippingAddress; a != nil {
+		shippingAddress = &order.Address{
+			Name:       a.Name,
+			Line1:      a.Line1,
+			Line2:      a.Line2,
+			City:       a.City,
+			State:      a.State,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+	}
+
+	// A checkout retried before the cart changed returns the order already placed
+	idempotencyKey := fmt.Sprintf("cart-%d", c.Version)
+	o, err := s.orderClient.PostOrder(ctx, r.AccountId, products, shippingAddress, r.CouponCode, idempotencyKey)
+	if err != nil {
+		log.Printf("Error posting order for account %s: %v", r.AccountId, err)
+		return nil, err
+	}
+
+	// Only what was ordered is removed, items added meanwhile stay in the cart
+	if err := s.service.RemoveItems(ctx, r.AccountId, c.Items); err != nil {
+		log.Printf("Order %s was placed but cart of account %s could not be cleared: %v", o.ID, r.AccountId, err)
+	}
+
+	res := &pb.CheckoutResponse{
+		OrderId:         o.ID,
+		Subtotal:        o.Subtotal,
+		TaxTotal:        o.TaxTotal,
+		TaxInclusive:    o.TaxInclusive,
+		TaxJurisdiction: o.TaxJurisdiction,
+		TotalPrice:      o.TotalPrice,
+		Products:        []*pb.Cart_CartItem{},
+		Discounts:       []*pb.CheckoutResponse_Discount{},
+		Taxes:           []*pb.CheckoutResponse_TaxLine{},
+	}
+	for _, d := range o.Discounts {
+		res.Discounts = append(res.Discounts, &pb.CheckoutResponse_Discount{
+			PromotionId: d.PromotionID,
+			Code:        d.Code,
+			ProductId:   d.ProductID,
+			Description: d.Description,
+			Amount:      d.Amount,
+		})
+	}
+	for _, t := range o.Taxes {
+		res.Taxes = append(res.Taxes, &pb.CheckoutResponse_TaxLine{
+			ProductId:     t.ProductID,
+			Category:      t.Category,
+			Rate:          t.Rate,
+			TaxableAmount: t.TaxableAmount,
+			Amount:        t.Amount,
+		})
+	}
+	res.CreatedAt, _ = o.CreatedAt.MarshalBinary()
+	for _, p := range o.Products {
+		item := &pb.Cart_CartItem{
+			ProductId:   p.ID,
+			VariantId:   p.VariantID,
+			Sku:         p.SKU,
+			Options:     []*pb.Cart_CartItem_VariantOption{},
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Quantity:    p.Quantity,
+		}
+		for _, o := range p.Options {
+			item.Options = append(item.Options, &pb.Cart_CartItem_VariantOption{Name: o.Name, Value: o.Value})
+		}
+		res.Products = append(res.Products, item)
+	}
+
+	return res, nil
+}
+
+// priceCart fills in current product details and prices from the catalog.
+// Products or variants removed from the catalog are left out.
+func (s *grpcServer) priceCart(ctx context.Context, c *Cart) (*pb.Cart, error) {
+	cartProto := &pb.Cart{
+		AccountId: c.AccountID,
+		Items:     []*pb.Cart_CartItem{},
+	}
+
+	if len(c.Items) == 0 {
+		return cartProto, nil
+	}
+
+	productIDs := []string{}
+	for _, item := range c.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	products, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "", catalog.ProductFilter{})
+	if err != nil {
+		log.Printf("Error getting products from catalog: %v", err)
+		return nil, err
+	}
+
+	productMap := map[string]catalog.Product{}
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+
+	for _, item := range c.Items {
+		p, ok := productMap[item.ProductID]
+		if !ok {
+			log.Printf("Product %s in cart of account %s is no longer in the catalog", item.ProductID, c.AccountID)
+			continue
+		}
+
+		itemProto := &pb.Cart_CartItem{
+			ProductId:   p.ID,
+			Options:     []*pb.Cart_CartItem_VariantOption{},
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Quantity:    item.Quantity,
+		}
+		if item.VariantID != "" {
+			v, ok := p.Variant(item.VariantID)
+			if !ok {
+				log.Printf("Variant %s of product %s in cart of account %s is no longer in the catalog", item.VariantID, item.ProductID, c.AccountID)
+				continue
+			}
+			itemProto.VariantId = v.ID
+			itemProto.Sku = v.SKU
+			itemProto.Price = v.Price
+			for _, o := range v.Options {
+				itemProto.Options = append(itemProto.Options, &pb.Cart_CartItem_VariantOption{Name: o.Name, Value: o.Value})
+			}
+		}
+
+		cartProto.Items = append(cartProto.Items, itemProto)
+		cartProto.TotalPrice += itemProto.Price * float64(item.Quantity)
+	}
+
+	return cartProto, nil
+}
@@ -0,0 +1,93 @@
+package cart
+
+import (
+	"context"
+	"errors"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+)
+
+var (
+	ErrInvalidQuantity = errors.New("quantity must be positive")
+	ErrEmptyCart       = errors.New("cart is empty")
+	ErrInvalidVariant  = errors.New("products with variants are added through one of their variants, other products without one")
+)
+
+type Service interface {
+	GetCart(ctx context.Context, accountID string) (*Cart, error)
+	AddItem(ctx context.Context, accountID string, productID string, variantID string, quantity uint32) (*Cart, error)
+	RemoveItem(ctx context.Context, accountID string, productID string, variantID string, quantity uint32) (*Cart, error)
+	RemoveItems(ctx context.Context, accountID string, items []CartItem) error
+}
+
+// Cart only stores product and variant IDs and quantities, product details
+// and prices are filled in from the catalog whenever the cart is read.
+// Version changes whenever the items change.
+type Cart struct {
+	AccountID  string
+	Version    uint64
+	Items      []CartItem
+	TotalPrice float64
+}
+
+// CartItem is a line of the cart. VariantID is empty for products without
+// variants, a product can be in the cart once per variant.
+type CartItem struct {
+	ProductID   string
+	VariantID   string
+	SKU         string
+	Options     []catalog.VariantOption
+	Name        string
+	Description string
+	Price       float64
+	Quantity    uint32
+}
+
+type cartService struct {
+	repository Repository
+}
+
+func NewService(r Repository) Service {
+	return &cartService{r}
+}
+
+func (s *cartService) GetCart(ctx context.Context, accountID string) (*Cart, error) {
+	version, items, err := s.repository.GetCartItems(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cart{
+		AccountID: accountID,
+		Version:   version,
+		Items:     items,
+	}, nil
+}
+
+func (s *cartService) AddItem(ctx context.Context, accountID string, productID string, variantID string, quantity uint32) (*Cart, error) {
+	if quantity == 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	if err := s.repository.AddItem(ctx, accountID, productID, variantID, quantity); err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, accountID)
+}
+
+// RemoveItem removes quantity units of the product variant, or the whole line
+// when quantity is 0
+func (s *cartService) RemoveItem(ctx context.Context, accountID string, productID string, variantID string, quantity uint32) (*Cart, error) {
+	if err := s.repository.RemoveItem(ctx, accountID, productID, variantID, quantity); err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, accountID)
+}
+
+// RemoveItems takes the quantity of each item off the cart, lines added or
+// topped up meanwhile keep the rest
+func (s *cartService) RemoveItems(ctx context.Context, accountID string, items []CartItem) error {
+	return s.repository.RemoveItems(ctx, accountID, items)
+}
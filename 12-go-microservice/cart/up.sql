@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS cart_items (
+  account_id CHAR(27) NOT NULL,
+  product_id CHAR(27) NOT NULL,
+  variant_id VARCHAR(27) NOT NULL DEFAULT '',
+  quantity INT NOT NULL CHECK (quantity > 0),
+  added_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  PRIMARY KEY (account_id, product_id, variant_id)
+);
+
+-- Bumped by every change to the items of a cart. Checkouts use it as the
+-- idempotency key of their order, so a retried checkout places one order.
+CREATE TABLE IF NOT EXISTS carts (
+  account_id CHAR(27) PRIMARY KEY,
+  version BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,88 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidCategory = errors.New("invalid category")
+	ErrCategoryInUse   = errors.New("category has subcategories or products")
+)
+
+// maxCategories bounds the category tree, which is always loaded whole
+const maxCategories = 1000
+
+// Category is a node of the category tree. Root categories have no parent.
+type Category struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ParentID string `json:"parentId,omitempty"`
+}
+
+// ProductFilter narrows and orders product listings. A category matches the
+// products of its subcategories too, and every tag must be present.
+type ProductFilter struct {
+	CategoryID string
+	Tags       []string
+	Sort       ProductSort
+}
+
+// ProductSort is the order of product listings. By default searches are
+// ordered by relevance and other listings by ID.
+type ProductSort string
+
+const (
+	SortDefault ProductSort = ""
+	SortRating  ProductSort = "rating"
+)
+
+// descendantIDs returns id followed by the IDs of every category below it
+func descendantIDs(categories []Category, id string) []string {
+	children := map[string][]string{}
+	for _, c := range categories {
+		children[c.ParentID] = append(children[c.ParentID], c.ID)
+	}
+
+	ids := []string{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids
+}
+
+// validateCategory checks c can be saved in the tree of categories, which may
+// hold c itself when it is updated
+func validateCategory(c Category, categories []Category) error {
+	if c.Name == "" || len(c.Name) > 64 {
+		return fmt.Errorf("%w: name must be between 1 and 64 characters", ErrInvalidCategory)
+	}
+
+	if c.ParentID != "" {
+		found := false
+		for _, other := range categories {
+			if other.ID == c.ParentID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: parent %s not found", ErrInvalidCategory, c.ParentID)
+		}
+
+		for _, id := range descendantIDs(categories, c.ID) {
+			if id == c.ParentID {
+				return fmt.Errorf("%w: a category cannot be moved below itself", ErrInvalidCategory)
+			}
+		}
+	}
+
+	for _, other := range categories {
+		if other.ID != c.ID && other.ParentID == c.ParentID && strings.EqualFold(other.Name, c.Name) {
+			return fmt.Errorf("%w: %q already exists at this level", ErrInvalidCategory, c.Name)
+		}
+	}
+
+	return nil
+}
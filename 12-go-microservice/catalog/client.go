@@ -2,19 +2,32 @@ package catalog
 
 import (
 	"context"
+	"errors"
+	"io"
+	"sort"
 
 	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog/pb"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
+// Only idempotent reads are retried, retrying a write could apply it twice
+var retryableMethods = []string{
+	"GetProduct",
+	"GetProducts",
+	"GetProductsPage",
+	"SuggestProducts",
+	"GetCategories",
+	"UpdateProductRating",
+}
+
 type Client struct {
 	conn    *grpc.ClientConn
 	service pb.CatalogServiceClient
 }
 
-func NewClient(url string) (*Client, error) {
-	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewClient(url string, cfg resilience.Config) (*Client, error) {
+	conn, err := resilience.Dial(url, pb.CatalogService_ServiceDesc.ServiceName, retryableMethods, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -31,23 +44,56 @@ func (c *Client) Close() {
 	c.conn.Close()
 }
 
-func (c *Client) PostProduct(ctx context.Context, name, description string, price float64) (*Product, error) {
+func (c *Client) PostProduct(ctx context.Context, p Product) (*Product, error) {
 	r, err := c.service.PostProduct(ctx, &pb.PostProductRequest{
-		Name:        name,
-		Description: description,
-		Price:       price,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		CategoryId:  p.CategoryID,
+		Tags:        p.Tags,
+		Attributes:  attributesToProto(p.Attributes),
+		Variants:    variantsToProto(p.Variants),
+		TaxCategory: p.TaxCategory,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &Product{
-		ID:          r.Product.Id,
-		Name:        r.Product.Name,
-		Description: r.Product.Description,
-		Price:       r.Product.Price,
-	}, nil
+	res := productFromProto(r.Product)
+	return &res, nil
+}
+
+func (c *Client) UpdateProduct(ctx context.Context, p Product) (*Product, error) {
+	r, err := c.service.UpdateProduct(ctx, &pb.UpdateProductRequest{
+		Id:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		CategoryId:  p.CategoryID,
+		Tags:        p.Tags,
+		Attributes:  attributesToProto(p.Attributes),
+		Variants:    variantsToProto(p.Variants),
+		TaxCategory: p.TaxCategory,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := productFromProto(r.Product)
+	return &res, nil
+}
+
+// UpdateProductRating sets the rating of the product from count reviews
+func (c *Client) UpdateProductRating(ctx context.Context, id string, rating float64, count uint32) error {
+	_, err := c.service.UpdateProductRating(ctx, &pb.UpdateProductRatingRequest{
+		ProductId:   id,
+		Rating:      rating,
+		RatingCount: count,
+	})
+
+	return err
 }
 
 func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
@@ -59,20 +105,19 @@ func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
 		return nil, err
 	}
 
-	return &Product{
-		ID:          r.Product.Id,
-		Name:        r.Product.Name,
-		Description: r.Product.Description,
-		Price:       r.Product.Price,
-	}, nil
+	res := productFromProto(r.Product)
+	return &res, nil
 }
 
-func (c *Client) GetProducts(ctx context.Context, skip uint64, take uint64, ids []string, query string) ([]Product, error) {
+func (c *Client) GetProducts(ctx context.Context, skip uint64, take uint64, ids []string, query string, filter ProductFilter) ([]Product, error) {
 	r, err := c.service.GetProducts(ctx, &pb.GetProductsRequest{
-		Ids:   ids,
-		Query: query,
-		Skip:  skip,
-		Take:  take,
+		Ids:        ids,
+		Query:      query,
+		Skip:       skip,
+		Take:       take,
+		CategoryId: filter.CategoryID,
+		Tags:       filter.Tags,
+		Sort:       string(filter.Sort),
 	})
 
 	if err != nil {
@@ -82,13 +127,353 @@ func (c *Client) GetProducts(ctx context.Context, skip uint64, take uint64, ids
 	var products []Product
 
 	for _, r := range r.Products {
-		products = append(products, Product{
-			ID:          r.Id,
-			Name:        r.Name,
-			Description: r.Description,
-			Price:       r.Price,
-		})
+		products = append(products, productFromProto(r))
 	}
 
 	return products, nil
 }
+
+func (c *Client) GetProductsPage(ctx context.Context, query string, filter ProductFilter, after string, first uint64) (*ProductPage, error) {
+	r, err := c.service.GetProductsPage(ctx, &pb.GetProductsPageRequest{
+		Query:      query,
+		After:      after,
+		First:      first,
+		CategoryId: filter.CategoryID,
+		Tags:       filter.Tags,
+		Sort:       string(filter.Sort),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ProductPage{
+		TotalCount:  r.TotalCount,
+		HasNextPage: r.HasNextPage,
+	}
+
+	for _, e := range r.Edges {
+		page.Edges = append(page.Edges, ProductEdge{
+			Product: productFromProto(e.Product),
+			Cursor:  e.Cursor,
+		})
+	}
+
+	return page, nil
+}
+
+// SuggestProducts returns up to limit products whose name completes prefix
+func (c *Client) SuggestProducts(ctx context.Context, prefix string, limit uint64) ([]ProductSuggestion, error) {
+	r, err := c.service.SuggestProducts(ctx, &pb.SuggestProductsRequest{
+		Prefix: prefix,
+		Limit:  limit,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []ProductSuggestion{}
+	for _, s := range r.Suggestions {
+		suggestions = append(suggestions, ProductSuggestion{
+			ID:   s.ProductId,
+			Name: s.Name,
+		})
+	}
+
+	return suggestions, nil
+}
+
+func (c *Client) CreateCategory(ctx context.Context, name string, parentID string) (*Category, error) {
+	r, err := c.service.CreateCategory(ctx, &pb.CreateCategoryRequest{
+		Name:     name,
+		ParentId: parentID,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := categoryFromProto(r.Category)
+	return &res, nil
+}
+
+func (c *Client) UpdateCategory(ctx context.Context, id string, name string, parentID string) (*Category, error) {
+	r, err := c.service.UpdateCategory(ctx, &pb.UpdateCategoryRequest{
+		Id:       id,
+		Name:     name,
+		ParentId: parentID,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := categoryFromProto(r.Category)
+	return &res, nil
+}
+
+func (c *Client) DeleteCategory(ctx context.Context, id string) error {
+	_, err := c.service.DeleteCategory(ctx, &pb.DeleteCategoryRequest{
+		Id: id,
+	})
+	return err
+}
+
+// GetCategories returns the whole category tree as a flat list sorted by name
+func (c *Client) GetCategories(ctx context.Context) ([]Category, error) {
+	r, err := c.service.GetCategories(ctx, &pb.GetCategoriesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	categories := []Category{}
+	for _, c := range r.Categories {
+		categories = append(categories, categoryFromProto(c))
+	}
+
+	return categories, nil
+}
+
+func productFromProto(p *pb.Product) Product {
+	return Product{
+		ID:          p.Id,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		CategoryID:  p.CategoryId,
+		Tags:        p.Tags,
+		Attributes:  attributesFromProto(p.Attributes),
+		Variants:    variantsFromProto(p.Variants),
+		TaxCategory: p.TaxCategory,
+		Rating:      p.Rating,
+		RatingCount: p.RatingCount,
+		Highlights:  highlightsFromProto(p.Highlights),
+	}
+}
+
+func categoryFromProto(c *pb.Category) Category {
+	return Category{
+		ID:       c.Id,
+		Name:     c.Name,
+		ParentID: c.ParentId,
+	}
+}
+
+func attributesFromProto(attributes []*pb.ProductAttribute) []ProductAttribute {
+	var res []ProductAttribute
+	for _, a := range attributes {
+		res = append(res, ProductAttribute{Name: a.Name, Value: a.Value})
+	}
+	return res
+}
+
+func attributesToProto(attributes []ProductAttribute) []*pb.ProductAttribute {
+	res := []*pb.ProductAttribute{}
+	for _, a := range attributes {
+		res = append(res, &pb.ProductAttribute{Name: a.Name, Value: a.Value})
+	}
+	return res
+}
+
+func variantsFromProto(variants []*pb.ProductVariant) []ProductVariant {
+	var res []ProductVariant
+	for _, v := range variants {
+		variant := ProductVariant{
+			ID:    v.Id,
+			SKU:   v.Sku,
+			Price: v.Price,
+		}
+		for _, o := range v.Options {
+			variant.Options = append(variant.Options, VariantOption{Name: o.Name, Value: o.Value})
+		}
+		res = append(res, variant)
+	}
+	return res
+}
+
+func variantsToProto(variants []ProductVariant) []*pb.ProductVariant {
+	res := []*pb.ProductVariant{}
+	for _, v := range variants {
+		variant := &pb.ProductVariant{
+			Id:      v.ID,
+			Sku:     v.SKU,
+			Options: []*pb.VariantOption{},
+			Price:   v.Price,
+		}
+		for _, o := range v.Options {
+			variant.Options = append(variant.Options, &pb.VariantOption{Name: o.Name, Value: o.Value})
+		}
+		res = append(res, variant)
+	}
+	return res
+}
+
+func highlightsFromProto(highlights []*pb.ProductHighlight) []ProductHighlight {
+	var res []ProductHighlight
+	for _, h := range highlights {
+		res = append(res, ProductHighlight{
+			Field:     h.Field,
+			Fragments: h.Fragments,
+		})
+	}
+	return res
+}
+
+// WatchProductEvents calls handle for every product event until the stream
+// ends or ctx is done. connected is called once the subscription is live.
+func (c *Client) WatchProductEvents(ctx context.Context, connected func(), handle func(ProductEvent)) error {
+	stream, err := c.service.WatchProductEvents(ctx, &pb.WatchProductEventsRequest{})
+	if err != nil {
+		return err
+	}
+
+	// Wait for the stream to be established before reporting it as connected
+	if _, err := stream.Header(); err != nil {
+		return err
+	}
+	connected()
+
+	for {
+		e, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		handle(ProductEvent{
+			Type:      ProductEventType(e.Type),
+			ProductID: e.ProductId,
+		})
+	}
+}
+
+// ExportProducts calls handle for every product matching query, all products when it is empty
+func (c *Client) ExportProducts(ctx context.Context, query string, handle func(Product) error) error {
+	stream, err := c.service.ExportProducts(ctx, &pb.ExportProductsRequest{
+		Query: query,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = handle(productFromProto(p)); err != nil {
+			return err
+		}
+	}
+}
+
+type ImportError struct {
+	Index uint64
+	ID    string
+	Err   string
+}
+
+type ImportResult struct {
+	Imported uint64
+	Errors   []ImportError
+}
+
+// ImportRecordError is returned by the next func of ImportProducts for a
+// record that cannot be read. It is reported along with the products the
+// catalog rejected, and the import goes on with the next record.
+type ImportRecordError struct {
+	Err error
+}
+
+func (e *ImportRecordError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ImportRecordError) Unwrap() error {
+	return e.Err
+}
+
+// ImportProducts streams the products returned by next until it returns io.EOF.
+// Error indexes are those of the records next returned.
+func (c *Client) ImportProducts(ctx context.Context, next func() (Product, error)) (*ImportResult, error) {
+	// Cancelling the stream makes the catalog discard the products it has not
+	// imported yet, rather than import part of a failed import as if it ended
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.service.ImportProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	// The record index of each product sent, the catalog counts products sent
+	sent := []uint64{}
+	for index := uint64(0); ; index++ {
+		p, err := next()
+		if err == io.EOF {
+			break
+		}
+		var recordErr *ImportRecordError
+		if errors.As(err, &recordErr) {
+			result.Errors = append(result.Errors, ImportError{
+				Index: index,
+				Err:   recordErr.Error(),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sent = append(sent, index)
+		err = stream.Send(&pb.ImportProductsRequest{
+			Product: &pb.Product{
+				Id:          p.ID,
+				Name:        p.Name,
+				Description: p.Description,
+				Price:       p.Price,
+				CategoryId:  p.CategoryID,
+				Tags:        p.Tags,
+				Attributes:  attributesToProto(p.Attributes),
+				Variants:    variantsToProto(p.Variants),
+				TaxCategory: p.TaxCategory,
+				Rating:      p.Rating,
+				RatingCount: p.RatingCount,
+			},
+		})
+		// io.EOF means the server ended the stream, its error comes from CloseAndRecv
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+
+	result.Imported = r.Imported
+	for _, e := range r.Errors {
+		index := e.Index
+		if index < uint64(len(sent)) {
+			index = sent[index]
+		}
+		result.Errors = append(result.Errors, ImportError{
+			Index: index,
+			ID:    e.Id,
+			Err:   e.Error,
+		})
+	}
+	sort.SliceStable(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Index < result.Errors[j].Index
+	})
+	return result, nil
+}
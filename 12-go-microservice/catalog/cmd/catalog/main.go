@@ -2,42 +2,60 @@ package main
 
 import (
 	"log"
-	"time"
 
-	"github.com/kelseyhightower/envconfig"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
 	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
-	"github.com/tinrab/retry"
 )
 
 type Config struct {
-	DatabaseURL string `envconfig:"DATABASE_URL"`
+	bootstrap.Config
+	// Elasticsearch manages its own connections, so there is no pool to tune
+	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+	HTTPPort    int    `envconfig:"HTTP_PORT" default:"8090"`
+
+	// Synonym rules the index is created with, one per line
+	SynonymsFile string `envconfig:"SEARCH_SYNONYMS_FILE"`
+}
+
+func (c Config) Validate() error {
+	return bootstrap.ValidatePort("HTTP_PORT", c.HTTPPort)
 }
 
 func main() {
 	var cfg Config
-	err := envconfig.Process("", &cfg)
-
-	if err != nil {
+	if err := bootstrap.Load(&cfg); err != nil {
 		log.Fatal(err)
 	}
+	bootstrap.Banner("catalog", &cfg)
 
-	var r catalog.Repository
-	retry.ForeverSleep(2*time.Second, func(_ int) (err error) {
-		r, err = catalog.NewElasticRepository(cfg.DatabaseURL)
+	var synonyms []string
+	if cfg.SynonymsFile != "" {
+		var err error
+		synonyms, err = catalog.LoadSynonyms(cfg.SynonymsFile)
 		if err != nil {
-			log.Println(err)
+			log.Fatal(err)
 		}
+	}
 
-		return
+	r, err := bootstrap.WaitFor(cfg.Startup, "elasticsearch", func() (catalog.Repository, error) {
+		return catalog.NewElasticRepository(cfg.DatabaseURL, synonyms)
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer r.Close()
 
-	log.Println("Listening on port 8080...")
+	log.Printf("Listening on port %d, REST/JSON on port %d...", cfg.Port, cfg.HTTPPort)
 
 	// Create an catalog service wrapping repository
 	s := catalog.NewService(r)
 
+	// The REST/JSON gateway forwards to the gRPC server below
+	go func() {
+		log.Fatal(catalog.ListenHTTP(cfg.Port, cfg.HTTPPort))
+	}()
+
 	// Create a server and listen to service
-	log.Fatal(catalog.ListenGRPC(s, 8080))
+	log.Fatal(catalog.ListenGRPC(s, cfg.Port))
 
 }
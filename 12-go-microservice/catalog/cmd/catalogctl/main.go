@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+)
+
+const usage = `Usage: catalogctl [-addr host:port] <command> [flags]
+
+Commands:
+  export  write products to a file or stdout
+  import  read products from a file or stdin
+
+Files are NDJSON (one product per line) or CSV with an
+id,name,description,price,category_id,tags,tax_category header, where tags
+are separated by |. Only name, description and price are required when importing CSV, and
+attributes and variants are only kept in NDJSON. The format is taken from the file
+extension unless -format is given.
+`
+
+var csvHeader = []string{"id", "name", "description", "price", "category_id", "tags", "tax_category"}
+
+// maxNDJSONLine is the longest product line read when importing NDJSON
+const maxNDJSONLine = 16 << 20
+
+// csvRequired are the columns an imported CSV file must have
+var csvRequired = []string{"name", "description", "price"}
+
+type Config struct {
+	CatalogURL string `envconfig:"CATALOG_SERVICE_URL" default:"localhost:8080"`
+
+	RPC resilience.Config `envconfig:"RPC"`
+}
+
+func main() {
+	log.SetFlags(0)
+
+	var cfg Config
+	if err := bootstrap.Load(&cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.StringVar(&cfg.CatalogURL, "addr", cfg.CatalogURL, "catalog service address")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client, err := catalog.NewClient(cfg.CatalogURL, cfg.RPC)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	switch flag.Arg(0) {
+	case "export":
+		err = export(client, flag.Args()[1:])
+	case "import":
+		err = importProducts(client, flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func export(client *catalog.Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "", "output file, stdout when empty")
+	format := fs.String("format", "", "ndjson or csv")
+	query := fs.String("query", "", "only export products matching this search")
+	fs.Parse(args)
+
+	f := os.Stdout
+	if *output != "" {
+		var err error
+		f, err = os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+
+	w := bufio.NewWriter(f)
+	defer w.Flush()
+
+	var write func(catalog.Product) error
+	var flush func() error
+
+	switch fileFormat(*format, *output) {
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		write = func(p catalog.Product) error {
+			return cw.Write([]string{
+				p.ID,
+				p.Name,
+				p.Description,
+				strconv.FormatFloat(p.Price, 'f', -1, 64),
+				p.CategoryID,
+				strings.Join(p.Tags, "|"),
+				p.TaxCategory,
+			})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		enc := json.NewEncoder(w)
+		write = func(p catalog.Product) error {
+			return enc.Encode(p)
+		}
+		flush = func() error {
+			return nil
+		}
+	}
+
+	count := 0
+	err := client.ExportProducts(context.Background(), *query, func(p catalog.Product) error {
+		count++
+		return write(p)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	log.Printf("Exported %d products", count)
+	return nil
+}
+
+func importProducts(client *catalog.Client, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	input := fs.String("i", "", "input file, stdin when empty")
+	format := fs.String("format", "", "ndjson or csv")
+	fs.Parse(args)
+
+	f := os.Stdin
+	if *input != "" {
+		var err error
+		f, err = os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+
+	var next func() (catalog.Product, error)
+
+	switch fileFormat(*format, *input) {
+	case "csv":
+		r := csv.NewReader(bufio.NewReader(f))
+		header, err := r.Read()
+		if err != nil {
+			return err
+		}
+		columns := map[string]int{}
+		for i, name := range header {
+			columns[name] = i
+		}
+		for _, name := range csvRequired {
+			if _, ok := columns[name]; !ok {
+				return fmt.Errorf("missing %q column", name)
+			}
+		}
+
+		// Malformed rows are reported and skipped, the reader goes on with the next one
+		next = func() (catalog.Product, error) {
+			record, err := r.Read()
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return catalog.Product{}, &catalog.ImportRecordError{Err: err}
+			}
+			if err != nil {
+				return catalog.Product{}, err
+			}
+
+			price, err := strconv.ParseFloat(record[columns["price"]], 64)
+			if err != nil {
+				return catalog.Product{}, &catalog.ImportRecordError{Err: fmt.Errorf("line %d: %w", lineOf(r), err)}
+			}
+
+			p := catalog.Product{
+				Name:        record[columns["name"]],
+				Description: record[columns["description"]],
+				Price:       price,
+			}
+			if i, ok := columns["id"]; ok {
+				p.ID = record[i]
+			}
+			if i, ok := columns["category_id"]; ok {
+				p.CategoryID = record[i]
+			}
+			if i, ok := columns["tags"]; ok && record[i] != "" {
+				p.Tags = strings.Split(record[i], "|")
+			}
+			if i, ok := columns["tax_category"]; ok {
+				p.TaxCategory = record[i]
+			}
+			return p, nil
+		}
+	default:
+		// Products are read a line at a time, so a malformed line is skipped
+		// rather than ending the import
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+		line := 0
+		next = func() (catalog.Product, error) {
+			for scanner.Scan() {
+				line++
+				text := bytes.TrimSpace(scanner.Bytes())
+				if len(text) == 0 {
+					continue
+				}
+
+				p := catalog.Product{}
+				if err := json.Unmarshal(text, &p); err != nil {
+					return catalog.Product{}, &catalog.ImportRecordError{Err: fmt.Errorf("line %d: %w", line, err)}
+				}
+				return p, nil
+			}
+			if err := scanner.Err(); err != nil {
+				return catalog.Product{}, err
+			}
+			return catalog.Product{}, io.EOF
+		}
+	}
+
+	res, err := client.ImportProducts(context.Background(), next)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range res.Errors {
+		log.Printf("Record %d (%s): %s", e.Index+1, e.ID, e.Err)
+	}
+	log.Printf("Imported %d products, %d failed", res.Imported, len(res.Errors))
+
+	if len(res.Errors) > 0 {
+		return errors.New("some products were not imported")
+	}
+	return nil
+}
+
+func lineOf(r *csv.Reader) int {
+	line, _ := r.FieldPos(0)
+	return line
+}
+
+func fileFormat(format, path string) string {
+	if format != "" {
+		return format
+	}
+	if filepath.Ext(path) == ".csv" {
+		return "csv"
+	}
+	return "ndjson"
+}
@@ -0,0 +1,64 @@
+package catalog
+
+import (
+	"sync"
+)
+
+type ProductEventType int
+
+const (
+	ProductCreated ProductEventType = iota
+	ProductUpdated
+)
+
+type ProductEvent struct {
+	Type      ProductEventType
+	ProductID string
+}
+
+// eventHub fans product events out to every subscriber. A subscriber that
+// falls behind is disconnected rather than blocking writes, it is expected
+// to resubscribe and resync. Events stay in this process, subscribers never
+// see changes made through another catalog instance.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan ProductEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: map[chan ProductEvent]struct{}{},
+	}
+}
+
+func (h *eventHub) publish(e ProductEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *eventHub) subscribe() (<-chan ProductEvent, func()) {
+	ch := make(chan ProductEvent, 64)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
@@ -4,28 +4,86 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 
 	elastic "gopkg.in/olivere/elastic.v5"
 )
 
 var (
-	ErrNotFound = errors.New("entity not found")
+	ErrNotFound      = errors.New("entity not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
 )
 
 type Repository interface {
 	Close()
 	PutProduct(ctx context.Context, p Product) error
+	PutProductRating(ctx context.Context, id string, rating float64, count uint32) error
 	GetProductByID(ctx context.Context, id string) (*Product, error)
-	ListProducts(ctx context.Context, skip uint64, take uint64) ([]Product, error)
+	ListProducts(ctx context.Context, filter ProductFilter, skip uint64, take uint64) ([]Product, error)
 	ListProductsWithIDs(ctx context.Context, ids []string) ([]Product, error)
-	SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]Product, error)
+	SearchProducts(ctx context.Context, query string, filter ProductFilter, skip uint64, take uint64) ([]Product, error)
+	SuggestProducts(ctx context.Context, prefix string, limit uint64) ([]ProductSuggestion, error)
+	ListProductsPage(ctx context.Context, query string, filter ProductFilter, after string, first uint64) (*ProductPage, error)
+	CountProducts(ctx context.Context, filter ProductFilter) (uint64, error)
+	ScrollProducts(ctx context.Context, query string, handle func(Product) error) error
+	BulkPutProducts(ctx context.Context, products []Product) ([]error, error)
+	PutCategory(ctx context.Context, c Category) error
+	DeleteCategory(ctx context.Context, id string) error
+	ListCategories(ctx context.Context) ([]Category, error)
 }
 
 type productDocument struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Price       float64            `json:"price"`
+	CategoryID  string             `json:"categoryId,omitempty"`
+	Tags        []string           `json:"tags,omitempty"`
+	Attributes  []ProductAttribute `json:"attributes,omitempty"`
+	Variants    []ProductVariant   `json:"variants,omitempty"`
+	TaxCategory string             `json:"taxCategory,omitempty"`
+	Rating      float64            `json:"rating"`
+	RatingCount uint32             `json:"ratingCount"`
+}
+
+func newProductDocument(p Product) productDocument {
+	return productDocument{
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		CategoryID:  p.CategoryID,
+		Tags:        p.Tags,
+		Attributes:  p.Attributes,
+		Variants:    p.Variants,
+		TaxCategory: p.TaxCategory,
+		Rating:      p.Rating,
+		RatingCount: p.RatingCount,
+	}
+}
+
+func (d productDocument) product(id string) Product {
+	return Product{
+		ID:          id,
+		Name:        d.Name,
+		Description: d.Description,
+		Price:       d.Price,
+		CategoryID:  d.CategoryID,
+		Tags:        d.Tags,
+		Attributes:  d.Attributes,
+		Variants:    d.Variants,
+		TaxCategory: d.TaxCategory,
+		Rating:      d.Rating,
+		RatingCount: d.RatingCount,
+	}
+}
+
+// categoryIndex holds the category tree, which is small and read whole
+const categoryIndex = "catalog_categories"
+
+type categoryDocument struct {
+	Name     string `json:"name"`
+	ParentID string `json:"parentId"`
 }
 
 type elasticRepository struct {
@@ -41,16 +99,41 @@ func (r *elasticRepository) PutProduct(ctx context.Context, p Product) error {
 		Index("catalog").
 		Type("product").
 		Id(p.ID).
-		BodyJson(productDocument{
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		}).
+		BodyJson(newProductDocument(p)).
 		Do(ctx)
 
 	return nil
 }
 
+// ratingScript sets the rating unless the stored one was computed from more
+// reviews, which means a newer rating was already written
+const ratingScript = `
+if (ctx._source.ratingCount != null && ctx._source.ratingCount > params.ratingCount) {
+	ctx.op = 'none';
+} else {
+	ctx._source.rating = params.rating;
+	ctx._source.ratingCount = params.ratingCount;
+}`
+
+// PutProductRating only updates the rating fields, the rest of the product is
+// left as is. A rating from fewer reviews than the stored one is ignored.
+func (r *elasticRepository) PutProductRating(ctx context.Context, id string, rating float64, count uint32) error {
+	_, err := r.client.Update().
+		Index("catalog").
+		Type("product").
+		Id(id).
+		Script(elastic.NewScript(ratingScript).Lang("painless").Params(map[string]interface{}{
+			"rating":      rating,
+			"ratingCount": count,
+		})).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
 func (r *elasticRepository) GetProductByID(ctx context.Context, id string) (*Product, error) {
 	res, err := r.client.Get().
 		Index("catalog").
@@ -72,21 +155,46 @@ func (r *elasticRepository) GetProductByID(ctx context.Context, id string) (*Pro
 		return nil, err
 	}
 
-	return &Product{
-		ID:          id,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}, nil
+	product := p.product(id)
+	return &product, nil
 }
 
-func (r *elasticRepository) ListProducts(ctx context.Context, skip uint64, take uint64) ([]Product, error) {
-	res, err := r.client.Search().
+// productQuery matches the products found by query, all of them when it is
+// empty, that pass filter
+func (r *elasticRepository) productQuery(ctx context.Context, query string, filter ProductFilter) (elastic.Query, error) {
+	var q elastic.Query = elastic.NewMatchAllQuery()
+	if query != "" {
+		q = searchQuery(query)
+	}
+
+	var categoryIDs []string
+	if filter.CategoryID != "" {
+		categories, err := r.ListCategories(ctx)
+		if err != nil {
+			return nil, err
+		}
+		categoryIDs = descendantIDs(categories, filter.CategoryID)
+	}
+
+	return filterQuery(q, categoryIDs, normalizeTags(filter.Tags)), nil
+}
+
+func (r *elasticRepository) ListProducts(ctx context.Context, filter ProductFilter, skip uint64, take uint64) ([]Product, error) {
+	q, err := r.productQuery(ctx, "", filter)
+	if err != nil {
+		return nil, err
+	}
+
+	search := r.client.Search().
 		Index("catalog").
 		Type("product").
-		Query(elastic.NewMatchAllQuery()).
-		From(int(skip)).Size(int(take)).
-		Do(ctx)
+		Query(q).
+		From(int(skip)).Size(int(take))
+	if filter.Sort != SortDefault {
+		search = search.SortBy(productSorters(filter.Sort, "")...)
+	}
+
+	res, err := search.Do(ctx)
 
 	if err != nil {
 		log.Println(err)
@@ -97,12 +205,7 @@ func (r *elasticRepository) ListProducts(ctx context.Context, skip uint64, take
 	for _, hit := range res.Hits.Hits {
 		p := productDocument{}
 		if err = json.Unmarshal(*hit.Source, &p); err == nil {
-			products = append(products, Product{
-				ID:          hit.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
+			products = append(products, p.product(hit.Id))
 		}
 	}
 
@@ -145,12 +248,7 @@ func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, ids []strin
 
 		p := productDocument{}
 		if err = json.Unmarshal(*doc.Source, &p); err == nil {
-			products = append(products, Product{
-				ID:          doc.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
+			products = append(products, p.product(doc.Id))
 		} else {
 			log.Printf("Error unmarshaling product %s: %v", doc.Id, err)
 		}
@@ -160,14 +258,24 @@ func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, ids []strin
 	return products, nil
 }
 
-func (r *elasticRepository) SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]Product, error) {
-	res, err := r.client.Search().
+func (r *elasticRepository) SearchProducts(ctx context.Context, query string, filter ProductFilter, skip uint64, take uint64) ([]Product, error) {
+	q, err := r.productQuery(ctx, query, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	search := r.client.Search().
 		Index("catalog").
 		Type("product").
-		Query(elastic.NewMultiMatchQuery(query, "name", "description")).
+		Query(q).
+		Highlight(searchHighlight()).
 		From(int(skip)).
-		Size(int(take)).
-		Do(ctx)
+		Size(int(take))
+	if filter.Sort != SortDefault {
+		search = search.SortBy(productSorters(filter.Sort, query)...)
+	}
+
+	res, err := search.Do(ctx)
 
 	if err != nil {
 		log.Println(err)
@@ -178,12 +286,9 @@ func (r *elasticRepository) SearchProducts(ctx context.Context, query string, sk
 	for _, hit := range res.Hits.Hits {
 		p := productDocument{}
 		if err = json.Unmarshal(*hit.Source, &p); err == nil {
-			products = append(products, Product{
-				ID:          hit.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
+			product := p.product(hit.Id)
+			product.Highlights = highlightsFromHit(hit)
+			products = append(products, product)
 		}
 	}
 
@@ -191,7 +296,279 @@ func (r *elasticRepository) SearchProducts(ctx context.Context, query string, sk
 
 }
 
-func NewElasticRepository(url string) (Repository, error) {
+// SuggestProducts completes prefix into product names. Names starting with
+// the prefix come first, from the completion field, which tolerates typos.
+// Names with a later word starting with it follow, from the edge n-grams.
+func (r *elasticRepository) SuggestProducts(ctx context.Context, prefix string, limit uint64) ([]ProductSuggestion, error) {
+	res, err := r.client.Search().
+		Index("catalog").
+		Type("product").
+		Query(elastic.NewMatchQuery("name.autocomplete", prefix).Operator("and")).
+		Suggester(
+			elastic.NewCompletionSuggester("names").
+				Field("name.suggest").
+				PrefixWithEditDistance(prefix, "AUTO").
+				Size(int(limit)),
+		).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Include("name")).
+		Size(int(limit)).
+		Do(ctx)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	suggestions := []ProductSuggestion{}
+	seen := map[string]bool{}
+	add := func(id string, source *json.RawMessage) {
+		if seen[id] || source == nil || uint64(len(suggestions)) == limit {
+			return
+		}
+		p := productDocument{}
+		if err := json.Unmarshal(*source, &p); err != nil {
+			return
+		}
+		seen[id] = true
+		suggestions = append(suggestions, ProductSuggestion{ID: id, Name: p.Name})
+	}
+
+	for _, suggestion := range res.Suggest["names"] {
+		for _, option := range suggestion.Options {
+			add(option.Id, option.Source)
+		}
+	}
+	for _, hit := range res.Hits.Hits {
+		add(hit.Id, hit.Source)
+	}
+
+	return suggestions, nil
+}
+
+// ListProductsPage pages with search_after instead of from/size, so it is not
+// bound by the max result window. The cursor is the JSON encoded sort values of a hit.
+func (r *elasticRepository) ListProductsPage(ctx context.Context, query string, filter ProductFilter, after string, first uint64) (*ProductPage, error) {
+	q, err := r.productQuery(ctx, query, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	search := r.client.Search().
+		Index("catalog").
+		Type("product").
+		Query(q).
+		SortBy(productSorters(filter.Sort, query)...).
+		Size(int(first) + 1)
+
+	if query != "" {
+		search = search.Highlight(searchHighlight())
+	}
+
+	if after != "" {
+		var sortValues []interface{}
+		if err := json.Unmarshal([]byte(after), &sortValues); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		search = search.SearchAfter(sortValues...)
+	}
+
+	res, err := search.Do(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	page := &ProductPage{
+		Edges:      []ProductEdge{},
+		TotalCount: uint64(res.TotalHits()),
+	}
+	for _, hit := range res.Hits.Hits {
+		if uint64(len(page.Edges)) == first {
+			page.HasNextPage = true
+			break
+		}
+
+		p := productDocument{}
+		if err = json.Unmarshal(*hit.Source, &p); err != nil {
+			return nil, err
+		}
+
+		cursor, err := json.Marshal(hit.Sort)
+		if err != nil {
+			return nil, err
+		}
+
+		product := p.product(hit.Id)
+		product.Highlights = highlightsFromHit(hit)
+		page.Edges = append(page.Edges, ProductEdge{
+			Product: product,
+			Cursor:  string(cursor),
+		})
+	}
+
+	return page, nil
+}
+
+func (r *elasticRepository) CountProducts(ctx context.Context, filter ProductFilter) (uint64, error) {
+	q, err := r.productQuery(ctx, "", filter)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := r.client.Count("catalog").
+		Type("product").
+		Query(q).
+		Do(ctx)
+
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	return uint64(count), nil
+}
+
+// ScrollProducts walks every product matching query, or all products when it is empty
+func (r *elasticRepository) ScrollProducts(ctx context.Context, query string, handle func(Product) error) error {
+	var q elastic.Query = elastic.NewMatchAllQuery()
+	if query != "" {
+		q = searchQuery(query)
+	}
+
+	scroll := r.client.Scroll("catalog").
+		Type("product").
+		Query(q).
+		Size(500).
+		KeepAlive("1m")
+	defer scroll.Clear(context.Background())
+
+	for {
+		res, err := scroll.Do(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+
+		for _, hit := range res.Hits.Hits {
+			p := productDocument{}
+			if err = json.Unmarshal(*hit.Source, &p); err != nil {
+				return err
+			}
+
+			if err = handle(p.product(hit.Id)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// BulkPutProducts indexes products in a single bulk request. The returned
+// slice has one entry per product, nil when that product was indexed.
+func (r *elasticRepository) BulkPutProducts(ctx context.Context, products []Product) ([]error, error) {
+	bulk := r.client.Bulk()
+	for _, p := range products {
+		bulk.Add(
+			elastic.NewBulkIndexRequest().
+				Index("catalog").
+				Type("product").
+				Id(p.ID).
+				Doc(newProductDocument(p)),
+		)
+	}
+
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	itemErrors := make([]error, len(products))
+	for i, item := range res.Items {
+		for _, result := range item {
+			if result.Error != nil {
+				itemErrors[i] = fmt.Errorf("%s: %s", result.Error.Type, result.Error.Reason)
+			}
+		}
+	}
+
+	return itemErrors, nil
+}
+
+// PutCategory creates or replaces a category. It waits for the change to be
+// searchable, as the whole tree is read back right after edits.
+func (r *elasticRepository) PutCategory(ctx context.Context, c Category) error {
+	_, err := r.client.Index().
+		Index(categoryIndex).
+		Type("category").
+		Id(c.ID).
+		BodyJson(categoryDocument{
+			Name:     c.Name,
+			ParentID: c.ParentID,
+		}).
+		Refresh("wait_for").
+		Do(ctx)
+
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *elasticRepository) DeleteCategory(ctx context.Context, id string) error {
+	_, err := r.client.Delete().
+		Index(categoryIndex).
+		Type("category").
+		Id(id).
+		Refresh("wait_for").
+		Do(ctx)
+
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// ListCategories returns every category, sorted by name
+func (r *elasticRepository) ListCategories(ctx context.Context) ([]Category, error) {
+	res, err := r.client.Search().
+		Index(categoryIndex).
+		Type("category").
+		Query(elastic.NewMatchAllQuery()).
+		SortBy(elastic.NewFieldSort("name").Asc()).
+		Size(maxCategories).
+		Do(ctx)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	categories := []Category{}
+	for _, hit := range res.Hits.Hits {
+		c := categoryDocument{}
+		if err = json.Unmarshal(*hit.Source, &c); err == nil {
+			categories = append(categories, Category{
+				ID:       hit.Id,
+				Name:     c.Name,
+				ParentID: c.ParentID,
+			})
+		}
+	}
+
+	return categories, nil
+}
+
+func NewElasticRepository(url string, synonyms []string) (Repository, error) {
 	client, err := elastic.NewClient(
 		elastic.SetURL(url),
 		elastic.SetSniff(false),
@@ -210,7 +587,7 @@ func NewElasticRepository(url string) (Repository, error) {
 
 	if !exists {
 		// Create index with mapping
-		createIndex, err := client.CreateIndex(indexName).Do(context.Background())
+		createIndex, err := client.CreateIndex(indexName).BodyJson(indexBody(synonyms)).Do(context.Background())
 		if err != nil {
 			return nil, err
 		}
@@ -218,6 +595,44 @@ func NewElasticRepository(url string) (Repository, error) {
 			return nil, errors.New("index creation not acknowledged")
 		}
 		log.Printf("Created index: %s", indexName)
+	} else {
+		if ok, err := hasSearchMapping(context.Background(), client, indexName); err != nil {
+			return nil, err
+		} else if !ok {
+			log.Printf("Index %s predates search suggestions, export and re-import the catalog to recreate it", indexName)
+		}
+
+		_, err := client.PutMapping().
+			Index(indexName).
+			Type("product").
+			BodyJson(map[string]interface{}{"properties": keywordProperties()}).
+			Do(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	exists, err = client.IndexExists(categoryIndex).Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		keyword := map[string]interface{}{"type": "keyword"}
+		_, err := client.CreateIndex(categoryIndex).BodyJson(map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"category": map[string]interface{}{
+					"properties": map[string]interface{}{
+						"name":     keyword,
+						"parentId": keyword,
+					},
+				},
+			},
+		}).Do(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Created index: %s", categoryIndex)
 	}
 
 	return &elasticRepository{client}, nil
@@ -0,0 +1,240 @@
+package catalog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// Names are indexed three ways: as words for search, as edge n-grams so a
+// search can match the start of any word while typing, and in a completion
+// field that suggests names from their first letters. Synonyms are expanded
+// when searching. They are part of the index settings, so an index keeps the
+// synonyms it was created with.
+
+// indexBody is the settings and mapping the catalog index is created with
+func indexBody(synonyms []string) map[string]interface{} {
+	filters := map[string]interface{}{
+		"autocomplete_ngram": map[string]interface{}{
+			"type":     "edge_ngram",
+			"min_gram": 1,
+			"max_gram": 20,
+		},
+	}
+	searchFilters := []string{"lowercase"}
+	if len(synonyms) > 0 {
+		filters["product_synonyms"] = map[string]interface{}{
+			"type":     "synonym",
+			"synonyms": synonyms,
+		}
+		searchFilters = append(searchFilters, "product_synonyms")
+	}
+
+	text := func(fields map[string]interface{}) map[string]interface{} {
+		m := map[string]interface{}{
+			"type":            "text",
+			"analyzer":        "standard",
+			"search_analyzer": "product_search",
+		}
+		if fields != nil {
+			m["fields"] = fields
+		}
+		return m
+	}
+
+	properties := map[string]interface{}{
+		"name": text(map[string]interface{}{
+			"autocomplete": map[string]interface{}{
+				"type":            "text",
+				"analyzer":        "autocomplete",
+				"search_analyzer": "standard",
+			},
+			"suggest": map[string]interface{}{
+				"type": "completion",
+			},
+		}),
+		"description": text(nil),
+		"price":       map[string]interface{}{"type": "double"},
+	}
+	for field, mapping := range keywordProperties() {
+		properties[field] = mapping
+	}
+
+	return map[string]interface{}{
+		"settings": map[string]interface{}{
+			"analysis": map[string]interface{}{
+				"filter": filters,
+				"analyzer": map[string]interface{}{
+					"product_search": map[string]interface{}{
+						"tokenizer": "standard",
+						"filter":    searchFilters,
+					},
+					"autocomplete": map[string]interface{}{
+						"tokenizer": "standard",
+						"filter":    []string{"lowercase", "autocomplete_ngram"},
+					},
+				},
+			},
+		},
+		"mappings": map[string]interface{}{
+			"product": map[string]interface{}{
+				"properties": properties,
+			},
+		},
+	}
+}
+
+// keywordProperties maps the fields of products that hold exact values, such
+// as the ones products are filtered and sorted on. New fields can be added to an existing
+// index, so these are also put on indexes created before them.
+func keywordProperties() map[string]interface{} {
+	keyword := map[string]interface{}{"type": "keyword"}
+	nameValue := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"name":  keyword,
+			"value": keyword,
+		},
+	}
+	return map[string]interface{}{
+		"categoryId":  keyword,
+		"tags":        keyword,
+		"taxCategory": keyword,
+		"attributes":  nameValue,
+		"rating":      map[string]interface{}{"type": "double"},
+		"ratingCount": map[string]interface{}{"type": "integer"},
+		"variants": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"id":      keyword,
+				"sku":     keyword,
+				"options": nameValue,
+				"price":   map[string]interface{}{"type": "double"},
+			},
+		},
+	}
+}
+
+// hasSearchMapping reports whether the index was created with the mapping
+// above. Indexes created before it lack the fields suggestions rely on.
+func hasSearchMapping(ctx context.Context, client *elastic.Client, index string) (bool, error) {
+	res, err := client.GetMapping().Index(index).Type("product").Do(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var mapping struct {
+		Mappings struct {
+			Product struct {
+				Properties struct {
+					Name struct {
+						Fields map[string]interface{} `json:"fields"`
+					} `json:"name"`
+				} `json:"properties"`
+			} `json:"product"`
+		} `json:"mappings"`
+	}
+	b, err := json.Marshal(res[index])
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, &mapping); err != nil {
+		return false, err
+	}
+
+	_, ok := mapping.Mappings.Product.Properties.Name.Fields["suggest"]
+	return ok, nil
+}
+
+// searchQuery matches products by name and description, tolerating typos.
+// Name matches weigh more.
+func searchQuery(query string) elastic.Query {
+	return elastic.NewMultiMatchQuery(query, "name^3", "description").
+		Fuzziness("AUTO").
+		PrefixLength(1)
+}
+
+// filterQuery restricts q to the products in one of categoryIDs, when there
+// are any, and carrying every tag
+func filterQuery(q elastic.Query, categoryIDs []string, tags []string) elastic.Query {
+	if len(categoryIDs) == 0 && len(tags) == 0 {
+		return q
+	}
+
+	b := elastic.NewBoolQuery().Must(q)
+	if len(categoryIDs) > 0 {
+		ids := []interface{}{}
+		for _, id := range categoryIDs {
+			ids = append(ids, id)
+		}
+		b = b.Filter(elastic.NewTermsQuery("categoryId", ids...))
+	}
+	for _, tag := range tags {
+		b = b.Filter(elastic.NewTermQuery("tags", tag))
+	}
+	return b
+}
+
+// productSorters orders products by sort, then by relevance for searches,
+// then by ID so that every product has a distinct position for cursors.
+// Products indexed before ratings existed sort as unrated.
+func productSorters(sort ProductSort, query string) []elastic.Sorter {
+	sorters := []elastic.Sorter{}
+	if sort == SortRating {
+		sorters = append(sorters,
+			elastic.NewFieldSort("rating").Desc().Missing(0),
+			elastic.NewFieldSort("ratingCount").Desc().Missing(0),
+		)
+	}
+	if query != "" {
+		sorters = append(sorters, elastic.NewScoreSort())
+	}
+	return append(sorters, elastic.NewFieldSort("_uid").Asc())
+}
+
+// searchHighlight marks the matched words of names and descriptions with <em>.
+// The whole name is returned, descriptions as up to three fragments.
+func searchHighlight() *elastic.Highlight {
+	return elastic.NewHighlight().
+		Fields(
+			elastic.NewHighlighterField("name").NumOfFragments(0),
+			elastic.NewHighlighterField("description").FragmentSize(150).NumOfFragments(3),
+		).
+		PreTags("<em>").
+		PostTags("</em>").
+		Encoder("html")
+}
+
+func highlightsFromHit(hit *elastic.SearchHit) []ProductHighlight {
+	highlights := []ProductHighlight{}
+	for _, field := range []string{"name", "description"} {
+		if fragments, ok := hit.Highlight[field]; ok {
+			highlights = append(highlights, ProductHighlight{Field: field, Fragments: fragments})
+		}
+	}
+	return highlights
+}
+
+// LoadSynonyms reads synonym rules, one per line in the Solr format such as
+// "tee, t-shirt" or "sneakers => shoes". Blank lines and # comments are skipped.
+func LoadSynonyms(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	synonyms := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		synonyms = append(synonyms, line)
+	}
+
+	return synonyms, scanner.Err()
+}
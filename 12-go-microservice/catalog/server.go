@@ -2,13 +2,20 @@ package catalog
 
 import (
 	"context"
+	_ "embed"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 
 	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog/pb"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/rest"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type grpcServer struct {
@@ -29,39 +36,78 @@ func ListenGRPC(s Service, port int) error {
 
 }
 
+//go:embed pb/catalog.swagger.json
+var openAPI []byte
+
+// ListenHTTP serves the REST/JSON API, forwarding each request to the gRPC
+// server listening on grpcPort
+func ListenHTTP(grpcPort int, port int) error {
+	return rest.Listen(port, fmt.Sprintf("localhost:%d", grpcPort), openAPI, pb.RegisterCatalogServiceHandlerFromEndpoint)
+}
+
 func (s *grpcServer) PostProduct(ctx context.Context, r *pb.PostProductRequest) (*pb.PostProductResponse, error) {
-	p, err := s.service.PostProduct(ctx, r.Name, r.Description, r.Price)
+	p, err := s.service.PostProduct(ctx, Product{
+		Name:        r.Name,
+		Description: r.Description,
+		Price:       r.Price,
+		CategoryID:  r.CategoryId,
+		Tags:        r.Tags,
+		Attributes:  attributesFromProto(r.Attributes),
+		Variants:    variantsFromProto(r.Variants),
+		TaxCategory: r.TaxCategory,
+	})
 	if err != nil {
 		log.Println(err)
-		return nil, err
+		return nil, catalogError(err)
 	}
 
 	return &pb.PostProductResponse{
-		Product: &pb.Product{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		},
+		Product: productToProto(*p),
 	}, nil
 
 }
 
+func (s *grpcServer) UpdateProduct(ctx context.Context, r *pb.UpdateProductRequest) (*pb.UpdateProductResponse, error) {
+	p, err := s.service.UpdateProduct(ctx, Product{
+		ID:          r.Id,
+		Name:        r.Name,
+		Description: r.Description,
+		Price:       r.Price,
+		CategoryID:  r.CategoryId,
+		Tags:        r.Tags,
+		Attributes:  attributesFromProto(r.Attributes),
+		Variants:    variantsFromProto(r.Variants),
+		TaxCategory: r.TaxCategory,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, catalogError(err)
+	}
+
+	return &pb.UpdateProductResponse{
+		Product: productToProto(*p),
+	}, nil
+}
+
+func (s *grpcServer) UpdateProductRating(ctx context.Context, r *pb.UpdateProductRatingRequest) (*pb.UpdateProductRatingResponse, error) {
+	if err := s.service.UpdateProductRating(ctx, r.ProductId, r.Rating, r.RatingCount); err != nil {
+		log.Println(err)
+		return nil, catalogError(err)
+	}
+
+	return &pb.UpdateProductRatingResponse{}, nil
+}
+
 func (s *grpcServer) GetProduct(ctx context.Context, r *pb.GetProductRequest) (*pb.GetProductResponse, error) {
 	p, err := s.service.GetProduct(ctx, r.Id)
 
 	if err != nil {
 		log.Println(err)
-		return nil, err
+		return nil, catalogError(err)
 	}
 
 	return &pb.GetProductResponse{
-		Product: &pb.Product{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		},
+		Product: productToProto(*p),
 	}, nil
 }
 
@@ -69,27 +115,23 @@ func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest)
 	var res []Product
 	var err error
 
+	filter := ProductFilter{CategoryID: r.CategoryId, Tags: r.Tags, Sort: ProductSort(r.Sort)}
 	if r.Query != "" {
-		res, err = s.service.SearchProducts(ctx, r.Query, r.Skip, r.Take)
+		res, err = s.service.SearchProducts(ctx, r.Query, filter, r.Skip, r.Take)
 	} else if len(r.Ids) != 0 {
 		res, err = s.service.GetProductsByIDs(ctx, r.Ids)
 	} else {
-		res, err = s.service.GetProducts(ctx, r.Skip, r.Take)
+		res, err = s.service.GetProducts(ctx, filter, r.Skip, r.Take)
 	}
 
 	if err != nil {
 		log.Println(err)
-		return nil, err
+		return nil, catalogError(err)
 	}
 
 	products := []*pb.Product{}
 	for _, p := range res {
-		products = append(products, &pb.Product{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		})
+		products = append(products, productToProto(p))
 	}
 
 	return &pb.GetProductsResponse{
@@ -97,3 +139,238 @@ func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest)
 	}, nil
 
 }
+
+func (s *grpcServer) GetProductsPage(ctx context.Context, r *pb.GetProductsPageRequest) (*pb.GetProductsPageResponse, error) {
+	filter := ProductFilter{CategoryID: r.CategoryId, Tags: r.Tags, Sort: ProductSort(r.Sort)}
+	page, err := s.service.GetProductsPage(ctx, r.Query, filter, r.After, r.First)
+	if err != nil {
+		log.Println(err)
+		return nil, catalogError(err)
+	}
+
+	edges := []*pb.ProductEdge{}
+	for _, e := range page.Edges {
+		edges = append(edges, &pb.ProductEdge{
+			Product: productToProto(e.Product),
+			Cursor:  e.Cursor,
+		})
+	}
+
+	return &pb.GetProductsPageResponse{
+		Edges:       edges,
+		TotalCount:  page.TotalCount,
+		HasNextPage: page.HasNextPage,
+	}, nil
+}
+
+func (s *grpcServer) SuggestProducts(ctx context.Context, r *pb.SuggestProductsRequest) (*pb.SuggestProductsResponse, error) {
+	suggestions, err := s.service.SuggestProducts(ctx, r.Prefix, r.Limit)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	res := &pb.SuggestProductsResponse{Suggestions: []*pb.SuggestProductsResponse_Suggestion{}}
+	for _, suggestion := range suggestions {
+		res.Suggestions = append(res.Suggestions, &pb.SuggestProductsResponse_Suggestion{
+			ProductId: suggestion.ID,
+			Name:      suggestion.Name,
+		})
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) CreateCategory(ctx context.Context, r *pb.CreateCategoryRequest) (*pb.CreateCategoryResponse, error) {
+	c, err := s.service.CreateCategory(ctx, Category{Name: r.Name, ParentID: r.ParentId})
+	if err != nil {
+		log.Println(err)
+		return nil, catalogError(err)
+	}
+
+	return &pb.CreateCategoryResponse{Category: categoryToProto(*c)}, nil
+}
+
+func (s *grpcServer) UpdateCategory(ctx context.Context, r *pb.UpdateCategoryRequest) (*pb.UpdateCategoryResponse, error) {
+	c, err := s.service.UpdateCategory(ctx, Category{ID: r.Id, Name: r.Name, ParentID: r.ParentId})
+	if err != nil {
+		log.Println(err)
+		return nil, catalogError(err)
+	}
+
+	return &pb.UpdateCategoryResponse{Category: categoryToProto(*c)}, nil
+}
+
+func (s *grpcServer) DeleteCategory(ctx context.Context, r *pb.DeleteCategoryRequest) (*pb.DeleteCategoryResponse, error) {
+	if err := s.service.DeleteCategory(ctx, r.Id); err != nil {
+		log.Println(err)
+		return nil, catalogError(err)
+	}
+
+	return &pb.DeleteCategoryResponse{}, nil
+}
+
+func (s *grpcServer) GetCategories(ctx context.Context, r *pb.GetCategoriesRequest) (*pb.GetCategoriesResponse, error) {
+	categories, err := s.service.GetCategories(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	res := &pb.GetCategoriesResponse{Categories: []*pb.Category{}}
+	for _, c := range categories {
+		res.Categories = append(res.Categories, categoryToProto(c))
+	}
+
+	return res, nil
+}
+
+// catalogError maps service errors to gRPC status codes so clients can tell them apart
+func catalogError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidProduct), errors.Is(err, ErrInvalidCategory), errors.Is(err, ErrInvalidSort):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrCategoryInUse):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return err
+	}
+}
+
+func productToProto(p Product) *pb.Product {
+	return &pb.Product{
+		Id:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		Highlights:  highlightsToProto(p.Highlights),
+		CategoryId:  p.CategoryID,
+		Tags:        p.Tags,
+		Attributes:  attributesToProto(p.Attributes),
+		Variants:    variantsToProto(p.Variants),
+		TaxCategory: p.TaxCategory,
+		Rating:      p.Rating,
+		RatingCount: p.RatingCount,
+	}
+}
+
+func categoryToProto(c Category) *pb.Category {
+	return &pb.Category{
+		Id:       c.ID,
+		Name:     c.Name,
+		ParentId: c.ParentID,
+	}
+}
+
+func highlightsToProto(highlights []ProductHighlight) []*pb.ProductHighlight {
+	res := []*pb.ProductHighlight{}
+	for _, h := range highlights {
+		res = append(res, &pb.ProductHighlight{
+			Field:     h.Field,
+			Fragments: h.Fragments,
+		})
+	}
+	return res
+}
+
+func (s *grpcServer) WatchProductEvents(r *pb.WatchProductEventsRequest, stream pb.CatalogService_WatchProductEventsServer) error {
+	events, unsubscribe := s.service.SubscribeProductEvents()
+	defer unsubscribe()
+
+	// Tell the client it is subscribed, so it knows no later event is missed
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "subscriber fell behind")
+			}
+
+			err := stream.Send(&pb.ProductEvent{
+				Type:      pb.ProductEvent_Type(e.Type),
+				ProductId: e.ProductID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *grpcServer) ExportProducts(r *pb.ExportProductsRequest, stream pb.CatalogService_ExportProductsServer) error {
+	return s.service.ExportProducts(stream.Context(), r.Query, func(p Product) error {
+		return stream.Send(productToProto(p))
+	})
+}
+
+// importBatchSize is the number of products sent to Elasticsearch per bulk request
+const importBatchSize = 500
+
+func (s *grpcServer) ImportProducts(stream pb.CatalogService_ImportProductsServer) error {
+	res := &pb.ImportProductsResponse{}
+	batch := []Product{}
+	offset := uint64(0)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		itemErrors, err := s.service.ImportProducts(stream.Context(), batch)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+
+		for i, err := range itemErrors {
+			if err != nil {
+				res.Errors = append(res.Errors, &pb.ImportProductsResponse_ItemError{
+					Index: offset + uint64(i),
+					Id:    batch[i].ID,
+					Error: err.Error(),
+				})
+			} else {
+				res.Imported++
+			}
+		}
+
+		offset += uint64(len(batch))
+		batch = []Product{}
+		return nil
+	}
+
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		p := Product{}
+		if r.Product != nil {
+			p = productFromProto(r.Product)
+		}
+		batch = append(batch, p)
+
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(res)
+}
@@ -2,71 +2,550 @@ package catalog
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/segmentio/ksuid"
 )
 
 type Service interface {
-	PostProduct(ctx context.Context, name, description string, price float64) (*Product, error)
+	PostProduct(ctx context.Context, p Product) (*Product, error)
+	UpdateProduct(ctx context.Context, p Product) (*Product, error)
+	UpdateProductRating(ctx context.Context, id string, rating float64, count uint32) error
 	GetProduct(ctx context.Context, id string) (*Product, error)
-	GetProducts(ctx context.Context, skip uint64, take uint64) ([]Product, error)
+	GetProducts(ctx context.Context, filter ProductFilter, skip uint64, take uint64) ([]Product, error)
 	GetProductsByIDs(ctx context.Context, ids []string) ([]Product, error)
-	SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]Product, error)
+	SearchProducts(ctx context.Context, query string, filter ProductFilter, skip uint64, take uint64) ([]Product, error)
+	SuggestProducts(ctx context.Context, prefix string, limit uint64) ([]ProductSuggestion, error)
+	GetProductsPage(ctx context.Context, query string, filter ProductFilter, after string, first uint64) (*ProductPage, error)
+	CreateCategory(ctx context.Context, c Category) (*Category, error)
+	UpdateCategory(ctx context.Context, c Category) (*Category, error)
+	DeleteCategory(ctx context.Context, id string) error
+	GetCategories(ctx context.Context) ([]Category, error)
+	SubscribeProductEvents() (<-chan ProductEvent, func())
+	ExportProducts(ctx context.Context, query string, handle func(Product) error) error
+	ImportProducts(ctx context.Context, products []Product) ([]error, error)
 }
 
+var (
+	ErrInvalidProduct = errors.New("invalid product")
+	ErrInvalidSort    = errors.New("invalid product sort")
+)
+
+const (
+	maxTags           = 20
+	maxTagLength      = 32
+	maxAttributes     = 20
+	maxAttributeName  = 32
+	maxAttributeValue = 128
+	maxVariants       = 100
+	maxVariantOptions = 5
+	maxSKULength      = 64
+	maxTaxCategory    = 32
+)
+
 type Product struct {
 	ID          string  `json:"id"`
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
+
+	CategoryID string             `json:"categoryId,omitempty"`
+	Tags       []string           `json:"tags,omitempty"`
+	Attributes []ProductAttribute `json:"attributes,omitempty"`
+	Variants   []ProductVariant   `json:"variants,omitempty"`
+
+	// TaxCategory names the rate orders tax the product at, such as "food".
+	// Empty means the default category of the order service.
+	TaxCategory string `json:"taxCategory,omitempty"`
+
+	// Rating is the average rating of the reviews of the product, out of
+	// RatingCount reviews. It is set by the review service, product updates
+	// and imports keep it.
+	Rating      float64 `json:"rating,omitempty"`
+	RatingCount uint32  `json:"ratingCount,omitempty"`
+
+	// Highlights are only set on search results
+	Highlights []ProductHighlight `json:"highlights,omitempty"`
+}
+
+// ProductHighlight holds the fragments of a field that matched a search, with
+// the matched words wrapped in <em> tags and the rest HTML escaped
+type ProductHighlight struct {
+	Field     string   `json:"field"`
+	Fragments []string `json:"fragments"`
+}
+
+// ProductAttribute is a free-form property of a product, such as its brand
+type ProductAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ProductVariant is a purchasable version of a product, such as a size and
+// color. Products with variants are ordered through one of them, at its price.
+type ProductVariant struct {
+	ID      string          `json:"id"`
+	SKU     string          `json:"sku"`
+	Options []VariantOption `json:"options,omitempty"`
+	Price   float64         `json:"price"`
+}
+
+// VariantOption is one of the choices that tells variants apart, such as size M
+type VariantOption struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Variant returns the variant of the product with the given ID
+func (p Product) Variant(id string) (ProductVariant, bool) {
+	for _, v := range p.Variants {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return ProductVariant{}, false
+}
+
+type ProductSuggestion struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ProductEdge pairs a product with the opaque cursor that points right after it
+type ProductEdge struct {
+	Product Product
+	Cursor  string
+}
+
+type ProductPage struct {
+	Edges       []ProductEdge
+	TotalCount  uint64
+	HasNextPage bool
+}
+
+// normalize trims names, lower cases and de-duplicates tags, and checks the
+// product is valid
+func (p *Product) normalize() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || p.Price < 0 {
+		return fmt.Errorf("%w: product needs a name and a non-negative price", ErrInvalidProduct)
+	}
+
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, tag := range p.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidProduct, tag, maxTagLength)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return fmt.Errorf("%w: a product has at most %d tags", ErrInvalidProduct, maxTags)
+	}
+	p.Tags = tags
+
+	p.TaxCategory = strings.TrimSpace(p.TaxCategory)
+	if len(p.TaxCategory) > maxTaxCategory {
+		return fmt.Errorf("%w: tax category is longer than %d characters", ErrInvalidProduct, maxTaxCategory)
+	}
+
+	names := map[string]bool{}
+	for i, a := range p.Attributes {
+		a.Name = strings.TrimSpace(a.Name)
+		a.Value = strings.TrimSpace(a.Value)
+		if a.Name == "" || len(a.Name) > maxAttributeName || len(a.Value) > maxAttributeValue {
+			return fmt.Errorf("%w: attribute names have 1 to %d characters and values at most %d", ErrInvalidProduct, maxAttributeName, maxAttributeValue)
+		}
+		if names[strings.ToLower(a.Name)] {
+			return fmt.Errorf("%w: duplicate attribute %q", ErrInvalidProduct, a.Name)
+		}
+		names[strings.ToLower(a.Name)] = true
+		p.Attributes[i] = a
+	}
+	if len(p.Attributes) > maxAttributes {
+		return fmt.Errorf("%w: a product has at most %d attributes", ErrInvalidProduct, maxAttributes)
+	}
+
+	return p.normalizeVariants()
+}
+
+// normalizeVariants trims SKUs and options, gives new variants an ID, and
+// checks SKUs and option combinations are unique within the product
+func (p *Product) normalizeVariants() error {
+	if len(p.Variants) > maxVariants {
+		return fmt.Errorf("%w: a product has at most %d variants", ErrInvalidProduct, maxVariants)
+	}
+
+	ids := map[string]bool{}
+	skus := map[string]bool{}
+	combinations := map[string]bool{}
+	for i, v := range p.Variants {
+		v.SKU = strings.TrimSpace(v.SKU)
+		if v.SKU == "" || len(v.SKU) > maxSKULength {
+			return fmt.Errorf("%w: variant SKUs have 1 to %d characters", ErrInvalidProduct, maxSKULength)
+		}
+		if skus[strings.ToUpper(v.SKU)] {
+			return fmt.Errorf("%w: duplicate SKU %q", ErrInvalidProduct, v.SKU)
+		}
+		skus[strings.ToUpper(v.SKU)] = true
+
+		if v.Price < 0 {
+			return fmt.Errorf("%w: variant %s has a negative price", ErrInvalidProduct, v.SKU)
+		}
+
+		if v.ID == "" {
+			v.ID = ksuid.New().String()
+		}
+		if ids[v.ID] {
+			return fmt.Errorf("%w: duplicate variant %s", ErrInvalidProduct, v.ID)
+		}
+		ids[v.ID] = true
+
+		if len(v.Options) > maxVariantOptions {
+			return fmt.Errorf("%w: a variant has at most %d options", ErrInvalidProduct, maxVariantOptions)
+		}
+		names := map[string]bool{}
+		combination := []string{}
+		for j, o := range v.Options {
+			o.Name = strings.TrimSpace(o.Name)
+			o.Value = strings.TrimSpace(o.Value)
+			if o.Name == "" || o.Value == "" || len(o.Name) > maxAttributeName || len(o.Value) > maxAttributeValue {
+				return fmt.Errorf("%w: option names have 1 to %d characters and values 1 to %d", ErrInvalidProduct, maxAttributeName, maxAttributeValue)
+			}
+			if names[strings.ToLower(o.Name)] {
+				return fmt.Errorf("%w: variant %s repeats option %q", ErrInvalidProduct, v.SKU, o.Name)
+			}
+			names[strings.ToLower(o.Name)] = true
+			combination = append(combination, strings.ToLower(o.Name+"="+o.Value))
+			v.Options[j] = o
+		}
+
+		sort.Strings(combination)
+		key := strings.Join(combination, "\x00")
+		if len(v.Options) > 0 && combinations[key] {
+			return fmt.Errorf("%w: variant %s has the same options as another variant", ErrInvalidProduct, v.SKU)
+		}
+		combinations[key] = true
+
+		p.Variants[i] = v
+	}
+
+	return nil
+}
+
+// normalizeTags lower cases tags the way products store them
+func normalizeTags(tags []string) []string {
+	res := []string{}
+	for _, tag := range tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			res = append(res, tag)
+		}
+	}
+	return res
 }
 
 type catalogService struct {
 	repository Repository
+	events     *eventHub
 }
 
 func NewService(r Repository) Service {
-	return &catalogService{r}
+	return &catalogService{r, newEventHub()}
 }
 
-func (s *catalogService) PostProduct(
-	ctx context.Context,
-	name, description string,
-	price float64,
-) (*Product, error) {
-	p := &Product{
-		ID:          ksuid.New().String(),
-		Name:        name,
-		Description: description,
-		Price:       price,
+func (s *catalogService) PostProduct(ctx context.Context, p Product) (*Product, error) {
+	p.ID = ksuid.New().String()
+	if err := s.validateProduct(ctx, &p); err != nil {
+		return nil, err
 	}
 
-	if err := s.repository.PutProduct(ctx, *p); err != nil {
+	if err := s.repository.PutProduct(ctx, p); err != nil {
 		return nil, err
 	}
-	return p, nil
+
+	s.events.publish(ProductEvent{Type: ProductCreated, ProductID: p.ID})
+	return &p, nil
+}
+
+func (s *catalogService) UpdateProduct(ctx context.Context, p Product) (*Product, error) {
+	existing, err := s.repository.GetProductByID(ctx, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateProduct(ctx, &p); err != nil {
+		return nil, err
+	}
+	p.Rating, p.RatingCount = existing.Rating, existing.RatingCount
+
+	if err := s.repository.PutProduct(ctx, p); err != nil {
+		return nil, err
+	}
+
+	s.events.publish(ProductEvent{Type: ProductUpdated, ProductID: p.ID})
+	return &p, nil
+}
+
+// UpdateProductRating sets the average rating of the product and the number
+// of reviews it was computed from. Reviews are never removed, so a rating from
+// fewer reviews than the stored one is stale and left out.
+func (s *catalogService) UpdateProductRating(ctx context.Context, id string, rating float64, count uint32) error {
+	if rating < 0 || rating > 5 || (count == 0 && rating != 0) {
+		return fmt.Errorf("%w: rating must be between 0 and 5, and 0 without reviews", ErrInvalidProduct)
+	}
+
+	return s.repository.PutProductRating(ctx, id, rating, count)
+}
+
+// validateProduct normalizes p and checks its category exists
+func (s *catalogService) validateProduct(ctx context.Context, p *Product) error {
+	if err := p.normalize(); err != nil {
+		return err
+	}
+	if p.CategoryID == "" {
+		return nil
+	}
+
+	categories, err := s.repository.ListCategories(ctx)
+	if err != nil {
+		return err
+	}
+	return checkCategory(p.CategoryID, categories)
+}
+
+func checkSort(sort ProductSort) error {
+	switch sort {
+	case SortDefault, SortRating:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidSort, sort)
+	}
+}
+
+func checkCategory(id string, categories []Category) error {
+	for _, c := range categories {
+		if c.ID == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: category %s not found", ErrInvalidProduct, id)
 }
 
 func (s *catalogService) GetProduct(ctx context.Context, id string) (*Product, error) {
 	return s.repository.GetProductByID(ctx, id)
 }
 
-func (s *catalogService) GetProducts(ctx context.Context, skip uint64, take uint64) ([]Product, error) {
+func (s *catalogService) GetProducts(ctx context.Context, filter ProductFilter, skip uint64, take uint64) ([]Product, error) {
+	if err := checkSort(filter.Sort); err != nil {
+		return nil, err
+	}
 	if take > 100 || (skip == 0 && take == 0) {
 		take = 100
 	}
 
-	return s.repository.ListProducts(ctx, skip, take)
+	return s.repository.ListProducts(ctx, filter, skip, take)
 }
 
 func (s *catalogService) GetProductsByIDs(ctx context.Context, ids []string) ([]Product, error) {
 	return s.repository.ListProductsWithIDs(ctx, ids)
 }
 
-func (s *catalogService) SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]Product, error) {
+func (s *catalogService) SearchProducts(ctx context.Context, query string, filter ProductFilter, skip uint64, take uint64) ([]Product, error) {
+	if err := checkSort(filter.Sort); err != nil {
+		return nil, err
+	}
 	if take > 100 || (skip == 0 && take == 0) {
 		take = 100
 	}
 
-	return s.repository.SearchProducts(ctx, query, skip, take)
+	return s.repository.SearchProducts(ctx, query, filter, skip, take)
+}
+
+func (s *catalogService) SuggestProducts(ctx context.Context, prefix string, limit uint64) ([]ProductSuggestion, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return []ProductSuggestion{}, nil
+	}
+	if limit == 0 {
+		limit = 10
+	}
+	if limit > 20 {
+		limit = 20
+	}
+
+	return s.repository.SuggestProducts(ctx, prefix, limit)
+}
+
+func (s *catalogService) GetProductsPage(ctx context.Context, query string, filter ProductFilter, after string, first uint64) (*ProductPage, error) {
+	if err := checkSort(filter.Sort); err != nil {
+		return nil, err
+	}
+	if first == 0 || first > 100 {
+		first = 100
+	}
+
+	return s.repository.ListProductsPage(ctx, query, filter, after, first)
+}
+
+func (s *catalogService) CreateCategory(ctx context.Context, c Category) (*Category, error) {
+	categories, err := s.repository.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(categories) >= maxCategories {
+		return nil, fmt.Errorf("%w: there can be at most %d categories", ErrInvalidCategory, maxCategories)
+	}
+
+	c.ID = ksuid.New().String()
+	c.Name = strings.TrimSpace(c.Name)
+	if err := validateCategory(c, categories); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.PutCategory(ctx, c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UpdateCategory renames a category or moves it, with its subcategories and
+// products, below another parent
+func (s *catalogService) UpdateCategory(ctx context.Context, c Category) (*Category, error) {
+	categories, err := s.repository.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if checkCategory(c.ID, categories) != nil {
+		return nil, ErrNotFound
+	}
+
+	c.Name = strings.TrimSpace(c.Name)
+	if err := validateCategory(c, categories); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.PutCategory(ctx, c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteCategory only deletes empty categories, so no product is left
+// pointing at a missing one
+func (s *catalogService) DeleteCategory(ctx context.Context, id string) error {
+	categories, err := s.repository.ListCategories(ctx)
+	if err != nil {
+		return err
+	}
+	if checkCategory(id, categories) != nil {
+		return ErrNotFound
+	}
+	if len(descendantIDs(categories, id)) > 1 {
+		return ErrCategoryInUse
+	}
+
+	count, err := s.repository.CountProducts(ctx, ProductFilter{CategoryID: id})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCategoryInUse
+	}
+
+	return s.repository.DeleteCategory(ctx, id)
+}
+
+func (s *catalogService) GetCategories(ctx context.Context) ([]Category, error) {
+	return s.repository.ListCategories(ctx)
+}
+
+func (s *catalogService) SubscribeProductEvents() (<-chan ProductEvent, func()) {
+	return s.events.subscribe()
+}
+
+func (s *catalogService) ExportProducts(ctx context.Context, query string, handle func(Product) error) error {
+	return s.repository.ScrollProducts(ctx, query, handle)
+}
+
+// ImportProducts creates or replaces products in bulk. Products without an ID
+// get a new one. The returned slice holds the error of each product, if any.
+func (s *catalogService) ImportProducts(ctx context.Context, products []Product) ([]error, error) {
+	itemErrors := make([]error, len(products))
+
+	categories, err := s.repository.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := []Product{}
+	positions := []int{}
+	replaced := []string{}
+	for i, p := range products {
+		if err := p.normalize(); err != nil {
+			itemErrors[i] = err
+			continue
+		}
+		if p.CategoryID != "" {
+			if err := checkCategory(p.CategoryID, categories); err != nil {
+				itemErrors[i] = err
+				continue
+			}
+		}
+		if p.ID == "" {
+			p.Rating, p.RatingCount = 0, 0
+			p.ID = ksuid.New().String()
+			products[i].ID = p.ID
+		} else {
+			replaced = append(replaced, p.ID)
+		}
+		valid = append(valid, p)
+		positions = append(positions, i)
+	}
+
+	if len(valid) == 0 {
+		return itemErrors, nil
+	}
+
+	// Ratings come from reviews, so replaced products keep theirs. Products
+	// missing from the index, such as when it is recreated from an export,
+	// take the rating of the file.
+	if len(replaced) > 0 {
+		existing, err := s.repository.ListProductsWithIDs(ctx, replaced)
+		if err != nil {
+			return nil, err
+		}
+		ratings := map[string]Product{}
+		for _, p := range existing {
+			ratings[p.ID] = p
+		}
+		for i := range valid {
+			if r, ok := ratings[valid[i].ID]; ok {
+				valid[i].Rating, valid[i].RatingCount = r.Rating, r.RatingCount
+			}
+		}
+	}
+
+	bulkErrors, err := s.repository.BulkPutProducts(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, err := range bulkErrors {
+		i := positions[j]
+		if err != nil {
+			itemErrors[i] = err
+			continue
+		}
+		// Imports may overwrite existing products, so consumers are told it was an update
+		s.events.publish(ProductEvent{Type: ProductUpdated, ProductID: products[i].ID})
+	}
+
+	return itemErrors, nil
 }
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/account"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+)
+
+const usage = `Usage: shopctl [flags] <resource> <command> [flags] [args]
+
+Commands:
+  accounts create -name NAME -email EMAIL [-display-name NAME]
+  accounts list [-first N] [-after CURSOR]
+  accounts get ID
+  products create -name NAME -price PRICE [-description TEXT] [-category ID] [-tag TAG...]
+  products list [-query TEXT] [-category ID] [-tag TAG...] [-sort rating] [-first N] [-after CURSOR]
+  products get ID
+  orders place -account ID -product ID[/VARIANT]:QUANTITY... [-coupon CODE]
+  orders list -account ID
+  orders get ID
+  orders tail [-account ID]
+
+Service addresses default to ACCOUNT_SERVICE_URL, CATALOG_SERVICE_URL and
+ORDER_SERVICE_URL, and RPC_* variables tune timeouts and retries as they do
+for the services. Variables may also come from the file named by CONFIG_FILE.
+
+Flags:
+`
+
+type Config struct {
+	AccountURL string `envconfig:"ACCOUNT_SERVICE_URL" default:"localhost:8080"`
+	CatalogURL string `envconfig:"CATALOG_SERVICE_URL" default:"localhost:8080"`
+	OrderURL   string `envconfig:"ORDER_SERVICE_URL" default:"localhost:8080"`
+
+	RPC resilience.Config `envconfig:"RPC"`
+}
+
+type command func(ctx context.Context, cfg Config, out *printer, args []string) error
+
+var commands = map[string]map[string]command{
+	"accounts": {
+		"create": createAccount,
+		"list":   listAccounts,
+		"get":    getAccount,
+	},
+	"products": {
+		"create": createProduct,
+		"list":   listProducts,
+		"get":    getProduct,
+	},
+	"orders": {
+		"place": placeOrder,
+		"list":  listOrders,
+		"get":   getOrder,
+		"tail":  tailOrders,
+	},
+}
+
+func main() {
+	log.SetFlags(0)
+
+	var cfg Config
+	if err := bootstrap.Load(&cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.StringVar(&cfg.AccountURL, "account-addr", cfg.AccountURL, "account service address")
+	flag.StringVar(&cfg.CatalogURL, "catalog-addr", cfg.CatalogURL, "catalog service address")
+	flag.StringVar(&cfg.OrderURL, "order-addr", cfg.OrderURL, "order service address")
+	format := flag.String("o", "table", "output format, table or json")
+	flag.Parse()
+
+	if flag.NArg() < 2 || (*format != "table" && *format != "json") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	run, ok := commands[flag.Arg(0)][flag.Arg(1)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Ctrl-C stops tailing cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	out := newPrinter(os.Stdout, *format)
+	if err := run(ctx, cfg, out, flag.Args()[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func createAccount(ctx context.Context, cfg Config, out *printer, args []string) error {
+	fs := flag.NewFlagSet("accounts create", flag.ExitOnError)
+	name := fs.String("name", "", "account name")
+	email := fs.String("email", "", "account email")
+	displayName := fs.String("display-name", "", "display name, the name when empty")
+	fs.Parse(args)
+
+	client, err := account.NewClient(cfg.AccountURL, cfg.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	a, err := client.PostAccount(ctx, *name, *email, *displayName)
+	if err != nil {
+		return err
+	}
+
+	return out.account(*a)
+}
+
+func listAccounts(ctx context.Context, cfg Config, out *printer, args []string) error {
+	fs := flag.NewFlagSet("accounts list", flag.ExitOnError)
+	first := fs.Uint64("first", 20, "number of accounts")
+	after := fs.String("after", "", "cursor of the previous page")
+	fs.Parse(args)
+
+	client, err := account.NewClient(cfg.AccountURL, cfg.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	page, err := client.GetAccountsPage(ctx, *after, *first)
+	if err != nil {
+		return err
+	}
+
+	return out.accounts(page)
+}
+
+func getAccount(ctx context.Context, cfg Config, out *printer, args []string) error {
+	id, err := singleArg("accounts get", args)
+	if err != nil {
+		return err
+	}
+
+	client, err := account.NewClient(cfg.AccountURL, cfg.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	a, err := client.GetAccount(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return out.account(*a)
+}
+
+func createProduct(ctx context.Context, cfg Config, out *printer, args []string) error {
+	var tags tagsFlag
+	fs := flag.NewFlagSet("products create", flag.ExitOnError)
+	name := fs.String("name", "", "product name")
+	description := fs.String("description", "", "product description")
+	price := fs.Float64("price", 0, "product price")
+	category := fs.String("category", "", "category ID")
+	taxCategory := fs.String("tax-category", "", "tax category, such as food")
+	fs.Var(&tags, "tag", "product tag, repeat for several tags")
+	fs.Parse(args)
+
+	client, err := catalog.NewClient(cfg.CatalogURL, cfg.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	p, err := client.PostProduct(ctx, catalog.Product{
+		Name:        *name,
+		Description: *description,
+		Price:       *price,
+		CategoryID:  *category,
+		Tags:        tags,
+		TaxCategory: *taxCategory,
+	})
+	if err != nil {
+		return err
+	}
+
+	return out.products([]catalog.Product{*p}, "")
+}
+
+func listProducts(ctx context.Context, cfg Config, out *printer, args []string) error {
+	var tags tagsFlag
+	fs := flag.NewFlagSet("products list", flag.ExitOnError)
+	query := fs.String("query", "", "only list products matching this search")
+	category := fs.String("category", "", "only list products in this category or below it")
+	fs.Var(&tags, "tag", "only list products with this tag, repeat to require several")
+	sort := fs.String("sort", "", "rating to list the best rated products first")
+	first := fs.Uint64("first", 20, "number of products")
+	after := fs.String("after", "", "cursor of the previous page")
+	fs.Parse(args)
+
+	client, err := catalog.NewClient(cfg.CatalogURL, cfg.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	page, err := client.GetProductsPage(ctx, *query, catalog.ProductFilter{CategoryID: *category, Tags: tags, Sort: catalog.ProductSort(*sort)}, *after, *first)
+	if err != nil {
+		return err
+	}
+
+	products := []catalog.Product{}
+	next := ""
+	for _, e := range page.Edges {
+		products = append(products, e.Product)
+		next = e.Cursor
+	}
+	if !page.HasNextPage {
+		next = ""
+	}
+
+	return out.products(products, next)
+}
+
+func getProduct(ctx context.Context, cfg Config, out *printer, args []string) error {
+	id, err := singleArg("products get", args)
+	if err != nil {
+		return err
+	}
+
+	client, err := catalog.NewClient(cfg.CatalogURL, cfg.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	p, err := client.GetProduct(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return out.products([]catalog.Product{*p}, "")
+}
+
+// tagsFlag collects repeated -tag flags
+type tagsFlag []string
+
+func (f *tagsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *tagsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// productsFlag collects repeated -product ID[/VARIANT]:QUANTITY flags
+type productsFlag []order.OrderedProduct
+
+func (f *productsFlag) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *productsFlag) Set(value string) error {
+	id, quantity, found := strings.Cut(value, ":")
+	id, variantID, _ := strings.Cut(id, "/")
+	p := order.OrderedProduct{ID: id, VariantID: variantID, Quantity: 1}
+	if found {
+		q, err := strconv.ParseUint(quantity, 10, 32)
+		if err != nil || q == 0 {
+			return fmt.Errorf("invalid quantity %q", quantity)
+		}
+		p.Quantity = uint32(q)
+	}
+	*f = append(*f, p)
+	return nil
+}
+
+func placeOrder(ctx context.Context, cfg Config, out *printer, args []string) error {
+	var products productsFlag
+	fs := flag.NewFlagSet("orders place", flag.ExitOnError)
+	accountID := fs.String("account", "", "account placing the order")
+	coupon := fs.String("coupon", "", "coupon code")
+	fs.Var(&products, "product", "product to order as ID:QUANTITY, or ID/VARIANT:QUANTITY for a variant, repeat for several products")
+	fs.Parse(args)
+
+	if *accountID == "" || len(products) == 0 {
+		return errors.New("orders place needs -account and at least one -product")
+	}
+
+	client, err := order.NewClient(cfg.OrderURL, cfg.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	o, err := client.PostOrder(ctx, *accountID, products, nil, *coupon, "")
+	if err != nil {
+		return err
+	}
+
+	return out.order(*o)
+}
+
+func listOrders(ctx context.Context, cfg Config, out *printer, args []string) error {
+	fs := flag.NewFlagSet("orders list", flag.ExitOnError)
+	accountID := fs.String("account", "", "account whose orders are listed")
+	fs.Parse(args)
+
+	if *accountID == "" {
+		return errors.New("orders list needs -account")
+	}
+
+	client, err := order.NewClient(cfg.OrderURL, cfg.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	orders, err := client.GetOrdersForAccount(ctx, *accountID)
+	if err != nil {
+		return err
+	}
+
+	return out.orders(orders)
+}
+
+func getOrder(ctx context.Context, cfg Config, out *printer, args []string) error {
+	id, err := singleArg("orders get", args)
+	if err != nil {
+		return err
+	}
+
+	client, err := order.NewClient(cfg.OrderURL, cfg.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	o, err := client.GetOrder(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return out.order(*o)
+}
+
+func tailOrders(ctx context.Context, cfg Config, out *printer, args []string) error {
+	fs := flag.NewFlagSet("orders tail", flag.ExitOnError)
+	accountID := fs.String("account", "", "only show events of this account")
+	fs.Parse(args)
+
+	client, err := order.NewClient(cfg.OrderURL, cfg.RPC)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// A failed write, such as a closed pipe, ends the stream
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var printErr error
+	err = client.WatchOrderEvents(
+		ctx,
+		*accountID,
+		func() {
+			log.Println("Watching order events, press Ctrl-C to stop")
+		},
+		func(e order.OrderEvent) {
+			if printErr = out.event(e); printErr != nil {
+				cancel()
+			}
+		},
+	)
+	if printErr != nil {
+		return printErr
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func singleArg(command string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("%s takes exactly one ID", command)
+	}
+	return args[0], nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/account"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+)
+
+// printer writes results as aligned tables, or as JSON for scripts. The
+// cursor of the next page goes to stderr so stdout stays parseable.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func newPrinter(w io.Writer, format string) *printer {
+	return &printer{w: w, json: format == "json"}
+}
+
+func (p *printer) encode(v interface{}) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// table writes a header and rows of tab separated cells
+func (p *printer) table(header string, rows []string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, header)
+	for _, row := range rows {
+		fmt.Fprintln(tw, row)
+	}
+	return tw.Flush()
+}
+
+func nextPage(cursor string) {
+	if cursor != "" {
+		log.Printf("Next page: -after %s", cursor)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
+
+func (p *printer) account(a account.Account) error {
+	if p.json {
+		return p.encode(a)
+	}
+
+	err := p.table("ID\tNAME\tEMAIL\tDISPLAY NAME\tCREATED", []string{
+		fmt.Sprintf("%s\t%s\t%s\t%s\t%s", a.ID, a.Name, a.Email, a.DisplayName, formatTime(a.CreatedAt)),
+	})
+	if err != nil || len(a.Addresses) == 0 {
+		return err
+	}
+
+	rows := []string{}
+	for _, address := range a.Addresses {
+		def := ""
+		if address.IsDefault {
+			def = "yes"
+		}
+		rows = append(rows, fmt.Sprintf(
+			"%s\t%s\t%s\t%s, %s %s %s\t%s",
+			address.ID, address.Type, address.Name, address.Line1, address.PostalCode, address.City, address.Country, def,
+		))
+	}
+	fmt.Fprintln(p.w)
+	return p.table("ADDRESS\tTYPE\tNAME\tLOCATION\tDEFAULT", rows)
+}
+
+func (p *printer) accounts(page *account.AccountPage) error {
+	next := ""
+	if page.HasNextPage && len(page.Accounts) > 0 {
+		next = page.Accounts[len(page.Accounts)-1].ID
+	}
+	defer nextPage(next)
+
+	if p.json {
+		return p.encode(page.Accounts)
+	}
+
+	rows := []string{}
+	for _, a := range page.Accounts {
+		rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s\t%s", a.ID, a.Name, a.Email, a.DisplayName, formatTime(a.CreatedAt)))
+	}
+	return p.table("ID\tNAME\tEMAIL\tDISPLAY NAME\tCREATED", rows)
+}
+
+func (p *printer) products(products []catalog.Product, next string) error {
+	defer nextPage(next)
+
+	if p.json {
+		if len(products) == 1 && next == "" {
+			return p.encode(products[0])
+		}
+		return p.encode(products)
+	}
+
+	rows := []string{}
+	for _, product := range products {
+		rating := "-"
+		if product.RatingCount > 0 {
+			rating = fmt.Sprintf("%.1f (%d)", product.Rating, product.RatingCount)
+		}
+		rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s\t%s", product.ID, product.Name, formatPrice(product.Price), rating, product.Description))
+	}
+	return p.table("ID\tNAME\tPRICE\tRATING\tDESCRIPTION", rows)
+}
+
+func orderRow(o order.Order) string {
+	items := uint32(0)
+	for _, product := range o.Products {
+		items += product.Quantity
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%s", o.ID, o.AccountID, formatTime(o.CreatedAt), o.PaymentStatus, items, formatPrice(o.TotalPrice))
+}
+
+const orderHeader = "ID\tACCOUNT\tCREATED\tPAYMENT\tITEMS\tTOTAL"
+
+func (p *printer) order(o order.Order) error {
+	if p.json {
+		return p.encode(o)
+	}
+
+	if err := p.table(orderHeader, []string{orderRow(o)}); err != nil {
+		return err
+	}
+
+	rows := []string{}
+	for _, product := range o.Products {
+		rows = append(rows, fmt.Sprintf(
+			"%s\t%s\t%s\t%d\t%s\t%s",
+			product.ID, product.SKU, product.Name, product.Quantity, formatPrice(product.Price), formatPrice(product.Price*float64(product.Quantity)),
+		))
+	}
+	fmt.Fprintln(p.w)
+	if err := p.table("PRODUCT\tSKU\tNAME\tQUANTITY\tPRICE\tAMOUNT", rows); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(p.w)
+	return p.table("SUBTOTAL\tDISCOUNTS\tTAX\tTOTAL", []string{
+		fmt.Sprintf("%s\t%d\t%s\t%s", formatPrice(o.Subtotal), len(o.Discounts), formatPrice(o.TaxTotal), formatPrice(o.TotalPrice)),
+	})
+}
+
+func (p *printer) orders(orders []order.Order) error {
+	if p.json {
+		return p.encode(orders)
+	}
+
+	rows := []string{}
+	for _, o := range orders {
+		rows = append(rows, orderRow(o))
+	}
+	return p.table(orderHeader, rows)
+}
+
+// event prints one line per event, tails are read as they come
+func (p *printer) event(e order.OrderEvent) error {
+	if p.json {
+		return json.NewEncoder(p.w).Encode(struct {
+			Type string `json:"type"`
+			order.OrderEvent
+		}{e.Type.String(), e})
+	}
+
+	detail := fmt.Sprintf("payment %s, total %s", e.PaymentStatus, formatPrice(e.TotalPrice))
+	if e.ShipmentID != "" {
+		detail = fmt.Sprintf("shipment %s %s", e.ShipmentID, e.ShipmentStatus)
+	}
+	_, err := fmt.Fprintf(p.w, "%s  %-22s  %s  %s  %s\n", formatTime(e.OccurredAt), e.Type, e.OrderID, e.AccountID, detail)
+	return err
+}
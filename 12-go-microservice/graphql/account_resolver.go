@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"log"
-	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/account"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
 )
 
 type accountResolver struct {
@@ -11,9 +13,6 @@ type accountResolver struct {
 }
 
 func (r *accountResolver) Orders(ctx context.Context, obj *Account) ([]*Order, error) {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
-
 	// Get Orders for account
 	orderList, err := r.server.orderClient.GetOrdersForAccount(ctx, obj.ID)
 	if err != nil {
@@ -23,23 +22,207 @@ func (r *accountResolver) Orders(ctx context.Context, obj *Account) ([]*Order, e
 
 	var orders []*Order
 	for _, o := range orderList {
-		var products []*OrderedProduct
-		for _, p := range o.Products {
-			products = append(products, &OrderedProduct{
-				ID:          p.ID,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-				Quantity:    int(p.Quantity),
-			})
+		orders = append(orders, toGraphQLOrder(o))
+	}
+
+	return orders, nil
+}
+
+func (r *accountResolver) OrdersConnection(ctx context.Context, obj *Account, first *int, after *string) (*OrderConnection, error) {
+	cursor, firstValue, err := connectionArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := r.server.orderClient.GetOrdersForAccountPage(ctx, obj.ID, cursor, firstValue)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	connection := &OrderConnection{
+		Edges:      []*OrderEdge{},
+		TotalCount: int(page.TotalCount),
+	}
+	cursors := []string{}
+	for _, o := range page.Orders {
+		c := encodeCursor(o.ID)
+		cursors = append(cursors, c)
+		connection.Edges = append(connection.Edges, &OrderEdge{
+			Cursor: c,
+			Node:   toGraphQLOrder(o),
+		})
+	}
+	connection.PageInfo = newPageInfo(cursors, cursor, page.HasNextPage)
+
+	return connection, nil
+}
+
+func (r *accountResolver) Subscriptions(ctx context.Context, obj *Account) ([]*OrderSubscription, error) {
+	subscriptionList, err := r.server.orderClient.GetSubscriptionsForAccount(ctx, obj.ID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	subscriptions := []*OrderSubscription{}
+	for _, s := range subscriptionList {
+		subscriptions = append(subscriptions, toGraphQLSubscription(s))
+	}
+
+	return subscriptions, nil
+}
+
+func toGraphQLAccount(a account.Account) *Account {
+	addresses := []*AccountAddress{}
+	for _, address := range a.Addresses {
+		addresses = append(addresses, toGraphQLAccountAddress(address))
+	}
+	return &Account{
+		ID:          a.ID,
+		Name:        a.Name,
+		Email:       a.Email,
+		DisplayName: a.DisplayName,
+		Addresses:   addresses,
+		CreatedAt:   a.CreatedAt,
+		UpdatedAt:   a.UpdatedAt,
+	}
+}
+
+func toGraphQLAccountAddress(a account.Address) *AccountAddress {
+	res := &AccountAddress{
+		ID:         a.ID,
+		Type:       string(a.Type),
+		Name:       a.Name,
+		Line1:      a.Line1,
+		City:       a.City,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+		IsDefault:  a.IsDefault,
+		CreatedAt:  a.CreatedAt,
+		UpdatedAt:  a.UpdatedAt,
+	}
+	if a.Line2 != "" {
+		res.Line2 = &a.Line2
+	}
+	if a.State != "" {
+		res.State = &a.State
+	}
+	return res
+}
+
+func toGraphQLOrder(o order.Order) *Order {
+	var products []*OrderedProduct
+	for _, p := range o.Products {
+		product := &OrderedProduct{
+			ID:          p.ID,
+			Options:     []*VariantOption{},
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Quantity:    int(p.Quantity),
+		}
+		if p.VariantID != "" {
+			variantID, sku := p.VariantID, p.SKU
+			product.VariantID = &variantID
+			product.Sku = &sku
+		}
+		for _, o := range p.Options {
+			product.Options = append(product.Options, &VariantOption{Name: o.Name, Value: o.Value})
+		}
+		products = append(products, product)
+	}
+	discounts := []*Discount{}
+	for _, d := range o.Discounts {
+		discount := &Discount{
+			PromotionID: d.PromotionID,
+			ProductID:   d.ProductID,
+			Description: d.Description,
+			Amount:      d.Amount,
+		}
+		if d.Code != "" {
+			code := d.Code
+			discount.Code = &code
 		}
-		orders = append(orders, &Order{
-			ID:         o.ID,
-			CreatedAt:  o.CreatedAt,
-			TotalPrice: o.TotalPrice,
-			Products:   products,
+		discounts = append(discounts, discount)
+	}
+	taxes := []*TaxLine{}
+	for _, t := range o.Taxes {
+		taxes = append(taxes, &TaxLine{
+			ProductID:     t.ProductID,
+			Category:      t.Category,
+			Rate:          t.Rate,
+			TaxableAmount: t.TaxableAmount,
+			Amount:        t.Amount,
 		})
 	}
+	var taxJurisdiction *string
+	if o.TaxJurisdiction != "" {
+		taxJurisdiction = &o.TaxJurisdiction
+	}
+	shipments := []*Shipment{}
+	for _, s := range o.Shipments {
+		shipments = append(shipments, toGraphQLShipment(s))
+	}
+	return &Order{
+		ID:              o.ID,
+		CreatedAt:       o.CreatedAt,
+		Subtotal:        o.Subtotal,
+		TaxTotal:        o.TaxTotal,
+		TaxInclusive:    o.TaxInclusive,
+		TaxJurisdiction: taxJurisdiction,
+		TotalPrice:      o.TotalPrice,
+		PaymentStatus:   string(o.PaymentStatus),
+		ShippingAddress: toGraphQLAddress(o.ShippingAddress),
+		Products:        products,
+		Discounts:       discounts,
+		Taxes:           taxes,
+		Shipments:       shipments,
+	}
+}
 
-	return orders, nil
+func toGraphQLAddress(a *order.Address) *Address {
+	if a == nil {
+		return nil
+	}
+
+	res := &Address{
+		Name:       a.Name,
+		Line1:      a.Line1,
+		City:       a.City,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+	if a.Line2 != "" {
+		res.Line2 = &a.Line2
+	}
+	if a.State != "" {
+		res.State = &a.State
+	}
+	return res
+}
+
+func toGraphQLShipment(s order.Shipment) *Shipment {
+	items := []*ShipmentItem{}
+	for _, item := range s.Items {
+		shipmentItem := &ShipmentItem{
+			ProductID: item.ProductID,
+			Quantity:  int(item.Quantity),
+		}
+		if item.VariantID != "" {
+			variantID := item.VariantID
+			shipmentItem.VariantID = &variantID
+		}
+		items = append(items, shipmentItem)
+	}
+	return &Shipment{
+		ID:             s.ID,
+		Carrier:        s.Carrier,
+		TrackingNumber: s.TrackingNumber,
+		Status:         string(s.Status),
+		CreatedAt:      s.CreatedAt,
+		ShippedAt:      s.ShippedAt,
+		DeliveredAt:    s.DeliveredAt,
+		Items:          items,
+	}
 }
@@ -0,0 +1,115 @@
+package main
+
+// Cost model used by the complexity limit. Paginated lists are weighted by
+// the number of items they can return, so nesting large pages multiplies
+// quickly. Lists without pagination use a fixed estimate.
+const (
+	defaultListSize = 100
+	maxListSize     = 100
+	nestedListSize  = 10
+)
+
+func newComplexityRoot() ComplexityRoot {
+	c := ComplexityRoot{}
+
+	c.Query.Accounts = func(childComplexity int, pagination *PaginationInput, id *string) int {
+		if id != nil {
+			return 1 + childComplexity
+		}
+		return 1 + listSize(pagination)*childComplexity
+	}
+
+	c.Query.Products = func(childComplexity int, pagination *PaginationInput, query *string, id *string, category *string, tags []string, sort *string) int {
+		if id != nil {
+			return 1 + childComplexity
+		}
+		return 1 + listSize(pagination)*childComplexity
+	}
+
+	c.Query.AccountsConnection = func(childComplexity int, first *int, after *string) int {
+		return 1 + connectionSize(first)*childComplexity
+	}
+
+	c.Query.ProductsConnection = func(childComplexity int, first *int, after *string, query *string, category *string, tags []string, sort *string) int {
+		return 1 + connectionSize(first)*childComplexity
+	}
+
+	// The catalog returns at most 20 suggestions
+	c.Query.ProductSuggestions = func(childComplexity int, prefix string, limit *int) int {
+		return 1 + min(connectionSize(limit), 20)*childComplexity
+	}
+
+	c.Query.Categories = func(childComplexity int) int {
+		return 1 + defaultListSize*childComplexity
+	}
+
+	c.Category.Children = func(childComplexity int) int {
+		return 1 + nestedListSize*childComplexity
+	}
+
+	c.Product.Reviews = func(childComplexity int, pagination *PaginationInput) int {
+		return 1 + listSize(pagination)*childComplexity
+	}
+
+	// The order service returns at most 20 recommendations
+	c.Product.Recommended = func(childComplexity int, limit *int) int {
+		return 1 + min(connectionSize(limit), 20)*childComplexity
+	}
+
+	c.Webhook.Deliveries = func(childComplexity int, pagination *PaginationInput) int {
+		return 1 + listSize(pagination)*childComplexity
+	}
+
+	c.Account.OrdersConnection = func(childComplexity int, first *int, after *string) int {
+		return 1 + connectionSize(first)*childComplexity
+	}
+
+	c.Account.Orders = func(childComplexity int) int {
+		return 1 + nestedListSize*childComplexity
+	}
+
+	c.Account.Subscriptions = func(childComplexity int) int {
+		return 1 + nestedListSize*childComplexity
+	}
+
+	c.OrderSubscription.Runs = func(childComplexity int) int {
+		return 1 + nestedListSize*childComplexity
+	}
+
+	c.Order.Products = func(childComplexity int) int {
+		return 1 + nestedListSize*childComplexity
+	}
+
+	c.Order.Shipments = func(childComplexity int) int {
+		return 1 + nestedListSize*childComplexity
+	}
+
+	c.SalesReport.TopProducts = func(childComplexity int, orderBy *string, limit *int) int {
+		return 1 + connectionSize(limit)*childComplexity
+	}
+
+	c.SalesReport.TopAccounts = func(childComplexity int, accountIds []string, limit *int) int {
+		return 1 + connectionSize(limit)*childComplexity
+	}
+
+	return c
+}
+
+// connectionSize is listSize for relay style arguments
+func connectionSize(first *int) int {
+	return listSize(&PaginationInput{Take: first})
+}
+
+// listSize mirrors how the services clamp take, so the estimate matches the
+// number of items a backend can actually return.
+func listSize(pagination *PaginationInput) int {
+	if pagination == nil || pagination.Take == nil {
+		return defaultListSize
+	}
+
+	take := *pagination.Take
+	if take <= 0 || take > maxListSize {
+		return maxListSize
+	}
+	return take
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Cursors handed out by the services are wrapped so clients treat them as opaque
+
+func encodeCursor(cursor string) string {
+	return base64.URLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodeCursor(cursor *string) (string, error) {
+	if cursor == nil || *cursor == "" {
+		return "", nil
+	}
+
+	b, err := base64.URLEncoding.DecodeString(*cursor)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return string(b), nil
+}
+
+// connectionArgs converts relay arguments to what the services expect
+func connectionArgs(first *int, after *string) (string, uint64, error) {
+	cursor, err := decodeCursor(after)
+	if err != nil {
+		return "", 0, err
+	}
+
+	firstValue := uint64(0)
+	if first != nil {
+		if *first < 0 {
+			return "", 0, ErrInvalidParameter
+		}
+		firstValue = uint64(*first)
+	}
+	return cursor, firstValue, nil
+}
+
+func newPageInfo(cursors []string, after string, hasNextPage bool) *PageInfo {
+	info := &PageInfo{
+		HasNextPage:     hasNextPage,
+		HasPreviousPage: after != "",
+	}
+	if len(cursors) > 0 {
+		info.StartCursor = &cursors[0]
+		info.EndCursor = &cursors[len(cursors)-1]
+	}
+	return info
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, cursor := range []string{"2Q7v8XbY3ZJ1q0", "1700000000|2Q7v8XbY3ZJ1q0", "a/b+c?="} {
+		encoded := encodeCursor(cursor)
+		got, err := decodeCursor(&encoded)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q): %v", encoded, err)
+		}
+		if got != cursor {
+			t.Errorf("decodeCursor(encodeCursor(%q)) = %q", cursor, got)
+		}
+	}
+}
+
+func TestConnectionArgs(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	strPtr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name       string
+		first      *int
+		after      *string
+		wantCursor string
+		wantFirst  uint64
+		wantErr    error
+	}{
+		{"no arguments", nil, nil, "", 0, nil},
+		{"empty cursor", intPtr(10), strPtr(""), "", 10, nil},
+		{"cursor", intPtr(5), strPtr(encodeCursor("abc")), "abc", 5, nil},
+		{"invalid cursor", nil, strPtr("not base64!"), "", 0, ErrInvalidCursor},
+		{"negative first", intPtr(-1), nil, "", 0, ErrInvalidParameter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, first, err := connectionArgs(tt.first, tt.after)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if cursor != tt.wantCursor || first != tt.wantFirst {
+				t.Errorf("connectionArgs() = %q, %d, want %q, %d", cursor, first, tt.wantCursor, tt.wantFirst)
+			}
+		})
+	}
+}
@@ -3,39 +3,76 @@ package main
 import (
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/leminkhoa/go-grpc-graphql-microservice/account"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/cart"
 	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
 	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/payment"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/review"
 )
 
 type Server struct {
 	accountClient *account.Client
 	catalogClient *catalog.Client
 	orderClient   *order.Client
+	cartClient    *cart.Client
+	paymentClient *payment.Client
+	reviewClient  *review.Client
 }
 
-func NewGraphQLServer(accountUrl, catalogUrl, orderUrl string) (*Server, error) {
-	accountClient, err := account.NewClient(accountUrl)
+func NewGraphQLServer(accountUrl, catalogUrl, orderUrl, cartUrl, paymentUrl, reviewUrl string, rpc resilience.Config) (*Server, error) {
+	accountClient, err := account.NewClient(accountUrl, rpc)
 	if err != nil {
 		return nil, err
 	}
 
-	catalogClient, err := catalog.NewClient(catalogUrl)
+	catalogClient, err := catalog.NewClient(catalogUrl, rpc)
 	if err != nil {
 		accountClient.Close()
 		return nil, err
 	}
 
-	orderClient, err := order.NewClient(orderUrl)
+	orderClient, err := order.NewClient(orderUrl, rpc)
 	if err != nil {
 		accountClient.Close()
 		catalogClient.Close()
 		return nil, err
 	}
 
+	cartClient, err := cart.NewClient(cartUrl, rpc)
+	if err != nil {
+		accountClient.Close()
+		catalogClient.Close()
+		orderClient.Close()
+		return nil, err
+	}
+
+	paymentClient, err := payment.NewClient(paymentUrl, rpc)
+	if err != nil {
+		accountClient.Close()
+		catalogClient.Close()
+		orderClient.Close()
+		cartClient.Close()
+		return nil, err
+	}
+
+	reviewClient, err := review.NewClient(reviewUrl, rpc)
+	if err != nil {
+		accountClient.Close()
+		catalogClient.Close()
+		orderClient.Close()
+		cartClient.Close()
+		paymentClient.Close()
+		return nil, err
+	}
+
 	return &Server{
 		accountClient,
 		catalogClient,
 		orderClient,
+		cartClient,
+		paymentClient,
+		reviewClient,
 	}, nil
 }
 
@@ -58,10 +95,38 @@ func (s *Server) Account() AccountResolver {
 	}
 }
 
+func (s *Server) Order() OrderResolver {
+	return &orderResolver{
+		server: s,
+	}
+}
+
+func (s *Server) Product() ProductResolver {
+	return &productResolver{
+		server: s,
+	}
+}
+
+func (s *Server) Webhook() WebhookResolver {
+	return &webhookResolver{
+		server: s,
+	}
+}
+
+func (s *Server) SalesReport() SalesReportResolver {
+	return &salesReportResolver{
+		server: s,
+	}
+}
+
 func (s *Server) ToExecutableSchema() graphql.ExecutableSchema {
 	return NewExecutableSchema(
 		Config{
-			Resolvers: s,
+			Resolvers:  s,
+			Complexity: newComplexityRoot(),
+			Directives: DirectiveRoot{
+				Staff: staffDirective,
+			},
 		},
 	)
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+	"google.golang.org/grpc/status"
+)
+
+// invoiceFileHandler serves the invoice of an order as a PDF on
+// /invoices/{orderId}.pdf, or as HTML on /invoices/{orderId}.html. Invoices
+// carry billing addresses, so like the @staff fields they are only served to
+// requests marked by StaffAuth.
+func invoiceFileHandler(client *order.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isStaff(r.Context()) {
+			http.Error(w, "invoices are restricted to staff", http.StatusForbidden)
+			return
+		}
+
+		file := r.PathValue("file")
+		ext := path.Ext(file)
+		orderID := strings.TrimSuffix(file, ext)
+		if ext != ".pdf" && ext != ".html" {
+			http.NotFound(w, r)
+			return
+		}
+
+		inv, err := client.GetInvoice(r.Context(), orderID)
+		if err != nil {
+			http.Error(w, status.Convert(err).Message(), runtime.HTTPStatusFromCode(status.Code(err)))
+			return
+		}
+
+		body, contentType := inv.PDF, "application/pdf"
+		if ext == ".html" {
+			body, contentType = inv.HTML, "text/html; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": inv.Number + ext}))
+		http.ServeContent(w, r, "", inv.IssuedAt, bytes.NewReader(body))
+	})
+}
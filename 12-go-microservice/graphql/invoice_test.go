@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInvoiceFileHandlerRejectsBeforeCallingTheOrderService(t *testing.T) {
+	keys := []string{"staff-key"}
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		want          int
+	}{
+		{"no header", "/invoices/order.pdf", "", http.StatusForbidden},
+		{"unknown key", "/invoices/order.html", "Bearer other-key", http.StatusForbidden},
+		{"other extension", "/invoices/order.txt", "Bearer staff-key", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.Handle("GET /invoices/{file}", StaffAuth(keys, invoiceFileHandler(nil)))
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// DepthLimit rejects operations whose selection sets are nested deeper than Limit.
+type DepthLimit struct {
+	Limit int
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = DepthLimit{}
+
+func (d DepthLimit) ExtensionName() string {
+	return "DepthLimit"
+}
+
+func (d DepthLimit) Validate(schema graphql.ExecutableSchema) error {
+	if d.Limit <= 0 {
+		return fmt.Errorf("depth limit must be positive, got %d", d.Limit)
+	}
+	return nil
+}
+
+func (d DepthLimit) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	depth := selectionDepth(opCtx.Operation.SelectionSet)
+	if depth > d.Limit {
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, d.Limit)
+		errcode.Set(err, "DEPTH_LIMIT_EXCEEDED")
+		return err
+	}
+	return nil
+}
+
+// selectionDepth returns how deeply set nests fields. Introspection fields
+// such as __schema are not counted, the schema they describe has a fixed depth
+// and tools such as the playground query it deeply.
+func selectionDepth(set ast.SelectionSet) int {
+	depth := 0
+	for _, sel := range set {
+		d := 0
+		switch s := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name, "__") {
+				continue
+			}
+			if len(s.SelectionSet) > 0 {
+				d = 1 + selectionDepth(s.SelectionSet)
+			}
+		case *ast.InlineFragment:
+			d = selectionDepth(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				d = selectionDepth(s.Definition.SelectionSet)
+			}
+		}
+		if d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// PersistedQueryAllowlist only executes operations registered ahead of time.
+// Clients send the sha256 hash of the query in the APQ extension and the query
+// text is taken from the allowlist, any other request is rejected.
+type PersistedQueryAllowlist struct {
+	queries map[string]string
+}
+
+var _ interface {
+	graphql.OperationParameterMutator
+	graphql.HandlerExtension
+} = PersistedQueryAllowlist{}
+
+// LoadPersistedQueryAllowlist reads a JSON object mapping query hashes to query text.
+func LoadPersistedQueryAllowlist(path string) (*PersistedQueryAllowlist, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := map[string]string{}
+	if err := json.Unmarshal(b, &queries); err != nil {
+		return nil, err
+	}
+
+	for hash, query := range queries {
+		if queryHash(query) != hash {
+			return nil, fmt.Errorf("persisted query %s does not match its hash", hash)
+		}
+	}
+
+	return &PersistedQueryAllowlist{queries}, nil
+}
+
+func (a PersistedQueryAllowlist) ExtensionName() string {
+	return "PersistedQueryAllowlist"
+}
+
+func (a PersistedQueryAllowlist) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (a PersistedQueryAllowlist) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	ext, _ := rawParams.Extensions["persistedQuery"].(map[string]any)
+	hash, _ := ext["sha256Hash"].(string)
+	if hash == "" {
+		err := gqlerror.Errorf("only persisted queries are allowed")
+		errcode.Set(err, "PERSISTED_QUERY_REQUIRED")
+		return err
+	}
+
+	query, ok := a.queries[hash]
+	if !ok {
+		err := gqlerror.Errorf("persisted query %s is not allowed", hash)
+		errcode.Set(err, "PERSISTED_QUERY_NOT_ALLOWED")
+		return err
+	}
+
+	rawParams.Query = query
+	return nil
+}
+
+func queryHash(query string) string {
+	b := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(b[:])
+}
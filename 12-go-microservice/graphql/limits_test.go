@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+func TestSelectionDepth(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"scalar fields", `{ a b }`, 0},
+		{"one level", `{ accounts { id } }`, 1},
+		{"deepest branch", `{ accounts { id orders { id products { id } } } products { id } }`, 3},
+		{"inline fragment", `{ accounts { ... on Account { orders { id } } } }`, 2},
+		{"introspection", `{ __schema { types { fields { type { ofType { ofType { name } } } } } } }`, 0},
+		{"introspection beside fields", `{ __typename accounts { id } __type(name: "Account") { fields { type { name } } } }`, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.ParseQuery(&ast.Source{Input: tt.query})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := selectionDepth(doc.Operations[0].SelectionSet); got != tt.want {
+				t.Errorf("selectionDepth() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectionDepthFragmentSpread(t *testing.T) {
+	doc, err := parser.ParseQuery(&ast.Source{Input: `
+		{ accounts { ...orders } }
+		fragment orders on Account { orders { products { id } } }
+	`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Spreads are only linked to their definition once the query is validated
+	spread := doc.Operations[0].SelectionSet[0].(*ast.Field).SelectionSet[0].(*ast.FragmentSpread)
+	spread.Definition = doc.Fragments.ForName("orders")
+
+	if got := selectionDepth(doc.Operations[0].SelectionSet); got != 3 {
+		t.Errorf("selectionDepth() = %d, want 3", got)
+	}
+}
@@ -1,33 +1,66 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
-	"github.com/kelseyhightower/envconfig"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
 )
 
 type AppConfig struct {
-	AccountURL string `envconfig:"ACCOUNT_SERVICE_URL"`
-	CatalogURL string `envconfig:"CATALOG_SERVICE_URL"`
-	OrderURL   string `envconfig:"ORDER_SERVICE_URL"`
+	bootstrap.Config
+	AccountURL string `envconfig:"ACCOUNT_SERVICE_URL" required:"true"`
+	CatalogURL string `envconfig:"CATALOG_SERVICE_URL" required:"true"`
+	OrderURL   string `envconfig:"ORDER_SERVICE_URL" required:"true"`
+	CartURL    string `envconfig:"CART_SERVICE_URL" required:"true"`
+	PaymentURL string `envconfig:"PAYMENT_SERVICE_URL" required:"true"`
+	ReviewURL  string `envconfig:"REVIEW_SERVICE_URL" required:"true"`
+
+	RPC resilience.Config `envconfig:"RPC"`
+
+	ComplexityLimit      int    `envconfig:"QUERY_COMPLEXITY_LIMIT" default:"5000"`
+	DepthLimit           int    `envconfig:"QUERY_DEPTH_LIMIT" default:"6"`
+	APQCacheSize         int    `envconfig:"APQ_CACHE_SIZE" default:"1000"`
+	PersistedQueriesFile string `envconfig:"PERSISTED_QUERIES_FILE"`
+	PersistedQueriesOnly bool   `envconfig:"PERSISTED_QUERIES_ONLY" default:"false"`
+
+	// Bearer tokens that give access to the staff only fields, such as salesReport,
+	// and to the invoice files
+	StaffAPIKeys []string `envconfig:"STAFF_API_KEYS" secret:"true"`
+}
+
+func (c AppConfig) Validate() error {
+	if c.ComplexityLimit < 1 || c.DepthLimit < 1 || c.APQCacheSize < 1 {
+		return fmt.Errorf("%w: QUERY_COMPLEXITY_LIMIT, QUERY_DEPTH_LIMIT and APQ_CACHE_SIZE must be positive", bootstrap.ErrInvalidConfig)
+	}
+	if c.PersistedQueriesOnly && c.PersistedQueriesFile == "" {
+		return fmt.Errorf("%w: PERSISTED_QUERIES_ONLY needs a PERSISTED_QUERIES_FILE", bootstrap.ErrInvalidConfig)
+	}
+	return nil
 }
 
 func main() {
 	var cfg AppConfig
-
-	err := envconfig.Process("", &cfg)
-	if err != nil {
+	if err := bootstrap.Load(&cfg); err != nil {
 		log.Fatal(err)
 	}
+	bootstrap.Banner("graphql", &cfg)
 
 	s, err := NewGraphQLServer(
 		cfg.AccountURL,
 		cfg.CatalogURL,
 		cfg.OrderURL,
+		cfg.CartURL,
+		cfg.PaymentURL,
+		cfg.ReviewURL,
+		cfg.RPC,
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -41,9 +74,29 @@ func main() {
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
 
-	http.Handle("/graphql", srv)
+	// Protect the backends from expensive operations
+	srv.Use(extension.FixedComplexityLimit(cfg.ComplexityLimit))
+	srv.Use(DepthLimit{Limit: cfg.DepthLimit})
+
+	// In production only pre-registered operations are accepted, otherwise
+	// clients may register queries on the fly through APQ
+	if cfg.PersistedQueriesOnly {
+		allowlist, err := LoadPersistedQueryAllowlist(cfg.PersistedQueriesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		srv.Use(allowlist)
+	} else {
+		srv.Use(extension.AutomaticPersistedQuery{
+			Cache: lru.New[string](cfg.APQCacheSize),
+		})
+	}
+
+	http.Handle("/graphql", StaffAuth(cfg.StaffAPIKeys, srv))
+	http.Handle("GET /invoices/{file}", StaffAuth(cfg.StaffAPIKeys, invoiceFileHandler(s.orderClient)))
 	http.Handle("/playground", playground.Handler("Khoa Le", "/graphql"))
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Printf("Listening on port %d...", cfg.Port)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), nil))
 
 }
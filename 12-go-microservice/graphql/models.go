@@ -1,7 +1,24 @@
 package main
 
+import "time"
+
 type Account struct {
-	ID     string  `json:"id"`
-	Name   string  `json:"name"`
-	Orders []Order `json:"orders"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Email       string            `json:"email"`
+	DisplayName string            `json:"displayName"`
+	Addresses   []*AccountAddress `json:"addresses"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+	Orders      []Order           `json:"orders"`
+}
+
+type SalesReport struct {
+	From              time.Time      `json:"from"`
+	To                time.Time      `json:"to"`
+	Interval          string         `json:"interval"`
+	OrderCount        int            `json:"orderCount"`
+	Revenue           float64        `json:"revenue"`
+	AverageOrderValue float64        `json:"averageOrderValue"`
+	Buckets           []*SalesBucket `json:"buckets"`
 }
@@ -6,36 +6,234 @@ import (
 	"time"
 )
 
+type AccountAddress struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Name       string    `json:"name"`
+	Line1      string    `json:"line1"`
+	Line2      *string   `json:"line2,omitempty"`
+	City       string    `json:"city"`
+	State      *string   `json:"state,omitempty"`
+	PostalCode string    `json:"postalCode"`
+	Country    string    `json:"country"`
+	IsDefault  bool      `json:"isDefault"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type AccountAddressInput struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name"`
+	Line1      string  `json:"line1"`
+	Line2      *string `json:"line2,omitempty"`
+	City       string  `json:"city"`
+	State      *string `json:"state,omitempty"`
+	PostalCode string  `json:"postalCode"`
+	Country    string  `json:"country"`
+	IsDefault  *bool   `json:"isDefault,omitempty"`
+}
+
+type AccountConnection struct {
+	Edges      []*AccountEdge `json:"edges"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+	TotalCount int            `json:"totalCount"`
+}
+
+type AccountEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Account `json:"node"`
+}
+
 type AccountInput struct {
-	Name string `json:"name"`
+	Name        string  `json:"name"`
+	Email       string  `json:"email"`
+	DisplayName *string `json:"displayName,omitempty"`
+}
+
+type AccountValue struct {
+	AccountID         string    `json:"accountId"`
+	OrderCount        int       `json:"orderCount"`
+	LifetimeValue     float64   `json:"lifetimeValue"`
+	AverageOrderValue float64   `json:"averageOrderValue"`
+	FirstOrderAt      time.Time `json:"firstOrderAt"`
+	LastOrderAt       time.Time `json:"lastOrderAt"`
+}
+
+type Address struct {
+	Name       string  `json:"name"`
+	Line1      string  `json:"line1"`
+	Line2      *string `json:"line2,omitempty"`
+	City       string  `json:"city"`
+	State      *string `json:"state,omitempty"`
+	PostalCode string  `json:"postalCode"`
+	Country    string  `json:"country"`
+}
+
+type AddressInput struct {
+	Name       string  `json:"name"`
+	Line1      string  `json:"line1"`
+	Line2      *string `json:"line2,omitempty"`
+	City       string  `json:"city"`
+	State      *string `json:"state,omitempty"`
+	PostalCode string  `json:"postalCode"`
+	Country    string  `json:"country"`
+}
+
+type Cart struct {
+	AccountID  string      `json:"accountId"`
+	Items      []*CartItem `json:"items"`
+	TotalPrice float64     `json:"totalPrice"`
+}
+
+type CartItem struct {
+	ID          string           `json:"id"`
+	VariantID   *string          `json:"variantId,omitempty"`
+	Sku         *string          `json:"sku,omitempty"`
+	Options     []*VariantOption `json:"options"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Price       float64          `json:"price"`
+	Quantity    int              `json:"quantity"`
+}
+
+type CartItemInput struct {
+	AccountID string  `json:"accountId"`
+	ProductID string  `json:"productId"`
+	VariantID *string `json:"variantId,omitempty"`
+	Quantity  int     `json:"quantity"`
+}
+
+type Category struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	ParentID *string     `json:"parentId,omitempty"`
+	Children []*Category `json:"children"`
+}
+
+type CategoryInput struct {
+	Name     string  `json:"name"`
+	ParentID *string `json:"parentId,omitempty"`
+}
+
+type Discount struct {
+	PromotionID string  `json:"promotionId"`
+	Code        *string `json:"code,omitempty"`
+	ProductID   string  `json:"productId"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
 }
 
 type Mutation struct {
 }
 
 type Order struct {
-	ID         string            `json:"id"`
-	CreatedAt  time.Time         `json:"createdAt"`
-	TotalPrice float64           `json:"totalPrice"`
-	Products   []*OrderedProduct `json:"products"`
+	ID              string               `json:"id"`
+	CreatedAt       time.Time            `json:"createdAt"`
+	Subtotal        float64              `json:"subtotal"`
+	TaxTotal        float64              `json:"taxTotal"`
+	TaxInclusive    bool                 `json:"taxInclusive"`
+	TaxJurisdiction *string              `json:"taxJurisdiction,omitempty"`
+	TotalPrice      float64              `json:"totalPrice"`
+	PaymentStatus   string               `json:"paymentStatus"`
+	ShippingAddress *Address             `json:"shippingAddress,omitempty"`
+	Products        []*OrderedProduct    `json:"products"`
+	Discounts       []*Discount          `json:"discounts"`
+	Taxes           []*TaxLine           `json:"taxes"`
+	Shipments       []*Shipment          `json:"shipments"`
+	Notifications   []*OrderNotification `json:"notifications"`
+}
+
+type OrderConnection struct {
+	Edges      []*OrderEdge `json:"edges"`
+	PageInfo   *PageInfo    `json:"pageInfo"`
+	TotalCount int          `json:"totalCount"`
+}
+
+type OrderEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Order `json:"node"`
 }
 
 type OrderInput struct {
-	AccountID string               `json:"accountId"`
-	Products  []*OrderProductInput `json:"products"`
+	AccountID       string               `json:"accountId"`
+	Products        []*OrderProductInput `json:"products"`
+	ShippingAddress *AddressInput        `json:"shippingAddress,omitempty"`
+	CouponCode      *string              `json:"couponCode,omitempty"`
+}
+
+type OrderNotification struct {
+	ID            string     `json:"id"`
+	Kind          string     `json:"kind"`
+	Recipient     string     `json:"recipient"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	LastError     string     `json:"lastError"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
 }
 
 type OrderProductInput struct {
-	ID       string `json:"id"`
-	Quantity int    `json:"quantity"`
+	ID        string  `json:"id"`
+	VariantID *string `json:"variantId,omitempty"`
+	Quantity  int     `json:"quantity"`
+}
+
+type OrderSubscription struct {
+	ID              string                   `json:"id"`
+	AccountID       string                   `json:"accountId"`
+	Products        []*OrderSubscriptionItem `json:"products"`
+	ShippingAddress *Address                 `json:"shippingAddress,omitempty"`
+	Interval        string                   `json:"interval"`
+	IntervalCount   int                      `json:"intervalCount"`
+	NextRunAt       time.Time                `json:"nextRunAt"`
+	Status          string                   `json:"status"`
+	CreatedAt       time.Time                `json:"createdAt"`
+	Runs            []*OrderSubscriptionRun  `json:"runs"`
+}
+
+type OrderSubscriptionInput struct {
+	AccountID       string               `json:"accountId"`
+	Products        []*OrderProductInput `json:"products"`
+	ShippingAddress *AddressInput        `json:"shippingAddress,omitempty"`
+	Interval        string               `json:"interval"`
+	IntervalCount   *int                 `json:"intervalCount,omitempty"`
+	FirstRunAt      *time.Time           `json:"firstRunAt,omitempty"`
+}
+
+type OrderSubscriptionItem struct {
+	ProductID string  `json:"productId"`
+	VariantID *string `json:"variantId,omitempty"`
+	Quantity  int     `json:"quantity"`
+}
+
+type OrderSubscriptionRun struct {
+	ID            string     `json:"id"`
+	ScheduledFor  time.Time  `json:"scheduledFor"`
+	Status        string     `json:"status"`
+	OrderID       *string    `json:"orderId,omitempty"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	LastError     string     `json:"lastError"`
+	CreatedAt     time.Time  `json:"createdAt"`
 }
 
 type OrderedProduct struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Quantity    int     `json:"quantity"`
+	ID          string           `json:"id"`
+	VariantID   *string          `json:"variantId,omitempty"`
+	Sku         *string          `json:"sku,omitempty"`
+	Options     []*VariantOption `json:"options"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Price       float64          `json:"price"`
+	Quantity    int              `json:"quantity"`
+}
+
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
 }
 
 type PaginationInput struct {
@@ -43,18 +241,235 @@ type PaginationInput struct {
 	Take *int `json:"take,omitempty"`
 }
 
+type Payment struct {
+	ID             string            `json:"id"`
+	OrderID        string            `json:"orderId"`
+	Amount         float64           `json:"amount"`
+	RefundedAmount float64           `json:"refundedAmount"`
+	Status         string            `json:"status"`
+	Provider       string            `json:"provider"`
+	FailureReason  *string           `json:"failureReason,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	UpdatedAt      time.Time         `json:"updatedAt"`
+	Attempts       []*PaymentAttempt `json:"attempts"`
+}
+
+type PaymentAttempt struct {
+	Operation string    `json:"operation"`
+	Amount    float64   `json:"amount"`
+	Succeeded bool      `json:"succeeded"`
+	Error     *string   `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
 type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Price       float64             `json:"price"`
+	CategoryID  *string             `json:"categoryId,omitempty"`
+	Tags        []string            `json:"tags"`
+	Attributes  []*ProductAttribute `json:"attributes"`
+	Variants    []*ProductVariant   `json:"variants"`
+	TaxCategory *string             `json:"taxCategory,omitempty"`
+	Rating      *ProductRating      `json:"rating,omitempty"`
+	Reviews     []*Review           `json:"reviews"`
+	Recommended []*Product          `json:"recommended"`
+	Highlights  []*ProductHighlight `json:"highlights"`
+}
+
+type ProductAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type ProductAttributeInput struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type ProductConnection struct {
+	Edges      []*ProductEdge `json:"edges"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+	TotalCount int            `json:"totalCount"`
+}
+
+type ProductEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Product `json:"node"`
+}
+
+type ProductHighlight struct {
+	Field     string   `json:"field"`
+	Fragments []string `json:"fragments"`
 }
 
 type ProductInput struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description"`
+	Price       float64                  `json:"price"`
+	CategoryID  *string                  `json:"categoryId,omitempty"`
+	Tags        []string                 `json:"tags,omitempty"`
+	Attributes  []*ProductAttributeInput `json:"attributes,omitempty"`
+	Variants    []*ProductVariantInput   `json:"variants,omitempty"`
+	TaxCategory *string                  `json:"taxCategory,omitempty"`
+}
+
+type ProductRating struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+type ProductSales struct {
+	ProductID  string  `json:"productId"`
+	Name       string  `json:"name"`
+	Quantity   int     `json:"quantity"`
+	Revenue    float64 `json:"revenue"`
+	OrderCount int     `json:"orderCount"`
+}
+
+type ProductSuggestion struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type ProductVariant struct {
+	ID      string           `json:"id"`
+	Sku     string           `json:"sku"`
+	Options []*VariantOption `json:"options"`
+	Price   float64          `json:"price"`
+}
+
+type ProductVariantInput struct {
+	ID      *string               `json:"id,omitempty"`
+	Sku     string                `json:"sku"`
+	Options []*VariantOptionInput `json:"options,omitempty"`
+	Price   float64               `json:"price"`
 }
 
 type Query struct {
 }
+
+type RemoveCartItemInput struct {
+	AccountID string  `json:"accountId"`
+	ProductID string  `json:"productId"`
+	VariantID *string `json:"variantId,omitempty"`
+	Quantity  *int    `json:"quantity,omitempty"`
+}
+
+type Review struct {
+	ID        string    `json:"id"`
+	ProductID string    `json:"productId"`
+	AccountID string    `json:"accountId"`
+	Rating    int       `json:"rating"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ReviewInput struct {
+	ProductID string  `json:"productId"`
+	AccountID string  `json:"accountId"`
+	Rating    int     `json:"rating"`
+	Text      *string `json:"text,omitempty"`
+}
+
+type SalesBucket struct {
+	Start             time.Time `json:"start"`
+	OrderCount        int       `json:"orderCount"`
+	Revenue           float64   `json:"revenue"`
+	AverageOrderValue float64   `json:"averageOrderValue"`
+}
+
+type Shipment struct {
+	ID             string          `json:"id"`
+	Carrier        string          `json:"carrier"`
+	TrackingNumber string          `json:"trackingNumber"`
+	Status         string          `json:"status"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	ShippedAt      *time.Time      `json:"shippedAt,omitempty"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+	Items          []*ShipmentItem `json:"items"`
+}
+
+type ShipmentInput struct {
+	OrderID        string               `json:"orderId"`
+	Carrier        string               `json:"carrier"`
+	TrackingNumber string               `json:"trackingNumber"`
+	Items          []*ShipmentItemInput `json:"items,omitempty"`
+}
+
+type ShipmentItem struct {
+	ProductID string  `json:"productId"`
+	VariantID *string `json:"variantId,omitempty"`
+	Quantity  int     `json:"quantity"`
+}
+
+type ShipmentItemInput struct {
+	ProductID string  `json:"productId"`
+	VariantID *string `json:"variantId,omitempty"`
+	Quantity  int     `json:"quantity"`
+}
+
+type ShipmentUpdateInput struct {
+	Carrier        *string `json:"carrier,omitempty"`
+	TrackingNumber *string `json:"trackingNumber,omitempty"`
+	Status         *string `json:"status,omitempty"`
+}
+
+type TaxLine struct {
+	ProductID     string  `json:"productId"`
+	Category      string  `json:"category"`
+	Rate          float64 `json:"rate"`
+	TaxableAmount float64 `json:"taxableAmount"`
+	Amount        float64 `json:"amount"`
+}
+
+type VariantOption struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type VariantOptionInput struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Webhook struct {
+	ID         string             `json:"id"`
+	URL        string             `json:"url"`
+	EventTypes []string           `json:"eventTypes"`
+	Secret     *string            `json:"secret,omitempty"`
+	Active     bool               `json:"active"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	Deliveries []*WebhookDelivery `json:"deliveries"`
+}
+
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attemptedAt"`
+	StatusCode  int       `json:"statusCode"`
+	Error       string    `json:"error"`
+	DurationMs  int       `json:"durationMs"`
+}
+
+type WebhookDelivery struct {
+	ID             string            `json:"id"`
+	WebhookID      string            `json:"webhookId"`
+	EventID        string            `json:"eventId"`
+	EventType      string            `json:"eventType"`
+	Payload        string            `json:"payload"`
+	Status         string            `json:"status"`
+	Attempts       int               `json:"attempts"`
+	NextAttemptAt  *time.Time        `json:"nextAttemptAt,omitempty"`
+	LastStatusCode int               `json:"lastStatusCode"`
+	LastError      string            `json:"lastError"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	DeliveredAt    *time.Time        `json:"deliveredAt,omitempty"`
+	AttemptLog     []*WebhookAttempt `json:"attemptLog"`
+}
+
+type WebhookInput struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes,omitempty"`
+	Secret     *string  `json:"secret,omitempty"`
+	Active     *bool    `json:"active,omitempty"`
+}
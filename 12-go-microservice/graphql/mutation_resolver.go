@@ -4,14 +4,31 @@ import (
 	"context"
 	"errors"
 	"log"
-	"time"
 
+	"github.com/leminkhoa/go-grpc-graphql-microservice/account"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/cart"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
 	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/payment"
 )
 
 // CreateAccount
+// UpdateAccount
+// AddAccountAddress
+// UpdateAccountAddress
+// DeleteAccountAddress
 // CreateProduct
+// UpdateProduct
 // CreateOrder
+// AddToCart
+// RemoveFromCart
+// Checkout
+// AuthorizePayment
+// CapturePayment
+// VoidPayment
+// RefundPayment
+// CreateShipment
+// UpdateShipment
 
 var (
 	ErrInvalidParameter = errors.New("invalid parameter")
@@ -22,75 +39,545 @@ type mutationResolver struct {
 }
 
 func (r *mutationResolver) CreateAccount(ctx context.Context, in AccountInput) (*Account, error) {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
+	displayName := ""
+	if in.DisplayName != nil {
+		displayName = *in.DisplayName
+	}
+
+	a, err := r.server.accountClient.PostAccount(ctx, in.Name, in.Email, displayName)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLAccount(*a), nil
+}
+
+func (r *mutationResolver) UpdateAccount(ctx context.Context, id string, in AccountInput) (*Account, error) {
+	displayName := ""
+	if in.DisplayName != nil {
+		displayName = *in.DisplayName
+	}
+
+	a, err := r.server.accountClient.UpdateAccount(ctx, id, in.Name, in.Email, displayName)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLAccount(*a), nil
+}
 
-	a, err := r.server.accountClient.PostAccount(ctx, in.Name)
+func (r *mutationResolver) AddAccountAddress(ctx context.Context, accountID string, in AccountAddressInput) (*AccountAddress, error) {
+	a, err := r.server.accountClient.PostAddress(ctx, accountID, toAccountAddress(in))
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	return &Account{
-		ID:   a.ID,
-		Name: a.Name,
-	}, nil
+	return toGraphQLAccountAddress(*a), nil
+}
+
+func (r *mutationResolver) UpdateAccountAddress(ctx context.Context, accountID string, id string, in AccountAddressInput) (*AccountAddress, error) {
+	address := toAccountAddress(in)
+	address.ID = id
+
+	a, err := r.server.accountClient.UpdateAddress(ctx, accountID, address)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLAccountAddress(*a), nil
+}
+
+func (r *mutationResolver) DeleteAccountAddress(ctx context.Context, accountID string, id string) (bool, error) {
+	if err := r.server.accountClient.DeleteAddress(ctx, accountID, id); err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return true, nil
 }
 
 func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput) (*Product, error) {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
+	p, err := r.server.catalogClient.PostProduct(ctx, toCatalogProduct(in))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLProduct(*p), nil
+}
+
+func (r *mutationResolver) UpdateProduct(ctx context.Context, id string, in ProductInput) (*Product, error) {
+	product := toCatalogProduct(in)
+	product.ID = id
 
-	p, err := r.server.catalogClient.PostProduct(ctx, in.Name, in.Description, in.Price)
+	p, err := r.server.catalogClient.UpdateProduct(ctx, product)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	return &Product{
-		ID:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}, nil
+	return toGraphQLProduct(*p), nil
 }
 
-func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Order, error) {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
+func (r *mutationResolver) CreateCategory(ctx context.Context, in CategoryInput) (*Category, error) {
+	parentID := ""
+	if in.ParentID != nil {
+		parentID = *in.ParentID
+	}
+
+	c, err := r.server.catalogClient.CreateCategory(ctx, in.Name, parentID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLCategory(*c), nil
+}
+
+func (r *mutationResolver) UpdateCategory(ctx context.Context, id string, in CategoryInput) (*Category, error) {
+	parentID := ""
+	if in.ParentID != nil {
+		parentID = *in.ParentID
+	}
+
+	c, err := r.server.catalogClient.UpdateCategory(ctx, id, in.Name, parentID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLCategory(*c), nil
+}
+
+func (r *mutationResolver) DeleteCategory(ctx context.Context, id string) (bool, error) {
+	if err := r.server.catalogClient.DeleteCategory(ctx, id); err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return true, nil
+}
 
+func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Order, error) {
 	var products []order.OrderedProduct
 	for _, p := range in.Products {
 		if p.Quantity <= 0 {
 			return nil, ErrInvalidParameter
 		}
-		products = append(products, order.OrderedProduct{
+		product := order.OrderedProduct{
 			ID:       p.ID,
 			Quantity: uint32(p.Quantity),
-		})
+		}
+		if p.VariantID != nil {
+			product.VariantID = *p.VariantID
+		}
+		products = append(products, product)
+	}
+	couponCode := ""
+	if in.CouponCode != nil {
+		couponCode = *in.CouponCode
+	}
+
+	o, err := r.server.orderClient.PostOrder(ctx, in.AccountID, products, toOrderAddress(in.ShippingAddress), couponCode, "")
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLOrder(*o), nil
+
+}
+
+func (r *mutationResolver) CreateReview(ctx context.Context, in ReviewInput) (*Review, error) {
+	if in.Rating < 0 {
+		return nil, ErrInvalidParameter
 	}
-	o, err := r.server.orderClient.PostOrder(ctx, in.AccountID, products)
+	text := ""
+	if in.Text != nil {
+		text = *in.Text
+	}
+
+	rv, err := r.server.reviewClient.CreateReview(ctx, in.ProductID, in.AccountID, uint32(in.Rating), text)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	// Convert the order products to GraphQL format
-	var graphqlProducts []*OrderedProduct
-	for _, p := range o.Products {
-		graphqlProducts = append(graphqlProducts, &OrderedProduct{
-			ID:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			Quantity:    int(p.Quantity),
-		})
+	return toGraphQLReview(*rv), nil
+}
+
+func (r *mutationResolver) AddToCart(ctx context.Context, in CartItemInput) (*Cart, error) {
+	if in.Quantity <= 0 {
+		return nil, ErrInvalidParameter
+	}
+
+	variantID := ""
+	if in.VariantID != nil {
+		variantID = *in.VariantID
 	}
-	return &Order{
-		ID:         o.ID,
-		CreatedAt:  o.CreatedAt,
-		TotalPrice: o.TotalPrice,
-		Products:   graphqlProducts,
-	}, nil
 
+	c, err := r.server.cartClient.AddToCart(ctx, in.AccountID, in.ProductID, variantID, uint32(in.Quantity))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLCart(c), nil
+}
+
+// RemoveFromCart removes the whole cart line when no quantity is given
+func (r *mutationResolver) RemoveFromCart(ctx context.Context, in RemoveCartItemInput) (*Cart, error) {
+	quantity := uint32(0)
+	if in.Quantity != nil {
+		if *in.Quantity <= 0 {
+			return nil, ErrInvalidParameter
+		}
+		quantity = uint32(*in.Quantity)
+	}
+	variantID := ""
+	if in.VariantID != nil {
+		variantID = *in.VariantID
+	}
+
+	c, err := r.server.cartClient.RemoveFromCart(ctx, in.AccountID, in.ProductID, variantID, quantity)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLCart(c), nil
+}
+
+func (r *mutationResolver) Checkout(ctx context.Context, accountID string, shippingAddress *AddressInput, couponCode *string) (*Order, error) {
+	couponCodeValue := ""
+	if couponCode != nil {
+		couponCodeValue = *couponCode
+	}
+
+	o, err := r.server.cartClient.Checkout(ctx, accountID, toOrderAddress(shippingAddress), couponCodeValue)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLOrder(*o), nil
+}
+
+func (r *mutationResolver) AuthorizePayment(ctx context.Context, orderID string, source string) (*Payment, error) {
+	p, err := r.server.paymentClient.AuthorizePayment(ctx, orderID, source)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLPayment(p), nil
+}
+
+func (r *mutationResolver) CapturePayment(ctx context.Context, paymentID string) (*Payment, error) {
+	p, err := r.server.paymentClient.CapturePayment(ctx, paymentID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLPayment(p), nil
+}
+
+func (r *mutationResolver) VoidPayment(ctx context.Context, paymentID string) (*Payment, error) {
+	p, err := r.server.paymentClient.VoidPayment(ctx, paymentID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLPayment(p), nil
+}
+
+// RefundPayment refunds what is left of the payment when amount is not given
+func (r *mutationResolver) RefundPayment(ctx context.Context, paymentID string, amount *float64) (*Payment, error) {
+	amountValue := 0.0
+	if amount != nil {
+		if *amount <= 0 {
+			return nil, ErrInvalidParameter
+		}
+		amountValue = *amount
+	}
+
+	p, err := r.server.paymentClient.RefundPayment(ctx, paymentID, amountValue)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLPayment(p), nil
+}
+
+func (r *mutationResolver) CreateShipment(ctx context.Context, in ShipmentInput) (*Shipment, error) {
+	items := []order.ShipmentItem{}
+	for _, item := range in.Items {
+		if item.Quantity <= 0 {
+			return nil, ErrInvalidParameter
+		}
+		shipmentItem := order.ShipmentItem{
+			ProductID: item.ProductID,
+			Quantity:  uint32(item.Quantity),
+		}
+		if item.VariantID != nil {
+			shipmentItem.VariantID = *item.VariantID
+		}
+		items = append(items, shipmentItem)
+	}
+
+	s, err := r.server.orderClient.CreateShipment(ctx, in.OrderID, in.Carrier, in.TrackingNumber, items)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLShipment(*s), nil
+}
+
+func (r *mutationResolver) UpdateShipment(ctx context.Context, id string, in ShipmentUpdateInput) (*Shipment, error) {
+	var carrier, trackingNumber, status string
+	if in.Carrier != nil {
+		carrier = *in.Carrier
+	}
+	if in.TrackingNumber != nil {
+		trackingNumber = *in.TrackingNumber
+	}
+	if in.Status != nil {
+		status = *in.Status
+	}
+
+	s, err := r.server.orderClient.UpdateShipment(ctx, id, carrier, trackingNumber, order.ShipmentStatus(status))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLShipment(*s), nil
+}
+
+func (r *mutationResolver) CreateWebhook(ctx context.Context, in WebhookInput) (*Webhook, error) {
+	w, err := toOrderWebhook("", in)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := r.server.orderClient.CreateWebhook(ctx, w)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLWebhook(*created), nil
+}
+
+func (r *mutationResolver) UpdateWebhook(ctx context.Context, id string, in WebhookInput) (*Webhook, error) {
+	w, err := toOrderWebhook(id, in)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := r.server.orderClient.UpdateWebhook(ctx, w)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLWebhook(*updated), nil
+}
+
+func (r *mutationResolver) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	if err := r.server.orderClient.DeleteWebhook(ctx, id); err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) RedeliverWebhook(ctx context.Context, deliveryID string) (*WebhookDelivery, error) {
+	d, err := r.server.orderClient.RedeliverWebhook(ctx, deliveryID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLWebhookDelivery(*d), nil
+}
+
+func (r *mutationResolver) CreateSubscription(ctx context.Context, in OrderSubscriptionInput) (*OrderSubscription, error) {
+	sub, err := toOrderSubscription(in)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := r.server.orderClient.CreateSubscription(ctx, sub)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLSubscription(*created), nil
+}
+
+func (r *mutationResolver) PauseSubscription(ctx context.Context, id string) (*OrderSubscription, error) {
+	return updateSubscription(r.server.orderClient.PauseSubscription(ctx, id))
+}
+
+func (r *mutationResolver) ResumeSubscription(ctx context.Context, id string) (*OrderSubscription, error) {
+	return updateSubscription(r.server.orderClient.ResumeSubscription(ctx, id))
+}
+
+func (r *mutationResolver) CancelSubscription(ctx context.Context, id string) (*OrderSubscription, error) {
+	return updateSubscription(r.server.orderClient.CancelSubscription(ctx, id))
+}
+
+func updateSubscription(s *order.Subscription, err error) (*OrderSubscription, error) {
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLSubscription(*s), nil
+}
+
+func toAccountAddress(in AccountAddressInput) account.Address {
+	a := account.Address{
+		Type:       account.AddressType(in.Type),
+		Name:       in.Name,
+		Line1:      in.Line1,
+		City:       in.City,
+		PostalCode: in.PostalCode,
+		Country:    in.Country,
+	}
+	if in.Line2 != nil {
+		a.Line2 = *in.Line2
+	}
+	if in.State != nil {
+		a.State = *in.State
+	}
+	if in.IsDefault != nil {
+		a.IsDefault = *in.IsDefault
+	}
+	return a
+}
+
+func toCatalogProduct(in ProductInput) catalog.Product {
+	p := catalog.Product{
+		Name:        in.Name,
+		Description: in.Description,
+		Price:       in.Price,
+		Tags:        in.Tags,
+	}
+	if in.CategoryID != nil {
+		p.CategoryID = *in.CategoryID
+	}
+	if in.TaxCategory != nil {
+		p.TaxCategory = *in.TaxCategory
+	}
+	for _, a := range in.Attributes {
+		p.Attributes = append(p.Attributes, catalog.ProductAttribute{Name: a.Name, Value: a.Value})
+	}
+	for _, v := range in.Variants {
+		variant := catalog.ProductVariant{
+			SKU:   v.Sku,
+			Price: v.Price,
+		}
+		if v.ID != nil {
+			variant.ID = *v.ID
+		}
+		for _, o := range v.Options {
+			variant.Options = append(variant.Options, catalog.VariantOption{Name: o.Name, Value: o.Value})
+		}
+		p.Variants = append(p.Variants, variant)
+	}
+	return p
+}
+
+func toOrderAddress(in *AddressInput) *order.Address {
+	if in == nil {
+		return nil
+	}
+
+	a := &order.Address{
+		Name:       in.Name,
+		Line1:      in.Line1,
+		City:       in.City,
+		PostalCode: in.PostalCode,
+		Country:    in.Country,
+	}
+	if in.Line2 != nil {
+		a.Line2 = *in.Line2
+	}
+	if in.State != nil {
+		a.State = *in.State
+	}
+	return a
+}
+
+func toGraphQLPayment(p *payment.Payment) *Payment {
+	res := &Payment{
+		ID:             p.ID,
+		OrderID:        p.OrderID,
+		Amount:         p.Amount,
+		RefundedAmount: p.RefundedAmount,
+		Status:         string(p.Status),
+		Provider:       p.Provider,
+		CreatedAt:      p.CreatedAt,
+		UpdatedAt:      p.UpdatedAt,
+		Attempts:       []*PaymentAttempt{},
+	}
+	if p.FailureReason != "" {
+		res.FailureReason = &p.FailureReason
+	}
+
+	for _, a := range p.Attempts {
+		attempt := &PaymentAttempt{
+			Operation: a.Operation,
+			Amount:    a.Amount,
+			Succeeded: a.Succeeded,
+			CreatedAt: a.CreatedAt,
+		}
+		if a.Error != "" {
+			errValue := a.Error
+			attempt.Error = &errValue
+		}
+		res.Attempts = append(res.Attempts, attempt)
+	}
+
+	return res
+}
+
+func toGraphQLCart(c *cart.Cart) *Cart {
+	items := []*CartItem{}
+	for _, item := range c.Items {
+		cartItem := &CartItem{
+			ID:          item.ProductID,
+			Options:     []*VariantOption{},
+			Name:        item.Name,
+			Description: item.Description,
+			Price:       item.Price,
+			Quantity:    int(item.Quantity),
+		}
+		if item.VariantID != "" {
+			variantID, sku := item.VariantID, item.SKU
+			cartItem.VariantID = &variantID
+			cartItem.Sku = &sku
+		}
+		for _, o := range item.Options {
+			cartItem.Options = append(cartItem.Options, &VariantOption{Name: o.Name, Value: o.Value})
+		}
+		items = append(items, cartItem)
+	}
+	return &Cart{
+		AccountID:  c.AccountID,
+		Items:      items,
+		TotalPrice: c.TotalPrice,
+	}
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+)
+
+type orderResolver struct {
+	server *Server
+}
+
+func (r *orderResolver) Notifications(ctx context.Context, obj *Order) ([]*OrderNotification, error) {
+	notificationList, err := r.server.orderClient.GetOrderNotifications(ctx, obj.ID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	notifications := []*OrderNotification{}
+	for _, n := range notificationList {
+		notifications = append(notifications, toGraphQLNotification(n))
+	}
+
+	return notifications, nil
+}
+
+func toGraphQLNotification(n order.Notification) *OrderNotification {
+	return &OrderNotification{
+		ID:            n.ID,
+		Kind:          string(n.Kind),
+		Recipient:     n.Recipient,
+		Status:        string(n.Status),
+		Attempts:      int(n.Attempts),
+		NextAttemptAt: n.NextAttemptAt,
+		LastError:     n.LastError,
+		CreatedAt:     n.CreatedAt,
+		SentAt:        n.SentAt,
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/review"
+)
+
+type productResolver struct {
+	server *Server
+}
+
+func (r *productResolver) Reviews(ctx context.Context, obj *Product, pagination *PaginationInput) ([]*Review, error) {
+	skip, take := uint64(0), uint64(0)
+	if pagination != nil {
+		skip, take = pagination.bounds()
+	}
+
+	reviewList, err := r.server.reviewClient.GetReviewsForProduct(ctx, obj.ID, skip, take)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	reviews := []*Review{}
+	for _, rv := range reviewList {
+		reviews = append(reviews, toGraphQLReview(rv))
+	}
+
+	return reviews, nil
+}
+
+func (r *productResolver) Recommended(ctx context.Context, obj *Product, limit *int) ([]*Product, error) {
+	l := uint32(0)
+	if limit != nil && *limit > 0 {
+		l = uint32(*limit)
+	}
+
+	recommendations, err := r.server.orderClient.GetRecommendations(ctx, obj.ID, l)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	products := []*Product{}
+	if len(recommendations) == 0 {
+		return products, nil
+	}
+
+	ids := []string{}
+	for _, rec := range recommendations {
+		ids = append(ids, rec.ProductID)
+	}
+
+	productList, err := r.server.catalogClient.GetProducts(ctx, 0, 0, ids, "", catalog.ProductFilter{})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	productMap := map[string]catalog.Product{}
+	for _, p := range productList {
+		productMap[p.ID] = p
+	}
+
+	// Keep the order of the scores, products removed from the catalog are left out
+	for _, id := range ids {
+		if p, ok := productMap[id]; ok {
+			products = append(products, toGraphQLProduct(p))
+		}
+	}
+
+	return products, nil
+}
+
+func toGraphQLReview(r review.Review) *Review {
+	return &Review{
+		ID:        r.ID,
+		ProductID: r.ProductID,
+		AccountID: r.AccountID,
+		Rating:    int(r.Rating),
+		Text:      r.Text,
+		CreatedAt: r.CreatedAt,
+	}
+}
@@ -4,19 +4,22 @@ import (
 	"context"
 	"log"
 	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
 )
 
 // Accounts
 // Products
+// Cart
+// Payments
+// SalesReport
 
 type queryResolver struct {
 	server *Server
 }
 
 func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInput, id *string) ([]*Account, error) {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
-
 	// Get single account
 	if id != nil {
 		r, err := r.server.accountClient.GetAccount(ctx, *id)
@@ -24,10 +27,7 @@ func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInpu
 			log.Println(err)
 			return nil, err
 		}
-		return []*Account{{
-			ID:   r.ID,
-			Name: r.Name,
-		}}, nil
+		return []*Account{toGraphQLAccount(*r)}, nil
 	}
 
 	// Get multiple accounts
@@ -44,20 +44,13 @@ func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInpu
 
 	var accounts []*Account
 	for _, a := range accountList {
-		account := &Account{
-			ID:   a.ID,
-			Name: a.Name,
-		}
-		accounts = append(accounts, account)
+		accounts = append(accounts, toGraphQLAccount(a))
 	}
 	return accounts, nil
 
 }
 
-func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInput, id *string, query *string) ([]*Product, error) {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
-
+func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInput, query *string, id *string, category *string, tags []string, sort *string) ([]*Product, error) {
 	// Get single
 	if id != nil {
 		r, err := r.server.catalogClient.GetProduct(ctx, *id)
@@ -65,12 +58,7 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 			log.Println(err)
 			return nil, err
 		}
-		return []*Product{{
-			ID:          r.ID,
-			Name:        r.Name,
-			Description: r.Description,
-			Price:       r.Price,
-		}}, nil
+		return []*Product{toGraphQLProduct(*r)}, nil
 	}
 
 	// Get multiple products
@@ -83,7 +71,7 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 	if query != nil {
 		q = *query
 	}
-	productList, err := r.server.catalogClient.GetProducts(ctx, skip, take, nil, q)
+	productList, err := r.server.catalogClient.GetProducts(ctx, skip, take, nil, q, productFilter(category, tags, sort))
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -91,19 +79,158 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 
 	var products []*Product
 	for _, a := range productList {
-		products = append(products,
-			&Product{
-				ID:          a.ID,
-				Name:        a.Name,
-				Description: a.Description,
-				Price:       a.Price,
-			},
-		)
+		products = append(products, toGraphQLProduct(a))
 	}
 
 	return products, nil
 }
 
+func (r *queryResolver) AccountsConnection(ctx context.Context, first *int, after *string) (*AccountConnection, error) {
+	cursor, firstValue, err := connectionArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := r.server.accountClient.GetAccountsPage(ctx, cursor, firstValue)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	connection := &AccountConnection{
+		Edges:      []*AccountEdge{},
+		TotalCount: int(page.TotalCount),
+	}
+	cursors := []string{}
+	for _, a := range page.Accounts {
+		c := encodeCursor(a.ID)
+		cursors = append(cursors, c)
+		connection.Edges = append(connection.Edges, &AccountEdge{
+			Cursor: c,
+			Node:   toGraphQLAccount(a),
+		})
+	}
+	connection.PageInfo = newPageInfo(cursors, cursor, page.HasNextPage)
+
+	return connection, nil
+}
+
+func (r *queryResolver) ProductsConnection(ctx context.Context, first *int, after *string, query *string, category *string, tags []string, sort *string) (*ProductConnection, error) {
+	cursor, firstValue, err := connectionArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	q := ""
+	if query != nil {
+		q = *query
+	}
+	page, err := r.server.catalogClient.GetProductsPage(ctx, q, productFilter(category, tags, sort), cursor, firstValue)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	connection := &ProductConnection{
+		Edges:      []*ProductEdge{},
+		TotalCount: int(page.TotalCount),
+	}
+	cursors := []string{}
+	for _, e := range page.Edges {
+		c := encodeCursor(e.Cursor)
+		cursors = append(cursors, c)
+		connection.Edges = append(connection.Edges, &ProductEdge{
+			Cursor: c,
+			Node:   toGraphQLProduct(e.Product),
+		})
+	}
+	connection.PageInfo = newPageInfo(cursors, cursor, page.HasNextPage)
+
+	return connection, nil
+}
+
+func (r *queryResolver) ProductSuggestions(ctx context.Context, prefix string, limit *int) ([]*ProductSuggestion, error) {
+	l := uint64(0)
+	if limit != nil && *limit > 0 {
+		l = uint64(*limit)
+	}
+
+	res, err := r.server.catalogClient.SuggestProducts(ctx, prefix, l)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	suggestions := []*ProductSuggestion{}
+	for _, s := range res {
+		suggestions = append(suggestions, &ProductSuggestion{
+			ID:   s.ID,
+			Name: s.Name,
+		})
+	}
+
+	return suggestions, nil
+}
+
+func (r *queryResolver) Categories(ctx context.Context) ([]*Category, error) {
+	categories, err := r.server.catalogClient.GetCategories(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLCategoryTree(categories), nil
+}
+
+func productFilter(category *string, tags []string, sort *string) catalog.ProductFilter {
+	filter := catalog.ProductFilter{Tags: tags}
+	if category != nil {
+		filter.CategoryID = *category
+	}
+	if sort != nil {
+		filter.Sort = catalog.ProductSort(*sort)
+	}
+	return filter
+}
+
+func (r *queryResolver) Cart(ctx context.Context, accountID string) (*Cart, error) {
+	c, err := r.server.cartClient.GetCart(ctx, accountID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return toGraphQLCart(c), nil
+}
+
+func (r *queryResolver) Payments(ctx context.Context, orderID string) ([]*Payment, error) {
+	payments, err := r.server.paymentClient.GetPaymentsForOrder(ctx, orderID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	res := []*Payment{}
+	for i := range payments {
+		res = append(res, toGraphQLPayment(&payments[i]))
+	}
+	return res, nil
+}
+
+func (r *queryResolver) Webhooks(ctx context.Context) ([]*Webhook, error) {
+	webhookList, err := r.server.orderClient.GetWebhooks(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	webhooks := []*Webhook{}
+	for _, w := range webhookList {
+		webhooks = append(webhooks, toGraphQLWebhook(w))
+	}
+	return webhooks, nil
+}
+
 func (p PaginationInput) bounds() (uint64, uint64) {
 	skipValue := uint64(0)
 	takeValue := uint64(100)
@@ -115,3 +242,120 @@ func (p PaginationInput) bounds() (uint64, uint64) {
 	}
 	return skipValue, takeValue
 }
+
+func (r *queryResolver) SalesReport(ctx context.Context, from time.Time, to time.Time, interval *string) (*SalesReport, error) {
+	intervalValue := order.ReportDaily
+	if interval != nil {
+		intervalValue = order.ReportInterval(*interval)
+	}
+
+	report, err := r.server.orderClient.GetSalesReport(ctx, from, to, intervalValue)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	res := &SalesReport{
+		From:              report.From,
+		To:                report.To,
+		Interval:          string(report.Interval),
+		OrderCount:        int(report.OrderCount),
+		Revenue:           report.Revenue,
+		AverageOrderValue: report.AverageOrderValue,
+		Buckets:           []*SalesBucket{},
+	}
+	for _, b := range report.Buckets {
+		res.Buckets = append(res.Buckets, &SalesBucket{
+			Start:             b.Start,
+			OrderCount:        int(b.OrderCount),
+			Revenue:           b.Revenue,
+			AverageOrderValue: b.AverageOrderValue,
+		})
+	}
+	return res, nil
+}
+
+func toGraphQLProduct(p catalog.Product) *Product {
+	res := &Product{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		Tags:        p.Tags,
+		Attributes:  []*ProductAttribute{},
+		Variants:    []*ProductVariant{},
+		Highlights:  []*ProductHighlight{},
+	}
+	if p.CategoryID != "" {
+		res.CategoryID = &p.CategoryID
+	}
+	if p.TaxCategory != "" {
+		res.TaxCategory = &p.TaxCategory
+	}
+	if p.RatingCount > 0 {
+		res.Rating = &ProductRating{
+			Average: p.Rating,
+			Count:   int(p.RatingCount),
+		}
+	}
+	if res.Tags == nil {
+		res.Tags = []string{}
+	}
+	for _, a := range p.Attributes {
+		res.Attributes = append(res.Attributes, &ProductAttribute{
+			Name:  a.Name,
+			Value: a.Value,
+		})
+	}
+	for _, v := range p.Variants {
+		variant := &ProductVariant{
+			ID:      v.ID,
+			Sku:     v.SKU,
+			Options: []*VariantOption{},
+			Price:   v.Price,
+		}
+		for _, o := range v.Options {
+			variant.Options = append(variant.Options, &VariantOption{Name: o.Name, Value: o.Value})
+		}
+		res.Variants = append(res.Variants, variant)
+	}
+	for _, h := range p.Highlights {
+		res.Highlights = append(res.Highlights, &ProductHighlight{
+			Field:     h.Field,
+			Fragments: h.Fragments,
+		})
+	}
+
+	return res
+}
+
+func toGraphQLCategory(c catalog.Category) *Category {
+	res := &Category{
+		ID:       c.ID,
+		Name:     c.Name,
+		Children: []*Category{},
+	}
+	if c.ParentID != "" {
+		res.ParentID = &c.ParentID
+	}
+	return res
+}
+
+// toGraphQLCategoryTree nests the flat list of categories the catalog returns
+// and gives back the roots. Children keep the order of the list.
+func toGraphQLCategoryTree(categories []catalog.Category) []*Category {
+	nodes := map[string]*Category{}
+	for _, c := range categories {
+		nodes[c.ID] = toGraphQLCategory(c)
+	}
+
+	roots := []*Category{}
+	for _, c := range categories {
+		if parent, ok := nodes[c.ParentID]; ok {
+			parent.Children = append(parent.Children, nodes[c.ID])
+		} else {
+			roots = append(roots, nodes[c.ID])
+		}
+	}
+	return roots
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+)
+
+type salesReportResolver struct {
+	server *Server
+}
+
+func (r *salesReportResolver) TopProducts(ctx context.Context, obj *SalesReport, orderBy *string, limit *int) ([]*ProductSales, error) {
+	by := order.RankByRevenue
+	if orderBy != nil {
+		by = order.ProductRanking(*orderBy)
+	}
+
+	limitValue, err := reportLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	productList, err := r.server.orderClient.GetTopProducts(ctx, obj.From, obj.To, by, limitValue)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	products := []*ProductSales{}
+	for _, p := range productList {
+		products = append(products, &ProductSales{
+			ProductID:  p.ProductID,
+			Name:       p.Name,
+			Quantity:   int(p.Quantity),
+			Revenue:    p.Revenue,
+			OrderCount: int(p.OrderCount),
+		})
+	}
+	return products, nil
+}
+
+func (r *salesReportResolver) TopAccounts(ctx context.Context, obj *SalesReport, accountIds []string, limit *int) ([]*AccountValue, error) {
+	limitValue, err := reportLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	accountList, err := r.server.orderClient.GetAccountValues(ctx, accountIds, limitValue)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	accounts := []*AccountValue{}
+	for _, a := range accountList {
+		accounts = append(accounts, &AccountValue{
+			AccountID:         a.AccountID,
+			OrderCount:        int(a.OrderCount),
+			LifetimeValue:     a.LifetimeValue,
+			AverageOrderValue: a.AverageOrderValue,
+			FirstOrderAt:      a.FirstOrderAt,
+			LastOrderAt:       a.LastOrderAt,
+		})
+	}
+	return accounts, nil
+}
+
+func reportLimit(limit *int) (uint32, error) {
+	if limit == nil {
+		return 0, nil
+	}
+	if *limit < 0 || *limit > maxListSize {
+		return 0, ErrInvalidParameter
+	}
+	return uint32(*limit), nil
+}
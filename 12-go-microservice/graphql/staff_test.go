@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStaffAuth(t *testing.T) {
+	keys := []string{"", "staff-key-1", "staff-key-2"}
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          bool
+	}{
+		{"first key", "Bearer staff-key-1", true},
+		{"second key", "Bearer staff-key-2", true},
+		{"no header", "", false},
+		{"unknown key", "Bearer staff-key-3", false},
+		{"empty key", "Bearer ", false},
+		{"other scheme", "Basic staff-key-1", false},
+		{"key prefix", "Bearer staff-key", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bool
+			handler := StaffAuth(keys, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = isStaff(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("isStaff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
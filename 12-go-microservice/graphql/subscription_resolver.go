@@ -0,0 +1,80 @@
+package main
+
+import (
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+)
+
+func toOrderSubscription(in OrderSubscriptionInput) (order.Subscription, error) {
+	sub := order.Subscription{
+		AccountID:       in.AccountID,
+		Products:        []order.SubscriptionItem{},
+		ShippingAddress: toOrderAddress(in.ShippingAddress),
+		Interval:        order.SubscriptionInterval(in.Interval),
+	}
+	for _, p := range in.Products {
+		if p.Quantity <= 0 {
+			return order.Subscription{}, ErrInvalidParameter
+		}
+		item := order.SubscriptionItem{
+			ProductID: p.ID,
+			Quantity:  uint32(p.Quantity),
+		}
+		if p.VariantID != nil {
+			item.VariantID = *p.VariantID
+		}
+		sub.Products = append(sub.Products, item)
+	}
+	if in.IntervalCount != nil {
+		if *in.IntervalCount <= 0 {
+			return order.Subscription{}, ErrInvalidParameter
+		}
+		sub.IntervalCount = uint32(*in.IntervalCount)
+	}
+	if in.FirstRunAt != nil {
+		sub.NextRunAt = *in.FirstRunAt
+	}
+	return sub, nil
+}
+
+func toGraphQLSubscription(s order.Subscription) *OrderSubscription {
+	res := &OrderSubscription{
+		ID:              s.ID,
+		AccountID:       s.AccountID,
+		Products:        []*OrderSubscriptionItem{},
+		ShippingAddress: toGraphQLAddress(s.ShippingAddress),
+		Interval:        string(s.Interval),
+		IntervalCount:   int(s.IntervalCount),
+		NextRunAt:       s.NextRunAt,
+		Status:          string(s.Status),
+		CreatedAt:       s.CreatedAt,
+		Runs:            []*OrderSubscriptionRun{},
+	}
+	for _, p := range s.Products {
+		item := &OrderSubscriptionItem{
+			ProductID: p.ProductID,
+			Quantity:  int(p.Quantity),
+		}
+		if p.VariantID != "" {
+			variantID := p.VariantID
+			item.VariantID = &variantID
+		}
+		res.Products = append(res.Products, item)
+	}
+	for _, r := range s.Runs {
+		run := &OrderSubscriptionRun{
+			ID:            r.ID,
+			ScheduledFor:  r.ScheduledFor,
+			Status:        string(r.Status),
+			Attempts:      int(r.Attempts),
+			NextAttemptAt: r.NextAttemptAt,
+			LastError:     r.LastError,
+			CreatedAt:     r.CreatedAt,
+		}
+		if r.OrderID != "" {
+			orderID := r.OrderID
+			run.OrderID = &orderID
+		}
+		res.Runs = append(res.Runs, run)
+	}
+	return res
+}
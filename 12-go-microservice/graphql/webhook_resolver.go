@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+)
+
+type webhookResolver struct {
+	server *Server
+}
+
+func (r *webhookResolver) Deliveries(ctx context.Context, obj *Webhook, pagination *PaginationInput) ([]*WebhookDelivery, error) {
+	skip, take := uint64(0), uint64(0)
+	if pagination != nil {
+		skip, take = pagination.bounds()
+	}
+
+	deliveryList, err := r.server.orderClient.GetWebhookDeliveries(ctx, obj.ID, skip, take)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	deliveries := []*WebhookDelivery{}
+	for _, d := range deliveryList {
+		deliveries = append(deliveries, toGraphQLWebhookDelivery(d))
+	}
+
+	return deliveries, nil
+}
+
+func toOrderWebhook(id string, in WebhookInput) (order.Webhook, error) {
+	types, err := order.ParseOrderEventTypes(in.EventTypes)
+	if err != nil {
+		return order.Webhook{}, err
+	}
+
+	w := order.Webhook{
+		ID:         id,
+		URL:        in.URL,
+		EventTypes: types,
+		Active:     true,
+	}
+	if in.Secret != nil {
+		w.Secret = *in.Secret
+	}
+	if in.Active != nil {
+		w.Active = *in.Active
+	}
+	return w, nil
+}
+
+func toGraphQLWebhook(w order.Webhook) *Webhook {
+	res := &Webhook{
+		ID:         w.ID,
+		URL:        w.URL,
+		EventTypes: []string{},
+		Active:     w.Active,
+		CreatedAt:  w.CreatedAt,
+	}
+	for _, t := range w.EventTypes {
+		res.EventTypes = append(res.EventTypes, t.String())
+	}
+	if w.Secret != "" {
+		res.Secret = &w.Secret
+	}
+	return res
+}
+
+func toGraphQLWebhookDelivery(d order.WebhookDelivery) *WebhookDelivery {
+	res := &WebhookDelivery{
+		ID:             d.ID,
+		WebhookID:      d.WebhookID,
+		EventID:        d.EventID,
+		EventType:      d.EventType.String(),
+		Payload:        string(d.Payload),
+		Status:         string(d.Status),
+		Attempts:       int(d.Attempts),
+		NextAttemptAt:  d.NextAttemptAt,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		DeliveredAt:    d.DeliveredAt,
+		AttemptLog:     []*WebhookAttempt{},
+	}
+	for _, a := range d.AttemptLog {
+		res.AttemptLog = append(res.AttemptLog, &WebhookAttempt{
+			AttemptedAt: a.AttemptedAt,
+			StatusCode:  a.StatusCode,
+			Error:       a.Error,
+			DurationMs:  int(a.Duration.Milliseconds()),
+		})
+	}
+	return res
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// fileMailer writes each message to an .eml file, which mail clients open
+// as is
+type fileMailer struct {
+	from string
+	dir  string
+}
+
+func NewFileMailer(cfg Config) (Mailer, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileMailer{from: cfg.From, dir: cfg.Dir}, nil
+}
+
+func (f *fileMailer) Send(ctx context.Context, m Message) error {
+	if m.From == "" {
+		m.From = f.from
+	}
+
+	now := time.Now().UTC()
+	data, err := Build(m, now)
+	if err != nil {
+		return err
+	}
+
+	// Named by time so the directory lists messages in the order they were sent
+	id := m.ID
+	if id == "" {
+		id = ksuid.New().String()
+	}
+	name := filepath.Join(f.dir, fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000"), filepath.Base(id)))
+
+	// Written under a temporary name so a reader never sees a partial message
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	log.Printf("Wrote email %q to %s", m.Subject, name)
+	return nil
+}
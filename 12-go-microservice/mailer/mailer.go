@@ -0,0 +1,183 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+)
+
+var (
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// Message is an email with a plain text and an HTML body. ID is unique per
+// message and becomes its Message-ID, so a message sent twice can be
+// recognized as a duplicate.
+type Message struct {
+	ID      string
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends emails. From defaults to the configured sender.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Config is read from the MAILER_* variables. The file driver writes every
+// message to Dir instead of sending it, for development.
+type Config struct {
+	Driver string `envconfig:"DRIVER" default:"file"`
+	From   string `envconfig:"FROM" default:"Shop <orders@localhost>"`
+	// File driver
+	Dir string `envconfig:"DIR" default:"mail"`
+	// SMTP driver, STARTTLS is used when the server offers it
+	Host     string        `envconfig:"SMTP_HOST" default:"localhost"`
+	Port     int           `envconfig:"SMTP_PORT" default:"25"`
+	Username string        `envconfig:"SMTP_USERNAME"`
+	Password string        `envconfig:"SMTP_PASSWORD"`
+	Timeout  time.Duration `envconfig:"SMTP_TIMEOUT" default:"30s"`
+}
+
+func (c Config) Validate() error {
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return fmt.Errorf("%w: MAILER_FROM %q is not a valid address", bootstrap.ErrInvalidConfig, c.From)
+	}
+	switch c.Driver {
+	case "file":
+		if c.Dir == "" {
+			return fmt.Errorf("%w: MAILER_DIR is required", bootstrap.ErrInvalidConfig)
+		}
+	case "smtp":
+		if c.Host == "" {
+			return fmt.Errorf("%w: MAILER_SMTP_HOST is required", bootstrap.ErrInvalidConfig)
+		}
+		if err := bootstrap.ValidatePort("MAILER_SMTP_PORT", c.Port); err != nil {
+			return err
+		}
+		if c.Timeout <= 0 {
+			return fmt.Errorf("%w: MAILER_SMTP_TIMEOUT must be positive", bootstrap.ErrInvalidConfig)
+		}
+	default:
+		return fmt.Errorf("%w: MAILER_DRIVER %q must be file or smtp", bootstrap.ErrInvalidConfig, c.Driver)
+	}
+	return nil
+}
+
+// Open creates the mailer of the configured driver
+func Open(cfg Config) (Mailer, error) {
+	if cfg.Driver == "smtp" {
+		return NewSMTPMailer(cfg), nil
+	}
+	return NewFileMailer(cfg)
+}
+
+// envelope returns the sender and recipient addresses of m
+func envelope(m Message) (*mail.Address, *mail.Address, error) {
+	sender, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: sender %q: %v", ErrInvalidMessage, m.From, err)
+	}
+	recipient, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: recipient %q: %v", ErrInvalidMessage, m.To, err)
+	}
+	if m.Text == "" && m.HTML == "" {
+		return nil, nil, fmt.Errorf("%w: body is empty", ErrInvalidMessage)
+	}
+	return sender, recipient, nil
+}
+
+// Build encodes m as a MIME message, multipart/alternative when it has both
+// a text and an HTML body
+func Build(m Message, date time.Time) ([]byte, error) {
+	sender, recipient, err := envelope(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	header := func(key string, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", sender.String())
+	header("To", recipient.String())
+	// Line breaks would start a new header
+	subject := strings.Join(strings.Fields(m.Subject), " ")
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", date.Format(time.RFC1123Z))
+	if m.ID != "" {
+		header("Message-ID", fmt.Sprintf("<%s@%s>", m.ID, domain(sender.Address)))
+	}
+	header("MIME-Version", "1.0")
+
+	if m.Text == "" || m.HTML == "" {
+		contentType, body := "text/plain", m.Text
+		if m.HTML != "" {
+			contentType, body = "text/html", m.HTML
+		}
+		header("Content-Type", contentType+"; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var parts bytes.Buffer
+	w := multipart.NewWriter(&parts)
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": w.Boundary()}))
+	buf.WriteString("\r\n")
+
+	// Clients show the last part they support, so HTML goes last
+	for _, part := range []struct{ contentType, body string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	buf.Write(parts.Bytes())
+	return buf.Bytes(), nil
+}
+
+// writeQuotedPrintable encodes body with CRLF line endings, as required by SMTP
+func writeQuotedPrintable(w io.Writer, body string) error {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func domain(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
@@ -6,17 +6,34 @@ import (
 	"time"
 
 	"github.com/leminkhoa/go-grpc-graphql-microservice/order/pb"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
+// Only idempotent reads are retried, retrying a write could apply it twice
+var retryableMethods = []string{
+	"GetOrder",
+	"GetOrdersForAccount",
+	"GetOrdersForAccountPage",
+	"GetSalesReport",
+	"GetTopProducts",
+	"GetAccountValues",
+	"GetRecommendations",
+	"GetWebhooks",
+	"GetWebhookDeliveries",
+	"GetOrderNotifications",
+	"GetInvoice",
+	"GetSubscription",
+	"GetSubscriptionsForAccount",
+}
+
 type Client struct {
 	conn    *grpc.ClientConn
 	service pb.OrderServiceClient
 }
 
-func NewClient(url string) (*Client, error) {
-	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewClient(url string, cfg resilience.Config) (*Client, error) {
+	conn, err := resilience.Dial(url, pb.OrderService_ServiceDesc.ServiceName, retryableMethods, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -32,19 +49,26 @@ func (c *Client) PostOrder(
 	ctx context.Context,
 	accountID string,
 	products []OrderedProduct,
+	shippingAddress *Address,
+	couponCode string,
+	idempotencyKey string,
 ) (*Order, error) {
 	protoProducts := []*pb.PostOrderRequest_OrderProduct{}
 	for _, p := range products {
 		protoProducts = append(protoProducts, &pb.PostOrderRequest_OrderProduct{
 			ProductId: p.ID,
+			VariantId: p.VariantID,
 			Quantity:  p.Quantity,
 		})
 	}
 	r, err := c.service.PostOrder(
 		ctx,
 		&pb.PostOrderRequest{
-			AccountId: accountID,
-			Products:  protoProducts,
+			AccountId:       accountID,
+			Products:        protoProducts,
+			ShippingAddress: addressToProto(shippingAddress),
+			CouponCode:      couponCode,
+			IdempotencyKey:  idempotencyKey,
 		},
 	)
 	if err != nil {
@@ -59,24 +83,386 @@ func (c *Client) PostOrder(
 	// Convert the enriched products from the response
 	var enrichedProducts []OrderedProduct
 	for _, p := range newOrder.Products {
-		enrichedProducts = append(enrichedProducts, OrderedProduct{
-			ID:          p.Id,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			Quantity:    p.Quantity,
-		})
+		enrichedProducts = append(enrichedProducts, orderedProductFromProto(p))
 	}
 
 	return &Order{
-		ID:         newOrder.Id,
-		CreatedAt:  newOrderCreatedAt,
-		TotalPrice: newOrder.TotalPrice,
-		AccountID:  newOrder.AccountId,
-		Products:   enrichedProducts,
+		ID:              newOrder.Id,
+		CreatedAt:       newOrderCreatedAt,
+		TotalPrice:      newOrder.TotalPrice,
+		AccountID:       newOrder.AccountId,
+		PaymentStatus:   PaymentStatus(newOrder.PaymentStatus),
+		ShippingAddress: addressFromProto(newOrder.ShippingAddress),
+		Products:        enrichedProducts,
+		Discounts:       discountsFromProto(newOrder.Id, newOrder.Discounts),
+		Subtotal:        newOrder.Subtotal,
+		TaxTotal:        newOrder.TaxTotal,
+		TaxInclusive:    newOrder.TaxInclusive,
+		TaxJurisdiction: newOrder.TaxJurisdiction,
+		Taxes:           taxesFromProto(newOrder.Id, newOrder.Taxes),
+		Shipments:       []Shipment{},
 	}, nil
 }
 
+func (c *Client) GetOrder(ctx context.Context, id string) (*Order, error) {
+	r, err := c.service.GetOrder(ctx, &pb.GetOrderRequest{
+		Id: id,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	o := orderFromProto(r.Order)
+	return &o, nil
+}
+
+func (c *Client) UpdatePaymentStatus(ctx context.Context, id string, status PaymentStatus) (*Order, error) {
+	r, err := c.service.UpdatePaymentStatus(ctx, &pb.UpdatePaymentStatusRequest{
+		OrderId:       id,
+		PaymentStatus: string(status),
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	o := orderFromProto(r.Order)
+	return &o, nil
+}
+
+// CreateShipment ships items of the order, or everything not shipped yet when items is empty
+func (c *Client) CreateShipment(ctx context.Context, orderID string, carrier string, trackingNumber string, items []ShipmentItem) (*Shipment, error) {
+	protoItems := []*pb.Shipment_ShipmentItem{}
+	for _, item := range items {
+		protoItems = append(protoItems, &pb.Shipment_ShipmentItem{
+			ProductId: item.ProductID,
+			VariantId: item.VariantID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	r, err := c.service.CreateShipment(ctx, &pb.CreateShipmentRequest{
+		OrderId:        orderID,
+		Carrier:        carrier,
+		TrackingNumber: trackingNumber,
+		Items:          protoItems,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return shipmentFromProto(r.Shipment), nil
+}
+
+// UpdateShipment changes the shipment, empty values are left unchanged
+func (c *Client) UpdateShipment(ctx context.Context, id string, carrier string, trackingNumber string, status ShipmentStatus) (*Shipment, error) {
+	r, err := c.service.UpdateShipment(ctx, &pb.UpdateShipmentRequest{
+		ShipmentId:     id,
+		Carrier:        carrier,
+		TrackingNumber: trackingNumber,
+		Status:         string(status),
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return shipmentFromProto(r.Shipment), nil
+}
+
+func (c *Client) CreatePromotion(ctx context.Context, p Promotion) (*Promotion, error) {
+	r, err := c.service.CreatePromotion(ctx, &pb.CreatePromotionRequest{
+		Promotion: promotionToProto(&p),
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return promotionFromProto(r.Promotion), nil
+}
+
+// UpdatePromotion replaces every field of the promotion with the given ID
+func (c *Client) UpdatePromotion(ctx context.Context, p Promotion) (*Promotion, error) {
+	r, err := c.service.UpdatePromotion(ctx, &pb.UpdatePromotionRequest{
+		Promotion: promotionToProto(&p),
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return promotionFromProto(r.Promotion), nil
+}
+
+func (c *Client) GetPromotions(ctx context.Context) ([]Promotion, error) {
+	r, err := c.service.GetPromotions(ctx, &pb.GetPromotionsRequest{})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	promotions := []Promotion{}
+	for _, p := range r.Promotions {
+		promotions = append(promotions, *promotionFromProto(p))
+	}
+	return promotions, nil
+}
+
+// CreateWebhook returns the webhook with its secret, generated when w has none
+func (c *Client) CreateWebhook(ctx context.Context, w Webhook) (*Webhook, error) {
+	r, err := c.service.CreateWebhook(ctx, &pb.CreateWebhookRequest{
+		Webhook: webhookToProto(&w),
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return webhookFromProto(r.Webhook)
+}
+
+// UpdateWebhook replaces the URL, event types and active flag of the webhook
+// with the given ID, and its secret when w has one
+func (c *Client) UpdateWebhook(ctx context.Context, w Webhook) (*Webhook, error) {
+	r, err := c.service.UpdateWebhook(ctx, &pb.UpdateWebhookRequest{
+		Webhook: webhookToProto(&w),
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return webhookFromProto(r.Webhook)
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	_, err := c.service.DeleteWebhook(ctx, &pb.DeleteWebhookRequest{Id: id})
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+func (c *Client) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	r, err := c.service.GetWebhooks(ctx, &pb.GetWebhooksRequest{})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	webhooks := []Webhook{}
+	for _, w := range r.Webhooks {
+		webhook, err := webhookFromProto(w)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, nil
+}
+
+func (c *Client) GetWebhookDeliveries(ctx context.Context, webhookID string, skip uint64, take uint64) ([]WebhookDelivery, error) {
+	r, err := c.service.GetWebhookDeliveries(ctx, &pb.GetWebhookDeliveriesRequest{
+		WebhookId: webhookID,
+		Skip:      skip,
+		Take:      take,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	deliveries := []WebhookDelivery{}
+	for _, d := range r.Deliveries {
+		deliveries = append(deliveries, webhookDeliveryFromProto(d))
+	}
+	return deliveries, nil
+}
+
+func (c *Client) RedeliverWebhook(ctx context.Context, deliveryID string) (*WebhookDelivery, error) {
+	r, err := c.service.RedeliverWebhook(ctx, &pb.RedeliverWebhookRequest{DeliveryId: deliveryID})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	d := webhookDeliveryFromProto(r.Delivery)
+	return &d, nil
+}
+
+func (c *Client) GetOrderNotifications(ctx context.Context, orderID string) ([]Notification, error) {
+	r, err := c.service.GetOrderNotifications(ctx, &pb.GetOrderNotificationsRequest{OrderId: orderID})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	notifications := []Notification{}
+	for _, n := range r.Notifications {
+		notifications = append(notifications, notificationFromProto(n))
+	}
+	return notifications, nil
+}
+
+func (c *Client) GetInvoice(ctx context.Context, orderID string) (*Invoice, error) {
+	r, err := c.service.GetInvoice(ctx, &pb.GetInvoiceRequest{OrderId: orderID})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	inv := &Invoice{
+		OrderID: r.Invoice.GetOrderId(),
+		Number:  r.Invoice.GetNumber(),
+		HTML:    []byte(r.Invoice.GetHtml()),
+		PDF:     r.Invoice.GetPdf(),
+	}
+	inv.IssuedAt.UnmarshalBinary(r.Invoice.GetIssuedAt())
+	return inv, nil
+}
+
+func (c *Client) GetSalesReport(ctx context.Context, from time.Time, to time.Time, interval ReportInterval) (*SalesReport, error) {
+	req := &pb.GetSalesReportRequest{Interval: string(interval)}
+	req.From, _ = from.MarshalBinary()
+	req.To, _ = to.MarshalBinary()
+
+	r, err := c.service.GetSalesReport(ctx, req)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	report := &SalesReport{
+		From:              from,
+		To:                to,
+		Interval:          interval,
+		Buckets:           []SalesBucket{},
+		OrderCount:        r.OrderCount,
+		Revenue:           r.Revenue,
+		AverageOrderValue: r.AverageOrderValue,
+	}
+	for _, b := range r.Buckets {
+		bucket := SalesBucket{
+			OrderCount:        b.OrderCount,
+			Revenue:           b.Revenue,
+			AverageOrderValue: b.AverageOrderValue,
+		}
+		bucket.Start.UnmarshalBinary(b.Start)
+		report.Buckets = append(report.Buckets, bucket)
+	}
+	return report, nil
+}
+
+func (c *Client) GetTopProducts(ctx context.Context, from time.Time, to time.Time, by ProductRanking, limit uint32) ([]ProductSales, error) {
+	req := &pb.GetTopProductsRequest{
+		OrderBy: string(by),
+		Limit:   limit,
+	}
+	req.From, _ = from.MarshalBinary()
+	req.To, _ = to.MarshalBinary()
+
+	r, err := c.service.GetTopProducts(ctx, req)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	products := []ProductSales{}
+	for _, p := range r.Products {
+		products = append(products, ProductSales{
+			ProductID:  p.ProductId,
+			Name:       p.Name,
+			Quantity:   p.Quantity,
+			Revenue:    p.Revenue,
+			OrderCount: p.OrderCount,
+		})
+	}
+	return products, nil
+}
+
+func (c *Client) GetAccountValues(ctx context.Context, accountIDs []string, limit uint32) ([]AccountValue, error) {
+	r, err := c.service.GetAccountValues(ctx, &pb.GetAccountValuesRequest{
+		AccountIds: accountIDs,
+		Limit:      limit,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	accounts := []AccountValue{}
+	for _, a := range r.Accounts {
+		account := AccountValue{
+			AccountID:         a.AccountId,
+			OrderCount:        a.OrderCount,
+			LifetimeValue:     a.LifetimeValue,
+			AverageOrderValue: a.AverageOrderValue,
+		}
+		account.FirstOrderAt.UnmarshalBinary(a.FirstOrderAt)
+		account.LastOrderAt.UnmarshalBinary(a.LastOrderAt)
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func (c *Client) GetRecommendations(ctx context.Context, productID string, limit uint32) ([]Recommendation, error) {
+	r, err := c.service.GetRecommendations(ctx, &pb.GetRecommendationsRequest{
+		ProductId: productID,
+		Limit:     limit,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	recommendations := []Recommendation{}
+	for _, rec := range r.Recommendations {
+		recommendations = append(recommendations, Recommendation{
+			ProductID: rec.ProductId,
+			Score:     rec.Score,
+		})
+	}
+	return recommendations, nil
+}
+
+// WatchOrderEvents calls handle for every order event, of the account when
+// accountID is set, until the stream ends or ctx is done. connected is called
+// once the subscription is live.
+func (c *Client) WatchOrderEvents(ctx context.Context, accountID string, connected func(), handle func(OrderEvent)) error {
+	stream, err := c.service.WatchOrderEvents(ctx, &pb.WatchOrderEventsRequest{AccountId: accountID})
+	if err != nil {
+		return err
+	}
+
+	// Wait for the stream to be established before reporting it as connected
+	if _, err := stream.Header(); err != nil {
+		return err
+	}
+	connected()
+
+	for {
+		e, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		event := OrderEvent{
+			Type:           OrderEventType(e.Type),
+			OrderID:        e.OrderId,
+			AccountID:      e.AccountId,
+			TotalPrice:     e.TotalPrice,
+			PaymentStatus:  PaymentStatus(e.PaymentStatus),
+			ShipmentID:     e.ShipmentId,
+			ShipmentStatus: ShipmentStatus(e.ShipmentStatus),
+		}
+		event.OccurredAt.UnmarshalBinary(e.OccurredAt)
+		handle(event)
+	}
+}
+
 func (c *Client) GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error) {
 	r, err := c.service.GetOrdersForAccount(ctx, &pb.GetOrdersForAccountRequest{
 		AccountId: accountID,
@@ -89,27 +475,350 @@ func (c *Client) GetOrdersForAccount(ctx context.Context, accountID string) ([]O
 	// Create response orders
 	orders := []Order{}
 	for _, orderProto := range r.Orders {
-		newOrder := Order{
-			ID:         orderProto.Id,
-			TotalPrice: orderProto.TotalPrice,
-			AccountID:  orderProto.AccountId,
+		orders = append(orders, orderFromProto(orderProto))
+	}
+	return orders, nil
+}
+
+func (c *Client) GetOrdersForAccountPage(ctx context.Context, accountID string, after string, first uint64) (*OrderPage, error) {
+	r, err := c.service.GetOrdersForAccountPage(ctx, &pb.GetOrdersForAccountPageRequest{
+		AccountId: accountID,
+		After:     after,
+		First:     first,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	page := &OrderPage{
+		Orders:      []Order{},
+		TotalCount:  r.TotalCount,
+		HasNextPage: r.HasNextPage,
+	}
+	for _, orderProto := range r.Orders {
+		page.Orders = append(page.Orders, orderFromProto(orderProto))
+	}
+	return page, nil
+}
+
+func orderFromProto(orderProto *pb.Order) Order {
+	newOrder := Order{
+		ID:              orderProto.Id,
+		TotalPrice:      orderProto.TotalPrice,
+		AccountID:       orderProto.AccountId,
+		PaymentStatus:   PaymentStatus(orderProto.PaymentStatus),
+		ShippingAddress: addressFromProto(orderProto.ShippingAddress),
+		Discounts:       discountsFromProto(orderProto.Id, orderProto.Discounts),
+		Subtotal:        orderProto.Subtotal,
+		TaxTotal:        orderProto.TaxTotal,
+		TaxInclusive:    orderProto.TaxInclusive,
+		TaxJurisdiction: orderProto.TaxJurisdiction,
+		Taxes:           taxesFromProto(orderProto.Id, orderProto.Taxes),
+		Shipments:       []Shipment{},
+	}
+	newOrder.CreatedAt = time.Time{}
+	newOrder.CreatedAt.UnmarshalBinary(orderProto.CreatedAt)
+
+	products := []OrderedProduct{}
+	for _, p := range orderProto.Products {
+		products = append(products, orderedProductFromProto(p))
+	}
+	newOrder.Products = products
+
+	for _, s := range orderProto.Shipments {
+		newOrder.Shipments = append(newOrder.Shipments, *shipmentFromProto(s))
+	}
+
+	return newOrder
+}
+
+func discountsFromProto(orderID string, discounts []*pb.Discount) []Discount {
+	res := []Discount{}
+	for _, d := range discounts {
+		res = append(res, Discount{
+			OrderID:     orderID,
+			PromotionID: d.PromotionId,
+			Code:        d.Code,
+			ProductID:   d.ProductId,
+			Description: d.Description,
+			Amount:      d.Amount,
+		})
+	}
+	return res
+}
+
+func taxesFromProto(orderID string, taxes []*pb.TaxLine) []TaxLine {
+	res := []TaxLine{}
+	for _, t := range taxes {
+		res = append(res, TaxLine{
+			OrderID:       orderID,
+			ProductID:     t.ProductId,
+			Category:      t.Category,
+			Rate:          t.Rate,
+			TaxableAmount: t.TaxableAmount,
+			Amount:        t.Amount,
+		})
+	}
+	return res
+}
+
+func promotionFromProto(p *pb.Promotion) *Promotion {
+	promotion := &Promotion{
+		ID:                   p.GetId(),
+		Code:                 p.GetCode(),
+		Description:          p.GetDescription(),
+		Type:                 PromotionType(p.GetType()),
+		Value:                p.GetValue(),
+		BuyQuantity:          p.GetBuyQuantity(),
+		GetQuantity:          p.GetGetQuantity(),
+		ProductIDs:           p.GetProductIds(),
+		MinSpend:             p.GetMinSpend(),
+		UsageLimitPerAccount: p.GetUsageLimitPerAccount(),
+		StartsAt:             timeFromProto(p.GetStartsAt()),
+		EndsAt:               timeFromProto(p.GetEndsAt()),
+		Active:               p.GetActive(),
+	}
+	promotion.CreatedAt.UnmarshalBinary(p.GetCreatedAt())
+
+	return promotion
+}
+
+func webhookFromProto(w *pb.Webhook) (*Webhook, error) {
+	types, err := ParseOrderEventTypes(w.GetEventTypes())
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &Webhook{
+		ID:         w.GetId(),
+		URL:        w.GetUrl(),
+		EventTypes: types,
+		Secret:     w.GetSecret(),
+		Active:     w.GetActive(),
+	}
+	webhook.CreatedAt.UnmarshalBinary(w.GetCreatedAt())
+
+	return webhook, nil
+}
+
+func webhookDeliveryFromProto(d *pb.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:             d.GetId(),
+		WebhookID:      d.GetWebhookId(),
+		EventID:        d.GetEventId(),
+		Payload:        []byte(d.GetPayload()),
+		Status:         WebhookDeliveryStatus(d.GetStatus()),
+		Attempts:       d.GetAttempts(),
+		NextAttemptAt:  timeFromProto(d.GetNextAttemptAt()),
+		LastStatusCode: int(d.GetLastStatusCode()),
+		LastError:      d.GetLastError(),
+		DeliveredAt:    timeFromProto(d.GetDeliveredAt()),
+		AttemptLog:     []WebhookAttempt{},
+	}
+	delivery.EventType.UnmarshalText([]byte(d.GetEventType()))
+	delivery.CreatedAt.UnmarshalBinary(d.GetCreatedAt())
+	for _, a := range d.GetAttemptLog() {
+		attempt := WebhookAttempt{
+			StatusCode: int(a.GetStatusCode()),
+			Error:      a.GetError(),
+			Duration:   time.Duration(a.GetDurationMs()) * time.Millisecond,
 		}
-		newOrder.CreatedAt = time.Time{}
-		newOrder.CreatedAt.UnmarshalBinary(orderProto.CreatedAt)
-
-		products := []OrderedProduct{}
-		for _, p := range orderProto.Products {
-			products = append(products, OrderedProduct{
-				ID:          p.Id,
-				Quantity:    p.Quantity,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
+		attempt.AttemptedAt.UnmarshalBinary(a.GetAttemptedAt())
+		delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+	}
+
+	return delivery
+}
+
+func (c *Client) CreateSubscription(ctx context.Context, sub Subscription) (*Subscription, error) {
+	r, err := c.service.CreateSubscription(ctx, &pb.CreateSubscriptionRequest{
+		Subscription: subscriptionToProto(&sub),
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	created := subscriptionFromProto(r.Subscription)
+	return &created, nil
+}
+
+func (c *Client) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	r, err := c.service.GetSubscription(ctx, &pb.GetSubscriptionRequest{Id: id})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	sub := subscriptionFromProto(r.Subscription)
+	return &sub, nil
+}
+
+func (c *Client) GetSubscriptionsForAccount(ctx context.Context, accountID string) ([]Subscription, error) {
+	r, err := c.service.GetSubscriptionsForAccount(ctx, &pb.GetSubscriptionsForAccountRequest{AccountId: accountID})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	subscriptions := []Subscription{}
+	for _, sub := range r.Subscriptions {
+		subscriptions = append(subscriptions, subscriptionFromProto(sub))
+	}
+	return subscriptions, nil
+}
+
+func (c *Client) PauseSubscription(ctx context.Context, id string) (*Subscription, error) {
+	return c.updateSubscriptionStatus(ctx, id, c.service.PauseSubscription)
+}
+
+func (c *Client) ResumeSubscription(ctx context.Context, id string) (*Subscription, error) {
+	return c.updateSubscriptionStatus(ctx, id, c.service.ResumeSubscription)
+}
+
+func (c *Client) CancelSubscription(ctx context.Context, id string) (*Subscription, error) {
+	return c.updateSubscriptionStatus(ctx, id, c.service.CancelSubscription)
+}
+
+func (c *Client) updateSubscriptionStatus(
+	ctx context.Context,
+	id string,
+	update func(ctx context.Context, r *pb.UpdateSubscriptionStatusRequest, opts ...grpc.CallOption) (*pb.UpdateSubscriptionStatusResponse, error),
+) (*Subscription, error) {
+	r, err := update(ctx, &pb.UpdateSubscriptionStatusRequest{Id: id})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	sub := subscriptionFromProto(r.Subscription)
+	return &sub, nil
+}
+
+func notificationFromProto(n *pb.OrderNotification) Notification {
+	notification := Notification{
+		ID:            n.GetId(),
+		OrderID:       n.GetOrderId(),
+		Kind:          NotificationKind(n.GetKind()),
+		Recipient:     n.GetRecipient(),
+		Status:        NotificationStatus(n.GetStatus()),
+		Attempts:      n.GetAttempts(),
+		NextAttemptAt: timeFromProto(n.GetNextAttemptAt()),
+		LastError:     n.GetLastError(),
+		SentAt:        timeFromProto(n.GetSentAt()),
+	}
+	notification.CreatedAt.UnmarshalBinary(n.GetCreatedAt())
+
+	return notification
+}
+
+func subscriptionFromProto(s *pb.OrderSubscription) Subscription {
+	sub := Subscription{
+		ID:              s.GetId(),
+		AccountID:       s.GetAccountId(),
+		Products:        []SubscriptionItem{},
+		ShippingAddress: addressFromProto(s.GetShippingAddress()),
+		Interval:        SubscriptionInterval(s.GetInterval()),
+		IntervalCount:   s.GetIntervalCount(),
+		Status:          SubscriptionStatus(s.GetStatus()),
+		Runs:            []SubscriptionRun{},
+	}
+	// Left zero when unset, so the first run is one interval after creation
+	if next := timeFromProto(s.GetNextRunAt()); next != nil {
+		sub.NextRunAt = *next
+	}
+	sub.CreatedAt.UnmarshalBinary(s.GetCreatedAt())
+	for _, p := range s.GetProducts() {
+		sub.Products = append(sub.Products, SubscriptionItem{
+			ProductID: p.GetProductId(),
+			VariantID: p.GetVariantId(),
+			Quantity:  p.GetQuantity(),
+		})
+	}
+	for _, r := range s.GetRuns() {
+		run := SubscriptionRun{
+			ID:             r.GetId(),
+			SubscriptionID: sub.ID,
+			Status:         SubscriptionRunStatus(r.GetStatus()),
+			OrderID:        r.GetOrderId(),
+			Attempts:       r.GetAttempts(),
+			NextAttemptAt:  timeFromProto(r.GetNextAttemptAt()),
+			LastError:      r.GetLastError(),
 		}
-		newOrder.Products = products
+		run.ScheduledFor.UnmarshalBinary(r.GetScheduledFor())
+		run.CreatedAt.UnmarshalBinary(r.GetCreatedAt())
+		sub.Runs = append(sub.Runs, run)
+	}
+
+	return sub
+}
 
-		orders = append(orders, newOrder)
+func addressFromProto(a *pb.Address) *Address {
+	if a == nil {
+		return nil
 	}
-	return orders, nil
+
+	return &Address{
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		State:      a.State,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func orderedProductFromProto(p *pb.Order_OrderProduct) OrderedProduct {
+	res := OrderedProduct{
+		ID:          p.Id,
+		VariantID:   p.VariantId,
+		SKU:         p.Sku,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		Quantity:    p.Quantity,
+	}
+	for _, o := range p.Options {
+		res.Options = append(res.Options, VariantOption{Name: o.Name, Value: o.Value})
+	}
+	return res
+}
+
+func shipmentFromProto(s *pb.Shipment) *Shipment {
+	shipment := &Shipment{
+		ID:             s.Id,
+		OrderID:        s.OrderId,
+		Carrier:        s.Carrier,
+		TrackingNumber: s.TrackingNumber,
+		Status:         ShipmentStatus(s.Status),
+		Items:          []ShipmentItem{},
+	}
+	shipment.CreatedAt.UnmarshalBinary(s.CreatedAt)
+	shipment.ShippedAt = timeFromProto(s.ShippedAt)
+	shipment.DeliveredAt = timeFromProto(s.DeliveredAt)
+
+	for _, item := range s.Items {
+		shipment.Items = append(shipment.Items, ShipmentItem{
+			ProductID: item.ProductId,
+			VariantID: item.VariantId,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	return shipment
+}
+
+// timeFromProto reads an optional timestamp, empty bytes mean it is not set
+func timeFromProto(b []byte) *time.Time {
+	if len(b) == 0 {
+		return nil
+	}
+
+	t := time.Time{}
+	if err := t.UnmarshalBinary(b); err != nil {
+		return nil
+	}
+	return &t
 }
@@ -1,44 +1,153 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
-	"time"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
 
-	"github.com/kelseyhightower/envconfig"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/account"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/broker"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/mailer"
 	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
-	"github.com/tinrab/retry"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
 )
 
 type Config struct {
-	DatabaseURL string `envconfig:"DATABASE_URL"`
-	AccountURL  string `envconfig:"ACCOUNT_SERVICE_URL"`
-	CatalogURL  string `envconfig:"CATALOG_SERVICE_URL"`
+	bootstrap.Config
+	Database   bootstrap.DatabaseConfig `envconfig:"DATABASE"`
+	HTTPPort   int                      `envconfig:"HTTP_PORT" default:"8090"`
+	AccountURL string                   `envconfig:"ACCOUNT_SERVICE_URL" required:"true"`
+	CatalogURL string                   `envconfig:"CATALOG_SERVICE_URL" required:"true"`
+
+	RPC             resilience.Config          `envconfig:"RPC"`
+	ProductCache    order.ProductCacheConfig   `envconfig:"PRODUCT_CACHE"`
+	Recommendations order.RecommendationConfig `envconfig:"RECOMMENDATIONS"`
+	Broker          broker.Config              `envconfig:"BROKER"`
+	Outbox          order.OutboxConfig         `envconfig:"OUTBOX"`
+	Webhooks        order.WebhookConfig        `envconfig:"WEBHOOKS"`
+	Mailer          mailer.Config              `envconfig:"MAILER"`
+	Notifications   order.NotificationConfig   `envconfig:"NOTIFICATIONS"`
+	Invoices        order.InvoiceConfig        `envconfig:"INVOICES"`
+	Subscriptions   order.SubscriptionConfig   `envconfig:"SUBSCRIPTIONS"`
+	MetricsAddr     string                     `envconfig:"METRICS_ADDR"`
+	TaxConfig       string                     `envconfig:"TAX_CONFIG_FILE"`
+}
+
+func (c Config) Validate() error {
+	return bootstrap.ValidatePort("HTTP_PORT", c.HTTPPort)
 }
 
 func main() {
 	var cfg Config
-
-	err := envconfig.Process("", &cfg)
-	if err != nil {
+	if err := bootstrap.Load(&cfg); err != nil {
 		log.Fatal(err)
 	}
+	bootstrap.Banner("order", &cfg)
+
+	// Background jobs run until the process is asked to stop, and finish
+	// their current batch before it exits
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	var jobs sync.WaitGroup
+	run := func(job func(context.Context)) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(ctx)
+		}()
+	}
 
 	// Repository
-	var r order.Repository
-	retry.ForeverSleep(
-		2*time.Second,
-		func(_ int) (err error) {
-			r, err = order.NewPostgresRepository(cfg.DatabaseURL)
-			if err != nil {
-				log.Println(err)
-			}
-			return
-		},
-	)
+	r, err := bootstrap.WaitFor(cfg.Startup, "database", func() (order.Repository, error) {
+		return order.NewPostgresRepository(cfg.Database)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer r.Close()
-	log.Println("Listening on port 8080...")
+	log.Printf("Listening on port %d, REST/JSON on port %d...", cfg.Port, cfg.HTTPPort)
+
+	// Orders are not taxed without a tax configuration
+	var tax *order.TaxCalculator
+	if cfg.TaxConfig != "" {
+		tax, err = order.LoadTaxCalculator(cfg.TaxConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// Service
-	s := order.NewService(r)
-	log.Fatal(order.ListenGRPC(s, cfg.AccountURL, cfg.CatalogURL, 8080))
+	s := order.NewService(r, tax)
+
+	// Order events are relayed from the outbox to the broker
+	b, err := bootstrap.WaitFor(cfg.Startup, "broker", func() (broker.Broker, error) {
+		return broker.Open(cfg.Broker)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer b.Close()
+	run(func(ctx context.Context) { order.RunOutboxRelay(ctx, r, b, cfg.Outbox) })
+
+	// Webhooks are sent from the events on the broker
+	run(func(ctx context.Context) { order.RunWebhookDispatcher(ctx, r, b, cfg.Webhooks) })
+
+	// Customers are emailed a confirmation of their orders
+	m, err := mailer.Open(cfg.Mailer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	accountClient, err := account.NewClient(cfg.AccountURL, cfg.RPC)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer accountClient.Close()
+	catalogClient, err := catalog.NewClient(cfg.CatalogURL, cfg.RPC)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer catalogClient.Close()
+	notifier := order.NewNotifier(s, r, accountClient, catalogClient, m, cfg.Notifications)
+	run(func(ctx context.Context) { notifier.Run(ctx, b) })
+
+	// Paid orders are invoiced
+	invoicer := order.NewInvoicer(s, r, accountClient, catalogClient, cfg.Invoices)
+	run(func(ctx context.Context) { invoicer.Run(ctx, b) })
+
+	// Subscription orders are placed through the gRPC server below, like any other order
+	orderClient, err := order.NewClient(fmt.Sprintf("localhost:%d", cfg.Port), cfg.RPC)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer orderClient.Close()
+	run(func(ctx context.Context) { order.RunSubscriptionScheduler(ctx, r, orderClient, cfg.Subscriptions) })
+
+	// Product pair scores are updated in the background as orders come in
+	run(func(ctx context.Context) { order.RunRecommendationJob(ctx, r, cfg.Recommendations) })
+
+	// Expose expvar metrics such as the product cache hit ratio on /debug/vars
+	if cfg.MetricsAddr != "" {
+		go func() {
+			log.Println(http.ListenAndServe(cfg.MetricsAddr, nil))
+		}()
+	}
+
+	// The REST/JSON gateway forwards to the gRPC server below
+	go func() {
+		log.Fatal(order.ListenHTTP(cfg.Port, cfg.HTTPPort))
+	}()
+
+	go func() {
+		log.Fatal(order.ListenGRPC(s, cfg.AccountURL, cfg.CatalogURL, cfg.RPC, cfg.ProductCache, cfg.Port))
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down, waiting for background jobs...")
+	jobs.Wait()
 }
@@ -0,0 +1,107 @@
+package order
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type OrderEventType int
+
+const (
+	OrderCreated OrderEventType = iota
+	OrderPaymentStatusChanged
+	OrderShipmentCreated
+	OrderShipmentUpdated
+)
+
+func (t OrderEventType) String() string {
+	switch t {
+	case OrderCreated:
+		return "created"
+	case OrderPaymentStatusChanged:
+		return "payment_status_changed"
+	case OrderShipmentCreated:
+		return "shipment_created"
+	case OrderShipmentUpdated:
+		return "shipment_updated"
+	default:
+		return "unknown"
+	}
+}
+
+// Event types are written by name in the outbox and on the broker
+func (t OrderEventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *OrderEventType) UnmarshalText(text []byte) error {
+	for _, et := range []OrderEventType{OrderCreated, OrderPaymentStatusChanged, OrderShipmentCreated, OrderShipmentUpdated} {
+		if et.String() == string(text) {
+			*t = et
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown order event type %q", text)
+}
+
+// OrderEvent describes a change to an order. Shipment fields are only set
+// for shipment events. ID is unique per event, consumers of the broker use
+// it to ignore redeliveries.
+type OrderEvent struct {
+	ID             string         `json:"id"`
+	Type           OrderEventType `json:"type"`
+	OrderID        string         `json:"orderId"`
+	AccountID      string         `json:"accountId"`
+	TotalPrice     float64        `json:"totalPrice"`
+	PaymentStatus  PaymentStatus  `json:"paymentStatus"`
+	ShipmentID     string         `json:"shipmentId,omitempty"`
+	ShipmentStatus ShipmentStatus `json:"shipmentStatus,omitempty"`
+	OccurredAt     time.Time      `json:"occurredAt"`
+}
+
+// eventHub fans order events out to every subscriber. A subscriber that
+// falls behind is disconnected rather than blocking writes, it is expected
+// to resubscribe.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan OrderEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: map[chan OrderEvent]struct{}{},
+	}
+}
+
+func (h *eventHub) publish(e OrderEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *eventHub) subscribe() (<-chan OrderEvent, func()) {
+	ch := make(chan OrderEvent, 64)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
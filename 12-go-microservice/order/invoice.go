@@ -0,0 +1,360 @@
+package order
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/account"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/broker"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+)
+
+var (
+	ErrInvoiceNotFound = errors.New("invoice not found, orders are invoiced once paid")
+)
+
+// Invoice of a paid order. Numbers follow each other without gaps in the
+// order invoices are issued. The documents are rendered once, when the
+// invoice is issued, and never change afterwards.
+type Invoice struct {
+	OrderID  string
+	Number   string
+	IssuedAt time.Time
+	HTML     []byte
+	PDF      []byte
+}
+
+type InvoiceConfig struct {
+	// Invoice numbers are the prefix followed by at least 6 digits, e.g. INV-000042
+	Prefix     string `envconfig:"PREFIX" default:"INV-"`
+	SellerName string `envconfig:"SELLER_NAME" default:"Shop"`
+	// Lines of the seller address, separated by semicolons
+	SellerAddress string `envconfig:"SELLER_ADDRESS"`
+}
+
+func (c InvoiceConfig) Validate() error {
+	if len(c.Prefix) > 16 {
+		return fmt.Errorf("%w: INVOICES_PREFIX is longer than 16 characters", bootstrap.ErrInvalidConfig)
+	}
+	if c.SellerName == "" {
+		return fmt.Errorf("%w: INVOICES_SELLER_NAME is required", bootstrap.ErrInvalidConfig)
+	}
+	return nil
+}
+
+func (c InvoiceConfig) number(seq uint64) string {
+	return fmt.Sprintf("%s%06d", c.Prefix, seq)
+}
+
+// GetInvoice returns the invoice of an order, which only exists once the
+// order was paid
+func (s orderService) GetInvoice(ctx context.Context, orderID string) (*Invoice, error) {
+	return s.repository.GetInvoice(ctx, orderID)
+}
+
+// Invoicer issues the invoice of every order paid. Like the confirmation
+// email, it shows the account and product names as they were when it was
+// issued.
+type Invoicer struct {
+	service  Service
+	repo     Repository
+	accounts *account.Client
+	catalog  *catalog.Client
+	cfg      InvoiceConfig
+}
+
+func NewInvoicer(s Service, r Repository, accounts *account.Client, catalog *catalog.Client, cfg InvoiceConfig) *Invoicer {
+	return &Invoicer{s, r, accounts, catalog, cfg}
+}
+
+// Run issues invoices from the order events on b until ctx is done. An
+// invoice that fails to be issued is retried when the broker redelivers the
+// event.
+func (iv *Invoicer) Run(ctx context.Context, b broker.Broker) {
+	consumeOrderEvents(ctx, b, "invoices", time.Second, func(ctx context.Context, e OrderEvent) error {
+		if e.Type != OrderPaymentStatusChanged || e.PaymentStatus != PaymentPaid {
+			return nil
+		}
+		return iv.Issue(ctx, e.OrderID)
+	})
+}
+
+// Issue creates the invoice of an order, unless it already has one
+func (iv *Invoicer) Issue(ctx context.Context, orderID string) error {
+	o, err := iv.service.GetOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if err := NameProducts(ctx, iv.catalog, o); err != nil {
+		return err
+	}
+
+	a, err := iv.accounts.GetAccount(ctx, o.AccountID)
+	if err != nil {
+		return err
+	}
+	addresses, err := iv.accounts.GetAddresses(ctx, o.AccountID)
+	if err != nil {
+		return err
+	}
+
+	customer := invoiceCustomer{
+		Name:    a.Name,
+		Email:   a.Email,
+		Address: o.ShippingAddress,
+	}
+	if a.DisplayName != "" {
+		customer.Name = a.DisplayName
+	}
+	// Billed to the default billing address, or where the order was shipped
+	for _, address := range addresses {
+		if address.Type == account.AddressBilling && address.IsDefault {
+			customer.Address = &Address{
+				Name:       address.Name,
+				Line1:      address.Line1,
+				Line2:      address.Line2,
+				City:       address.City,
+				State:      address.State,
+				PostalCode: address.PostalCode,
+				Country:    address.Country,
+			}
+		}
+	}
+
+	return iv.repo.PutInvoice(ctx, orderID, func(seq uint64) (Invoice, error) {
+		inv := Invoice{
+			OrderID:  orderID,
+			Number:   iv.cfg.number(seq),
+			IssuedAt: time.Now().UTC(),
+		}
+		doc := newInvoiceDocument(inv, *o, customer, iv.cfg)
+
+		var html bytes.Buffer
+		if err := invoiceHTML.Execute(&html, doc); err != nil {
+			return Invoice{}, err
+		}
+		pdf, err := renderInvoicePDF(doc)
+		if err != nil {
+			return Invoice{}, err
+		}
+
+		inv.HTML = html.Bytes()
+		inv.PDF = pdf
+		log.Printf("Issued invoice %s for order %s", inv.Number, orderID)
+		return inv, nil
+	})
+}
+
+type invoiceCustomer struct {
+	Name    string
+	Email   string
+	Address *Address
+}
+
+// invoiceDocument is what both the HTML and the PDF invoice show
+type invoiceDocument struct {
+	Number        string
+	IssuedAt      time.Time
+	SellerName    string
+	SellerAddress []string
+	Customer      invoiceCustomer
+	Order         Order
+	Lines         []invoiceLine
+	Discounts     []invoiceAmount
+	Taxes         []invoiceAmount
+}
+
+type invoiceLine struct {
+	Description string
+	Quantity    uint32
+	UnitPrice   float64
+	Amount      float64
+}
+
+type invoiceAmount struct {
+	Label  string
+	Amount float64
+}
+
+func newInvoiceDocument(inv Invoice, o Order, customer invoiceCustomer, cfg InvoiceConfig) invoiceDocument {
+	doc := invoiceDocument{
+		Number:     inv.Number,
+		IssuedAt:   inv.IssuedAt,
+		SellerName: cfg.SellerName,
+		Customer:   customer,
+		Order:      o,
+	}
+	for _, line := range strings.Split(cfg.SellerAddress, ";") {
+		if line = strings.TrimSpace(line); line != "" {
+			doc.SellerAddress = append(doc.SellerAddress, line)
+		}
+	}
+
+	for _, p := range o.Products {
+		description := p.Name
+		if description == "" {
+			description = p.ID
+		}
+		if options := formatOptions(p.Options); options != "" {
+			description += " (" + options + ")"
+		}
+		if p.SKU != "" {
+			description += ", SKU " + p.SKU
+		}
+		doc.Lines = append(doc.Lines, invoiceLine{
+			Description: description,
+			Quantity:    p.Quantity,
+			UnitPrice:   p.Price,
+			Amount:      roundCents(p.Price * float64(p.Quantity)),
+		})
+	}
+
+	for _, d := range o.Discounts {
+		doc.Discounts = append(doc.Discounts, invoiceAmount{d.Description, d.Amount})
+	}
+
+	// Tax lines are per product, the invoice sums them per category and rate
+	index := map[string]int{}
+	for _, t := range o.Taxes {
+		label := fmt.Sprintf("%s tax %g%%", t.Category, t.Rate)
+		if o.TaxInclusive {
+			label += " included"
+		}
+		i, ok := index[label]
+		if !ok {
+			i = len(doc.Taxes)
+			index[label] = i
+			doc.Taxes = append(doc.Taxes, invoiceAmount{Label: label})
+		}
+		doc.Taxes[i].Amount = roundCents(doc.Taxes[i].Amount + t.Amount)
+	}
+
+	return doc
+}
+
+var invoiceHTML = htmltemplate.Must(htmltemplate.New("invoice.html").Funcs(templateFuncs).ParseFS(templateFS, "templates/invoice.html"))
+
+// renderInvoicePDF lays the invoice out on A4 pages with the standard
+// Helvetica font, which covers Western European characters only
+func renderInvoicePDF(d invoiceDocument) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle(d.Number, true)
+	pdf.SetAuthor(d.SellerName, true)
+	pdf.SetCreationDate(d.IssuedAt)
+	pdf.SetMargins(15, 15, 15)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, tr("Invoice "+d.Number), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 5, "Issued on "+d.IssuedAt.Format("January 2, 2006"), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 5, "Order "+d.Order.ID+", placed on "+d.Order.CreatedAt.Format("January 2, 2006"), "", 1, "L", false, 0, "")
+	pdf.Ln(6)
+
+	// Seller on the left, customer on the right
+	seller := append([]string{d.SellerName}, d.SellerAddress...)
+	customer := []string{d.Customer.Name, d.Customer.Email}
+	if a := d.Customer.Address; a != nil {
+		customer = append(customer, addressLines(a)...)
+	}
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(90, 5, "From", "", 0, "L", false, 0, "")
+	pdf.CellFormat(90, 5, "Bill to", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for i := 0; i < max(len(seller), len(customer)); i++ {
+		left, right := "", ""
+		if i < len(seller) {
+			left = seller[i]
+		}
+		if i < len(customer) {
+			right = customer[i]
+		}
+		pdf.CellFormat(90, 5, tr(left), "", 0, "L", false, 0, "")
+		pdf.CellFormat(90, 5, tr(right), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(8)
+
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(235, 235, 235)
+	pdf.CellFormat(100, 7, "Description", "B", 0, "L", true, 0, "")
+	pdf.CellFormat(20, 7, "Qty", "B", 0, "R", true, 0, "")
+	pdf.CellFormat(30, 7, "Unit price", "B", 0, "R", true, 0, "")
+	pdf.CellFormat(30, 7, "Amount", "B", 1, "R", true, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, l := range d.Lines {
+		// Long descriptions wrap, the numbers stay on the first line
+		lines := wrapText(pdf, tr(l.Description), 98)
+		pdf.CellFormat(100, 6, lines[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(20, 6, fmt.Sprint(l.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 6, formatMoney(l.UnitPrice), "", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 6, formatMoney(l.Amount), "", 1, "R", false, 0, "")
+		for _, line := range lines[1:] {
+			pdf.CellFormat(100, 6, line, "", 1, "L", false, 0, "")
+		}
+	}
+	pdf.Ln(2)
+
+	total := func(label string, amount string, style string) {
+		pdf.SetFont("Helvetica", style, 10)
+		pdf.CellFormat(150, 6, tr(label), "", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 6, amount, "", 1, "R", false, 0, "")
+	}
+	total("Subtotal", formatMoney(d.Order.Subtotal), "")
+	for _, discount := range d.Discounts {
+		total(discount.Label, "-"+formatMoney(discount.Amount), "")
+	}
+	for _, tax := range d.Taxes {
+		total(tax.Label, formatMoney(tax.Amount), "")
+	}
+	total("Total", formatMoney(d.Order.TotalPrice), "B")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// wrapText splits text, already in the single byte encoding of the font, into
+// lines no wider than width. SplitText measures runes, so each byte is passed
+// as the rune of the same value.
+func wrapText(pdf *fpdf.Fpdf, text string, width float64) []string {
+	runes := make([]rune, len(text))
+	for i := 0; i < len(text); i++ {
+		runes[i] = rune(text[i])
+	}
+
+	lines := []string{}
+	for _, line := range pdf.SplitText(string(runes), width) {
+		b := make([]byte, 0, len(line))
+		for _, r := range line {
+			b = append(b, byte(r))
+		}
+		lines = append(lines, string(b))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+func addressLines(a *Address) []string {
+	lines := []string{a.Name, a.Line1}
+	if a.Line2 != "" {
+		lines = append(lines, a.Line2)
+	}
+	city := a.PostalCode + " " + a.City
+	if a.State != "" {
+		city += ", " + a.State
+	}
+	return append(lines, city, a.Country)
+}
@@ -0,0 +1,309 @@
+package order
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/account"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/broker"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/mailer"
+	"github.com/segmentio/ksuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NotificationKind is the email sent, each kind is sent at most once per order
+type NotificationKind string
+
+const (
+	NotificationOrderConfirmation NotificationKind = "order_confirmation"
+)
+
+type NotificationStatus string
+
+const (
+	NotificationPending NotificationStatus = "pending"
+	NotificationSent    NotificationStatus = "sent"
+	// NotificationFailed notifications ran out of attempts or can never be sent
+	NotificationFailed NotificationStatus = "failed"
+)
+
+// Notification is an email about an order. Recipient is the email of the
+// account when it was last attempted, accounts may change it in the meantime.
+type Notification struct {
+	ID            string
+	OrderID       string
+	Kind          NotificationKind
+	Recipient     string
+	Status        NotificationStatus
+	Attempts      uint32
+	NextAttemptAt *time.Time
+	LastError     string
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+//go:embed templates
+var templateFS embed.FS
+
+var templateFuncs = map[string]any{
+	"money": formatMoney,
+	"lineTotal": func(p OrderedProduct) float64 {
+		return roundCents(p.Price * float64(p.Quantity))
+	},
+	"options": formatOptions,
+}
+
+func formatMoney(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+// formatOptions describes a variant, e.g. Size: M, Color: Red
+func formatOptions(options []VariantOption) string {
+	values := []string{}
+	for _, o := range options {
+		values = append(values, o.Name+": "+o.Value)
+	}
+	return strings.Join(values, ", ")
+}
+
+var (
+	confirmationText = texttemplate.Must(texttemplate.New("order_confirmation.txt").Funcs(templateFuncs).ParseFS(templateFS, "templates/order_confirmation.txt"))
+	confirmationHTML = htmltemplate.Must(htmltemplate.New("order_confirmation.html").Funcs(templateFuncs).ParseFS(templateFS, "templates/order_confirmation.html"))
+)
+
+// RenderOrderConfirmation returns the confirmation email of o sent to the
+// account that placed it. Products are expected to carry their names.
+func RenderOrderConfirmation(o Order, a account.Account) (mailer.Message, error) {
+	name := a.DisplayName
+	if name == "" {
+		name = a.Name
+	}
+	data := struct {
+		Name  string
+		Order Order
+	}{name, o}
+
+	var text, html bytes.Buffer
+	if err := confirmationText.Execute(&text, data); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := confirmationHTML.Execute(&html, data); err != nil {
+		return mailer.Message{}, err
+	}
+
+	return mailer.Message{
+		To:      a.Email,
+		Subject: fmt.Sprintf("Your order %s is confirmed", o.ID),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// GetOrderNotifications returns the emails sent about an order, oldest first
+func (s orderService) GetOrderNotifications(ctx context.Context, orderID string) ([]Notification, error) {
+	if _, err := s.repository.GetOrderByID(ctx, orderID); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetNotificationsForOrder(ctx, orderID)
+}
+
+type NotificationConfig struct {
+	Interval  time.Duration `envconfig:"INTERVAL" default:"1s"`
+	BatchSize int           `envconfig:"BATCH_SIZE" default:"20"`
+	// Retries wait InitialBackoff, then twice as long each time up to MaxBackoff
+	MaxAttempts    uint32        `envconfig:"MAX_ATTEMPTS" default:"5"`
+	InitialBackoff time.Duration `envconfig:"INITIAL_BACKOFF" default:"1m"`
+	MaxBackoff     time.Duration `envconfig:"MAX_BACKOFF" default:"1h"`
+}
+
+func (c NotificationConfig) Validate() error {
+	if c.Interval <= 0 || c.BatchSize < 1 || c.MaxAttempts < 1 || c.InitialBackoff <= 0 {
+		return fmt.Errorf("%w: NOTIFICATIONS_INTERVAL, NOTIFICATIONS_BATCH_SIZE, NOTIFICATIONS_MAX_ATTEMPTS and NOTIFICATIONS_INITIAL_BACKOFF must be positive", bootstrap.ErrInvalidConfig)
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		return fmt.Errorf("%w: NOTIFICATIONS_MAX_BACKOFF is below NOTIFICATIONS_INITIAL_BACKOFF", bootstrap.ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Notifier emails customers about their orders. The account and product
+// names are looked up when an email is sent, as they are not stored with
+// orders.
+type Notifier struct {
+	service  Service
+	repo     Repository
+	accounts *account.Client
+	catalog  *catalog.Client
+	mailer   mailer.Mailer
+	cfg      NotificationConfig
+}
+
+func NewNotifier(s Service, r Repository, accounts *account.Client, catalog *catalog.Client, m mailer.Mailer, cfg NotificationConfig) *Notifier {
+	return &Notifier{s, r, accounts, catalog, m, cfg}
+}
+
+// Run queues a confirmation for every order created on b, and sends due
+// notifications until ctx is done
+func (n *Notifier) Run(ctx context.Context, b broker.Broker) {
+	consumed := make(chan struct{})
+	defer func() { <-consumed }()
+	go func() {
+		defer close(consumed)
+		consumeOrderEvents(ctx, b, "notifications", n.cfg.Interval, n.queue)
+	}()
+
+	ticker := time.NewTicker(n.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			sent, err := n.sendDue(ctx)
+			if err != nil {
+				log.Printf("Error sending notifications: %v", err)
+				break
+			}
+			if sent < n.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (n *Notifier) queue(ctx context.Context, e OrderEvent) error {
+	if e.Type != OrderCreated {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	return n.repo.PutNotification(ctx, Notification{
+		ID:            ksuid.New().String(),
+		OrderID:       e.OrderID,
+		Kind:          NotificationOrderConfirmation,
+		Status:        NotificationPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	})
+}
+
+// sendDue sends a batch of due notifications, returning how many were attempted
+func (n *Notifier) sendDue(ctx context.Context) (int, error) {
+	// Claimed notifications are not due again until the lease is over, in
+	// case this process stops before recording the attempts
+	lease := time.Duration(n.cfg.BatchSize)*time.Minute + time.Minute
+	claimed, err := n.repo.ClaimNotifications(ctx, n.cfg.BatchSize, time.Now().UTC(), lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, notification := range claimed {
+		err := n.send(ctx, &notification)
+		now := time.Now().UTC()
+
+		notification.Attempts++
+		switch {
+		case err == nil:
+			notification.Status = NotificationSent
+			notification.NextAttemptAt = nil
+			notification.LastError = ""
+			notification.SentAt = &now
+		case permanent(err) || notification.Attempts >= n.cfg.MaxAttempts:
+			notification.Status = NotificationFailed
+			notification.NextAttemptAt = nil
+			notification.LastError = err.Error()
+		default:
+			next := now.Add(backoff(n.cfg.InitialBackoff, n.cfg.MaxBackoff, notification.Attempts))
+			notification.NextAttemptAt = &next
+			notification.LastError = err.Error()
+		}
+		if err != nil {
+			log.Printf("Error sending notification %s of order %s: %v", notification.ID, notification.OrderID, err)
+		}
+
+		if err := n.repo.UpdateNotification(ctx, notification); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(claimed), nil
+}
+
+func (n *Notifier) send(ctx context.Context, notification *Notification) error {
+	o, err := n.service.GetOrder(ctx, notification.OrderID)
+	if err != nil {
+		return err
+	}
+	a, err := n.accounts.GetAccount(ctx, o.AccountID)
+	if err != nil {
+		return err
+	}
+	notification.Recipient = a.Email
+
+	if err := NameProducts(ctx, n.catalog, o); err != nil {
+		return err
+	}
+
+	m, err := RenderOrderConfirmation(*o, *a)
+	if err != nil {
+		return err
+	}
+	// Lets mail clients recognize a message sent again after a lost reply
+	m.ID = notification.ID
+	return n.mailer.Send(ctx, m)
+}
+
+// permanent reports whether retrying an email would fail the same way
+func permanent(err error) bool {
+	return errors.Is(err, ErrOrderNotFound) ||
+		errors.Is(err, mailer.ErrInvalidMessage) ||
+		status.Code(err) == codes.NotFound
+}
+
+// NameProducts sets the names and descriptions of the products of o from the catalog
+func NameProducts(ctx context.Context, c *catalog.Client, o *Order) error {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, p := range o.Products {
+		if !seen[p.ID] {
+			seen[p.ID] = true
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	products, err := c.GetProducts(ctx, 0, uint64(len(ids)), ids, "", catalog.ProductFilter{})
+	if err != nil {
+		return err
+	}
+
+	found := map[string]catalog.Product{}
+	for _, p := range products {
+		found[p.ID] = p
+	}
+	for i, p := range o.Products {
+		if cp, ok := found[p.ID]; ok {
+			o.Products[i].Name = cp.Name
+			o.Products[i].Description = cp.Description
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package order
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/broker"
+)
+
+// Order events are written to an outbox table in the transaction of the
+// change they describe, and a relay publishes them to the broker. An event is
+// only lost if the change is, but it may be published more than once. A single
+// relay runs at a time across order services, holding a Postgres advisory
+// lock, so events are published in outbox order. Transactions that commit
+// out of order can still put a later event before an earlier one.
+
+// OrderEventsSubject matches every order event on the broker
+const OrderEventsSubject = "orders.>"
+
+// Subject is the broker subject of events of type t, e.g. orders.created
+func (t OrderEventType) Subject() string {
+	return "orders." + t.String()
+}
+
+type OutboxConfig struct {
+	Interval  time.Duration `envconfig:"INTERVAL" default:"1s"`
+	BatchSize int           `envconfig:"BATCH_SIZE" default:"100"`
+}
+
+func (c OutboxConfig) Validate() error {
+	if c.Interval <= 0 || c.BatchSize < 1 {
+		return fmt.Errorf("%w: OUTBOX_INTERVAL and OUTBOX_BATCH_SIZE must be positive", bootstrap.ErrInvalidConfig)
+	}
+	return nil
+}
+
+// RunOutboxRelay publishes the outbox to b until ctx is done. Events that
+// fail to publish stay in the outbox and are retried on the next run.
+func RunOutboxRelay(ctx context.Context, r Repository, b broker.Broker, cfg OutboxConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	publish := func(e OrderEvent) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return b.Publish(ctx, broker.Message{
+			Subject: e.Type.Subject(),
+			ID:      e.ID,
+			Data:    data,
+		})
+	}
+
+	for {
+		for {
+			n, err := r.RelayOutboxEvents(ctx, cfg.BatchSize, publish)
+			if err != nil {
+				log.Printf("Error relaying order events: %v", err)
+				break
+			}
+			if n < cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ConsumeOrderEvents passes the order events on b to handle until ctx is
+// done. The broker remembers the last event handled by consumer, and events
+// are redelivered until handle succeeds, so handle may see an event twice.
+func ConsumeOrderEvents(ctx context.Context, b broker.Broker, consumer string, handle func(context.Context, OrderEvent) error) error {
+	return b.Subscribe(ctx, consumer, OrderEventsSubject, func(ctx context.Context, m broker.Message) error {
+		e := OrderEvent{}
+		if err := json.Unmarshal(m.Data, &e); err != nil {
+			// Retrying would never succeed
+			log.Printf("Skipping malformed order event %s: %v", m.ID, err)
+			return nil
+		}
+		return handle(ctx, e)
+	})
+}
+
+// consumeOrderEvents runs ConsumeOrderEvents until ctx is done, subscribing
+// again every retry after it stops on an error
+func consumeOrderEvents(ctx context.Context, b broker.Broker, consumer string, retry time.Duration, handle func(context.Context, OrderEvent) error) {
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+
+	for {
+		err := ConsumeOrderEvents(ctx, b, consumer, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Order event consumer %s stopped, resubscribing: %v", consumer, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
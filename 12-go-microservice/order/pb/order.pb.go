@@ -7,6 +7,7 @@
 package pb
 
 import (
+	_ "google.golang.org/genproto/googleapis/api/annotations"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	reflect "reflect"
@@ -21,31 +22,85 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
-type Order struct {
+type OrderEvent_Type int32
+
+const (
+	OrderEvent_CREATED                OrderEvent_Type = 0
+	OrderEvent_PAYMENT_STATUS_CHANGED OrderEvent_Type = 1
+	OrderEvent_SHIPMENT_CREATED       OrderEvent_Type = 2
+	OrderEvent_SHIPMENT_UPDATED       OrderEvent_Type = 3
+)
+
+// Enum value maps for OrderEvent_Type.
+var (
+	OrderEvent_Type_name = map[int32]string{
+		0: "CREATED",
+		1: "PAYMENT_STATUS_CHANGED",
+		2: "SHIPMENT_CREATED",
+		3: "SHIPMENT_UPDATED",
+	}
+	OrderEvent_Type_value = map[string]int32{
+		"CREATED":                0,
+		"PAYMENT_STATUS_CHANGED": 1,
+		"SHIPMENT_CREATED":       2,
+		"SHIPMENT_UPDATED":       3,
+	}
+)
+
+func (x OrderEvent_Type) Enum() *OrderEvent_Type {
+	p := new(OrderEvent_Type)
+	*p = x
+	return p
+}
+
+func (x OrderEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (OrderEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_order_proto_enumTypes[0].Descriptor()
+}
+
+func (OrderEvent_Type) Type() protoreflect.EnumType {
+	return &file_order_proto_enumTypes[0]
+}
+
+func (x OrderEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use OrderEvent_Type.Descriptor instead.
+func (OrderEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{64, 0}
+}
+
+type Address struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	CreatedAt     []byte                 `protobuf:"bytes,2,opt,name=createdAt,proto3" json:"createdAt,omitempty"`
-	AccountId     string                 `protobuf:"bytes,3,opt,name=accountId,proto3" json:"accountId,omitempty"`
-	TotalPrice    float64                `protobuf:"fixed64,4,opt,name=totalPrice,proto3" json:"totalPrice,omitempty"`
-	Products      []*Order_OrderProduct  `protobuf:"bytes,5,rep,name=products,proto3" json:"products,omitempty"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Line1         string                 `protobuf:"bytes,2,opt,name=line1,proto3" json:"line1,omitempty"`
+	Line2         string                 `protobuf:"bytes,3,opt,name=line2,proto3" json:"line2,omitempty"`
+	City          string                 `protobuf:"bytes,4,opt,name=city,proto3" json:"city,omitempty"`
+	State         string                 `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	PostalCode    string                 `protobuf:"bytes,6,opt,name=postalCode,proto3" json:"postalCode,omitempty"`
+	Country       string                 `protobuf:"bytes,7,opt,name=country,proto3" json:"country,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Order) Reset() {
-	*x = Order{}
+func (x *Address) Reset() {
+	*x = Address{}
 	mi := &file_order_proto_msgTypes[0]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Order) String() string {
+func (x *Address) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Order) ProtoMessage() {}
+func (*Address) ProtoMessage() {}
 
-func (x *Order) ProtoReflect() protoreflect.Message {
+func (x *Address) ProtoReflect() protoreflect.Message {
 	mi := &file_order_proto_msgTypes[0]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -57,120 +112,4253 @@ func (x *Order) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Order.ProtoReflect.Descriptor instead.
-func (*Order) Descriptor() ([]byte, []int) {
+// Deprecated: Use Address.ProtoReflect.Descriptor instead.
+func (*Address) Descriptor() ([]byte, []int) {
 	return file_order_proto_rawDescGZIP(), []int{0}
 }
 
-func (x *Order) GetId() string {
+func (x *Address) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Address) GetLine1() string {
+	if x != nil {
+		return x.Line1
+	}
+	return ""
+}
+
+func (x *Address) GetLine2() string {
+	if x != nil {
+		return x.Line2
+	}
+	return ""
+}
+
+func (x *Address) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *Address) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Address) GetPostalCode() string {
+	if x != nil {
+		return x.PostalCode
+	}
+	return ""
+}
+
+func (x *Address) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+type Shipment struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	OrderId        string                 `protobuf:"bytes,2,opt,name=orderId,proto3" json:"orderId,omitempty"`
+	Carrier        string                 `protobuf:"bytes,3,opt,name=carrier,proto3" json:"carrier,omitempty"`
+	TrackingNumber string                 `protobuf:"bytes,4,opt,name=trackingNumber,proto3" json:"trackingNumber,omitempty"`
+	Status         string                 `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`
+	CreatedAt      []byte                 `protobuf:"bytes,6,opt,name=createdAt,proto3" json:"createdAt,omitempty"`
+	// Empty until the shipment is shipped or delivered
+	ShippedAt     []byte                   `protobuf:"bytes,7,opt,name=shippedAt,proto3" json:"shippedAt,omitempty"`
+	DeliveredAt   []byte                   `protobuf:"bytes,8,opt,name=deliveredAt,proto3" json:"deliveredAt,omitempty"`
+	Items         []*Shipment_ShipmentItem `protobuf:"bytes,9,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Shipment) Reset() {
+	*x = Shipment{}
+	mi := &file_order_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Shipment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Shipment) ProtoMessage() {}
+
+func (x *Shipment) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Shipment.ProtoReflect.Descriptor instead.
+func (*Shipment) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Shipment) GetId() string {
 	if x != nil {
 		return x.Id
 	}
 	return ""
 }
 
-func (x *Order) GetCreatedAt() []byte {
+func (x *Shipment) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *Shipment) GetCarrier() string {
+	if x != nil {
+		return x.Carrier
+	}
+	return ""
+}
+
+func (x *Shipment) GetTrackingNumber() string {
+	if x != nil {
+		return x.TrackingNumber
+	}
+	return ""
+}
+
+func (x *Shipment) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Shipment) GetCreatedAt() []byte {
 	if x != nil {
 		return x.CreatedAt
 	}
 	return nil
 }
 
-func (x *Order) GetAccountId() string {
+func (x *Shipment) GetShippedAt() []byte {
 	if x != nil {
-		return x.AccountId
+		return x.ShippedAt
 	}
-	return ""
+	return nil
 }
 
-func (x *Order) GetTotalPrice() float64 {
+func (x *Shipment) GetDeliveredAt() []byte {
 	if x != nil {
-		return x.TotalPrice
+		return x.DeliveredAt
 	}
-	return 0
+	return nil
 }
 
-func (x *Order) GetProducts() []*Order_OrderProduct {
+func (x *Shipment) GetItems() []*Shipment_ShipmentItem {
 	if x != nil {
-		return x.Products
+		return x.Items
 	}
 	return nil
 }
 
-type PostOrderRequest struct {
-	state         protoimpl.MessageState           `protogen:"open.v1"`
-	AccountId     string                           `protobuf:"bytes,2,opt,name=accountId,proto3" json:"accountId,omitempty"`
-	Products      []*PostOrderRequest_OrderProduct `protobuf:"bytes,4,rep,name=products,proto3" json:"products,omitempty"`
+type Discount struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PromotionId   string                 `protobuf:"bytes,1,opt,name=promotionId,proto3" json:"promotionId,omitempty"`
+	Code          string                 `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	ProductId     string                 `protobuf:"bytes,3,opt,name=productId,proto3" json:"productId,omitempty"`
+	Description   string                 `protobuf:"bytes,4,opt,name=description,proto3" json:"description,omitempty"`
+	Amount        float64                `protobuf:"fixed64,5,opt,name=amount,proto3" json:"amount,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *PostOrderRequest) Reset() {
-	*x = PostOrderRequest{}
-	mi := &file_order_proto_msgTypes[1]
+func (x *Discount) Reset() {
+	*x = Discount{}
+	mi := &file_order_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *PostOrderRequest) String() string {
+func (x *Discount) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*PostOrderRequest) ProtoMessage() {}
+func (*Discount) ProtoMessage() {}
+
+func (x *Discount) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Discount.ProtoReflect.Descriptor instead.
+func (*Discount) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Discount) GetPromotionId() string {
+	if x != nil {
+		return x.PromotionId
+	}
+	return ""
+}
+
+func (x *Discount) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Discount) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *Discount) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Discount) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+type Promotion struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Empty for promotions that apply automatically
+	Code                 string   `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	Description          string   `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	Type                 string   `protobuf:"bytes,4,opt,name=type,proto3" json:"type,omitempty"`
+	Value                float64  `protobuf:"fixed64,5,opt,name=value,proto3" json:"value,omitempty"`
+	BuyQuantity          uint32   `protobuf:"varint,6,opt,name=buyQuantity,proto3" json:"buyQuantity,omitempty"`
+	GetQuantity          uint32   `protobuf:"varint,7,opt,name=getQuantity,proto3" json:"getQuantity,omitempty"`
+	ProductIds           []string `protobuf:"bytes,8,rep,name=productIds,proto3" json:"productIds,omitempty"`
+	MinSpend             float64  `protobuf:"fixed64,9,opt,name=minSpend,proto3" json:"minSpend,omitempty"`
+	UsageLimitPerAccount uint32   `protobuf:"varint,10,opt,name=usageLimitPerAccount,proto3" json:"usageLimitPerAccount,omitempty"`
+	// Empty when the promotion has no start or end
+	StartsAt      []byte `protobuf:"bytes,11,opt,name=startsAt,proto3" json:"startsAt,omitempty"`
+	EndsAt        []byte `protobuf:"bytes,12,opt,name=endsAt,proto3" json:"endsAt,omitempty"`
+	Active        bool   `protobuf:"varint,13,opt,name=active,proto3" json:"active,omitempty"`
+	CreatedAt     []byte `protobuf:"bytes,14,opt,name=createdAt,proto3" json:"createdAt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Promotion) Reset() {
+	*x = Promotion{}
+	mi := &file_order_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Promotion) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Promotion) ProtoMessage() {}
+
+func (x *Promotion) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Promotion.ProtoReflect.Descriptor instead.
+func (*Promotion) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Promotion) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Promotion) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Promotion) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Promotion) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Promotion) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Promotion) GetBuyQuantity() uint32 {
+	if x != nil {
+		return x.BuyQuantity
+	}
+	return 0
+}
+
+func (x *Promotion) GetGetQuantity() uint32 {
+	if x != nil {
+		return x.GetQuantity
+	}
+	return 0
+}
+
+func (x *Promotion) GetProductIds() []string {
+	if x != nil {
+		return x.ProductIds
+	}
+	return nil
+}
+
+func (x *Promotion) GetMinSpend() float64 {
+	if x != nil {
+		return x.MinSpend
+	}
+	return 0
+}
+
+func (x *Promotion) GetUsageLimitPerAccount() uint32 {
+	if x != nil {
+		return x.UsageLimitPerAccount
+	}
+	return 0
+}
+
+func (x *Promotion) GetStartsAt() []byte {
+	if x != nil {
+		return x.StartsAt
+	}
+	return nil
+}
+
+func (x *Promotion) GetEndsAt() []byte {
+	if x != nil {
+		return x.EndsAt
+	}
+	return nil
+}
+
+func (x *Promotion) GetActive() bool {
+	if x != nil {
+		return x.Active
+	}
+	return false
+}
+
+func (x *Promotion) GetCreatedAt() []byte {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+type TaxLine struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=productId,proto3" json:"productId,omitempty"`
+	Category      string                 `protobuf:"bytes,2,opt,name=category,proto3" json:"category,omitempty"`
+	Rate          float64                `protobuf:"fixed64,3,opt,name=rate,proto3" json:"rate,omitempty"`
+	TaxableAmount float64                `protobuf:"fixed64,4,opt,name=taxableAmount,proto3" json:"taxableAmount,omitempty"`
+	Amount        float64                `protobuf:"fixed64,5,opt,name=amount,proto3" json:"amount,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TaxLine) Reset() {
+	*x = TaxLine{}
+	mi := &file_order_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaxLine) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaxLine) ProtoMessage() {}
+
+func (x *TaxLine) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaxLine.ProtoReflect.Descriptor instead.
+func (*TaxLine) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TaxLine) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *TaxLine) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+func (x *TaxLine) GetRate() float64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+func (x *TaxLine) GetTaxableAmount() float64 {
+	if x != nil {
+		return x.TaxableAmount
+	}
+	return 0
+}
+
+func (x *TaxLine) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+type Order struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreatedAt       []byte                 `protobuf:"bytes,2,opt,name=createdAt,proto3" json:"createdAt,omitempty"`
+	AccountId       string                 `protobuf:"bytes,3,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	TotalPrice      float64                `protobuf:"fixed64,4,opt,name=totalPrice,proto3" json:"totalPrice,omitempty"`
+	Products        []*Order_OrderProduct  `protobuf:"bytes,5,rep,name=products,proto3" json:"products,omitempty"`
+	PaymentStatus   string                 `protobuf:"bytes,6,opt,name=paymentStatus,proto3" json:"paymentStatus,omitempty"`
+	ShippingAddress *Address               `protobuf:"bytes,7,opt,name=shippingAddress,proto3" json:"shippingAddress,omitempty"`
+	Shipments       []*Shipment            `protobuf:"bytes,8,rep,name=shipments,proto3" json:"shipments,omitempty"`
+	Discounts       []*Discount            `protobuf:"bytes,9,rep,name=discounts,proto3" json:"discounts,omitempty"`
+	Subtotal        float64                `protobuf:"fixed64,10,opt,name=subtotal,proto3" json:"subtotal,omitempty"`
+	TaxTotal        float64                `protobuf:"fixed64,11,opt,name=taxTotal,proto3" json:"taxTotal,omitempty"`
+	TaxInclusive    bool                   `protobuf:"varint,12,opt,name=taxInclusive,proto3" json:"taxInclusive,omitempty"`
+	TaxJurisdiction string                 `protobuf:"bytes,13,opt,name=taxJurisdiction,proto3" json:"taxJurisdiction,omitempty"`
+	Taxes           []*TaxLine             `protobuf:"bytes,14,rep,name=taxes,proto3" json:"taxes,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Order) Reset() {
+	*x = Order{}
+	mi := &file_order_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Order) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Order) ProtoMessage() {}
+
+func (x *Order) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Order.ProtoReflect.Descriptor instead.
+func (*Order) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Order) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Order) GetCreatedAt() []byte {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Order) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+func (x *Order) GetTotalPrice() float64 {
+	if x != nil {
+		return x.TotalPrice
+	}
+	return 0
+}
+
+func (x *Order) GetProducts() []*Order_OrderProduct {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+func (x *Order) GetPaymentStatus() string {
+	if x != nil {
+		return x.PaymentStatus
+	}
+	return ""
+}
+
+func (x *Order) GetShippingAddress() *Address {
+	if x != nil {
+		return x.ShippingAddress
+	}
+	return nil
+}
+
+func (x *Order) GetShipments() []*Shipment {
+	if x != nil {
+		return x.Shipments
+	}
+	return nil
+}
+
+func (x *Order) GetDiscounts() []*Discount {
+	if x != nil {
+		return x.Discounts
+	}
+	return nil
+}
+
+func (x *Order) GetSubtotal() float64 {
+	if x != nil {
+		return x.Subtotal
+	}
+	return 0
+}
+
+func (x *Order) GetTaxTotal() float64 {
+	if x != nil {
+		return x.TaxTotal
+	}
+	return 0
+}
+
+func (x *Order) GetTaxInclusive() bool {
+	if x != nil {
+		return x.TaxInclusive
+	}
+	return false
+}
+
+func (x *Order) GetTaxJurisdiction() string {
+	if x != nil {
+		return x.TaxJurisdiction
+	}
+	return ""
+}
+
+func (x *Order) GetTaxes() []*TaxLine {
+	if x != nil {
+		return x.Taxes
+	}
+	return nil
+}
+
+type PostOrderRequest struct {
+	state           protoimpl.MessageState           `protogen:"open.v1"`
+	AccountId       string                           `protobuf:"bytes,2,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	Products        []*PostOrderRequest_OrderProduct `protobuf:"bytes,4,rep,name=products,proto3" json:"products,omitempty"`
+	ShippingAddress *Address                         `protobuf:"bytes,5,opt,name=shippingAddress,proto3" json:"shippingAddress,omitempty"`
+	CouponCode      string                           `protobuf:"bytes,6,opt,name=couponCode,proto3" json:"couponCode,omitempty"`
+	// Posting again with the key of an earlier order of the account returns that order
+	IdempotencyKey string `protobuf:"bytes,7,opt,name=idempotencyKey,proto3" json:"idempotencyKey,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *PostOrderRequest) Reset() {
+	*x = PostOrderRequest{}
+	mi := &file_order_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PostOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PostOrderRequest) ProtoMessage() {}
+
+func (x *PostOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PostOrderRequest.ProtoReflect.Descriptor instead.
+func (*PostOrderRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PostOrderRequest) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+func (x *PostOrderRequest) GetProducts() []*PostOrderRequest_OrderProduct {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+func (x *PostOrderRequest) GetShippingAddress() *Address {
+	if x != nil {
+		return x.ShippingAddress
+	}
+	return nil
+}
+
+func (x *PostOrderRequest) GetCouponCode() string {
+	if x != nil {
+		return x.CouponCode
+	}
+	return ""
+}
+
+func (x *PostOrderRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+type PostOrderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Order         *Order                 `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PostOrderResponse) Reset() {
+	*x = PostOrderResponse{}
+	mi := &file_order_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PostOrderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PostOrderResponse) ProtoMessage() {}
+
+func (x *PostOrderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PostOrderResponse.ProtoReflect.Descriptor instead.
+func (*PostOrderResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *PostOrderResponse) GetOrder() *Order {
+	if x != nil {
+		return x.Order
+	}
+	return nil
+}
+
+type GetOrderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrderRequest) Reset() {
+	*x = GetOrderRequest{}
+	mi := &file_order_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrderRequest) ProtoMessage() {}
+
+func (x *GetOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrderRequest.ProtoReflect.Descriptor instead.
+func (*GetOrderRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetOrderRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type GetOrderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Order         *Order                 `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrderResponse) Reset() {
+	*x = GetOrderResponse{}
+	mi := &file_order_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrderResponse) ProtoMessage() {}
+
+func (x *GetOrderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrderResponse.ProtoReflect.Descriptor instead.
+func (*GetOrderResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetOrderResponse) GetOrder() *Order {
+	if x != nil {
+		return x.Order
+	}
+	return nil
+}
+
+type UpdatePaymentStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrderId       string                 `protobuf:"bytes,1,opt,name=orderId,proto3" json:"orderId,omitempty"`
+	PaymentStatus string                 `protobuf:"bytes,2,opt,name=paymentStatus,proto3" json:"paymentStatus,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdatePaymentStatusRequest) Reset() {
+	*x = UpdatePaymentStatusRequest{}
+	mi := &file_order_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePaymentStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePaymentStatusRequest) ProtoMessage() {}
+
+func (x *UpdatePaymentStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePaymentStatusRequest.ProtoReflect.Descriptor instead.
+func (*UpdatePaymentStatusRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *UpdatePaymentStatusRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *UpdatePaymentStatusRequest) GetPaymentStatus() string {
+	if x != nil {
+		return x.PaymentStatus
+	}
+	return ""
+}
+
+type UpdatePaymentStatusResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Order         *Order                 `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdatePaymentStatusResponse) Reset() {
+	*x = UpdatePaymentStatusResponse{}
+	mi := &file_order_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePaymentStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePaymentStatusResponse) ProtoMessage() {}
+
+func (x *UpdatePaymentStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePaymentStatusResponse.ProtoReflect.Descriptor instead.
+func (*UpdatePaymentStatusResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *UpdatePaymentStatusResponse) GetOrder() *Order {
+	if x != nil {
+		return x.Order
+	}
+	return nil
+}
+
+type CreateShipmentRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	OrderId        string                 `protobuf:"bytes,1,opt,name=orderId,proto3" json:"orderId,omitempty"`
+	Carrier        string                 `protobuf:"bytes,2,opt,name=carrier,proto3" json:"carrier,omitempty"`
+	TrackingNumber string                 `protobuf:"bytes,3,opt,name=trackingNumber,proto3" json:"trackingNumber,omitempty"`
+	// Empty ships everything that was not shipped yet
+	Items         []*Shipment_ShipmentItem `protobuf:"bytes,4,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateShipmentRequest) Reset() {
+	*x = CreateShipmentRequest{}
+	mi := &file_order_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateShipmentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateShipmentRequest) ProtoMessage() {}
+
+func (x *CreateShipmentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateShipmentRequest.ProtoReflect.Descriptor instead.
+func (*CreateShipmentRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *CreateShipmentRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *CreateShipmentRequest) GetCarrier() string {
+	if x != nil {
+		return x.Carrier
+	}
+	return ""
+}
+
+func (x *CreateShipmentRequest) GetTrackingNumber() string {
+	if x != nil {
+		return x.TrackingNumber
+	}
+	return ""
+}
+
+func (x *CreateShipmentRequest) GetItems() []*Shipment_ShipmentItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type CreateShipmentResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Shipment      *Shipment              `protobuf:"bytes,1,opt,name=shipment,proto3" json:"shipment,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateShipmentResponse) Reset() {
+	*x = CreateShipmentResponse{}
+	mi := &file_order_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateShipmentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateShipmentResponse) ProtoMessage() {}
+
+func (x *CreateShipmentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateShipmentResponse.ProtoReflect.Descriptor instead.
+func (*CreateShipmentResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *CreateShipmentResponse) GetShipment() *Shipment {
+	if x != nil {
+		return x.Shipment
+	}
+	return nil
+}
+
+// Empty fields are left unchanged
+type UpdateShipmentRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ShipmentId     string                 `protobuf:"bytes,1,opt,name=shipmentId,proto3" json:"shipmentId,omitempty"`
+	Carrier        string                 `protobuf:"bytes,2,opt,name=carrier,proto3" json:"carrier,omitempty"`
+	TrackingNumber string                 `protobuf:"bytes,3,opt,name=trackingNumber,proto3" json:"trackingNumber,omitempty"`
+	Status         string                 `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *UpdateShipmentRequest) Reset() {
+	*x = UpdateShipmentRequest{}
+	mi := &file_order_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateShipmentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateShipmentRequest) ProtoMessage() {}
+
+func (x *UpdateShipmentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateShipmentRequest.ProtoReflect.Descriptor instead.
+func (*UpdateShipmentRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *UpdateShipmentRequest) GetShipmentId() string {
+	if x != nil {
+		return x.ShipmentId
+	}
+	return ""
+}
+
+func (x *UpdateShipmentRequest) GetCarrier() string {
+	if x != nil {
+		return x.Carrier
+	}
+	return ""
+}
+
+func (x *UpdateShipmentRequest) GetTrackingNumber() string {
+	if x != nil {
+		return x.TrackingNumber
+	}
+	return ""
+}
+
+func (x *UpdateShipmentRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+type UpdateShipmentResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Shipment      *Shipment              `protobuf:"bytes,1,opt,name=shipment,proto3" json:"shipment,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateShipmentResponse) Reset() {
+	*x = UpdateShipmentResponse{}
+	mi := &file_order_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateShipmentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateShipmentResponse) ProtoMessage() {}
+
+func (x *UpdateShipmentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateShipmentResponse.ProtoReflect.Descriptor instead.
+func (*UpdateShipmentResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *UpdateShipmentResponse) GetShipment() *Shipment {
+	if x != nil {
+		return x.Shipment
+	}
+	return nil
+}
+
+type CreatePromotionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Promotion     *Promotion             `protobuf:"bytes,1,opt,name=promotion,proto3" json:"promotion,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreatePromotionRequest) Reset() {
+	*x = CreatePromotionRequest{}
+	mi := &file_order_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreatePromotionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreatePromotionRequest) ProtoMessage() {}
+
+func (x *CreatePromotionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreatePromotionRequest.ProtoReflect.Descriptor instead.
+func (*CreatePromotionRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *CreatePromotionRequest) GetPromotion() *Promotion {
+	if x != nil {
+		return x.Promotion
+	}
+	return nil
+}
+
+type CreatePromotionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Promotion     *Promotion             `protobuf:"bytes,1,opt,name=promotion,proto3" json:"promotion,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreatePromotionResponse) Reset() {
+	*x = CreatePromotionResponse{}
+	mi := &file_order_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreatePromotionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreatePromotionResponse) ProtoMessage() {}
+
+func (x *CreatePromotionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreatePromotionResponse.ProtoReflect.Descriptor instead.
+func (*CreatePromotionResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *CreatePromotionResponse) GetPromotion() *Promotion {
+	if x != nil {
+		return x.Promotion
+	}
+	return nil
+}
+
+type UpdatePromotionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Promotion     *Promotion             `protobuf:"bytes,1,opt,name=promotion,proto3" json:"promotion,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdatePromotionRequest) Reset() {
+	*x = UpdatePromotionRequest{}
+	mi := &file_order_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePromotionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePromotionRequest) ProtoMessage() {}
+
+func (x *UpdatePromotionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePromotionRequest.ProtoReflect.Descriptor instead.
+func (*UpdatePromotionRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *UpdatePromotionRequest) GetPromotion() *Promotion {
+	if x != nil {
+		return x.Promotion
+	}
+	return nil
+}
+
+type UpdatePromotionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Promotion     *Promotion             `protobuf:"bytes,1,opt,name=promotion,proto3" json:"promotion,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdatePromotionResponse) Reset() {
+	*x = UpdatePromotionResponse{}
+	mi := &file_order_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePromotionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePromotionResponse) ProtoMessage() {}
+
+func (x *UpdatePromotionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePromotionResponse.ProtoReflect.Descriptor instead.
+func (*UpdatePromotionResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *UpdatePromotionResponse) GetPromotion() *Promotion {
+	if x != nil {
+		return x.Promotion
+	}
+	return nil
+}
+
+type GetPromotionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPromotionsRequest) Reset() {
+	*x = GetPromotionsRequest{}
+	mi := &file_order_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPromotionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPromotionsRequest) ProtoMessage() {}
+
+func (x *GetPromotionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPromotionsRequest.ProtoReflect.Descriptor instead.
+func (*GetPromotionsRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{20}
+}
+
+type GetPromotionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Promotions    []*Promotion           `protobuf:"bytes,1,rep,name=promotions,proto3" json:"promotions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPromotionsResponse) Reset() {
+	*x = GetPromotionsResponse{}
+	mi := &file_order_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPromotionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPromotionsResponse) ProtoMessage() {}
+
+func (x *GetPromotionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPromotionsResponse.ProtoReflect.Descriptor instead.
+func (*GetPromotionsResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *GetPromotionsResponse) GetPromotions() []*Promotion {
+	if x != nil {
+		return x.Promotions
+	}
+	return nil
+}
+
+type SalesBucket struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Start             []byte                 `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	OrderCount        uint64                 `protobuf:"varint,2,opt,name=orderCount,proto3" json:"orderCount,omitempty"`
+	Revenue           float64                `protobuf:"fixed64,3,opt,name=revenue,proto3" json:"revenue,omitempty"`
+	AverageOrderValue float64                `protobuf:"fixed64,4,opt,name=averageOrderValue,proto3" json:"averageOrderValue,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *SalesBucket) Reset() {
+	*x = SalesBucket{}
+	mi := &file_order_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SalesBucket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SalesBucket) ProtoMessage() {}
+
+func (x *SalesBucket) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SalesBucket.ProtoReflect.Descriptor instead.
+func (*SalesBucket) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *SalesBucket) GetStart() []byte {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *SalesBucket) GetOrderCount() uint64 {
+	if x != nil {
+		return x.OrderCount
+	}
+	return 0
+}
+
+func (x *SalesBucket) GetRevenue() float64 {
+	if x != nil {
+		return x.Revenue
+	}
+	return 0
+}
+
+func (x *SalesBucket) GetAverageOrderValue() float64 {
+	if x != nil {
+		return x.AverageOrderValue
+	}
+	return 0
+}
+
+type GetSalesReportRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	From          []byte                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To            []byte                 `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	Interval      string                 `protobuf:"bytes,3,opt,name=interval,proto3" json:"interval,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSalesReportRequest) Reset() {
+	*x = GetSalesReportRequest{}
+	mi := &file_order_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSalesReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSalesReportRequest) ProtoMessage() {}
+
+func (x *GetSalesReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSalesReportRequest.ProtoReflect.Descriptor instead.
+func (*GetSalesReportRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *GetSalesReportRequest) GetFrom() []byte {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *GetSalesReportRequest) GetTo() []byte {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *GetSalesReportRequest) GetInterval() string {
+	if x != nil {
+		return x.Interval
+	}
+	return ""
+}
+
+type GetSalesReportResponse struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Buckets           []*SalesBucket         `protobuf:"bytes,1,rep,name=buckets,proto3" json:"buckets,omitempty"`
+	OrderCount        uint64                 `protobuf:"varint,2,opt,name=orderCount,proto3" json:"orderCount,omitempty"`
+	Revenue           float64                `protobuf:"fixed64,3,opt,name=revenue,proto3" json:"revenue,omitempty"`
+	AverageOrderValue float64                `protobuf:"fixed64,4,opt,name=averageOrderValue,proto3" json:"averageOrderValue,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *GetSalesReportResponse) Reset() {
+	*x = GetSalesReportResponse{}
+	mi := &file_order_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSalesReportResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSalesReportResponse) ProtoMessage() {}
+
+func (x *GetSalesReportResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSalesReportResponse.ProtoReflect.Descriptor instead.
+func (*GetSalesReportResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *GetSalesReportResponse) GetBuckets() []*SalesBucket {
+	if x != nil {
+		return x.Buckets
+	}
+	return nil
+}
+
+func (x *GetSalesReportResponse) GetOrderCount() uint64 {
+	if x != nil {
+		return x.OrderCount
+	}
+	return 0
+}
+
+func (x *GetSalesReportResponse) GetRevenue() float64 {
+	if x != nil {
+		return x.Revenue
+	}
+	return 0
+}
+
+func (x *GetSalesReportResponse) GetAverageOrderValue() float64 {
+	if x != nil {
+		return x.AverageOrderValue
+	}
+	return 0
+}
+
+type ProductSales struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=productId,proto3" json:"productId,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Quantity      uint64                 `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	Revenue       float64                `protobuf:"fixed64,4,opt,name=revenue,proto3" json:"revenue,omitempty"`
+	OrderCount    uint64                 `protobuf:"varint,5,opt,name=orderCount,proto3" json:"orderCount,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProductSales) Reset() {
+	*x = ProductSales{}
+	mi := &file_order_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProductSales) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProductSales) ProtoMessage() {}
+
+func (x *ProductSales) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProductSales.ProtoReflect.Descriptor instead.
+func (*ProductSales) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *ProductSales) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *ProductSales) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ProductSales) GetQuantity() uint64 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *ProductSales) GetRevenue() float64 {
+	if x != nil {
+		return x.Revenue
+	}
+	return 0
+}
+
+func (x *ProductSales) GetOrderCount() uint64 {
+	if x != nil {
+		return x.OrderCount
+	}
+	return 0
+}
+
+type GetTopProductsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	From          []byte                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To            []byte                 `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	OrderBy       string                 `protobuf:"bytes,3,opt,name=orderBy,proto3" json:"orderBy,omitempty"`
+	Limit         uint32                 `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTopProductsRequest) Reset() {
+	*x = GetTopProductsRequest{}
+	mi := &file_order_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTopProductsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTopProductsRequest) ProtoMessage() {}
+
+func (x *GetTopProductsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTopProductsRequest.ProtoReflect.Descriptor instead.
+func (*GetTopProductsRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *GetTopProductsRequest) GetFrom() []byte {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *GetTopProductsRequest) GetTo() []byte {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *GetTopProductsRequest) GetOrderBy() string {
+	if x != nil {
+		return x.OrderBy
+	}
+	return ""
+}
+
+func (x *GetTopProductsRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type GetTopProductsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Products      []*ProductSales        `protobuf:"bytes,1,rep,name=products,proto3" json:"products,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTopProductsResponse) Reset() {
+	*x = GetTopProductsResponse{}
+	mi := &file_order_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTopProductsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTopProductsResponse) ProtoMessage() {}
+
+func (x *GetTopProductsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTopProductsResponse.ProtoReflect.Descriptor instead.
+func (*GetTopProductsResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *GetTopProductsResponse) GetProducts() []*ProductSales {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+type AccountValue struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	AccountId         string                 `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	OrderCount        uint64                 `protobuf:"varint,2,opt,name=orderCount,proto3" json:"orderCount,omitempty"`
+	LifetimeValue     float64                `protobuf:"fixed64,3,opt,name=lifetimeValue,proto3" json:"lifetimeValue,omitempty"`
+	AverageOrderValue float64                `protobuf:"fixed64,4,opt,name=averageOrderValue,proto3" json:"averageOrderValue,omitempty"`
+	FirstOrderAt      []byte                 `protobuf:"bytes,5,opt,name=firstOrderAt,proto3" json:"firstOrderAt,omitempty"`
+	LastOrderAt       []byte                 `protobuf:"bytes,6,opt,name=lastOrderAt,proto3" json:"lastOrderAt,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *AccountValue) Reset() {
+	*x = AccountValue{}
+	mi := &file_order_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccountValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccountValue) ProtoMessage() {}
+
+func (x *AccountValue) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccountValue.ProtoReflect.Descriptor instead.
+func (*AccountValue) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *AccountValue) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+func (x *AccountValue) GetOrderCount() uint64 {
+	if x != nil {
+		return x.OrderCount
+	}
+	return 0
+}
+
+func (x *AccountValue) GetLifetimeValue() float64 {
+	if x != nil {
+		return x.LifetimeValue
+	}
+	return 0
+}
+
+func (x *AccountValue) GetAverageOrderValue() float64 {
+	if x != nil {
+		return x.AverageOrderValue
+	}
+	return 0
+}
+
+func (x *AccountValue) GetFirstOrderAt() []byte {
+	if x != nil {
+		return x.FirstOrderAt
+	}
+	return nil
+}
+
+func (x *AccountValue) GetLastOrderAt() []byte {
+	if x != nil {
+		return x.LastOrderAt
+	}
+	return nil
+}
+
+type GetAccountValuesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountIds    []string               `protobuf:"bytes,1,rep,name=accountIds,proto3" json:"accountIds,omitempty"`
+	Limit         uint32                 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAccountValuesRequest) Reset() {
+	*x = GetAccountValuesRequest{}
+	mi := &file_order_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAccountValuesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAccountValuesRequest) ProtoMessage() {}
+
+func (x *GetAccountValuesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAccountValuesRequest.ProtoReflect.Descriptor instead.
+func (*GetAccountValuesRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *GetAccountValuesRequest) GetAccountIds() []string {
+	if x != nil {
+		return x.AccountIds
+	}
+	return nil
+}
+
+func (x *GetAccountValuesRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type GetAccountValuesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accounts      []*AccountValue        `protobuf:"bytes,1,rep,name=accounts,proto3" json:"accounts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAccountValuesResponse) Reset() {
+	*x = GetAccountValuesResponse{}
+	mi := &file_order_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAccountValuesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAccountValuesResponse) ProtoMessage() {}
+
+func (x *GetAccountValuesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAccountValuesResponse.ProtoReflect.Descriptor instead.
+func (*GetAccountValuesResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *GetAccountValuesResponse) GetAccounts() []*AccountValue {
+	if x != nil {
+		return x.Accounts
+	}
+	return nil
+}
+
+type Recommendation struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ProductId string                 `protobuf:"bytes,1,opt,name=productId,proto3" json:"productId,omitempty"`
+	// Number of orders with both products
+	Score         uint64 `protobuf:"varint,2,opt,name=score,proto3" json:"score,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Recommendation) Reset() {
+	*x = Recommendation{}
+	mi := &file_order_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Recommendation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Recommendation) ProtoMessage() {}
+
+func (x *Recommendation) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Recommendation.ProtoReflect.Descriptor instead.
+func (*Recommendation) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *Recommendation) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *Recommendation) GetScore() uint64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+type GetRecommendationsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=productId,proto3" json:"productId,omitempty"`
+	Limit         uint32                 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRecommendationsRequest) Reset() {
+	*x = GetRecommendationsRequest{}
+	mi := &file_order_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRecommendationsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRecommendationsRequest) ProtoMessage() {}
+
+func (x *GetRecommendationsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRecommendationsRequest.ProtoReflect.Descriptor instead.
+func (*GetRecommendationsRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *GetRecommendationsRequest) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *GetRecommendationsRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type GetRecommendationsResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Recommendations []*Recommendation      `protobuf:"bytes,1,rep,name=recommendations,proto3" json:"recommendations,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *GetRecommendationsResponse) Reset() {
+	*x = GetRecommendationsResponse{}
+	mi := &file_order_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRecommendationsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRecommendationsResponse) ProtoMessage() {}
+
+func (x *GetRecommendationsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRecommendationsResponse.ProtoReflect.Descriptor instead.
+func (*GetRecommendationsResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *GetRecommendationsResponse) GetRecommendations() []*Recommendation {
+	if x != nil {
+		return x.Recommendations
+	}
+	return nil
+}
+
+type Webhook struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Url   string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	// Event type names such as created, empty for every event
+	EventTypes []string `protobuf:"bytes,3,rep,name=eventTypes,proto3" json:"eventTypes,omitempty"`
+	// Only returned when the webhook is created or its secret changed
+	Secret        string `protobuf:"bytes,4,opt,name=secret,proto3" json:"secret,omitempty"`
+	Active        bool   `protobuf:"varint,5,opt,name=active,proto3" json:"active,omitempty"`
+	CreatedAt     []byte `protobuf:"bytes,6,opt,name=createdAt,proto3" json:"createdAt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Webhook) Reset() {
+	*x = Webhook{}
+	mi := &file_order_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Webhook) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Webhook) ProtoMessage() {}
+
+func (x *Webhook) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Webhook.ProtoReflect.Descriptor instead.
+func (*Webhook) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *Webhook) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Webhook) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Webhook) GetEventTypes() []string {
+	if x != nil {
+		return x.EventTypes
+	}
+	return nil
+}
+
+func (x *Webhook) GetSecret() string {
+	if x != nil {
+		return x.Secret
+	}
+	return ""
+}
+
+func (x *Webhook) GetActive() bool {
+	if x != nil {
+		return x.Active
+	}
+	return false
+}
+
+func (x *Webhook) GetCreatedAt() []byte {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+type WebhookDelivery struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	WebhookId string                 `protobuf:"bytes,2,opt,name=webhookId,proto3" json:"webhookId,omitempty"`
+	EventId   string                 `protobuf:"bytes,3,opt,name=eventId,proto3" json:"eventId,omitempty"`
+	EventType string                 `protobuf:"bytes,4,opt,name=eventType,proto3" json:"eventType,omitempty"`
+	Payload   string                 `protobuf:"bytes,5,opt,name=payload,proto3" json:"payload,omitempty"`
+	Status    string                 `protobuf:"bytes,6,opt,name=status,proto3" json:"status,omitempty"`
+	Attempts  uint32                 `protobuf:"varint,7,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	// Empty once the delivery succeeded or failed
+	NextAttemptAt  []byte                     `protobuf:"bytes,8,opt,name=nextAttemptAt,proto3" json:"nextAttemptAt,omitempty"`
+	LastStatusCode int32                      `protobuf:"varint,9,opt,name=lastStatusCode,proto3" json:"lastStatusCode,omitempty"`
+	LastError      string                     `protobuf:"bytes,10,opt,name=lastError,proto3" json:"lastError,omitempty"`
+	CreatedAt      []byte                     `protobuf:"bytes,11,opt,name=createdAt,proto3" json:"createdAt,omitempty"`
+	DeliveredAt    []byte                     `protobuf:"bytes,12,opt,name=deliveredAt,proto3" json:"deliveredAt,omitempty"`
+	AttemptLog     []*WebhookDelivery_Attempt `protobuf:"bytes,13,rep,name=attemptLog,proto3" json:"attemptLog,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *WebhookDelivery) Reset() {
+	*x = WebhookDelivery{}
+	mi := &file_order_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WebhookDelivery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WebhookDelivery) ProtoMessage() {}
+
+func (x *WebhookDelivery) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WebhookDelivery.ProtoReflect.Descriptor instead.
+func (*WebhookDelivery) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *WebhookDelivery) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *WebhookDelivery) GetWebhookId() string {
+	if x != nil {
+		return x.WebhookId
+	}
+	return ""
+}
+
+func (x *WebhookDelivery) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+func (x *WebhookDelivery) GetEventType() string {
+	if x != nil {
+		return x.EventType
+	}
+	return ""
+}
+
+func (x *WebhookDelivery) GetPayload() string {
+	if x != nil {
+		return x.Payload
+	}
+	return ""
+}
+
+func (x *WebhookDelivery) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *WebhookDelivery) GetAttempts() uint32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *WebhookDelivery) GetNextAttemptAt() []byte {
+	if x != nil {
+		return x.NextAttemptAt
+	}
+	return nil
+}
+
+func (x *WebhookDelivery) GetLastStatusCode() int32 {
+	if x != nil {
+		return x.LastStatusCode
+	}
+	return 0
+}
+
+func (x *WebhookDelivery) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+func (x *WebhookDelivery) GetCreatedAt() []byte {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *WebhookDelivery) GetDeliveredAt() []byte {
+	if x != nil {
+		return x.DeliveredAt
+	}
+	return nil
+}
+
+func (x *WebhookDelivery) GetAttemptLog() []*WebhookDelivery_Attempt {
+	if x != nil {
+		return x.AttemptLog
+	}
+	return nil
+}
+
+type CreateWebhookRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Webhook       *Webhook               `protobuf:"bytes,1,opt,name=webhook,proto3" json:"webhook,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateWebhookRequest) Reset() {
+	*x = CreateWebhookRequest{}
+	mi := &file_order_proto_msgTypes[36]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateWebhookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateWebhookRequest) ProtoMessage() {}
+
+func (x *CreateWebhookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[36]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateWebhookRequest.ProtoReflect.Descriptor instead.
+func (*CreateWebhookRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{36}
+}
+
+func (x *CreateWebhookRequest) GetWebhook() *Webhook {
+	if x != nil {
+		return x.Webhook
+	}
+	return nil
+}
+
+type CreateWebhookResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Webhook       *Webhook               `protobuf:"bytes,1,opt,name=webhook,proto3" json:"webhook,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateWebhookResponse) Reset() {
+	*x = CreateWebhookResponse{}
+	mi := &file_order_proto_msgTypes[37]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateWebhookResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateWebhookResponse) ProtoMessage() {}
+
+func (x *CreateWebhookResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[37]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateWebhookResponse.ProtoReflect.Descriptor instead.
+func (*CreateWebhookResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{37}
+}
+
+func (x *CreateWebhookResponse) GetWebhook() *Webhook {
+	if x != nil {
+		return x.Webhook
+	}
+	return nil
+}
+
+type UpdateWebhookRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Webhook       *Webhook               `protobuf:"bytes,1,opt,name=webhook,proto3" json:"webhook,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateWebhookRequest) Reset() {
+	*x = UpdateWebhookRequest{}
+	mi := &file_order_proto_msgTypes[38]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateWebhookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateWebhookRequest) ProtoMessage() {}
+
+func (x *UpdateWebhookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[38]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateWebhookRequest.ProtoReflect.Descriptor instead.
+func (*UpdateWebhookRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{38}
+}
+
+func (x *UpdateWebhookRequest) GetWebhook() *Webhook {
+	if x != nil {
+		return x.Webhook
+	}
+	return nil
+}
+
+type UpdateWebhookResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Webhook       *Webhook               `protobuf:"bytes,1,opt,name=webhook,proto3" json:"webhook,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateWebhookResponse) Reset() {
+	*x = UpdateWebhookResponse{}
+	mi := &file_order_proto_msgTypes[39]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateWebhookResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateWebhookResponse) ProtoMessage() {}
+
+func (x *UpdateWebhookResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[39]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateWebhookResponse.ProtoReflect.Descriptor instead.
+func (*UpdateWebhookResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{39}
+}
+
+func (x *UpdateWebhookResponse) GetWebhook() *Webhook {
+	if x != nil {
+		return x.Webhook
+	}
+	return nil
+}
+
+type DeleteWebhookRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteWebhookRequest) Reset() {
+	*x = DeleteWebhookRequest{}
+	mi := &file_order_proto_msgTypes[40]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteWebhookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteWebhookRequest) ProtoMessage() {}
+
+func (x *DeleteWebhookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[40]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteWebhookRequest.ProtoReflect.Descriptor instead.
+func (*DeleteWebhookRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{40}
+}
+
+func (x *DeleteWebhookRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteWebhookResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteWebhookResponse) Reset() {
+	*x = DeleteWebhookResponse{}
+	mi := &file_order_proto_msgTypes[41]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteWebhookResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteWebhookResponse) ProtoMessage() {}
+
+func (x *DeleteWebhookResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[41]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteWebhookResponse.ProtoReflect.Descriptor instead.
+func (*DeleteWebhookResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{41}
+}
+
+type GetWebhooksRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetWebhooksRequest) Reset() {
+	*x = GetWebhooksRequest{}
+	mi := &file_order_proto_msgTypes[42]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetWebhooksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetWebhooksRequest) ProtoMessage() {}
+
+func (x *GetWebhooksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[42]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetWebhooksRequest.ProtoReflect.Descriptor instead.
+func (*GetWebhooksRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{42}
+}
+
+type GetWebhooksResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Webhooks      []*Webhook             `protobuf:"bytes,1,rep,name=webhooks,proto3" json:"webhooks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetWebhooksResponse) Reset() {
+	*x = GetWebhooksResponse{}
+	mi := &file_order_proto_msgTypes[43]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetWebhooksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetWebhooksResponse) ProtoMessage() {}
+
+func (x *GetWebhooksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[43]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetWebhooksResponse.ProtoReflect.Descriptor instead.
+func (*GetWebhooksResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{43}
+}
+
+func (x *GetWebhooksResponse) GetWebhooks() []*Webhook {
+	if x != nil {
+		return x.Webhooks
+	}
+	return nil
+}
+
+type GetWebhookDeliveriesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	WebhookId     string                 `protobuf:"bytes,1,opt,name=webhookId,proto3" json:"webhookId,omitempty"`
+	Skip          uint64                 `protobuf:"varint,2,opt,name=skip,proto3" json:"skip,omitempty"`
+	Take          uint64                 `protobuf:"varint,3,opt,name=take,proto3" json:"take,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetWebhookDeliveriesRequest) Reset() {
+	*x = GetWebhookDeliveriesRequest{}
+	mi := &file_order_proto_msgTypes[44]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetWebhookDeliveriesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetWebhookDeliveriesRequest) ProtoMessage() {}
+
+func (x *GetWebhookDeliveriesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[44]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetWebhookDeliveriesRequest.ProtoReflect.Descriptor instead.
+func (*GetWebhookDeliveriesRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{44}
+}
+
+func (x *GetWebhookDeliveriesRequest) GetWebhookId() string {
+	if x != nil {
+		return x.WebhookId
+	}
+	return ""
+}
+
+func (x *GetWebhookDeliveriesRequest) GetSkip() uint64 {
+	if x != nil {
+		return x.Skip
+	}
+	return 0
+}
+
+func (x *GetWebhookDeliveriesRequest) GetTake() uint64 {
+	if x != nil {
+		return x.Take
+	}
+	return 0
+}
+
+type GetWebhookDeliveriesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Deliveries    []*WebhookDelivery     `protobuf:"bytes,1,rep,name=deliveries,proto3" json:"deliveries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetWebhookDeliveriesResponse) Reset() {
+	*x = GetWebhookDeliveriesResponse{}
+	mi := &file_order_proto_msgTypes[45]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetWebhookDeliveriesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetWebhookDeliveriesResponse) ProtoMessage() {}
+
+func (x *GetWebhookDeliveriesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[45]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetWebhookDeliveriesResponse.ProtoReflect.Descriptor instead.
+func (*GetWebhookDeliveriesResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{45}
+}
+
+func (x *GetWebhookDeliveriesResponse) GetDeliveries() []*WebhookDelivery {
+	if x != nil {
+		return x.Deliveries
+	}
+	return nil
+}
+
+type RedeliverWebhookRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeliveryId    string                 `protobuf:"bytes,1,opt,name=deliveryId,proto3" json:"deliveryId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RedeliverWebhookRequest) Reset() {
+	*x = RedeliverWebhookRequest{}
+	mi := &file_order_proto_msgTypes[46]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RedeliverWebhookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RedeliverWebhookRequest) ProtoMessage() {}
+
+func (x *RedeliverWebhookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[46]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RedeliverWebhookRequest.ProtoReflect.Descriptor instead.
+func (*RedeliverWebhookRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{46}
+}
+
+func (x *RedeliverWebhookRequest) GetDeliveryId() string {
+	if x != nil {
+		return x.DeliveryId
+	}
+	return ""
+}
+
+type RedeliverWebhookResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Delivery      *WebhookDelivery       `protobuf:"bytes,1,opt,name=delivery,proto3" json:"delivery,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RedeliverWebhookResponse) Reset() {
+	*x = RedeliverWebhookResponse{}
+	mi := &file_order_proto_msgTypes[47]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RedeliverWebhookResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RedeliverWebhookResponse) ProtoMessage() {}
+
+func (x *RedeliverWebhookResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[47]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RedeliverWebhookResponse.ProtoReflect.Descriptor instead.
+func (*RedeliverWebhookResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{47}
+}
+
+func (x *RedeliverWebhookResponse) GetDelivery() *WebhookDelivery {
+	if x != nil {
+		return x.Delivery
+	}
+	return nil
+}
+
+type OrderNotification struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Id      string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	OrderId string                 `protobuf:"bytes,2,opt,name=orderId,proto3" json:"orderId,omitempty"`
+	// order_confirmation
+	Kind      string `protobuf:"bytes,3,opt,name=kind,proto3" json:"kind,omitempty"`
+	Recipient string `protobuf:"bytes,4,opt,name=recipient,proto3" json:"recipient,omitempty"`
+	Status    string `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`
+	Attempts  uint32 `protobuf:"varint,6,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	// Empty once the notification was sent or failed
+	NextAttemptAt []byte `protobuf:"bytes,7,opt,name=nextAttemptAt,proto3" json:"nextAttemptAt,omitempty"`
+	LastError     string `protobuf:"bytes,8,opt,name=lastError,proto3" json:"lastError,omitempty"`
+	CreatedAt     []byte `protobuf:"bytes,9,opt,name=createdAt,proto3" json:"createdAt,omitempty"`
+	SentAt        []byte `protobuf:"bytes,10,opt,name=sentAt,proto3" json:"sentAt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrderNotification) Reset() {
+	*x = OrderNotification{}
+	mi := &file_order_proto_msgTypes[48]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrderNotification) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderNotification) ProtoMessage() {}
+
+func (x *OrderNotification) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[48]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderNotification.ProtoReflect.Descriptor instead.
+func (*OrderNotification) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{48}
+}
+
+func (x *OrderNotification) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *OrderNotification) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *OrderNotification) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *OrderNotification) GetRecipient() string {
+	if x != nil {
+		return x.Recipient
+	}
+	return ""
+}
+
+func (x *OrderNotification) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *OrderNotification) GetAttempts() uint32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *OrderNotification) GetNextAttemptAt() []byte {
+	if x != nil {
+		return x.NextAttemptAt
+	}
+	return nil
+}
+
+func (x *OrderNotification) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+func (x *OrderNotification) GetCreatedAt() []byte {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *OrderNotification) GetSentAt() []byte {
+	if x != nil {
+		return x.SentAt
+	}
+	return nil
+}
+
+type GetOrderNotificationsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrderId       string                 `protobuf:"bytes,1,opt,name=orderId,proto3" json:"orderId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrderNotificationsRequest) Reset() {
+	*x = GetOrderNotificationsRequest{}
+	mi := &file_order_proto_msgTypes[49]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrderNotificationsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrderNotificationsRequest) ProtoMessage() {}
+
+func (x *GetOrderNotificationsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[49]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrderNotificationsRequest.ProtoReflect.Descriptor instead.
+func (*GetOrderNotificationsRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{49}
+}
+
+func (x *GetOrderNotificationsRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+type GetOrderNotificationsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Notifications []*OrderNotification   `protobuf:"bytes,1,rep,name=notifications,proto3" json:"notifications,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrderNotificationsResponse) Reset() {
+	*x = GetOrderNotificationsResponse{}
+	mi := &file_order_proto_msgTypes[50]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrderNotificationsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrderNotificationsResponse) ProtoMessage() {}
+
+func (x *GetOrderNotificationsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[50]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrderNotificationsResponse.ProtoReflect.Descriptor instead.
+func (*GetOrderNotificationsResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{50}
+}
+
+func (x *GetOrderNotificationsResponse) GetNotifications() []*OrderNotification {
+	if x != nil {
+		return x.Notifications
+	}
+	return nil
+}
+
+type Invoice struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrderId       string                 `protobuf:"bytes,1,opt,name=orderId,proto3" json:"orderId,omitempty"`
+	Number        string                 `protobuf:"bytes,2,opt,name=number,proto3" json:"number,omitempty"`
+	IssuedAt      []byte                 `protobuf:"bytes,3,opt,name=issuedAt,proto3" json:"issuedAt,omitempty"`
+	Html          string                 `protobuf:"bytes,4,opt,name=html,proto3" json:"html,omitempty"`
+	Pdf           []byte                 `protobuf:"bytes,5,opt,name=pdf,proto3" json:"pdf,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Invoice) Reset() {
+	*x = Invoice{}
+	mi := &file_order_proto_msgTypes[51]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Invoice) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Invoice) ProtoMessage() {}
+
+func (x *Invoice) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[51]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Invoice.ProtoReflect.Descriptor instead.
+func (*Invoice) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{51}
+}
+
+func (x *Invoice) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *Invoice) GetNumber() string {
+	if x != nil {
+		return x.Number
+	}
+	return ""
+}
+
+func (x *Invoice) GetIssuedAt() []byte {
+	if x != nil {
+		return x.IssuedAt
+	}
+	return nil
+}
+
+func (x *Invoice) GetHtml() string {
+	if x != nil {
+		return x.Html
+	}
+	return ""
+}
+
+func (x *Invoice) GetPdf() []byte {
+	if x != nil {
+		return x.Pdf
+	}
+	return nil
+}
+
+type GetInvoiceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrderId       string                 `protobuf:"bytes,1,opt,name=orderId,proto3" json:"orderId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetInvoiceRequest) Reset() {
+	*x = GetInvoiceRequest{}
+	mi := &file_order_proto_msgTypes[52]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetInvoiceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetInvoiceRequest) ProtoMessage() {}
+
+func (x *GetInvoiceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[52]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetInvoiceRequest.ProtoReflect.Descriptor instead.
+func (*GetInvoiceRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{52}
+}
+
+func (x *GetInvoiceRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+type GetInvoiceResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Invoice       *Invoice               `protobuf:"bytes,1,opt,name=invoice,proto3" json:"invoice,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetInvoiceResponse) Reset() {
+	*x = GetInvoiceResponse{}
+	mi := &file_order_proto_msgTypes[53]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetInvoiceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetInvoiceResponse) ProtoMessage() {}
+
+func (x *GetInvoiceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[53]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetInvoiceResponse.ProtoReflect.Descriptor instead.
+func (*GetInvoiceResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{53}
+}
+
+func (x *GetInvoiceResponse) GetInvoice() *Invoice {
+	if x != nil {
+		return x.Invoice
+	}
+	return nil
+}
+
+type OrderSubscription struct {
+	state           protoimpl.MessageState    `protogen:"open.v1"`
+	Id              string                    `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	AccountId       string                    `protobuf:"bytes,2,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	Products        []*OrderSubscription_Item `protobuf:"bytes,3,rep,name=products,proto3" json:"products,omitempty"`
+	ShippingAddress *Address                  `protobuf:"bytes,4,opt,name=shippingAddress,proto3" json:"shippingAddress,omitempty"`
+	// day, week or month
+	Interval      string `protobuf:"bytes,5,opt,name=interval,proto3" json:"interval,omitempty"`
+	IntervalCount uint32 `protobuf:"varint,6,opt,name=intervalCount,proto3" json:"intervalCount,omitempty"`
+	NextRunAt     []byte `protobuf:"bytes,7,opt,name=nextRunAt,proto3" json:"nextRunAt,omitempty"`
+	// active, paused or cancelled
+	Status    string `protobuf:"bytes,8,opt,name=status,proto3" json:"status,omitempty"`
+	CreatedAt []byte `protobuf:"bytes,9,opt,name=createdAt,proto3" json:"createdAt,omitempty"`
+	// The latest runs, newest first
+	Runs          []*OrderSubscription_Run `protobuf:"bytes,10,rep,name=runs,proto3" json:"runs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrderSubscription) Reset() {
+	*x = OrderSubscription{}
+	mi := &file_order_proto_msgTypes[54]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrderSubscription) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderSubscription) ProtoMessage() {}
+
+func (x *OrderSubscription) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[54]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderSubscription.ProtoReflect.Descriptor instead.
+func (*OrderSubscription) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{54}
+}
+
+func (x *OrderSubscription) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *OrderSubscription) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+func (x *OrderSubscription) GetProducts() []*OrderSubscription_Item {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+func (x *OrderSubscription) GetShippingAddress() *Address {
+	if x != nil {
+		return x.ShippingAddress
+	}
+	return nil
+}
+
+func (x *OrderSubscription) GetInterval() string {
+	if x != nil {
+		return x.Interval
+	}
+	return ""
+}
+
+func (x *OrderSubscription) GetIntervalCount() uint32 {
+	if x != nil {
+		return x.IntervalCount
+	}
+	return 0
+}
+
+func (x *OrderSubscription) GetNextRunAt() []byte {
+	if x != nil {
+		return x.NextRunAt
+	}
+	return nil
+}
+
+func (x *OrderSubscription) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *OrderSubscription) GetCreatedAt() []byte {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *OrderSubscription) GetRuns() []*OrderSubscription_Run {
+	if x != nil {
+		return x.Runs
+	}
+	return nil
+}
+
+type CreateSubscriptionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The first order is placed one interval after now unless nextRunAt is set
+	Subscription  *OrderSubscription `protobuf:"bytes,1,opt,name=subscription,proto3" json:"subscription,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateSubscriptionRequest) Reset() {
+	*x = CreateSubscriptionRequest{}
+	mi := &file_order_proto_msgTypes[55]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateSubscriptionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateSubscriptionRequest) ProtoMessage() {}
+
+func (x *CreateSubscriptionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[55]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateSubscriptionRequest.ProtoReflect.Descriptor instead.
+func (*CreateSubscriptionRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{55}
+}
+
+func (x *CreateSubscriptionRequest) GetSubscription() *OrderSubscription {
+	if x != nil {
+		return x.Subscription
+	}
+	return nil
+}
+
+type CreateSubscriptionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Subscription  *OrderSubscription     `protobuf:"bytes,1,opt,name=subscription,proto3" json:"subscription,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateSubscriptionResponse) Reset() {
+	*x = CreateSubscriptionResponse{}
+	mi := &file_order_proto_msgTypes[56]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateSubscriptionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateSubscriptionResponse) ProtoMessage() {}
+
+func (x *CreateSubscriptionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[56]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateSubscriptionResponse.ProtoReflect.Descriptor instead.
+func (*CreateSubscriptionResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{56}
+}
+
+func (x *CreateSubscriptionResponse) GetSubscription() *OrderSubscription {
+	if x != nil {
+		return x.Subscription
+	}
+	return nil
+}
+
+type GetSubscriptionsForAccountRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     string                 `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSubscriptionsForAccountRequest) Reset() {
+	*x = GetSubscriptionsForAccountRequest{}
+	mi := &file_order_proto_msgTypes[57]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSubscriptionsForAccountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSubscriptionsForAccountRequest) ProtoMessage() {}
+
+func (x *GetSubscriptionsForAccountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[57]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSubscriptionsForAccountRequest.ProtoReflect.Descriptor instead.
+func (*GetSubscriptionsForAccountRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{57}
+}
+
+func (x *GetSubscriptionsForAccountRequest) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+type GetSubscriptionsForAccountResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Subscriptions []*OrderSubscription   `protobuf:"bytes,1,rep,name=subscriptions,proto3" json:"subscriptions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSubscriptionsForAccountResponse) Reset() {
+	*x = GetSubscriptionsForAccountResponse{}
+	mi := &file_order_proto_msgTypes[58]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSubscriptionsForAccountResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSubscriptionsForAccountResponse) ProtoMessage() {}
+
+func (x *GetSubscriptionsForAccountResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[58]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSubscriptionsForAccountResponse.ProtoReflect.Descriptor instead.
+func (*GetSubscriptionsForAccountResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{58}
+}
+
+func (x *GetSubscriptionsForAccountResponse) GetSubscriptions() []*OrderSubscription {
+	if x != nil {
+		return x.Subscriptions
+	}
+	return nil
+}
+
+type GetSubscriptionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSubscriptionRequest) Reset() {
+	*x = GetSubscriptionRequest{}
+	mi := &file_order_proto_msgTypes[59]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSubscriptionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSubscriptionRequest) ProtoMessage() {}
+
+func (x *GetSubscriptionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[59]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSubscriptionRequest.ProtoReflect.Descriptor instead.
+func (*GetSubscriptionRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{59}
+}
+
+func (x *GetSubscriptionRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type GetSubscriptionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Subscription  *OrderSubscription     `protobuf:"bytes,1,opt,name=subscription,proto3" json:"subscription,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSubscriptionResponse) Reset() {
+	*x = GetSubscriptionResponse{}
+	mi := &file_order_proto_msgTypes[60]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSubscriptionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSubscriptionResponse) ProtoMessage() {}
+
+func (x *GetSubscriptionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[60]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSubscriptionResponse.ProtoReflect.Descriptor instead.
+func (*GetSubscriptionResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{60}
+}
+
+func (x *GetSubscriptionResponse) GetSubscription() *OrderSubscription {
+	if x != nil {
+		return x.Subscription
+	}
+	return nil
+}
+
+type UpdateSubscriptionStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateSubscriptionStatusRequest) Reset() {
+	*x = UpdateSubscriptionStatusRequest{}
+	mi := &file_order_proto_msgTypes[61]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateSubscriptionStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateSubscriptionStatusRequest) ProtoMessage() {}
+
+func (x *UpdateSubscriptionStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[61]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateSubscriptionStatusRequest.ProtoReflect.Descriptor instead.
+func (*UpdateSubscriptionStatusRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{61}
+}
+
+func (x *UpdateSubscriptionStatusRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type UpdateSubscriptionStatusResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Subscription  *OrderSubscription     `protobuf:"bytes,1,opt,name=subscription,proto3" json:"subscription,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateSubscriptionStatusResponse) Reset() {
+	*x = UpdateSubscriptionStatusResponse{}
+	mi := &file_order_proto_msgTypes[62]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateSubscriptionStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateSubscriptionStatusResponse) ProtoMessage() {}
+
+func (x *UpdateSubscriptionStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[62]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateSubscriptionStatusResponse.ProtoReflect.Descriptor instead.
+func (*UpdateSubscriptionStatusResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{62}
+}
+
+func (x *UpdateSubscriptionStatusResponse) GetSubscription() *OrderSubscription {
+	if x != nil {
+		return x.Subscription
+	}
+	return nil
+}
+
+type WatchOrderEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only events of this account are sent when set
+	AccountId     string `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchOrderEventsRequest) Reset() {
+	*x = WatchOrderEventsRequest{}
+	mi := &file_order_proto_msgTypes[63]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchOrderEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchOrderEventsRequest) ProtoMessage() {}
+
+func (x *WatchOrderEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[63]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchOrderEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchOrderEventsRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{63}
+}
+
+func (x *WatchOrderEventsRequest) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+type OrderEvent struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Type           OrderEvent_Type        `protobuf:"varint,1,opt,name=type,proto3,enum=pb.OrderEvent_Type" json:"type,omitempty"`
+	OrderId        string                 `protobuf:"bytes,2,opt,name=orderId,proto3" json:"orderId,omitempty"`
+	AccountId      string                 `protobuf:"bytes,3,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	TotalPrice     float64                `protobuf:"fixed64,4,opt,name=totalPrice,proto3" json:"totalPrice,omitempty"`
+	PaymentStatus  string                 `protobuf:"bytes,5,opt,name=paymentStatus,proto3" json:"paymentStatus,omitempty"`
+	ShipmentId     string                 `protobuf:"bytes,6,opt,name=shipmentId,proto3" json:"shipmentId,omitempty"`
+	ShipmentStatus string                 `protobuf:"bytes,7,opt,name=shipmentStatus,proto3" json:"shipmentStatus,omitempty"`
+	OccurredAt     []byte                 `protobuf:"bytes,8,opt,name=occurredAt,proto3" json:"occurredAt,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *OrderEvent) Reset() {
+	*x = OrderEvent{}
+	mi := &file_order_proto_msgTypes[64]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrderEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderEvent) ProtoMessage() {}
+
+func (x *OrderEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[64]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderEvent.ProtoReflect.Descriptor instead.
+func (*OrderEvent) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{64}
+}
+
+func (x *OrderEvent) GetType() OrderEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return OrderEvent_CREATED
+}
+
+func (x *OrderEvent) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *OrderEvent) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+func (x *OrderEvent) GetTotalPrice() float64 {
+	if x != nil {
+		return x.TotalPrice
+	}
+	return 0
+}
+
+func (x *OrderEvent) GetPaymentStatus() string {
+	if x != nil {
+		return x.PaymentStatus
+	}
+	return ""
+}
+
+func (x *OrderEvent) GetShipmentId() string {
+	if x != nil {
+		return x.ShipmentId
+	}
+	return ""
+}
+
+func (x *OrderEvent) GetShipmentStatus() string {
+	if x != nil {
+		return x.ShipmentStatus
+	}
+	return ""
+}
+
+func (x *OrderEvent) GetOccurredAt() []byte {
+	if x != nil {
+		return x.OccurredAt
+	}
+	return nil
+}
+
+type GetOrdersForAccountRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     string                 `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrdersForAccountRequest) Reset() {
+	*x = GetOrdersForAccountRequest{}
+	mi := &file_order_proto_msgTypes[65]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrdersForAccountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrdersForAccountRequest) ProtoMessage() {}
+
+func (x *GetOrdersForAccountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[65]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrdersForAccountRequest.ProtoReflect.Descriptor instead.
+func (*GetOrdersForAccountRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{65}
+}
+
+func (x *GetOrdersForAccountRequest) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+type GetOrdersForAccountResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Orders        []*Order               `protobuf:"bytes,1,rep,name=orders,proto3" json:"orders,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrdersForAccountResponse) Reset() {
+	*x = GetOrdersForAccountResponse{}
+	mi := &file_order_proto_msgTypes[66]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrdersForAccountResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrdersForAccountResponse) ProtoMessage() {}
+
+func (x *GetOrdersForAccountResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[66]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrdersForAccountResponse.ProtoReflect.Descriptor instead.
+func (*GetOrdersForAccountResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{66}
+}
+
+func (x *GetOrdersForAccountResponse) GetOrders() []*Order {
+	if x != nil {
+		return x.Orders
+	}
+	return nil
+}
+
+type GetOrdersForAccountPageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccountId     string                 `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
+	After         string                 `protobuf:"bytes,2,opt,name=after,proto3" json:"after,omitempty"`
+	First         uint64                 `protobuf:"varint,3,opt,name=first,proto3" json:"first,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrdersForAccountPageRequest) Reset() {
+	*x = GetOrdersForAccountPageRequest{}
+	mi := &file_order_proto_msgTypes[67]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrdersForAccountPageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrdersForAccountPageRequest) ProtoMessage() {}
+
+func (x *GetOrdersForAccountPageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[67]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrdersForAccountPageRequest.ProtoReflect.Descriptor instead.
+func (*GetOrdersForAccountPageRequest) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{67}
+}
+
+func (x *GetOrdersForAccountPageRequest) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+func (x *GetOrdersForAccountPageRequest) GetAfter() string {
+	if x != nil {
+		return x.After
+	}
+	return ""
+}
+
+func (x *GetOrdersForAccountPageRequest) GetFirst() uint64 {
+	if x != nil {
+		return x.First
+	}
+	return 0
+}
+
+type GetOrdersForAccountPageResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Orders        []*Order               `protobuf:"bytes,1,rep,name=orders,proto3" json:"orders,omitempty"`
+	TotalCount    uint64                 `protobuf:"varint,2,opt,name=totalCount,proto3" json:"totalCount,omitempty"`
+	HasNextPage   bool                   `protobuf:"varint,3,opt,name=hasNextPage,proto3" json:"hasNextPage,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetOrdersForAccountPageResponse) Reset() {
+	*x = GetOrdersForAccountPageResponse{}
+	mi := &file_order_proto_msgTypes[68]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetOrdersForAccountPageResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetOrdersForAccountPageResponse) ProtoMessage() {}
+
+func (x *GetOrdersForAccountPageResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[68]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetOrdersForAccountPageResponse.ProtoReflect.Descriptor instead.
+func (*GetOrdersForAccountPageResponse) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{68}
+}
+
+func (x *GetOrdersForAccountPageResponse) GetOrders() []*Order {
+	if x != nil {
+		return x.Orders
+	}
+	return nil
+}
+
+func (x *GetOrdersForAccountPageResponse) GetTotalCount() uint64 {
+	if x != nil {
+		return x.TotalCount
+	}
+	return 0
+}
+
+func (x *GetOrdersForAccountPageResponse) GetHasNextPage() bool {
+	if x != nil {
+		return x.HasNextPage
+	}
+	return false
+}
+
+type Shipment_ShipmentItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=productId,proto3" json:"productId,omitempty"`
+	Quantity      uint32                 `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	VariantId     string                 `protobuf:"bytes,3,opt,name=variantId,proto3" json:"variantId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Shipment_ShipmentItem) Reset() {
+	*x = Shipment_ShipmentItem{}
+	mi := &file_order_proto_msgTypes[69]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Shipment_ShipmentItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Shipment_ShipmentItem) ProtoMessage() {}
+
+func (x *Shipment_ShipmentItem) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[69]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Shipment_ShipmentItem.ProtoReflect.Descriptor instead.
+func (*Shipment_ShipmentItem) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{1, 0}
+}
+
+func (x *Shipment_ShipmentItem) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *Shipment_ShipmentItem) GetQuantity() uint32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Shipment_ShipmentItem) GetVariantId() string {
+	if x != nil {
+		return x.VariantId
+	}
+	return ""
+}
+
+type Order_OrderProduct struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Id          string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name        string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Description string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	Price       float64                `protobuf:"fixed64,4,opt,name=price,proto3" json:"price,omitempty"`
+	Quantity    uint32                 `protobuf:"varint,5,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// The variant as it was when the order was placed, empty for products without variants
+	VariantId     string                              `protobuf:"bytes,6,opt,name=variantId,proto3" json:"variantId,omitempty"`
+	Sku           string                              `protobuf:"bytes,7,opt,name=sku,proto3" json:"sku,omitempty"`
+	Options       []*Order_OrderProduct_VariantOption `protobuf:"bytes,8,rep,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Order_OrderProduct) Reset() {
+	*x = Order_OrderProduct{}
+	mi := &file_order_proto_msgTypes[70]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Order_OrderProduct) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Order_OrderProduct) ProtoMessage() {}
+
+func (x *Order_OrderProduct) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[70]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Order_OrderProduct.ProtoReflect.Descriptor instead.
+func (*Order_OrderProduct) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{5, 0}
+}
+
+func (x *Order_OrderProduct) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Order_OrderProduct) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Order_OrderProduct) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Order_OrderProduct) GetPrice() float64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
 
-func (x *PostOrderRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_order_proto_msgTypes[1]
+func (x *Order_OrderProduct) GetQuantity() uint32 {
 	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
+		return x.Quantity
 	}
-	return mi.MessageOf(x)
+	return 0
 }
 
-// Deprecated: Use PostOrderRequest.ProtoReflect.Descriptor instead.
-func (*PostOrderRequest) Descriptor() ([]byte, []int) {
-	return file_order_proto_rawDescGZIP(), []int{1}
+func (x *Order_OrderProduct) GetVariantId() string {
+	if x != nil {
+		return x.VariantId
+	}
+	return ""
 }
 
-func (x *PostOrderRequest) GetAccountId() string {
+func (x *Order_OrderProduct) GetSku() string {
 	if x != nil {
-		return x.AccountId
+		return x.Sku
 	}
 	return ""
 }
 
-func (x *PostOrderRequest) GetProducts() []*PostOrderRequest_OrderProduct {
+func (x *Order_OrderProduct) GetOptions() []*Order_OrderProduct_VariantOption {
 	if x != nil {
-		return x.Products
+		return x.Options
 	}
 	return nil
 }
 
-type PostOrderResponse struct {
+type Order_OrderProduct_VariantOption struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Order         *Order                 `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *PostOrderResponse) Reset() {
-	*x = PostOrderResponse{}
-	mi := &file_order_proto_msgTypes[2]
+func (x *Order_OrderProduct_VariantOption) Reset() {
+	*x = Order_OrderProduct_VariantOption{}
+	mi := &file_order_proto_msgTypes[71]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *PostOrderResponse) String() string {
+func (x *Order_OrderProduct_VariantOption) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*PostOrderResponse) ProtoMessage() {}
+func (*Order_OrderProduct_VariantOption) ProtoMessage() {}
 
-func (x *PostOrderResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_order_proto_msgTypes[2]
+func (x *Order_OrderProduct_VariantOption) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[71]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -181,40 +4369,50 @@ func (x *PostOrderResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use PostOrderResponse.ProtoReflect.Descriptor instead.
-func (*PostOrderResponse) Descriptor() ([]byte, []int) {
-	return file_order_proto_rawDescGZIP(), []int{2}
+// Deprecated: Use Order_OrderProduct_VariantOption.ProtoReflect.Descriptor instead.
+func (*Order_OrderProduct_VariantOption) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{5, 0, 0}
 }
 
-func (x *PostOrderResponse) GetOrder() *Order {
+func (x *Order_OrderProduct_VariantOption) GetName() string {
 	if x != nil {
-		return x.Order
+		return x.Name
 	}
-	return nil
+	return ""
 }
 
-type GetOrderRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+func (x *Order_OrderProduct_VariantOption) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type PostOrderRequest_OrderProduct struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ProductId string                 `protobuf:"bytes,2,opt,name=productId,proto3" json:"productId,omitempty"`
+	Quantity  uint32                 `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// Required for products with variants
+	VariantId     string `protobuf:"bytes,4,opt,name=variantId,proto3" json:"variantId,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetOrderRequest) Reset() {
-	*x = GetOrderRequest{}
-	mi := &file_order_proto_msgTypes[3]
+func (x *PostOrderRequest_OrderProduct) Reset() {
+	*x = PostOrderRequest_OrderProduct{}
+	mi := &file_order_proto_msgTypes[72]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetOrderRequest) String() string {
+func (x *PostOrderRequest_OrderProduct) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetOrderRequest) ProtoMessage() {}
+func (*PostOrderRequest_OrderProduct) ProtoMessage() {}
 
-func (x *GetOrderRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_order_proto_msgTypes[3]
+func (x *PostOrderRequest_OrderProduct) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[72]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -225,40 +4423,58 @@ func (x *GetOrderRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetOrderRequest.ProtoReflect.Descriptor instead.
-func (*GetOrderRequest) Descriptor() ([]byte, []int) {
-	return file_order_proto_rawDescGZIP(), []int{3}
+// Deprecated: Use PostOrderRequest_OrderProduct.ProtoReflect.Descriptor instead.
+func (*PostOrderRequest_OrderProduct) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{6, 0}
 }
 
-func (x *GetOrderRequest) GetId() string {
+func (x *PostOrderRequest_OrderProduct) GetProductId() string {
 	if x != nil {
-		return x.Id
+		return x.ProductId
 	}
 	return ""
 }
 
-type GetOrderResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Order         *Order                 `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
+func (x *PostOrderRequest_OrderProduct) GetQuantity() uint32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *PostOrderRequest_OrderProduct) GetVariantId() string {
+	if x != nil {
+		return x.VariantId
+	}
+	return ""
+}
+
+type WebhookDelivery_Attempt struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	AttemptedAt []byte                 `protobuf:"bytes,1,opt,name=attemptedAt,proto3" json:"attemptedAt,omitempty"`
+	// 0 when no response was received
+	StatusCode    int32  `protobuf:"varint,2,opt,name=statusCode,proto3" json:"statusCode,omitempty"`
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	DurationMs    uint32 `protobuf:"varint,4,opt,name=durationMs,proto3" json:"durationMs,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetOrderResponse) Reset() {
-	*x = GetOrderResponse{}
-	mi := &file_order_proto_msgTypes[4]
+func (x *WebhookDelivery_Attempt) Reset() {
+	*x = WebhookDelivery_Attempt{}
+	mi := &file_order_proto_msgTypes[73]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetOrderResponse) String() string {
+func (x *WebhookDelivery_Attempt) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetOrderResponse) ProtoMessage() {}
+func (*WebhookDelivery_Attempt) ProtoMessage() {}
 
-func (x *GetOrderResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_order_proto_msgTypes[4]
+func (x *WebhookDelivery_Attempt) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[73]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -269,84 +4485,64 @@ func (x *GetOrderResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetOrderResponse.ProtoReflect.Descriptor instead.
-func (*GetOrderResponse) Descriptor() ([]byte, []int) {
-	return file_order_proto_rawDescGZIP(), []int{4}
+// Deprecated: Use WebhookDelivery_Attempt.ProtoReflect.Descriptor instead.
+func (*WebhookDelivery_Attempt) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{35, 0}
 }
 
-func (x *GetOrderResponse) GetOrder() *Order {
+func (x *WebhookDelivery_Attempt) GetAttemptedAt() []byte {
 	if x != nil {
-		return x.Order
+		return x.AttemptedAt
 	}
 	return nil
 }
 
-type GetOrdersForAccountRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	AccountId     string                 `protobuf:"bytes,1,opt,name=accountId,proto3" json:"accountId,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
-}
-
-func (x *GetOrdersForAccountRequest) Reset() {
-	*x = GetOrdersForAccountRequest{}
-	mi := &file_order_proto_msgTypes[5]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
-}
-
-func (x *GetOrdersForAccountRequest) String() string {
-	return protoimpl.X.MessageStringOf(x)
-}
-
-func (*GetOrdersForAccountRequest) ProtoMessage() {}
-
-func (x *GetOrdersForAccountRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_order_proto_msgTypes[5]
+func (x *WebhookDelivery_Attempt) GetStatusCode() int32 {
 	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
+		return x.StatusCode
 	}
-	return mi.MessageOf(x)
+	return 0
 }
 
-// Deprecated: Use GetOrdersForAccountRequest.ProtoReflect.Descriptor instead.
-func (*GetOrdersForAccountRequest) Descriptor() ([]byte, []int) {
-	return file_order_proto_rawDescGZIP(), []int{5}
+func (x *WebhookDelivery_Attempt) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
 }
 
-func (x *GetOrdersForAccountRequest) GetAccountId() string {
+func (x *WebhookDelivery_Attempt) GetDurationMs() uint32 {
 	if x != nil {
-		return x.AccountId
+		return x.DurationMs
 	}
-	return ""
+	return 0
 }
 
-type GetOrdersForAccountResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Orders        []*Order               `protobuf:"bytes,1,rep,name=orders,proto3" json:"orders,omitempty"`
+type OrderSubscription_Item struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ProductId string                 `protobuf:"bytes,1,opt,name=productId,proto3" json:"productId,omitempty"`
+	// Required for products with variants
+	VariantId     string `protobuf:"bytes,2,opt,name=variantId,proto3" json:"variantId,omitempty"`
+	Quantity      uint32 `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *GetOrdersForAccountResponse) Reset() {
-	*x = GetOrdersForAccountResponse{}
-	mi := &file_order_proto_msgTypes[6]
+func (x *OrderSubscription_Item) Reset() {
+	*x = OrderSubscription_Item{}
+	mi := &file_order_proto_msgTypes[74]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *GetOrdersForAccountResponse) String() string {
+func (x *OrderSubscription_Item) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetOrdersForAccountResponse) ProtoMessage() {}
+func (*OrderSubscription_Item) ProtoMessage() {}
 
-func (x *GetOrdersForAccountResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_order_proto_msgTypes[6]
+func (x *OrderSubscription_Item) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[74]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -357,44 +4553,63 @@ func (x *GetOrdersForAccountResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetOrdersForAccountResponse.ProtoReflect.Descriptor instead.
-func (*GetOrdersForAccountResponse) Descriptor() ([]byte, []int) {
-	return file_order_proto_rawDescGZIP(), []int{6}
+// Deprecated: Use OrderSubscription_Item.ProtoReflect.Descriptor instead.
+func (*OrderSubscription_Item) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{54, 0}
 }
 
-func (x *GetOrdersForAccountResponse) GetOrders() []*Order {
+func (x *OrderSubscription_Item) GetProductId() string {
 	if x != nil {
-		return x.Orders
+		return x.ProductId
 	}
-	return nil
+	return ""
 }
 
-type Order_OrderProduct struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
-	Description   string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
-	Price         float64                `protobuf:"fixed64,4,opt,name=price,proto3" json:"price,omitempty"`
-	Quantity      uint32                 `protobuf:"varint,5,opt,name=quantity,proto3" json:"quantity,omitempty"`
+func (x *OrderSubscription_Item) GetVariantId() string {
+	if x != nil {
+		return x.VariantId
+	}
+	return ""
+}
+
+func (x *OrderSubscription_Item) GetQuantity() uint32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+type OrderSubscription_Run struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Id           string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	ScheduledFor []byte                 `protobuf:"bytes,2,opt,name=scheduledFor,proto3" json:"scheduledFor,omitempty"`
+	// pending, placed, failed or skipped
+	Status string `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	// Set once the order is placed
+	OrderId       string `protobuf:"bytes,4,opt,name=orderId,proto3" json:"orderId,omitempty"`
+	Attempts      uint32 `protobuf:"varint,5,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	NextAttemptAt []byte `protobuf:"bytes,6,opt,name=nextAttemptAt,proto3" json:"nextAttemptAt,omitempty"`
+	LastError     string `protobuf:"bytes,7,opt,name=lastError,proto3" json:"lastError,omitempty"`
+	CreatedAt     []byte `protobuf:"bytes,8,opt,name=createdAt,proto3" json:"createdAt,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Order_OrderProduct) Reset() {
-	*x = Order_OrderProduct{}
-	mi := &file_order_proto_msgTypes[7]
+func (x *OrderSubscription_Run) Reset() {
+	*x = OrderSubscription_Run{}
+	mi := &file_order_proto_msgTypes[75]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Order_OrderProduct) String() string {
+func (x *OrderSubscription_Run) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Order_OrderProduct) ProtoMessage() {}
+func (*OrderSubscription_Run) ProtoMessage() {}
 
-func (x *Order_OrderProduct) ProtoReflect() protoreflect.Message {
-	mi := &file_order_proto_msgTypes[7]
+func (x *OrderSubscription_Run) ProtoReflect() protoreflect.Message {
+	mi := &file_order_proto_msgTypes[75]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -405,103 +4620,126 @@ func (x *Order_OrderProduct) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Order_OrderProduct.ProtoReflect.Descriptor instead.
-func (*Order_OrderProduct) Descriptor() ([]byte, []int) {
-	return file_order_proto_rawDescGZIP(), []int{0, 0}
+// Deprecated: Use OrderSubscription_Run.ProtoReflect.Descriptor instead.
+func (*OrderSubscription_Run) Descriptor() ([]byte, []int) {
+	return file_order_proto_rawDescGZIP(), []int{54, 1}
 }
 
-func (x *Order_OrderProduct) GetId() string {
+func (x *OrderSubscription_Run) GetId() string {
 	if x != nil {
 		return x.Id
 	}
 	return ""
 }
 
-func (x *Order_OrderProduct) GetName() string {
+func (x *OrderSubscription_Run) GetScheduledFor() []byte {
 	if x != nil {
-		return x.Name
+		return x.ScheduledFor
 	}
-	return ""
+	return nil
 }
 
-func (x *Order_OrderProduct) GetDescription() string {
+func (x *OrderSubscription_Run) GetStatus() string {
 	if x != nil {
-		return x.Description
+		return x.Status
 	}
 	return ""
 }
 
-func (x *Order_OrderProduct) GetPrice() float64 {
+func (x *OrderSubscription_Run) GetOrderId() string {
 	if x != nil {
-		return x.Price
+		return x.OrderId
 	}
-	return 0
+	return ""
 }
 
-func (x *Order_OrderProduct) GetQuantity() uint32 {
+func (x *OrderSubscription_Run) GetAttempts() uint32 {
 	if x != nil {
-		return x.Quantity
+		return x.Attempts
 	}
 	return 0
 }
 
-type PostOrderRequest_OrderProduct struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	ProductId     string                 `protobuf:"bytes,2,opt,name=productId,proto3" json:"productId,omitempty"`
-	Quantity      uint32                 `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
-}
-
-func (x *PostOrderRequest_OrderProduct) Reset() {
-	*x = PostOrderRequest_OrderProduct{}
-	mi := &file_order_proto_msgTypes[8]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
-}
-
-func (x *PostOrderRequest_OrderProduct) String() string {
-	return protoimpl.X.MessageStringOf(x)
-}
-
-func (*PostOrderRequest_OrderProduct) ProtoMessage() {}
-
-func (x *PostOrderRequest_OrderProduct) ProtoReflect() protoreflect.Message {
-	mi := &file_order_proto_msgTypes[8]
+func (x *OrderSubscription_Run) GetNextAttemptAt() []byte {
 	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
+		return x.NextAttemptAt
 	}
-	return mi.MessageOf(x)
-}
-
-// Deprecated: Use PostOrderRequest_OrderProduct.ProtoReflect.Descriptor instead.
-func (*PostOrderRequest_OrderProduct) Descriptor() ([]byte, []int) {
-	return file_order_proto_rawDescGZIP(), []int{1, 0}
+	return nil
 }
 
-func (x *PostOrderRequest_OrderProduct) GetProductId() string {
+func (x *OrderSubscription_Run) GetLastError() string {
 	if x != nil {
-		return x.ProductId
+		return x.LastError
 	}
 	return ""
 }
 
-func (x *PostOrderRequest_OrderProduct) GetQuantity() uint32 {
+func (x *OrderSubscription_Run) GetCreatedAt() []byte {
 	if x != nil {
-		return x.Quantity
+		return x.CreatedAt
 	}
-	return 0
+	return nil
 }
 
 var File_order_proto protoreflect.FileDescriptor
 
 const file_order_proto_rawDesc = "" +
 	"\n" +
-	"\vorder.proto\x12\x02pb\"\xb0\x02\n" +
+	"\vorder.proto\x12\x02pb\x1a\x1cgoogle/api/annotations.proto\"\xad\x01\n" +
+	"\aAddress\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05line1\x18\x02 \x01(\tR\x05line1\x12\x14\n" +
+	"\x05line2\x18\x03 \x01(\tR\x05line2\x12\x12\n" +
+	"\x04city\x18\x04 \x01(\tR\x04city\x12\x14\n" +
+	"\x05state\x18\x05 \x01(\tR\x05state\x12\x1e\n" +
+	"\n" +
+	"postalCode\x18\x06 \x01(\tR\n" +
+	"postalCode\x12\x18\n" +
+	"\acountry\x18\a \x01(\tR\acountry\"\x85\x03\n" +
+	"\bShipment\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\aorderId\x18\x02 \x01(\tR\aorderId\x12\x18\n" +
+	"\acarrier\x18\x03 \x01(\tR\acarrier\x12&\n" +
+	"\x0etrackingNumber\x18\x04 \x01(\tR\x0etrackingNumber\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\tR\x06status\x12\x1c\n" +
+	"\tcreatedAt\x18\x06 \x01(\fR\tcreatedAt\x12\x1c\n" +
+	"\tshippedAt\x18\a \x01(\fR\tshippedAt\x12 \n" +
+	"\vdeliveredAt\x18\b \x01(\fR\vdeliveredAt\x12/\n" +
+	"\x05items\x18\t \x03(\v2\x19.pb.Shipment.ShipmentItemR\x05items\x1af\n" +
+	"\fShipmentItem\x12\x1c\n" +
+	"\tproductId\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\rR\bquantity\x12\x1c\n" +
+	"\tvariantId\x18\x03 \x01(\tR\tvariantId\"\x98\x01\n" +
+	"\bDiscount\x12 \n" +
+	"\vpromotionId\x18\x01 \x01(\tR\vpromotionId\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12\x1c\n" +
+	"\tproductId\x18\x03 \x01(\tR\tproductId\x12 \n" +
+	"\vdescription\x18\x04 \x01(\tR\vdescription\x12\x16\n" +
+	"\x06amount\x18\x05 \x01(\x01R\x06amount\"\x99\x03\n" +
+	"\tPromotion\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x12\x12\n" +
+	"\x04type\x18\x04 \x01(\tR\x04type\x12\x14\n" +
+	"\x05value\x18\x05 \x01(\x01R\x05value\x12 \n" +
+	"\vbuyQuantity\x18\x06 \x01(\rR\vbuyQuantity\x12 \n" +
+	"\vgetQuantity\x18\a \x01(\rR\vgetQuantity\x12\x1e\n" +
+	"\n" +
+	"productIds\x18\b \x03(\tR\n" +
+	"productIds\x12\x1a\n" +
+	"\bminSpend\x18\t \x01(\x01R\bminSpend\x122\n" +
+	"\x14usageLimitPerAccount\x18\n" +
+	" \x01(\rR\x14usageLimitPerAccount\x12\x1a\n" +
+	"\bstartsAt\x18\v \x01(\fR\bstartsAt\x12\x16\n" +
+	"\x06endsAt\x18\f \x01(\fR\x06endsAt\x12\x16\n" +
+	"\x06active\x18\r \x01(\bR\x06active\x12\x1c\n" +
+	"\tcreatedAt\x18\x0e \x01(\fR\tcreatedAt\"\x95\x01\n" +
+	"\aTaxLine\x12\x1c\n" +
+	"\tproductId\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bcategory\x18\x02 \x01(\tR\bcategory\x12\x12\n" +
+	"\x04rate\x18\x03 \x01(\x01R\x04rate\x12$\n" +
+	"\rtaxableAmount\x18\x04 \x01(\x01R\rtaxableAmount\x12\x16\n" +
+	"\x06amount\x18\x05 \x01(\x01R\x06amount\"\xb9\x06\n" +
 	"\x05Order\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1c\n" +
 	"\tcreatedAt\x18\x02 \x01(\fR\tcreatedAt\x12\x1c\n" +
@@ -509,32 +4747,337 @@ const file_order_proto_rawDesc = "" +
 	"\n" +
 	"totalPrice\x18\x04 \x01(\x01R\n" +
 	"totalPrice\x122\n" +
-	"\bproducts\x18\x05 \x03(\v2\x16.pb.Order.OrderProductR\bproducts\x1a\x86\x01\n" +
+	"\bproducts\x18\x05 \x03(\v2\x16.pb.Order.OrderProductR\bproducts\x12$\n" +
+	"\rpaymentStatus\x18\x06 \x01(\tR\rpaymentStatus\x125\n" +
+	"\x0fshippingAddress\x18\a \x01(\v2\v.pb.AddressR\x0fshippingAddress\x12*\n" +
+	"\tshipments\x18\b \x03(\v2\f.pb.ShipmentR\tshipments\x12*\n" +
+	"\tdiscounts\x18\t \x03(\v2\f.pb.DiscountR\tdiscounts\x12\x1a\n" +
+	"\bsubtotal\x18\n" +
+	" \x01(\x01R\bsubtotal\x12\x1a\n" +
+	"\btaxTotal\x18\v \x01(\x01R\btaxTotal\x12\"\n" +
+	"\ftaxInclusive\x18\f \x01(\bR\ftaxInclusive\x12(\n" +
+	"\x0ftaxJurisdiction\x18\r \x01(\tR\x0ftaxJurisdiction\x12!\n" +
+	"\x05taxes\x18\x0e \x03(\v2\v.pb.TaxLineR\x05taxes\x1a\xb1\x02\n" +
 	"\fOrderProduct\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12 \n" +
 	"\vdescription\x18\x03 \x01(\tR\vdescription\x12\x14\n" +
 	"\x05price\x18\x04 \x01(\x01R\x05price\x12\x1a\n" +
-	"\bquantity\x18\x05 \x01(\rR\bquantity\"\xb9\x01\n" +
+	"\bquantity\x18\x05 \x01(\rR\bquantity\x12\x1c\n" +
+	"\tvariantId\x18\x06 \x01(\tR\tvariantId\x12\x10\n" +
+	"\x03sku\x18\a \x01(\tR\x03sku\x12>\n" +
+	"\aoptions\x18\b \x03(\v2$.pb.Order.OrderProduct.VariantOptionR\aoptions\x1a9\n" +
+	"\rVariantOption\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"\xd6\x02\n" +
 	"\x10PostOrderRequest\x12\x1c\n" +
 	"\taccountId\x18\x02 \x01(\tR\taccountId\x12=\n" +
-	"\bproducts\x18\x04 \x03(\v2!.pb.PostOrderRequest.OrderProductR\bproducts\x1aH\n" +
+	"\bproducts\x18\x04 \x03(\v2!.pb.PostOrderRequest.OrderProductR\bproducts\x125\n" +
+	"\x0fshippingAddress\x18\x05 \x01(\v2\v.pb.AddressR\x0fshippingAddress\x12\x1e\n" +
+	"\n" +
+	"couponCode\x18\x06 \x01(\tR\n" +
+	"couponCode\x12&\n" +
+	"\x0eidempotencyKey\x18\a \x01(\tR\x0eidempotencyKey\x1af\n" +
 	"\fOrderProduct\x12\x1c\n" +
 	"\tproductId\x18\x02 \x01(\tR\tproductId\x12\x1a\n" +
-	"\bquantity\x18\x03 \x01(\rR\bquantity\"4\n" +
+	"\bquantity\x18\x03 \x01(\rR\bquantity\x12\x1c\n" +
+	"\tvariantId\x18\x04 \x01(\tR\tvariantId\"4\n" +
 	"\x11PostOrderResponse\x12\x1f\n" +
 	"\x05order\x18\x01 \x01(\v2\t.pb.OrderR\x05order\"!\n" +
 	"\x0fGetOrderRequest\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\"3\n" +
 	"\x10GetOrderResponse\x12\x1f\n" +
-	"\x05order\x18\x01 \x01(\v2\t.pb.OrderR\x05order\":\n" +
+	"\x05order\x18\x01 \x01(\v2\t.pb.OrderR\x05order\"\\\n" +
+	"\x1aUpdatePaymentStatusRequest\x12\x18\n" +
+	"\aorderId\x18\x01 \x01(\tR\aorderId\x12$\n" +
+	"\rpaymentStatus\x18\x02 \x01(\tR\rpaymentStatus\">\n" +
+	"\x1bUpdatePaymentStatusResponse\x12\x1f\n" +
+	"\x05order\x18\x01 \x01(\v2\t.pb.OrderR\x05order\"\xa4\x01\n" +
+	"\x15CreateShipmentRequest\x12\x18\n" +
+	"\aorderId\x18\x01 \x01(\tR\aorderId\x12\x18\n" +
+	"\acarrier\x18\x02 \x01(\tR\acarrier\x12&\n" +
+	"\x0etrackingNumber\x18\x03 \x01(\tR\x0etrackingNumber\x12/\n" +
+	"\x05items\x18\x04 \x03(\v2\x19.pb.Shipment.ShipmentItemR\x05items\"B\n" +
+	"\x16CreateShipmentResponse\x12(\n" +
+	"\bshipment\x18\x01 \x01(\v2\f.pb.ShipmentR\bshipment\"\x91\x01\n" +
+	"\x15UpdateShipmentRequest\x12\x1e\n" +
+	"\n" +
+	"shipmentId\x18\x01 \x01(\tR\n" +
+	"shipmentId\x12\x18\n" +
+	"\acarrier\x18\x02 \x01(\tR\acarrier\x12&\n" +
+	"\x0etrackingNumber\x18\x03 \x01(\tR\x0etrackingNumber\x12\x16\n" +
+	"\x06status\x18\x04 \x01(\tR\x06status\"B\n" +
+	"\x16UpdateShipmentResponse\x12(\n" +
+	"\bshipment\x18\x01 \x01(\v2\f.pb.ShipmentR\bshipment\"E\n" +
+	"\x16CreatePromotionRequest\x12+\n" +
+	"\tpromotion\x18\x01 \x01(\v2\r.pb.PromotionR\tpromotion\"F\n" +
+	"\x17CreatePromotionResponse\x12+\n" +
+	"\tpromotion\x18\x01 \x01(\v2\r.pb.PromotionR\tpromotion\"E\n" +
+	"\x16UpdatePromotionRequest\x12+\n" +
+	"\tpromotion\x18\x01 \x01(\v2\r.pb.PromotionR\tpromotion\"F\n" +
+	"\x17UpdatePromotionResponse\x12+\n" +
+	"\tpromotion\x18\x01 \x01(\v2\r.pb.PromotionR\tpromotion\"\x16\n" +
+	"\x14GetPromotionsRequest\"F\n" +
+	"\x15GetPromotionsResponse\x12-\n" +
+	"\n" +
+	"promotions\x18\x01 \x03(\v2\r.pb.PromotionR\n" +
+	"promotions\"\x8b\x01\n" +
+	"\vSalesBucket\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\fR\x05start\x12\x1e\n" +
+	"\n" +
+	"orderCount\x18\x02 \x01(\x04R\n" +
+	"orderCount\x12\x18\n" +
+	"\arevenue\x18\x03 \x01(\x01R\arevenue\x12,\n" +
+	"\x11averageOrderValue\x18\x04 \x01(\x01R\x11averageOrderValue\"W\n" +
+	"\x15GetSalesReportRequest\x12\x12\n" +
+	"\x04from\x18\x01 \x01(\fR\x04from\x12\x0e\n" +
+	"\x02to\x18\x02 \x01(\fR\x02to\x12\x1a\n" +
+	"\binterval\x18\x03 \x01(\tR\binterval\"\xab\x01\n" +
+	"\x16GetSalesReportResponse\x12)\n" +
+	"\abuckets\x18\x01 \x03(\v2\x0f.pb.SalesBucketR\abuckets\x12\x1e\n" +
+	"\n" +
+	"orderCount\x18\x02 \x01(\x04R\n" +
+	"orderCount\x12\x18\n" +
+	"\arevenue\x18\x03 \x01(\x01R\arevenue\x12,\n" +
+	"\x11averageOrderValue\x18\x04 \x01(\x01R\x11averageOrderValue\"\x96\x01\n" +
+	"\fProductSales\x12\x1c\n" +
+	"\tproductId\x18\x01 \x01(\tR\tproductId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1a\n" +
+	"\bquantity\x18\x03 \x01(\x04R\bquantity\x12\x18\n" +
+	"\arevenue\x18\x04 \x01(\x01R\arevenue\x12\x1e\n" +
+	"\n" +
+	"orderCount\x18\x05 \x01(\x04R\n" +
+	"orderCount\"k\n" +
+	"\x15GetTopProductsRequest\x12\x12\n" +
+	"\x04from\x18\x01 \x01(\fR\x04from\x12\x0e\n" +
+	"\x02to\x18\x02 \x01(\fR\x02to\x12\x18\n" +
+	"\aorderBy\x18\x03 \x01(\tR\aorderBy\x12\x14\n" +
+	"\x05limit\x18\x04 \x01(\rR\x05limit\"F\n" +
+	"\x16GetTopProductsResponse\x12,\n" +
+	"\bproducts\x18\x01 \x03(\v2\x10.pb.ProductSalesR\bproducts\"\xe6\x01\n" +
+	"\fAccountValue\x12\x1c\n" +
+	"\taccountId\x18\x01 \x01(\tR\taccountId\x12\x1e\n" +
+	"\n" +
+	"orderCount\x18\x02 \x01(\x04R\n" +
+	"orderCount\x12$\n" +
+	"\rlifetimeValue\x18\x03 \x01(\x01R\rlifetimeValue\x12,\n" +
+	"\x11averageOrderValue\x18\x04 \x01(\x01R\x11averageOrderValue\x12\"\n" +
+	"\ffirstOrderAt\x18\x05 \x01(\fR\ffirstOrderAt\x12 \n" +
+	"\vlastOrderAt\x18\x06 \x01(\fR\vlastOrderAt\"O\n" +
+	"\x17GetAccountValuesRequest\x12\x1e\n" +
+	"\n" +
+	"accountIds\x18\x01 \x03(\tR\n" +
+	"accountIds\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\rR\x05limit\"H\n" +
+	"\x18GetAccountValuesResponse\x12,\n" +
+	"\baccounts\x18\x01 \x03(\v2\x10.pb.AccountValueR\baccounts\"D\n" +
+	"\x0eRecommendation\x12\x1c\n" +
+	"\tproductId\x18\x01 \x01(\tR\tproductId\x12\x14\n" +
+	"\x05score\x18\x02 \x01(\x04R\x05score\"O\n" +
+	"\x19GetRecommendationsRequest\x12\x1c\n" +
+	"\tproductId\x18\x01 \x01(\tR\tproductId\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\rR\x05limit\"Z\n" +
+	"\x1aGetRecommendationsResponse\x12<\n" +
+	"\x0frecommendations\x18\x01 \x03(\v2\x12.pb.RecommendationR\x0frecommendations\"\x99\x01\n" +
+	"\aWebhook\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x1e\n" +
+	"\n" +
+	"eventTypes\x18\x03 \x03(\tR\n" +
+	"eventTypes\x12\x16\n" +
+	"\x06secret\x18\x04 \x01(\tR\x06secret\x12\x16\n" +
+	"\x06active\x18\x05 \x01(\bR\x06active\x12\x1c\n" +
+	"\tcreatedAt\x18\x06 \x01(\fR\tcreatedAt\"\xb2\x04\n" +
+	"\x0fWebhookDelivery\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1c\n" +
+	"\twebhookId\x18\x02 \x01(\tR\twebhookId\x12\x18\n" +
+	"\aeventId\x18\x03 \x01(\tR\aeventId\x12\x1c\n" +
+	"\teventType\x18\x04 \x01(\tR\teventType\x12\x18\n" +
+	"\apayload\x18\x05 \x01(\tR\apayload\x12\x16\n" +
+	"\x06status\x18\x06 \x01(\tR\x06status\x12\x1a\n" +
+	"\battempts\x18\a \x01(\rR\battempts\x12$\n" +
+	"\rnextAttemptAt\x18\b \x01(\fR\rnextAttemptAt\x12&\n" +
+	"\x0elastStatusCode\x18\t \x01(\x05R\x0elastStatusCode\x12\x1c\n" +
+	"\tlastError\x18\n" +
+	" \x01(\tR\tlastError\x12\x1c\n" +
+	"\tcreatedAt\x18\v \x01(\fR\tcreatedAt\x12 \n" +
+	"\vdeliveredAt\x18\f \x01(\fR\vdeliveredAt\x12;\n" +
+	"\n" +
+	"attemptLog\x18\r \x03(\v2\x1b.pb.WebhookDelivery.AttemptR\n" +
+	"attemptLog\x1a\x81\x01\n" +
+	"\aAttempt\x12 \n" +
+	"\vattemptedAt\x18\x01 \x01(\fR\vattemptedAt\x12\x1e\n" +
+	"\n" +
+	"statusCode\x18\x02 \x01(\x05R\n" +
+	"statusCode\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x1e\n" +
+	"\n" +
+	"durationMs\x18\x04 \x01(\rR\n" +
+	"durationMs\"=\n" +
+	"\x14CreateWebhookRequest\x12%\n" +
+	"\awebhook\x18\x01 \x01(\v2\v.pb.WebhookR\awebhook\">\n" +
+	"\x15CreateWebhookResponse\x12%\n" +
+	"\awebhook\x18\x01 \x01(\v2\v.pb.WebhookR\awebhook\"=\n" +
+	"\x14UpdateWebhookRequest\x12%\n" +
+	"\awebhook\x18\x01 \x01(\v2\v.pb.WebhookR\awebhook\">\n" +
+	"\x15UpdateWebhookResponse\x12%\n" +
+	"\awebhook\x18\x01 \x01(\v2\v.pb.WebhookR\awebhook\"&\n" +
+	"\x14DeleteWebhookRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x17\n" +
+	"\x15DeleteWebhookResponse\"\x14\n" +
+	"\x12GetWebhooksRequest\">\n" +
+	"\x13GetWebhooksResponse\x12'\n" +
+	"\bwebhooks\x18\x01 \x03(\v2\v.pb.WebhookR\bwebhooks\"c\n" +
+	"\x1bGetWebhookDeliveriesRequest\x12\x1c\n" +
+	"\twebhookId\x18\x01 \x01(\tR\twebhookId\x12\x12\n" +
+	"\x04skip\x18\x02 \x01(\x04R\x04skip\x12\x12\n" +
+	"\x04take\x18\x03 \x01(\x04R\x04take\"S\n" +
+	"\x1cGetWebhookDeliveriesResponse\x123\n" +
+	"\n" +
+	"deliveries\x18\x01 \x03(\v2\x13.pb.WebhookDeliveryR\n" +
+	"deliveries\"9\n" +
+	"\x17RedeliverWebhookRequest\x12\x1e\n" +
+	"\n" +
+	"deliveryId\x18\x01 \x01(\tR\n" +
+	"deliveryId\"K\n" +
+	"\x18RedeliverWebhookResponse\x12/\n" +
+	"\bdelivery\x18\x01 \x01(\v2\x13.pb.WebhookDeliveryR\bdelivery\"\x9d\x02\n" +
+	"\x11OrderNotification\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\aorderId\x18\x02 \x01(\tR\aorderId\x12\x12\n" +
+	"\x04kind\x18\x03 \x01(\tR\x04kind\x12\x1c\n" +
+	"\trecipient\x18\x04 \x01(\tR\trecipient\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\tR\x06status\x12\x1a\n" +
+	"\battempts\x18\x06 \x01(\rR\battempts\x12$\n" +
+	"\rnextAttemptAt\x18\a \x01(\fR\rnextAttemptAt\x12\x1c\n" +
+	"\tlastError\x18\b \x01(\tR\tlastError\x12\x1c\n" +
+	"\tcreatedAt\x18\t \x01(\fR\tcreatedAt\x12\x16\n" +
+	"\x06sentAt\x18\n" +
+	" \x01(\fR\x06sentAt\"8\n" +
+	"\x1cGetOrderNotificationsRequest\x12\x18\n" +
+	"\aorderId\x18\x01 \x01(\tR\aorderId\"\\\n" +
+	"\x1dGetOrderNotificationsResponse\x12;\n" +
+	"\rnotifications\x18\x01 \x03(\v2\x15.pb.OrderNotificationR\rnotifications\"}\n" +
+	"\aInvoice\x12\x18\n" +
+	"\aorderId\x18\x01 \x01(\tR\aorderId\x12\x16\n" +
+	"\x06number\x18\x02 \x01(\tR\x06number\x12\x1a\n" +
+	"\bissuedAt\x18\x03 \x01(\fR\bissuedAt\x12\x12\n" +
+	"\x04html\x18\x04 \x01(\tR\x04html\x12\x10\n" +
+	"\x03pdf\x18\x05 \x01(\fR\x03pdf\"-\n" +
+	"\x11GetInvoiceRequest\x12\x18\n" +
+	"\aorderId\x18\x01 \x01(\tR\aorderId\";\n" +
+	"\x12GetInvoiceResponse\x12%\n" +
+	"\ainvoice\x18\x01 \x01(\v2\v.pb.InvoiceR\ainvoice\"\xc1\x05\n" +
+	"\x11OrderSubscription\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1c\n" +
+	"\taccountId\x18\x02 \x01(\tR\taccountId\x126\n" +
+	"\bproducts\x18\x03 \x03(\v2\x1a.pb.OrderSubscription.ItemR\bproducts\x125\n" +
+	"\x0fshippingAddress\x18\x04 \x01(\v2\v.pb.AddressR\x0fshippingAddress\x12\x1a\n" +
+	"\binterval\x18\x05 \x01(\tR\binterval\x12$\n" +
+	"\rintervalCount\x18\x06 \x01(\rR\rintervalCount\x12\x1c\n" +
+	"\tnextRunAt\x18\a \x01(\fR\tnextRunAt\x12\x16\n" +
+	"\x06status\x18\b \x01(\tR\x06status\x12\x1c\n" +
+	"\tcreatedAt\x18\t \x01(\fR\tcreatedAt\x12-\n" +
+	"\x04runs\x18\n" +
+	" \x03(\v2\x19.pb.OrderSubscription.RunR\x04runs\x1a^\n" +
+	"\x04Item\x12\x1c\n" +
+	"\tproductId\x18\x01 \x01(\tR\tproductId\x12\x1c\n" +
+	"\tvariantId\x18\x02 \x01(\tR\tvariantId\x12\x1a\n" +
+	"\bquantity\x18\x03 \x01(\rR\bquantity\x1a\xe9\x01\n" +
+	"\x03Run\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\"\n" +
+	"\fscheduledFor\x18\x02 \x01(\fR\fscheduledFor\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x18\n" +
+	"\aorderId\x18\x04 \x01(\tR\aorderId\x12\x1a\n" +
+	"\battempts\x18\x05 \x01(\rR\battempts\x12$\n" +
+	"\rnextAttemptAt\x18\x06 \x01(\fR\rnextAttemptAt\x12\x1c\n" +
+	"\tlastError\x18\a \x01(\tR\tlastError\x12\x1c\n" +
+	"\tcreatedAt\x18\b \x01(\fR\tcreatedAt\"V\n" +
+	"\x19CreateSubscriptionRequest\x129\n" +
+	"\fsubscription\x18\x01 \x01(\v2\x15.pb.OrderSubscriptionR\fsubscription\"W\n" +
+	"\x1aCreateSubscriptionResponse\x129\n" +
+	"\fsubscription\x18\x01 \x01(\v2\x15.pb.OrderSubscriptionR\fsubscription\"A\n" +
+	"!GetSubscriptionsForAccountRequest\x12\x1c\n" +
+	"\taccountId\x18\x01 \x01(\tR\taccountId\"a\n" +
+	"\"GetSubscriptionsForAccountResponse\x12;\n" +
+	"\rsubscriptions\x18\x01 \x03(\v2\x15.pb.OrderSubscriptionR\rsubscriptions\"(\n" +
+	"\x16GetSubscriptionRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"T\n" +
+	"\x17GetSubscriptionResponse\x129\n" +
+	"\fsubscription\x18\x01 \x01(\v2\x15.pb.OrderSubscriptionR\fsubscription\"1\n" +
+	"\x1fUpdateSubscriptionStatusRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"]\n" +
+	" UpdateSubscriptionStatusResponse\x129\n" +
+	"\fsubscription\x18\x01 \x01(\v2\x15.pb.OrderSubscriptionR\fsubscription\"7\n" +
+	"\x17WatchOrderEventsRequest\x12\x1c\n" +
+	"\taccountId\x18\x01 \x01(\tR\taccountId\"\xf8\x02\n" +
+	"\n" +
+	"OrderEvent\x12'\n" +
+	"\x04type\x18\x01 \x01(\x0e2\x13.pb.OrderEvent.TypeR\x04type\x12\x18\n" +
+	"\aorderId\x18\x02 \x01(\tR\aorderId\x12\x1c\n" +
+	"\taccountId\x18\x03 \x01(\tR\taccountId\x12\x1e\n" +
+	"\n" +
+	"totalPrice\x18\x04 \x01(\x01R\n" +
+	"totalPrice\x12$\n" +
+	"\rpaymentStatus\x18\x05 \x01(\tR\rpaymentStatus\x12\x1e\n" +
+	"\n" +
+	"shipmentId\x18\x06 \x01(\tR\n" +
+	"shipmentId\x12&\n" +
+	"\x0eshipmentStatus\x18\a \x01(\tR\x0eshipmentStatus\x12\x1e\n" +
+	"\n" +
+	"occurredAt\x18\b \x01(\fR\n" +
+	"occurredAt\"[\n" +
+	"\x04Type\x12\v\n" +
+	"\aCREATED\x10\x00\x12\x1a\n" +
+	"\x16PAYMENT_STATUS_CHANGED\x10\x01\x12\x14\n" +
+	"\x10SHIPMENT_CREATED\x10\x02\x12\x14\n" +
+	"\x10SHIPMENT_UPDATED\x10\x03\":\n" +
 	"\x1aGetOrdersForAccountRequest\x12\x1c\n" +
 	"\taccountId\x18\x01 \x01(\tR\taccountId\"@\n" +
 	"\x1bGetOrdersForAccountResponse\x12!\n" +
-	"\x06orders\x18\x01 \x03(\v2\t.pb.OrderR\x06orders2\xa4\x01\n" +
-	"\fOrderService\x12:\n" +
-	"\tPostOrder\x12\x14.pb.PostOrderRequest\x1a\x15.pb.PostOrderResponse\"\x00\x12X\n" +
-	"\x13GetOrdersForAccount\x12\x1e.pb.GetOrdersForAccountRequest\x1a\x1f.pb.GetOrdersForAccountResponse\"\x00B\x06Z\x04./pbb\x06proto3"
+	"\x06orders\x18\x01 \x03(\v2\t.pb.OrderR\x06orders\"j\n" +
+	"\x1eGetOrdersForAccountPageRequest\x12\x1c\n" +
+	"\taccountId\x18\x01 \x01(\tR\taccountId\x12\x14\n" +
+	"\x05after\x18\x02 \x01(\tR\x05after\x12\x14\n" +
+	"\x05first\x18\x03 \x01(\x04R\x05first\"\x86\x01\n" +
+	"\x1fGetOrdersForAccountPageResponse\x12!\n" +
+	"\x06orders\x18\x01 \x03(\v2\t.pb.OrderR\x06orders\x12\x1e\n" +
+	"\n" +
+	"totalCount\x18\x02 \x01(\x04R\n" +
+	"totalCount\x12 \n" +
+	"\vhasNextPage\x18\x03 \x01(\bR\vhasNextPage2\xc0\x13\n" +
+	"\fOrderService\x12O\n" +
+	"\tPostOrder\x12\x14.pb.PostOrderRequest\x1a\x15.pb.PostOrderResponse\"\x15\x82\xd3\xe4\x93\x02\x0f:\x01*\"\n" +
+	"/v1/orders\x12N\n" +
+	"\bGetOrder\x12\x13.pb.GetOrderRequest\x1a\x14.pb.GetOrderResponse\"\x17\x82\xd3\xe4\x93\x02\x11\x12\x0f/v1/orders/{id}\x12X\n" +
+	"\x13UpdatePaymentStatus\x12\x1e.pb.UpdatePaymentStatusRequest\x1a\x1f.pb.UpdatePaymentStatusResponse\"\x00\x12I\n" +
+	"\x0eCreateShipment\x12\x19.pb.CreateShipmentRequest\x1a\x1a.pb.CreateShipmentResponse\"\x00\x12I\n" +
+	"\x0eUpdateShipment\x12\x19.pb.UpdateShipmentRequest\x1a\x1a.pb.UpdateShipmentResponse\"\x00\x12L\n" +
+	"\x0fCreatePromotion\x12\x1a.pb.CreatePromotionRequest\x1a\x1b.pb.CreatePromotionResponse\"\x00\x12L\n" +
+	"\x0fUpdatePromotion\x12\x1a.pb.UpdatePromotionRequest\x1a\x1b.pb.UpdatePromotionResponse\"\x00\x12F\n" +
+	"\rGetPromotions\x12\x18.pb.GetPromotionsRequest\x1a\x19.pb.GetPromotionsResponse\"\x00\x12X\n" +
+	"\x13GetOrdersForAccount\x12\x1e.pb.GetOrdersForAccountRequest\x1a\x1f.pb.GetOrdersForAccountResponse\"\x00\x12\x8b\x01\n" +
+	"\x17GetOrdersForAccountPage\x12\".pb.GetOrdersForAccountPageRequest\x1a#.pb.GetOrdersForAccountPageResponse\"'\x82\xd3\xe4\x93\x02!\x12\x1f/v1/accounts/{accountId}/orders\x12I\n" +
+	"\x0eGetSalesReport\x12\x19.pb.GetSalesReportRequest\x1a\x1a.pb.GetSalesReportResponse\"\x00\x12I\n" +
+	"\x0eGetTopProducts\x12\x19.pb.GetTopProductsRequest\x1a\x1a.pb.GetTopProductsResponse\"\x00\x12O\n" +
+	"\x10GetAccountValues\x12\x1b.pb.GetAccountValuesRequest\x1a\x1c.pb.GetAccountValuesResponse\"\x00\x12\x85\x01\n" +
+	"\x12GetRecommendations\x12\x1d.pb.GetRecommendationsRequest\x1a\x1e.pb.GetRecommendationsResponse\"0\x82\xd3\xe4\x93\x02*\x12(/v1/products/{productId}/recommendations\x12F\n" +
+	"\rCreateWebhook\x12\x18.pb.CreateWebhookRequest\x1a\x19.pb.CreateWebhookResponse\"\x00\x12F\n" +
+	"\rUpdateWebhook\x12\x18.pb.UpdateWebhookRequest\x1a\x19.pb.UpdateWebhookResponse\"\x00\x12F\n" +
+	"\rDeleteWebhook\x12\x18.pb.DeleteWebhookRequest\x1a\x19.pb.DeleteWebhookResponse\"\x00\x12@\n" +
+	"\vGetWebhooks\x12\x16.pb.GetWebhooksRequest\x1a\x17.pb.GetWebhooksResponse\"\x00\x12[\n" +
+	"\x14GetWebhookDeliveries\x12\x1f.pb.GetWebhookDeliveriesRequest\x1a .pb.GetWebhookDeliveriesResponse\"\x00\x12O\n" +
+	"\x10RedeliverWebhook\x12\x1b.pb.RedeliverWebhookRequest\x1a\x1c.pb.RedeliverWebhookResponse\"\x00\x12^\n" +
+	"\x15GetOrderNotifications\x12 .pb.GetOrderNotificationsRequest\x1a!.pb.GetOrderNotificationsResponse\"\x00\x12=\n" +
+	"\n" +
+	"GetInvoice\x12\x15.pb.GetInvoiceRequest\x1a\x16.pb.GetInvoiceResponse\"\x00\x12U\n" +
+	"\x12CreateSubscription\x12\x1d.pb.CreateSubscriptionRequest\x1a\x1e.pb.CreateSubscriptionResponse\"\x00\x12L\n" +
+	"\x0fGetSubscription\x12\x1a.pb.GetSubscriptionRequest\x1a\x1b.pb.GetSubscriptionResponse\"\x00\x12m\n" +
+	"\x1aGetSubscriptionsForAccount\x12%.pb.GetSubscriptionsForAccountRequest\x1a&.pb.GetSubscriptionsForAccountResponse\"\x00\x12`\n" +
+	"\x11PauseSubscription\x12#.pb.UpdateSubscriptionStatusRequest\x1a$.pb.UpdateSubscriptionStatusResponse\"\x00\x12a\n" +
+	"\x12ResumeSubscription\x12#.pb.UpdateSubscriptionStatusRequest\x1a$.pb.UpdateSubscriptionStatusResponse\"\x00\x12a\n" +
+	"\x12CancelSubscription\x12#.pb.UpdateSubscriptionStatusRequest\x1a$.pb.UpdateSubscriptionStatusResponse\"\x00\x12A\n" +
+	"\x10WatchOrderEvents\x12\x1b.pb.WatchOrderEventsRequest\x1a\x0e.pb.OrderEvent0\x01B\x06Z\x04./pbb\x06proto3"
 
 var (
 	file_order_proto_rawDescOnce sync.Once
@@ -548,33 +5091,196 @@ func file_order_proto_rawDescGZIP() []byte {
 	return file_order_proto_rawDescData
 }
 
-var file_order_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_order_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_order_proto_msgTypes = make([]protoimpl.MessageInfo, 76)
 var file_order_proto_goTypes = []any{
-	(*Order)(nil),                         // 0: pb.Order
-	(*PostOrderRequest)(nil),              // 1: pb.PostOrderRequest
-	(*PostOrderResponse)(nil),             // 2: pb.PostOrderResponse
-	(*GetOrderRequest)(nil),               // 3: pb.GetOrderRequest
-	(*GetOrderResponse)(nil),              // 4: pb.GetOrderResponse
-	(*GetOrdersForAccountRequest)(nil),    // 5: pb.GetOrdersForAccountRequest
-	(*GetOrdersForAccountResponse)(nil),   // 6: pb.GetOrdersForAccountResponse
-	(*Order_OrderProduct)(nil),            // 7: pb.Order.OrderProduct
-	(*PostOrderRequest_OrderProduct)(nil), // 8: pb.PostOrderRequest.OrderProduct
+	(OrderEvent_Type)(0),                       // 0: pb.OrderEvent.Type
+	(*Address)(nil),                            // 1: pb.Address
+	(*Shipment)(nil),                           // 2: pb.Shipment
+	(*Discount)(nil),                           // 3: pb.Discount
+	(*Promotion)(nil),                          // 4: pb.Promotion
+	(*TaxLine)(nil),                            // 5: pb.TaxLine
+	(*Order)(nil),                              // 6: pb.Order
+	(*PostOrderRequest)(nil),                   // 7: pb.PostOrderRequest
+	(*PostOrderResponse)(nil),                  // 8: pb.PostOrderResponse
+	(*GetOrderRequest)(nil),                    // 9: pb.GetOrderRequest
+	(*GetOrderResponse)(nil),                   // 10: pb.GetOrderResponse
+	(*UpdatePaymentStatusRequest)(nil),         // 11: pb.UpdatePaymentStatusRequest
+	(*UpdatePaymentStatusResponse)(nil),        // 12: pb.UpdatePaymentStatusResponse
+	(*CreateShipmentRequest)(nil),              // 13: pb.CreateShipmentRequest
+	(*CreateShipmentResponse)(nil),             // 14: pb.CreateShipmentResponse
+	(*UpdateShipmentRequest)(nil),              // 15: pb.UpdateShipmentRequest
+	(*UpdateShipmentResponse)(nil),             // 16: pb.UpdateShipmentResponse
+	(*CreatePromotionRequest)(nil),             // 17: pb.CreatePromotionRequest
+	(*CreatePromotionResponse)(nil),            // 18: pb.CreatePromotionResponse
+	(*UpdatePromotionRequest)(nil),             // 19: pb.UpdatePromotionRequest
+	(*UpdatePromotionResponse)(nil),            // 20: pb.UpdatePromotionResponse
+	(*GetPromotionsRequest)(nil),               // 21: pb.GetPromotionsRequest
+	(*GetPromotionsResponse)(nil),              // 22: pb.GetPromotionsResponse
+	(*SalesBucket)(nil),                        // 23: pb.SalesBucket
+	(*GetSalesReportRequest)(nil),              // 24: pb.GetSalesReportRequest
+	(*GetSalesReportResponse)(nil),             // 25: pb.GetSalesReportResponse
+	(*ProductSales)(nil),                       // 26: pb.ProductSales
+	(*GetTopProductsRequest)(nil),              // 27: pb.GetTopProductsRequest
+	(*GetTopProductsResponse)(nil),             // 28: pb.GetTopProductsResponse
+	(*AccountValue)(nil),                       // 29: pb.AccountValue
+	(*GetAccountValuesRequest)(nil),            // 30: pb.GetAccountValuesRequest
+	(*GetAccountValuesResponse)(nil),           // 31: pb.GetAccountValuesResponse
+	(*Recommendation)(nil),                     // 32: pb.Recommendation
+	(*GetRecommendationsRequest)(nil),          // 33: pb.GetRecommendationsRequest
+	(*GetRecommendationsResponse)(nil),         // 34: pb.GetRecommendationsResponse
+	(*Webhook)(nil),                            // 35: pb.Webhook
+	(*WebhookDelivery)(nil),                    // 36: pb.WebhookDelivery
+	(*CreateWebhookRequest)(nil),               // 37: pb.CreateWebhookRequest
+	(*CreateWebhookResponse)(nil),              // 38: pb.CreateWebhookResponse
+	(*UpdateWebhookRequest)(nil),               // 39: pb.UpdateWebhookRequest
+	(*UpdateWebhookResponse)(nil),              // 40: pb.UpdateWebhookResponse
+	(*DeleteWebhookRequest)(nil),               // 41: pb.DeleteWebhookRequest
+	(*DeleteWebhookResponse)(nil),              // 42: pb.DeleteWebhookResponse
+	(*GetWebhooksRequest)(nil),                 // 43: pb.GetWebhooksRequest
+	(*GetWebhooksResponse)(nil),                // 44: pb.GetWebhooksResponse
+	(*GetWebhookDeliveriesRequest)(nil),        // 45: pb.GetWebhookDeliveriesRequest
+	(*GetWebhookDeliveriesResponse)(nil),       // 46: pb.GetWebhookDeliveriesResponse
+	(*RedeliverWebhookRequest)(nil),            // 47: pb.RedeliverWebhookRequest
+	(*RedeliverWebhookResponse)(nil),           // 48: pb.RedeliverWebhookResponse
+	(*OrderNotification)(nil),                  // 49: pb.OrderNotification
+	(*GetOrderNotificationsRequest)(nil),       // 50: pb.GetOrderNotificationsRequest
+	(*GetOrderNotificationsResponse)(nil),      // 51: pb.GetOrderNotificationsResponse
+	(*Invoice)(nil),                            // 52: pb.Invoice
+	(*GetInvoiceRequest)(nil),                  // 53: pb.GetInvoiceRequest
+	(*GetInvoiceResponse)(nil),                 // 54: pb.GetInvoiceResponse
+	(*OrderSubscription)(nil),                  // 55: pb.OrderSubscription
+	(*CreateSubscriptionRequest)(nil),          // 56: pb.CreateSubscriptionRequest
+	(*CreateSubscriptionResponse)(nil),         // 57: pb.CreateSubscriptionResponse
+	(*GetSubscriptionsForAccountRequest)(nil),  // 58: pb.GetSubscriptionsForAccountRequest
+	(*GetSubscriptionsForAccountResponse)(nil), // 59: pb.GetSubscriptionsForAccountResponse
+	(*GetSubscriptionRequest)(nil),             // 60: pb.GetSubscriptionRequest
+	(*GetSubscriptionResponse)(nil),            // 61: pb.GetSubscriptionResponse
+	(*UpdateSubscriptionStatusRequest)(nil),    // 62: pb.UpdateSubscriptionStatusRequest
+	(*UpdateSubscriptionStatusResponse)(nil),   // 63: pb.UpdateSubscriptionStatusResponse
+	(*WatchOrderEventsRequest)(nil),            // 64: pb.WatchOrderEventsRequest
+	(*OrderEvent)(nil),                         // 65: pb.OrderEvent
+	(*GetOrdersForAccountRequest)(nil),         // 66: pb.GetOrdersForAccountRequest
+	(*GetOrdersForAccountResponse)(nil),        // 67: pb.GetOrdersForAccountResponse
+	(*GetOrdersForAccountPageRequest)(nil),     // 68: pb.GetOrdersForAccountPageRequest
+	(*GetOrdersForAccountPageResponse)(nil),    // 69: pb.GetOrdersForAccountPageResponse
+	(*Shipment_ShipmentItem)(nil),              // 70: pb.Shipment.ShipmentItem
+	(*Order_OrderProduct)(nil),                 // 71: pb.Order.OrderProduct
+	(*Order_OrderProduct_VariantOption)(nil),   // 72: pb.Order.OrderProduct.VariantOption
+	(*PostOrderRequest_OrderProduct)(nil),      // 73: pb.PostOrderRequest.OrderProduct
+	(*WebhookDelivery_Attempt)(nil),            // 74: pb.WebhookDelivery.Attempt
+	(*OrderSubscription_Item)(nil),             // 75: pb.OrderSubscription.Item
+	(*OrderSubscription_Run)(nil),              // 76: pb.OrderSubscription.Run
 }
 var file_order_proto_depIdxs = []int32{
-	7, // 0: pb.Order.products:type_name -> pb.Order.OrderProduct
-	8, // 1: pb.PostOrderRequest.products:type_name -> pb.PostOrderRequest.OrderProduct
-	0, // 2: pb.PostOrderResponse.order:type_name -> pb.Order
-	0, // 3: pb.GetOrderResponse.order:type_name -> pb.Order
-	0, // 4: pb.GetOrdersForAccountResponse.orders:type_name -> pb.Order
-	1, // 5: pb.OrderService.PostOrder:input_type -> pb.PostOrderRequest
-	5, // 6: pb.OrderService.GetOrdersForAccount:input_type -> pb.GetOrdersForAccountRequest
-	2, // 7: pb.OrderService.PostOrder:output_type -> pb.PostOrderResponse
-	6, // 8: pb.OrderService.GetOrdersForAccount:output_type -> pb.GetOrdersForAccountResponse
-	7, // [7:9] is the sub-list for method output_type
-	5, // [5:7] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	70, // 0: pb.Shipment.items:type_name -> pb.Shipment.ShipmentItem
+	71, // 1: pb.Order.products:type_name -> pb.Order.OrderProduct
+	1,  // 2: pb.Order.shippingAddress:type_name -> pb.Address
+	2,  // 3: pb.Order.shipments:type_name -> pb.Shipment
+	3,  // 4: pb.Order.discounts:type_name -> pb.Discount
+	5,  // 5: pb.Order.taxes:type_name -> pb.TaxLine
+	73, // 6: pb.PostOrderRequest.products:type_name -> pb.PostOrderRequest.OrderProduct
+	1,  // 7: pb.PostOrderRequest.shippingAddress:type_name -> pb.Address
+	6,  // 8: pb.PostOrderResponse.order:type_name -> pb.Order
+	6,  // 9: pb.GetOrderResponse.order:type_name -> pb.Order
+	6,  // 10: pb.UpdatePaymentStatusResponse.order:type_name -> pb.Order
+	70, // 11: pb.CreateShipmentRequest.items:type_name -> pb.Shipment.ShipmentItem
+	2,  // 12: pb.CreateShipmentResponse.shipment:type_name -> pb.Shipment
+	2,  // 13: pb.UpdateShipmentResponse.shipment:type_name -> pb.Shipment
+	4,  // 14: pb.CreatePromotionRequest.promotion:type_name -> pb.Promotion
+	4,  // 15: pb.CreatePromotionResponse.promotion:type_name -> pb.Promotion
+	4,  // 16: pb.UpdatePromotionRequest.promotion:type_name -> pb.Promotion
+	4,  // 17: pb.UpdatePromotionResponse.promotion:type_name -> pb.Promotion
+	4,  // 18: pb.GetPromotionsResponse.promotions:type_name -> pb.Promotion
+	23, // 19: pb.GetSalesReportResponse.buckets:type_name -> pb.SalesBucket
+	26, // 20: pb.GetTopProductsResponse.products:type_name -> pb.ProductSales
+	29, // 21: pb.GetAccountValuesResponse.accounts:type_name -> pb.AccountValue
+	32, // 22: pb.GetRecommendationsResponse.recommendations:type_name -> pb.Recommendation
+	74, // 23: pb.WebhookDelivery.attemptLog:type_name -> pb.WebhookDelivery.Attempt
+	35, // 24: pb.CreateWebhookRequest.webhook:type_name -> pb.Webhook
+	35, // 25: pb.CreateWebhookResponse.webhook:type_name -> pb.Webhook
+	35, // 26: pb.UpdateWebhookRequest.webhook:type_name -> pb.Webhook
+	35, // 27: pb.UpdateWebhookResponse.webhook:type_name -> pb.Webhook
+	35, // 28: pb.GetWebhooksResponse.webhooks:type_name -> pb.Webhook
+	36, // 29: pb.GetWebhookDeliveriesResponse.deliveries:type_name -> pb.WebhookDelivery
+	36, // 30: pb.RedeliverWebhookResponse.delivery:type_name -> pb.WebhookDelivery
+	49, // 31: pb.GetOrderNotificationsResponse.notifications:type_name -> pb.OrderNotification
+	52, // 32: pb.GetInvoiceResponse.invoice:type_name -> pb.Invoice
+	75, // 33: pb.OrderSubscription.products:type_name -> pb.OrderSubscription.Item
+	1,  // 34: pb.OrderSubscription.shippingAddress:type_name -> pb.Address
+	76, // 35: pb.OrderSubscription.runs:type_name -> pb.OrderSubscription.Run
+	55, // 36: pb.CreateSubscriptionRequest.subscription:type_name -> pb.OrderSubscription
+	55, // 37: pb.CreateSubscriptionResponse.subscription:type_name -> pb.OrderSubscription
+	55, // 38: pb.GetSubscriptionsForAccountResponse.subscriptions:type_name -> pb.OrderSubscription
+	55, // 39: pb.GetSubscriptionResponse.subscription:type_name -> pb.OrderSubscription
+	55, // 40: pb.UpdateSubscriptionStatusResponse.subscription:type_name -> pb.OrderSubscription
+	0,  // 41: pb.OrderEvent.type:type_name -> pb.OrderEvent.Type
+	6,  // 42: pb.GetOrdersForAccountResponse.orders:type_name -> pb.Order
+	6,  // 43: pb.GetOrdersForAccountPageResponse.orders:type_name -> pb.Order
+	72, // 44: pb.Order.OrderProduct.options:type_name -> pb.Order.OrderProduct.VariantOption
+	7,  // 45: pb.OrderService.PostOrder:input_type -> pb.PostOrderRequest
+	9,  // 46: pb.OrderService.GetOrder:input_type -> pb.GetOrderRequest
+	11, // 47: pb.OrderService.UpdatePaymentStatus:input_type -> pb.UpdatePaymentStatusRequest
+	13, // 48: pb.OrderService.CreateShipment:input_type -> pb.CreateShipmentRequest
+	15, // 49: pb.OrderService.UpdateShipment:input_type -> pb.UpdateShipmentRequest
+	17, // 50: pb.OrderService.CreatePromotion:input_type -> pb.CreatePromotionRequest
+	19, // 51: pb.OrderService.UpdatePromotion:input_type -> pb.UpdatePromotionRequest
+	21, // 52: pb.OrderService.GetPromotions:input_type -> pb.GetPromotionsRequest
+	66, // 53: pb.OrderService.GetOrdersForAccount:input_type -> pb.GetOrdersForAccountRequest
+	68, // 54: pb.OrderService.GetOrdersForAccountPage:input_type -> pb.GetOrdersForAccountPageRequest
+	24, // 55: pb.OrderService.GetSalesReport:input_type -> pb.GetSalesReportRequest
+	27, // 56: pb.OrderService.GetTopProducts:input_type -> pb.GetTopProductsRequest
+	30, // 57: pb.OrderService.GetAccountValues:input_type -> pb.GetAccountValuesRequest
+	33, // 58: pb.OrderService.GetRecommendations:input_type -> pb.GetRecommendationsRequest
+	37, // 59: pb.OrderService.CreateWebhook:input_type -> pb.CreateWebhookRequest
+	39, // 60: pb.OrderService.UpdateWebhook:input_type -> pb.UpdateWebhookRequest
+	41, // 61: pb.OrderService.DeleteWebhook:input_type -> pb.DeleteWebhookRequest
+	43, // 62: pb.OrderService.GetWebhooks:input_type -> pb.GetWebhooksRequest
+	45, // 63: pb.OrderService.GetWebhookDeliveries:input_type -> pb.GetWebhookDeliveriesRequest
+	47, // 64: pb.OrderService.RedeliverWebhook:input_type -> pb.RedeliverWebhookRequest
+	50, // 65: pb.OrderService.GetOrderNotifications:input_type -> pb.GetOrderNotificationsRequest
+	53, // 66: pb.OrderService.GetInvoice:input_type -> pb.GetInvoiceRequest
+	56, // 67: pb.OrderService.CreateSubscription:input_type -> pb.CreateSubscriptionRequest
+	60, // 68: pb.OrderService.GetSubscription:input_type -> pb.GetSubscriptionRequest
+	58, // 69: pb.OrderService.GetSubscriptionsForAccount:input_type -> pb.GetSubscriptionsForAccountRequest
+	62, // 70: pb.OrderService.PauseSubscription:input_type -> pb.UpdateSubscriptionStatusRequest
+	62, // 71: pb.OrderService.ResumeSubscription:input_type -> pb.UpdateSubscriptionStatusRequest
+	62, // 72: pb.OrderService.CancelSubscription:input_type -> pb.UpdateSubscriptionStatusRequest
+	64, // 73: pb.OrderService.WatchOrderEvents:input_type -> pb.WatchOrderEventsRequest
+	8,  // 74: pb.OrderService.PostOrder:output_type -> pb.PostOrderResponse
+	10, // 75: pb.OrderService.GetOrder:output_type -> pb.GetOrderResponse
+	12, // 76: pb.OrderService.UpdatePaymentStatus:output_type -> pb.UpdatePaymentStatusResponse
+	14, // 77: pb.OrderService.CreateShipment:output_type -> pb.CreateShipmentResponse
+	16, // 78: pb.OrderService.UpdateShipment:output_type -> pb.UpdateShipmentResponse
+	18, // 79: pb.OrderService.CreatePromotion:output_type -> pb.CreatePromotionResponse
+	20, // 80: pb.OrderService.UpdatePromotion:output_type -> pb.UpdatePromotionResponse
+	22, // 81: pb.OrderService.GetPromotions:output_type -> pb.GetPromotionsResponse
+	67, // 82: pb.OrderService.GetOrdersForAccount:output_type -> pb.GetOrdersForAccountResponse
+	69, // 83: pb.OrderService.GetOrdersForAccountPage:output_type -> pb.GetOrdersForAccountPageResponse
+	25, // 84: pb.OrderService.GetSalesReport:output_type -> pb.GetSalesReportResponse
+	28, // 85: pb.OrderService.GetTopProducts:output_type -> pb.GetTopProductsResponse
+	31, // 86: pb.OrderService.GetAccountValues:output_type -> pb.GetAccountValuesResponse
+	34, // 87: pb.OrderService.GetRecommendations:output_type -> pb.GetRecommendationsResponse
+	38, // 88: pb.OrderService.CreateWebhook:output_type -> pb.CreateWebhookResponse
+	40, // 89: pb.OrderService.UpdateWebhook:output_type -> pb.UpdateWebhookResponse
+	42, // 90: pb.OrderService.DeleteWebhook:output_type -> pb.DeleteWebhookResponse
+	44, // 91: pb.OrderService.GetWebhooks:output_type -> pb.GetWebhooksResponse
+	46, // 92: pb.OrderService.GetWebhookDeliveries:output_type -> pb.GetWebhookDeliveriesResponse
+	48, // 93: pb.OrderService.RedeliverWebhook:output_type -> pb.RedeliverWebhookResponse
+	51, // 94: pb.OrderService.GetOrderNotifications:output_type -> pb.GetOrderNotificationsResponse
+	54, // 95: pb.OrderService.GetInvoice:output_type -> pb.GetInvoiceResponse
+	57, // 96: pb.OrderService.CreateSubscription:output_type -> pb.CreateSubscriptionResponse
+	61, // 97: pb.OrderService.GetSubscription:output_type -> pb.GetSubscriptionResponse
+	59, // 98: pb.OrderService.GetSubscriptionsForAccount:output_type -> pb.GetSubscriptionsForAccountResponse
+	63, // 99: pb.OrderService.PauseSubscription:output_type -> pb.UpdateSubscriptionStatusResponse
+	63, // 100: pb.OrderService.ResumeSubscription:output_type -> pb.UpdateSubscriptionStatusResponse
+	63, // 101: pb.OrderService.CancelSubscription:output_type -> pb.UpdateSubscriptionStatusResponse
+	65, // 102: pb.OrderService.WatchOrderEvents:output_type -> pb.OrderEvent
+	74, // [74:103] is the sub-list for method output_type
+	45, // [45:74] is the sub-list for method input_type
+	45, // [45:45] is the sub-list for extension type_name
+	45, // [45:45] is the sub-list for extension extendee
+	0,  // [0:45] is the sub-list for field type_name
 }
 
 func init() { file_order_proto_init() }
@@ -587,13 +5293,14 @@ func file_order_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_order_proto_rawDesc), len(file_order_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   9,
+			NumEnums:      1,
+			NumMessages:   76,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_order_proto_goTypes,
 		DependencyIndexes: file_order_proto_depIdxs,
+		EnumInfos:         file_order_proto_enumTypes,
 		MessageInfos:      file_order_proto_msgTypes,
 	}.Build()
 	File_order_proto = out.File
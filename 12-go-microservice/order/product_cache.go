@@ -0,0 +1,191 @@
+package order
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"golang.org/x/sync/singleflight"
+)
+
+// productFetchTimeout bounds a shared catalog lookup, which no longer follows
+// the deadline of the request that started it
+const productFetchTimeout = 10 * time.Second
+
+// ProductCache keeps recently used catalog products in memory. Entries expire
+// after a TTL and are dropped as soon as the catalog reports a change.
+//
+// Changes are only reported by the catalog instance the event stream is
+// connected to. When several catalog instances serve writes, changes made
+// through the others go unnoticed and the TTL is the only staleness bound.
+type ProductCache struct {
+	client *catalog.Client
+	lru    *expirable.LRU[string, catalog.Product]
+	group  singleflight.Group
+
+	// generation is bumped on every invalidation, so a lookup that started
+	// before the invalidation does not put a stale product back
+	mu         sync.Mutex
+	generation uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type ProductCacheConfig struct {
+	Size int           `envconfig:"SIZE" default:"1000"`
+	TTL  time.Duration `envconfig:"TTL" default:"5m"`
+}
+
+type ProductCacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+func NewProductCache(client *catalog.Client, cfg ProductCacheConfig) *ProductCache {
+	if cfg.Size <= 0 {
+		cfg.Size = 1000
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 5 * time.Minute
+	}
+
+	return &ProductCache{
+		client: client,
+		lru:    expirable.NewLRU[string, catalog.Product](cfg.Size, nil, cfg.TTL),
+	}
+}
+
+// GetProducts returns the products with the given IDs, unknown IDs are left out
+func (c *ProductCache) GetProducts(ctx context.Context, ids []string) ([]catalog.Product, error) {
+	products := []catalog.Product{}
+	missing := []string{}
+	for _, id := range ids {
+		if p, ok := c.lru.Get(id); ok {
+			products = append(products, p)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	c.hits.Add(uint64(len(ids) - len(missing)))
+	c.misses.Add(uint64(len(missing)))
+
+	if len(missing) == 0 {
+		return products, nil
+	}
+
+	// Concurrent lookups of the same products share one catalog call. The call
+	// outlives any single caller, so it runs detached with its own timeout and
+	// each caller only waits for it as long as its own ctx allows.
+	sort.Strings(missing)
+	ch := c.group.DoChan(strings.Join(missing, ","), func() (interface{}, error) {
+		generation := c.currentGeneration()
+
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), productFetchTimeout)
+		defer cancel()
+
+		fetched, err := c.client.GetProducts(fetchCtx, 0, 0, missing, "", catalog.ProductFilter{})
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if generation == c.generation {
+			for _, p := range fetched {
+				c.lru.Add(p.ID, p)
+			}
+		}
+		c.mu.Unlock()
+
+		return fetched, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return append(products, res.Val.([]catalog.Product)...), nil
+	}
+}
+
+func (c *ProductCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+func (c *ProductCache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.lru.Remove(id)
+}
+
+func (c *ProductCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.lru.Purge()
+}
+
+func (c *ProductCache) Stats() ProductCacheStats {
+	return ProductCacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: c.lru.Len(),
+	}
+}
+
+// Publish exposes the cache stats through expvar under name
+func (c *ProductCache) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return c.Stats()
+	}))
+}
+
+// WatchInvalidations follows the catalog product events until ctx is done.
+// Events may have been missed while disconnected, so the whole cache is
+// purged every time the subscription is (re)established.
+func (c *ProductCache) WatchInvalidations(ctx context.Context) {
+	backoff := time.Second
+	for {
+		err := c.client.WatchProductEvents(
+			ctx,
+			func() {
+				c.Purge()
+				backoff = time.Second
+			},
+			func(e catalog.ProductEvent) {
+				c.Invalidate(e.ProductID)
+			},
+		)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Product events stream ended: %v, reconnecting in %s", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidPromotion         = errors.New("invalid promotion")
+	ErrPromotionNotFound        = errors.New("promotion not found")
+	ErrCouponNotApplicable      = errors.New("coupon code cannot be applied to this order")
+	ErrCouponUsageLimitExceeded = errors.New("coupon code was already used the maximum number of times")
+)
+
+type PromotionType string
+
+const (
+	// PromotionPercentage takes Value percent off every eligible line
+	PromotionPercentage PromotionType = "percentage"
+	// PromotionFixed takes Value off the eligible lines, spread in proportion to their price
+	PromotionFixed PromotionType = "fixed"
+	// PromotionBuyXGetY makes GetQuantity units free for every BuyQuantity units bought of an eligible
+	// product, counting the units of all its variants. The cheapest units are the free ones.
+	PromotionBuyXGetY PromotionType = "buy_x_get_y"
+)
+
+// Promotion is a discount rule. Promotions without a code apply to every
+// order they are eligible for, the others only when their code is given.
+type Promotion struct {
+	ID          string
+	Code        string
+	Description string
+	Type        PromotionType
+	Value       float64
+	BuyQuantity uint32
+	GetQuantity uint32
+	// ProductIDs restricts the promotion to these products, empty means every product
+	ProductIDs []string
+	MinSpend   float64
+	// UsageLimitPerAccount is how many orders of an account may use the promotion, 0 is unlimited
+	UsageLimitPerAccount uint32
+	StartsAt             *time.Time
+	EndsAt               *time.Time
+	Active               bool
+	CreatedAt            time.Time
+}
+
+// Discount is the part of a promotion applied to one line of an order
+type Discount struct {
+	OrderID     string
+	PromotionID string
+	Code        string
+	ProductID   string
+	Description string
+	Amount      float64
+}
+
+// NormalizeCouponCode makes coupon codes case insensitive
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (p *Promotion) validate() error {
+	p.Code = NormalizeCouponCode(p.Code)
+
+	switch p.Type {
+	case PromotionPercentage:
+		if p.Value <= 0 || p.Value > 100 {
+			return fmt.Errorf("%w: percentage must be between 0 and 100", ErrInvalidPromotion)
+		}
+	case PromotionFixed:
+		if p.Value <= 0 {
+			return fmt.Errorf("%w: fixed amount must be positive", ErrInvalidPromotion)
+		}
+	case PromotionBuyXGetY:
+		if p.BuyQuantity == 0 || p.GetQuantity == 0 {
+			return fmt.Errorf("%w: buy and get quantities must be positive", ErrInvalidPromotion)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidPromotion, p.Type)
+	}
+
+	if p.MinSpend < 0 {
+		return fmt.Errorf("%w: minimum spend cannot be negative", ErrInvalidPromotion)
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return fmt.Errorf("%w: promotion must end after it starts", ErrInvalidPromotion)
+	}
+
+	return nil
+}
+
+// eligible checks the validity window and minimum spend, usage limits are checked separately
+func (p Promotion) eligible(now time.Time, subtotal float64) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil && now.Before(*p.StartsAt) {
+		return false
+	}
+	if p.EndsAt != nil && !now.Before(*p.EndsAt) {
+		return false
+	}
+	return subtotal >= p.MinSpend
+}
+
+func (p Promotion) appliesTo(productID string) bool {
+	if len(p.ProductIDs) == 0 {
+		return true
+	}
+	for _, id := range p.ProductIDs {
+		if id == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPromotions computes the discounts of each promotion in turn. A line is
+// never discounted below zero, so later promotions only get what is left.
+func applyPromotions(products []OrderedProduct, promotions []Promotion) []Discount {
+	remaining := make([]float64, len(products))
+	for i, p := range products {
+		remaining[i] = p.Price * float64(p.Quantity)
+	}
+
+	discounts := []Discount{}
+	for _, promotion := range promotions {
+		amounts := make([]float64, len(products))
+
+		switch promotion.Type {
+		case PromotionPercentage:
+			for i, p := range products {
+				if promotion.appliesTo(p.ID) {
+					amounts[i] = remaining[i] * promotion.Value / 100
+				}
+			}
+		case PromotionFixed:
+			eligible := 0.0
+			for i, p := range products {
+				if promotion.appliesTo(p.ID) {
+					eligible += remaining[i]
+				}
+			}
+			if eligible > 0 {
+				// The last eligible line takes what rounding left over, so the lines add up to the amount off
+				off := roundCents(math.Min(promotion.Value, eligible))
+				left := off
+				last := -1
+				for i, p := range products {
+					if promotion.appliesTo(p.ID) && remaining[i] > 0 {
+						amounts[i] = roundCents(off * remaining[i] / eligible)
+						left -= amounts[i]
+						last = i
+					}
+				}
+				if last >= 0 {
+					amounts[last] += left
+				}
+			}
+		case PromotionBuyXGetY:
+			quantities := map[string]uint32{}
+			productLines := map[string][]int{}
+			for i, p := range products {
+				if promotion.appliesTo(p.ID) {
+					quantities[p.ID] += p.Quantity
+					productLines[p.ID] = append(productLines[p.ID], i)
+				}
+			}
+			for id, indexes := range productLines {
+				free := quantities[id] / (promotion.BuyQuantity + promotion.GetQuantity) * promotion.GetQuantity
+				sort.SliceStable(indexes, func(a, b int) bool {
+					return products[indexes[a]].Price < products[indexes[b]].Price
+				})
+				for _, i := range indexes {
+					units := min(free, products[i].Quantity)
+					amounts[i] = float64(units) * products[i].Price
+					free -= units
+				}
+			}
+		}
+
+		// Discounts are kept per product, so the lines of the variants of a product add up
+		lines := map[string]int{}
+		for i, p := range products {
+			amount := math.Min(roundCents(amounts[i]), remaining[i])
+			if amount <= 0 {
+				continue
+			}
+			remaining[i] -= amount
+			if j, ok := lines[p.ID]; ok {
+				discounts[j].Amount = roundCents(discounts[j].Amount + amount)
+				continue
+			}
+			lines[p.ID] = len(discounts)
+			discounts = append(discounts, Discount{
+				PromotionID: promotion.ID,
+				Code:        promotion.Code,
+				ProductID:   p.ID,
+				Description: promotion.Description,
+				Amount:      amount,
+			})
+		}
+	}
+
+	return discounts
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
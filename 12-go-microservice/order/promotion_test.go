@@ -0,0 +1,118 @@
+package order
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyPromotions(t *testing.T) {
+	shirt := func(variantID string, price float64, quantity uint32) OrderedProduct {
+		return OrderedProduct{ID: "shirt", VariantID: variantID, Price: price, Quantity: quantity}
+	}
+	mug := OrderedProduct{ID: "mug", Price: 10, Quantity: 2}
+
+	tests := []struct {
+		name       string
+		products   []OrderedProduct
+		promotions []Promotion
+		want       map[string]float64
+	}{
+		{
+			name:       "percentage",
+			products:   []OrderedProduct{shirt("", 19.99, 1), mug},
+			promotions: []Promotion{{ID: "p", Type: PromotionPercentage, Value: 10}},
+			want:       map[string]float64{"shirt": 2, "mug": 2},
+		},
+		{
+			name:       "percentage of some products",
+			products:   []OrderedProduct{shirt("", 20, 1), mug},
+			promotions: []Promotion{{ID: "p", Type: PromotionPercentage, Value: 50, ProductIDs: []string{"mug"}}},
+			want:       map[string]float64{"mug": 10},
+		},
+		{
+			name:       "fixed spread by price",
+			products:   []OrderedProduct{shirt("", 30, 1), mug},
+			promotions: []Promotion{{ID: "p", Type: PromotionFixed, Value: 10}},
+			want:       map[string]float64{"shirt": 6, "mug": 4},
+		},
+		{
+			name:       "fixed rounding left on the last line",
+			products:   []OrderedProduct{{ID: "a", Price: 10, Quantity: 1}, {ID: "b", Price: 10, Quantity: 1}, {ID: "c", Price: 10, Quantity: 1}},
+			promotions: []Promotion{{ID: "p", Type: PromotionFixed, Value: 10}},
+			want:       map[string]float64{"a": 3.33, "b": 3.33, "c": 3.34},
+		},
+		{
+			name:       "fixed above the total",
+			products:   []OrderedProduct{mug},
+			promotions: []Promotion{{ID: "p", Type: PromotionFixed, Value: 50}},
+			want:       map[string]float64{"mug": 20},
+		},
+		{
+			name:       "buy 2 get 1",
+			products:   []OrderedProduct{shirt("", 20, 7)},
+			promotions: []Promotion{{ID: "p", Type: PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1}},
+			want:       map[string]float64{"shirt": 40},
+		},
+		{
+			name:       "buy 2 get 1 across variants",
+			products:   []OrderedProduct{shirt("s", 20, 1), shirt("m", 20, 1), shirt("l", 20, 1)},
+			promotions: []Promotion{{ID: "p", Type: PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1}},
+			want:       map[string]float64{"shirt": 20},
+		},
+		{
+			name:       "buy 2 get 1 cheapest free",
+			products:   []OrderedProduct{shirt("xl", 25, 2), shirt("s", 20, 1), shirt("m", 22, 3)},
+			promotions: []Promotion{{ID: "p", Type: PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1}},
+			want:       map[string]float64{"shirt": 20 + 22},
+		},
+		{
+			name:       "buy 2 get 1 counted per product",
+			products:   []OrderedProduct{shirt("", 20, 2), {ID: "mug", Price: 10, Quantity: 1}},
+			promotions: []Promotion{{ID: "p", Type: PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1}},
+			want:       map[string]float64{},
+		},
+		{
+			name:     "later promotions get what is left",
+			products: []OrderedProduct{mug},
+			promotions: []Promotion{
+				{ID: "p", Type: PromotionFixed, Value: 15},
+				{ID: "q", Type: PromotionPercentage, Value: 50},
+			},
+			want: map[string]float64{"mug": 17.5},
+		},
+		{
+			name:     "never below zero",
+			products: []OrderedProduct{mug},
+			promotions: []Promotion{
+				{ID: "p", Type: PromotionFixed, Value: 15},
+				{ID: "q", Type: PromotionFixed, Value: 10},
+			},
+			want: map[string]float64{"mug": 20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]float64{}
+			for _, d := range applyPromotions(tt.products, tt.promotions) {
+				got[d.ProductID] = roundCents(got[d.ProductID] + d.Amount)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("discounts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPromotionsOneDiscountPerProduct(t *testing.T) {
+	products := []OrderedProduct{
+		{ID: "shirt", VariantID: "s", Price: 20, Quantity: 1},
+		{ID: "shirt", VariantID: "m", Price: 20, Quantity: 1},
+	}
+	promotion := Promotion{ID: "p", Code: "TEN", Description: "10% off", Type: PromotionPercentage, Value: 10}
+
+	want := []Discount{{PromotionID: "p", Code: "TEN", ProductID: "shirt", Description: "10% off", Amount: 4}}
+	if got := applyPromotions(products, []Promotion{promotion}); !reflect.DeepEqual(got, want) {
+		t.Errorf("applyPromotions() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+)
+
+// Recommendations are "frequently bought together" products. The score of a
+// pair of products is the number of orders that contain both. Placing an
+// order queues it, and a job adds the pairs of queued orders to the scores,
+// so orders are never slowed down by the scores of popular products.
+
+// Recommendation is a product bought along with another one in Score orders
+type Recommendation struct {
+	ProductID string
+	Score     uint64
+}
+
+type RecommendationConfig struct {
+	Interval  time.Duration `envconfig:"INTERVAL" default:"1m"`
+	BatchSize int           `envconfig:"BATCH_SIZE" default:"500"`
+}
+
+func (c RecommendationConfig) Validate() error {
+	if c.Interval <= 0 || c.BatchSize < 1 {
+		return fmt.Errorf("%w: RECOMMENDATIONS_INTERVAL and RECOMMENDATIONS_BATCH_SIZE must be positive", bootstrap.ErrInvalidConfig)
+	}
+	return nil
+}
+
+// RunRecommendationJob keeps the scores up to date until ctx is done. The
+// first time it runs the scores are computed from every order placed so far,
+// after that only queued orders are added.
+func RunRecommendationJob(ctx context.Context, r Repository, cfg RecommendationConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	backfilled := false
+	for {
+		if !backfilled {
+			orders, err := r.BackfillProductPairs(ctx)
+			if err != nil {
+				log.Printf("Error computing recommendations from past orders: %v", err)
+			} else {
+				backfilled = true
+				if orders > 0 {
+					log.Printf("Computed recommendations from %d past orders", orders)
+				}
+			}
+		}
+
+		if backfilled {
+			for {
+				n, err := r.ProcessRecommendationQueue(ctx, cfg.BatchSize)
+				if err != nil {
+					log.Printf("Error updating recommendations: %v", err)
+					break
+				}
+				if n < cfg.BatchSize {
+					break
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s orderService) GetRecommendations(ctx context.Context, productID string, limit uint32) ([]Recommendation, error) {
+	if limit == 0 {
+		limit = 5
+	}
+	if limit > 20 {
+		limit = 20
+	}
+
+	return s.repository.GetProductPairs(ctx, productID, limit)
+}
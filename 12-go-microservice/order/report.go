@@ -0,0 +1,102 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidReport = errors.New("invalid report")
+)
+
+// Reports count every order except refunded ones. Revenue is what was
+// charged for the products once discounts are taken off, without tax.
+
+type ReportInterval string
+
+const (
+	ReportDaily   ReportInterval = "day"
+	ReportWeekly  ReportInterval = "week"
+	ReportMonthly ReportInterval = "month"
+)
+
+// maxReportBuckets bounds the number of rows a sales report can return
+const maxReportBuckets = 1000
+
+// ProductRanking is what top products are ranked by
+type ProductRanking string
+
+const (
+	RankByQuantity ProductRanking = "quantity"
+	RankByRevenue  ProductRanking = "revenue"
+)
+
+// SalesBucket holds the sales of one day, week or month. Weeks start on Monday
+// and buckets are in UTC.
+type SalesBucket struct {
+	Start             time.Time
+	OrderCount        uint64
+	Revenue           float64
+	AverageOrderValue float64
+}
+
+type SalesReport struct {
+	From              time.Time
+	To                time.Time
+	Interval          ReportInterval
+	Buckets           []SalesBucket
+	OrderCount        uint64
+	Revenue           float64
+	AverageOrderValue float64
+}
+
+type ProductSales struct {
+	ProductID  string
+	Name       string
+	Quantity   uint64
+	Revenue    float64
+	OrderCount uint64
+}
+
+// AccountValue is the lifetime value of an account
+type AccountValue struct {
+	AccountID         string
+	OrderCount        uint64
+	LifetimeValue     float64
+	AverageOrderValue float64
+	FirstOrderAt      time.Time
+	LastOrderAt       time.Time
+}
+
+// validateReportRange checks the range is in order and not split in too many buckets
+func validateReportRange(from time.Time, to time.Time, interval ReportInterval) error {
+	if !to.After(from) {
+		return fmt.Errorf("%w: range must end after it starts", ErrInvalidReport)
+	}
+
+	var bucket time.Duration
+	switch interval {
+	case ReportDaily:
+		bucket = 24 * time.Hour
+	case ReportWeekly:
+		bucket = 7 * 24 * time.Hour
+	case ReportMonthly:
+		bucket = 28 * 24 * time.Hour
+	default:
+		return fmt.Errorf("%w: unknown interval %q", ErrInvalidReport, interval)
+	}
+
+	if to.Sub(from)/bucket > maxReportBuckets {
+		return fmt.Errorf("%w: range spans more than %d buckets of a %s", ErrInvalidReport, maxReportBuckets, interval)
+	}
+
+	return nil
+}
+
+func averageOrderValue(revenue float64, orderCount uint64) float64 {
+	if orderCount == 0 {
+		return 0
+	}
+	return roundCents(revenue / float64(orderCount))
+}
@@ -3,14 +3,75 @@ package order
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
 	"github.com/lib/pq"
 )
 
+var (
+	ErrOrderNotFound    = errors.New("order not found")
+	ErrShipmentNotFound = errors.New("shipment not found")
+	ErrDuplicateOrder   = errors.New("an order of the account already has this idempotency key")
+)
+
 type Repository interface {
 	Close()
-	PutOrder(ctx context.Context, o Order) error
+	PutOrder(ctx context.Context, o Order, idempotencyKey string, e OrderEvent) error
+	GetOrderByID(ctx context.Context, id string) (*Order, error)
+	GetOrderIDByIdempotencyKey(ctx context.Context, accountID string, idempotencyKey string) (string, error)
+	UpdatePaymentStatus(ctx context.Context, id string, from PaymentStatus, to PaymentStatus, e OrderEvent) error
 	GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error)
+	GetOrdersForAccountAfter(ctx context.Context, accountID string, after string, first uint64) ([]Order, error)
+	CountOrdersForAccount(ctx context.Context, accountID string) (uint64, error)
+	PutShipment(ctx context.Context, s Shipment, e OrderEvent) error
+	UpdateShipment(ctx context.Context, s Shipment, e OrderEvent) error
+	GetShipmentByID(ctx context.Context, id string) (*Shipment, error)
+	GetShipmentsForOrders(ctx context.Context, orderIDs []string) ([]Shipment, error)
+	PutPromotion(ctx context.Context, p Promotion) error
+	UpdatePromotion(ctx context.Context, p Promotion) error
+	GetPromotionByID(ctx context.Context, id string) (*Promotion, error)
+	GetPromotionByCode(ctx context.Context, code string) (*Promotion, error)
+	GetPromotions(ctx context.Context) ([]Promotion, error)
+	GetAutomaticPromotions(ctx context.Context) ([]Promotion, error)
+	CountPromotionUses(ctx context.Context, promotionID string, accountID string) (uint32, error)
+	GetDiscountsForOrders(ctx context.Context, orderIDs []string) ([]Discount, error)
+	GetTaxesForOrders(ctx context.Context, orderIDs []string) ([]TaxLine, error)
+	GetSalesBuckets(ctx context.Context, from time.Time, to time.Time, interval ReportInterval) ([]SalesBucket, error)
+	GetTopProducts(ctx context.Context, from time.Time, to time.Time, by ProductRanking, limit uint32) ([]ProductSales, error)
+	GetAccountValues(ctx context.Context, accountIDs []string, limit uint32) ([]AccountValue, error)
+	BackfillProductPairs(ctx context.Context) (uint64, error)
+	ProcessRecommendationQueue(ctx context.Context, batchSize int) (int, error)
+	GetProductPairs(ctx context.Context, productID string, limit uint32) ([]Recommendation, error)
+	RelayOutboxEvents(ctx context.Context, batchSize int, publish func(OrderEvent) error) (int, error)
+	PutWebhook(ctx context.Context, w Webhook) error
+	UpdateWebhook(ctx context.Context, w Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+	GetWebhookByID(ctx context.Context, id string) (*Webhook, error)
+	GetWebhooks(ctx context.Context) ([]Webhook, error)
+	PutWebhookDeliveries(ctx context.Context, deliveries []WebhookDelivery) error
+	ClaimWebhookDeliveries(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]ClaimedWebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, d WebhookDelivery, a WebhookAttempt) error
+	ResetWebhookDelivery(ctx context.Context, id string, now time.Time) error
+	GetWebhookDeliveryByID(ctx context.Context, id string) (*WebhookDelivery, error)
+	GetWebhookDeliveries(ctx context.Context, webhookID string, skip uint64, take uint64) ([]WebhookDelivery, error)
+	PutNotification(ctx context.Context, n Notification) error
+	ClaimNotifications(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]Notification, error)
+	UpdateNotification(ctx context.Context, n Notification) error
+	GetNotificationsForOrder(ctx context.Context, orderID string) ([]Notification, error)
+	PutInvoice(ctx context.Context, orderID string, issue func(seq uint64) (Invoice, error)) error
+	GetInvoice(ctx context.Context, orderID string) (*Invoice, error)
+	PutSubscription(ctx context.Context, s Subscription) error
+	GetSubscriptionByID(ctx context.Context, id string) (*Subscription, error)
+	GetSubscriptionsForAccount(ctx context.Context, accountID string) ([]Subscription, error)
+	UpdateSubscriptionStatus(ctx context.Context, id string, from SubscriptionStatus, to SubscriptionStatus, nextRunAt time.Time) error
+	GetDueSubscriptions(ctx context.Context, now time.Time) ([]Subscription, error)
+	PutSubscriptionRun(ctx context.Context, run SubscriptionRun) error
+	ClaimSubscriptionRuns(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]ClaimedSubscriptionRun, error)
+	RecordSubscriptionRun(ctx context.Context, run SubscriptionRun, nextRunAt *time.Time) error
 }
 
 type postgresRepository struct {
@@ -21,7 +82,9 @@ func (r *postgresRepository) Close() {
 	r.db.Close()
 }
 
-func (r *postgresRepository) PutOrder(ctx context.Context, o Order) (err error) {
+// PutOrder saves the order along with e in the outbox. An empty idempotency
+// key is not stored, others must be unique for the account.
+func (r *postgresRepository) PutOrder(ctx context.Context, o Order, idempotencyKey string, e OrderEvent) (err error) {
 	// As Order logic has many dependencies, it would be safer to use transaction in this context
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -36,33 +99,61 @@ func (r *postgresRepository) PutOrder(ctx context.Context, o Order) (err error)
 		err = tx.Commit()
 	}()
 
+	// The address is kept as JSON, it is only ever read along with its order
+	var shippingAddress []byte
+	if o.ShippingAddress != nil {
+		shippingAddress, err = json.Marshal(o.ShippingAddress)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Insert order
 	_, err = tx.ExecContext(
 		ctx,
 		`
-		INSERT INTO orders(id, created_at, account_id, total_price) 
-			VALUES ($1, $2, $3, $4)
+		INSERT INTO orders(id, created_at, account_id, subtotal, tax_total, tax_inclusive, tax_jurisdiction, total_price, shipping_address, idempotency_key) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''))
 		`,
 		o.ID,
 		o.CreatedAt,
 		o.AccountID,
+		o.Subtotal,
+		o.TaxTotal,
+		o.TaxInclusive,
+		o.TaxJurisdiction,
 		o.TotalPrice,
+		shippingAddress,
+		idempotencyKey,
 	)
 
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrDuplicateOrder
+	}
 	if err != nil {
 		return err
 	}
 
 	// Only insert products if there are any
 	if len(o.Products) > 0 {
-		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("order_products", "order_id", "product_id", "quantity"))
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("order_products", "order_id", "product_id", "variant_id", "quantity", "price", "sku", "options"))
 		if err != nil {
 			return err
 		}
 		defer stmt.Close()
 
 		for _, p := range o.Products {
-			_, err = stmt.ExecContext(ctx, o.ID, p.ID, p.Quantity)
+			options := p.Options
+			if options == nil {
+				options = []VariantOption{}
+			}
+			encoded, err := json.Marshal(options)
+			if err != nil {
+				return err
+			}
+
+			_, err = stmt.ExecContext(ctx, o.ID, p.ID, p.VariantID, p.Quantity, p.Price, p.SKU, string(encoded))
 			if err != nil {
 				return err
 			}
@@ -74,9 +165,175 @@ func (r *postgresRepository) PutOrder(ctx context.Context, o Order) (err error)
 		}
 	}
 
+	if err = putDiscounts(ctx, tx, o); err != nil {
+		return err
+	}
+
+	for _, t := range o.Taxes {
+		_, err = tx.ExecContext(
+			ctx,
+			`
+			INSERT INTO order_taxes(order_id, product_id, category, rate, taxable_amount, amount)
+				VALUES ($1, $2, $3, $4, $5, $6)
+			`,
+			o.ID,
+			t.ProductID,
+			t.Category,
+			t.Rate,
+			t.TaxableAmount,
+			t.Amount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Queued in the same transaction so the recommendation job never misses an order
+	_, err = tx.ExecContext(ctx, "INSERT INTO recommendation_queue(order_id) VALUES ($1)", o.ID)
+	if err != nil {
+		return err
+	}
+
+	return putOutboxEvent(ctx, tx, e)
+}
+
+// putDiscounts saves the discounts of an order. Promotions with a usage limit
+// are locked first, so concurrent orders of an account cannot both use the last use.
+func putDiscounts(ctx context.Context, tx *sql.Tx, o Order) error {
+	checked := map[string]bool{}
+	for _, d := range o.Discounts {
+		if checked[d.PromotionID] {
+			continue
+		}
+		checked[d.PromotionID] = true
+
+		var limit uint32
+		err := tx.QueryRowContext(ctx, "SELECT usage_limit_per_account FROM promotions WHERE id = $1 FOR UPDATE", d.PromotionID).Scan(&limit)
+		if err != nil {
+			return err
+		}
+		if limit == 0 {
+			continue
+		}
+
+		uses, err := countPromotionUses(ctx, tx, d.PromotionID, o.AccountID)
+		if err != nil {
+			return err
+		}
+		if uses >= limit {
+			return ErrCouponUsageLimitExceeded
+		}
+	}
+
+	for _, d := range o.Discounts {
+		_, err := tx.ExecContext(
+			ctx,
+			`
+			INSERT INTO order_discounts(order_id, promotion_id, code, product_id, description, amount)
+				VALUES ($1, $2, $3, $4, $5, $6)
+			`,
+			o.ID,
+			d.PromotionID,
+			d.Code,
+			d.ProductID,
+			d.Description,
+			d.Amount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func (r *postgresRepository) GetOrderByID(ctx context.Context, id string) (*Order, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT
+			o.id,
+			o.created_at,
+			o.account_id,
+			o.subtotal::numeric::float8,
+			o.tax_total::numeric::float8,
+			o.tax_inclusive,
+			o.tax_jurisdiction,
+			o.total_price::money::numeric::float8,
+			o.payment_status,
+			o.shipping_address,
+			op.product_id,
+			op.variant_id,
+			op.quantity,
+			op.price::numeric::float8,
+			op.sku,
+			op.options
+		FROM orders o
+		JOIN order_products op
+			ON o.id = op.order_id
+		WHERE o.id = $1
+		`,
+		id,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(orders) == 0 {
+		return nil, ErrOrderNotFound
+	}
+
+	return &orders[0], nil
+}
+
+func (r *postgresRepository) GetOrderIDByIdempotencyKey(ctx context.Context, accountID string, idempotencyKey string) (string, error) {
+	var id string
+	err := r.db.QueryRowContext(ctx, "SELECT id FROM orders WHERE account_id = $1 AND idempotency_key = $2", accountID, idempotencyKey).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrOrderNotFound
+	}
+
+	return id, err
+}
+
+// UpdatePaymentStatus changes the payment status of an order still in status from
+func (r *postgresRepository) UpdatePaymentStatus(ctx context.Context, id string, from PaymentStatus, to PaymentStatus, e OrderEvent) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	res, err := tx.ExecContext(ctx, "UPDATE orders SET payment_status = $3 WHERE id = $1 AND payment_status = $2", id, from, to)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%w: order is no longer %s", ErrPaymentStatusChange, from)
+	}
+
+	return putOutboxEvent(ctx, tx, e)
+}
+
 func (r *postgresRepository) GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error) {
 	rows, err := r.db.QueryContext(
 		ctx,
@@ -85,9 +342,19 @@ func (r *postgresRepository) GetOrdersForAccount(ctx context.Context, accountID
 			o.id,
 			o.created_at,
 			o.account_id,
+			o.subtotal::numeric::float8,
+			o.tax_total::numeric::float8,
+			o.tax_inclusive,
+			o.tax_jurisdiction,
 			o.total_price::money::numeric::float8,
+			o.payment_status,
+			o.shipping_address,
 			op.product_id,
-			op.quantity
+			op.variant_id,
+			op.quantity,
+			op.price::numeric::float8,
+			op.sku,
+			op.options
 		FROM orders o
 		JOIN order_products op
 			ON o.id = op.order_id
@@ -102,81 +369,2040 @@ func (r *postgresRepository) GetOrdersForAccount(ctx context.Context, accountID
 		return nil, err
 	}
 
-	defer rows.Close()
+	return scanOrders(rows)
+}
 
-	orders := []Order{}
-	var currentOrder *Order
-	var products []OrderedProduct
+// GetOrdersForAccountAfter returns orders with ID greater than after. The page
+// of orders is selected first so LIMIT applies to orders, not to product rows.
+func (r *postgresRepository) GetOrdersForAccountAfter(ctx context.Context, accountID string, after string, first uint64) ([]Order, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT
+			o.id,
+			o.created_at,
+			o.account_id,
+			o.subtotal::numeric::float8,
+			o.tax_total::numeric::float8,
+			o.tax_inclusive,
+			o.tax_jurisdiction,
+			o.total_price::money::numeric::float8,
+			o.payment_status,
+			o.shipping_address,
+			op.product_id,
+			op.variant_id,
+			op.quantity,
+			op.price::numeric::float8,
+			op.sku,
+			op.options
+		FROM (
+			SELECT * FROM orders
+			WHERE account_id = $1 AND ($2 = '' OR id > $2)
+			ORDER BY id
+			LIMIT $3
+		) o
+		JOIN order_products op
+			ON o.id = op.order_id
+		ORDER BY
+			o.id
+		`,
+		accountID,
+		after,
+		first,
+	)
 
-	for rows.Next() {
-		order := &Order{}
-		orderedProduct := &OrderedProduct{}
+	if err != nil {
+		return nil, err
+	}
 
-		if err = rows.Scan(
-			&order.ID,
-			&order.CreatedAt,
-			&order.AccountID,
-			&order.TotalPrice,
-			&orderedProduct.ID,
-			&orderedProduct.Quantity,
-		); err != nil {
-			return nil, err
+	return scanOrders(rows)
+}
+
+func (r *postgresRepository) CountOrdersForAccount(ctx context.Context, accountID string) (uint64, error) {
+	var count uint64
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders WHERE account_id = $1", accountID).Scan(&count)
+
+	return count, err
+}
+
+func (r *postgresRepository) PutShipment(ctx context.Context, s Shipment, e OrderEvent) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
 		}
+		err = tx.Commit()
+	}()
 
-		// If we're processing a new order (different from the current one)
-		if currentOrder == nil || currentOrder.ID != order.ID {
-			// Save the previous order if it exists
-			if currentOrder != nil {
-				newOrder := Order{
-					ID:         currentOrder.ID,
-					AccountID:  currentOrder.AccountID,
-					CreatedAt:  currentOrder.CreatedAt,
-					TotalPrice: currentOrder.TotalPrice,
-					Products:   make([]OrderedProduct, len(products)),
-				}
-				copy(newOrder.Products, products)
-				orders = append(orders, newOrder)
-			}
+	_, err = tx.ExecContext(
+		ctx,
+		`
+		INSERT INTO shipments(id, order_id, carrier, tracking_number, status, created_at, shipped_at, delivered_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`,
+		s.ID,
+		s.OrderID,
+		s.Carrier,
+		s.TrackingNumber,
+		s.Status,
+		s.CreatedAt,
+		s.ShippedAt,
+		s.DeliveredAt,
+	)
+	if err != nil {
+		return err
+	}
 
-			// Start a new order
-			currentOrder = order
-			products = []OrderedProduct{}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("shipment_items", "shipment_id", "product_id", "variant_id", "quantity"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, item := range s.Items {
+		_, err = stmt.ExecContext(ctx, s.ID, item.ProductID, item.VariantID, item.Quantity)
+		if err != nil {
+			return err
 		}
+	}
 
-		// Add the current product to the products slice
-		products = append(products, *orderedProduct)
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Add the last order if it exists
-	if currentOrder != nil {
-		finalOrder := Order{
-			ID:         currentOrder.ID,
-			AccountID:  currentOrder.AccountID,
-			CreatedAt:  currentOrder.CreatedAt,
-			TotalPrice: currentOrder.TotalPrice,
-			Products:   make([]OrderedProduct, len(products)),
+	return putOutboxEvent(ctx, tx, e)
+}
+
+// UpdateShipment saves the tracking details and status, the items of a shipment never change
+func (r *postgresRepository) UpdateShipment(ctx context.Context, s Shipment, e OrderEvent) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
 		}
-		copy(finalOrder.Products, products)
-		orders = append(orders, finalOrder)
+		err = tx.Commit()
+	}()
+
+	res, err := tx.ExecContext(
+		ctx,
+		`
+		UPDATE shipments
+		SET carrier = $2, tracking_number = $3, status = $4, shipped_at = $5, delivered_at = $6
+		WHERE id = $1
+		`,
+		s.ID,
+		s.Carrier,
+		s.TrackingNumber,
+		s.Status,
+		s.ShippedAt,
+		s.DeliveredAt,
+	)
+	if err != nil {
+		return err
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
 	}
 
-	return orders, nil
+	if n == 0 {
+		return ErrShipmentNotFound
+	}
+
+	return putOutboxEvent(ctx, tx, e)
 }
 
-func NewPostgresRepository(url string) (Repository, error) {
-	db, err := sql.Open("postgres", url)
+const shipmentQuery = `
+	SELECT
+		s.id,
+		s.order_id,
+		s.carrier,
+		s.tracking_number,
+		s.status,
+		s.created_at,
+		s.shipped_at,
+		s.delivered_at,
+		si.product_id,
+		si.variant_id,
+		si.quantity
+	FROM shipments s
+	JOIN shipment_items si
+		ON s.id = si.shipment_id
+`
+
+func (r *postgresRepository) GetShipmentByID(ctx context.Context, id string) (*Shipment, error) {
+	rows, err := r.db.QueryContext(ctx, shipmentQuery+"WHERE s.id = $1", id)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.Ping()
+	shipments, err := scanShipments(rows)
 	if err != nil {
 		return nil, err
 	}
 
-	return &postgresRepository{db}, nil
+	if len(shipments) == 0 {
+		return nil, ErrShipmentNotFound
+	}
+
+	return &shipments[0], nil
+}
+
+func (r *postgresRepository) GetShipmentsForOrders(ctx context.Context, orderIDs []string) ([]Shipment, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		shipmentQuery+"WHERE s.order_id = ANY($1) ORDER BY s.created_at, s.id",
+		pq.Array(orderIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanShipments(rows)
+}
+
+// scanShipments groups rows of a shipments/shipment_items join, ordered by shipment, into shipments
+func scanShipments(rows *sql.Rows) ([]Shipment, error) {
+	defer rows.Close()
+
+	shipments := []Shipment{}
+	for rows.Next() {
+		s := Shipment{}
+		item := ShipmentItem{}
+
+		if err := rows.Scan(
+			&s.ID,
+			&s.OrderID,
+			&s.Carrier,
+			&s.TrackingNumber,
+			&s.Status,
+			&s.CreatedAt,
+			&s.ShippedAt,
+			&s.DeliveredAt,
+			&item.ProductID,
+			&item.VariantID,
+			&item.Quantity,
+		); err != nil {
+			return nil, err
+		}
+
+		if n := len(shipments); n > 0 && shipments[n-1].ID == s.ID {
+			shipments[n-1].Items = append(shipments[n-1].Items, item)
+			continue
+		}
+
+		s.Items = []ShipmentItem{item}
+		shipments = append(shipments, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shipments, nil
+}
+
+func (r *postgresRepository) PutPromotion(ctx context.Context, p Promotion) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`
+		INSERT INTO promotions(id, code, description, type, value, buy_quantity, get_quantity, product_ids, min_spend, usage_limit_per_account, starts_at, ends_at, active, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		`,
+		p.ID,
+		p.Code,
+		p.Description,
+		p.Type,
+		p.Value,
+		p.BuyQuantity,
+		p.GetQuantity,
+		pq.Array(p.ProductIDs),
+		p.MinSpend,
+		p.UsageLimitPerAccount,
+		p.StartsAt,
+		p.EndsAt,
+		p.Active,
+		p.CreatedAt,
+	)
+
+	return promotionError(err)
+}
+
+func (r *postgresRepository) UpdatePromotion(ctx context.Context, p Promotion) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		`
+		UPDATE promotions
+		SET code = $2, description = $3, type = $4, value = $5, buy_quantity = $6, get_quantity = $7, product_ids = $8,
+			min_spend = $9, usage_limit_per_account = $10, starts_at = $11, ends_at = $12, active = $13
+		WHERE id = $1
+		`,
+		p.ID,
+		p.Code,
+		p.Description,
+		p.Type,
+		p.Value,
+		p.BuyQuantity,
+		p.GetQuantity,
+		pq.Array(p.ProductIDs),
+		p.MinSpend,
+		p.UsageLimitPerAccount,
+		p.StartsAt,
+		p.EndsAt,
+		p.Active,
+	)
+	if err != nil {
+		return promotionError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrPromotionNotFound
+	}
+
+	return nil
+}
+
+// promotionError reports a duplicate coupon code as an invalid promotion
+func promotionError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("%w: code is already used by another promotion", ErrInvalidPromotion)
+	}
+	return err
+}
+
+const promotionQuery = `
+	SELECT
+		id,
+		code,
+		description,
+		type,
+		value,
+		buy_quantity,
+		get_quantity,
+		product_ids,
+		min_spend::numeric::float8,
+		usage_limit_per_account,
+		starts_at,
+		ends_at,
+		active,
+		created_at
+	FROM promotions
+`
+
+func (r *postgresRepository) GetPromotionByID(ctx context.Context, id string) (*Promotion, error) {
+	return r.getPromotion(ctx, promotionQuery+"WHERE id = $1", id)
+}
+
+func (r *postgresRepository) GetPromotionByCode(ctx context.Context, code string) (*Promotion, error) {
+	return r.getPromotion(ctx, promotionQuery+"WHERE code = $1 AND code <> ''", code)
+}
+
+func (r *postgresRepository) getPromotion(ctx context.Context, query string, arg string) (*Promotion, error) {
+	rows, err := r.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	promotions, err := scanPromotions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(promotions) == 0 {
+		return nil, ErrPromotionNotFound
+	}
+
+	return &promotions[0], nil
+}
+
+func (r *postgresRepository) GetPromotions(ctx context.Context) ([]Promotion, error) {
+	rows, err := r.db.QueryContext(ctx, promotionQuery+"ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPromotions(rows)
+}
+
+// GetAutomaticPromotions returns the active promotions without a code, in the order they apply
+func (r *postgresRepository) GetAutomaticPromotions(ctx context.Context) ([]Promotion, error) {
+	rows, err := r.db.QueryContext(ctx, promotionQuery+"WHERE code = '' AND active ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPromotions(rows)
+}
+
+func scanPromotions(rows *sql.Rows) ([]Promotion, error) {
+	defer rows.Close()
+
+	promotions := []Promotion{}
+	for rows.Next() {
+		p := Promotion{}
+		if err := rows.Scan(
+			&p.ID,
+			&p.Code,
+			&p.Description,
+			&p.Type,
+			&p.Value,
+			&p.BuyQuantity,
+			&p.GetQuantity,
+			pq.Array(&p.ProductIDs),
+			&p.MinSpend,
+			&p.UsageLimitPerAccount,
+			&p.StartsAt,
+			&p.EndsAt,
+			&p.Active,
+			&p.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return promotions, nil
+}
+
+func (r *postgresRepository) CountPromotionUses(ctx context.Context, promotionID string, accountID string) (uint32, error) {
+	return countPromotionUses(ctx, r.db, promotionID, accountID)
+}
+
+// queryRower is implemented by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// countPromotionUses counts the orders of the account that got a discount from the promotion
+func countPromotionUses(ctx context.Context, q queryRower, promotionID string, accountID string) (uint32, error) {
+	var count uint32
+	err := q.QueryRowContext(
+		ctx,
+		`
+		SELECT COUNT(DISTINCT d.order_id)
+		FROM order_discounts d
+		JOIN orders o
+			ON o.id = d.order_id
+		WHERE d.promotion_id = $1 AND o.account_id = $2
+		`,
+		promotionID,
+		accountID,
+	).Scan(&count)
+
+	return count, err
+}
+
+func (r *postgresRepository) GetDiscountsForOrders(ctx context.Context, orderIDs []string) ([]Discount, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT
+			order_id,
+			promotion_id,
+			code,
+			product_id,
+			description,
+			amount::numeric::float8
+		FROM order_discounts
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, promotion_id, product_id
+		`,
+		pq.Array(orderIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	discounts := []Discount{}
+	for rows.Next() {
+		d := Discount{}
+		if err := rows.Scan(&d.OrderID, &d.PromotionID, &d.Code, &d.ProductID, &d.Description, &d.Amount); err != nil {
+			return nil, err
+		}
+		discounts = append(discounts, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return discounts, nil
+}
+
+func (r *postgresRepository) GetTaxesForOrders(ctx context.Context, orderIDs []string) ([]TaxLine, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT
+			order_id,
+			product_id,
+			category,
+			rate,
+			taxable_amount::numeric::float8,
+			amount::numeric::float8
+		FROM order_taxes
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, product_id
+		`,
+		pq.Array(orderIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	taxes := []TaxLine{}
+	for rows.Next() {
+		t := TaxLine{}
+		if err := rows.Scan(&t.OrderID, &t.ProductID, &t.Category, &t.Rate, &t.TaxableAmount, &t.Amount); err != nil {
+			return nil, err
+		}
+		taxes = append(taxes, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return taxes, nil
+}
+
+// scanOrders groups rows of an orders/order_products join, ordered by order ID, into orders
+func scanOrders(rows *sql.Rows) ([]Order, error) {
+	defer rows.Close()
+
+	orders := []Order{}
+	var currentOrder *Order
+	var products []OrderedProduct
+
+	for rows.Next() {
+		order := &Order{}
+		orderedProduct := &OrderedProduct{}
+		var shippingAddress []byte
+		var options []byte
+
+		if err := rows.Scan(
+			&order.ID,
+			&order.CreatedAt,
+			&order.AccountID,
+			&order.Subtotal,
+			&order.TaxTotal,
+			&order.TaxInclusive,
+			&order.TaxJurisdiction,
+			&order.TotalPrice,
+			&order.PaymentStatus,
+			&shippingAddress,
+			&orderedProduct.ID,
+			&orderedProduct.VariantID,
+			&orderedProduct.Quantity,
+			&orderedProduct.Price,
+			&orderedProduct.SKU,
+			&options,
+		); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(options, &orderedProduct.Options); err != nil {
+			return nil, err
+		}
+
+		if shippingAddress != nil {
+			order.ShippingAddress = &Address{}
+			if err := json.Unmarshal(shippingAddress, order.ShippingAddress); err != nil {
+				return nil, err
+			}
+		}
+
+		// If we're processing a new order (different from the current one)
+		if currentOrder == nil || currentOrder.ID != order.ID {
+			// Save the previous order if it exists
+			if currentOrder != nil {
+				newOrder := *currentOrder
+				newOrder.Products = make([]OrderedProduct, len(products))
+				copy(newOrder.Products, products)
+				orders = append(orders, newOrder)
+			}
+
+			// Start a new order
+			currentOrder = order
+			products = []OrderedProduct{}
+		}
+
+		// Add the current product to the products slice
+		products = append(products, *orderedProduct)
+	}
+
+	// Add the last order if it exists
+	if currentOrder != nil {
+		finalOrder := *currentOrder
+		finalOrder.Products = make([]OrderedProduct, len(products))
+		copy(finalOrder.Products, products)
+		orders = append(orders, finalOrder)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func NewPostgresRepository(cfg bootstrap.DatabaseConfig) (Repository, error) {
+	db, err := cfg.Open("postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresRepository{db}, nil
+}
+
+// GetSalesBuckets aggregates the orders of the range by day, week or month.
+// Buckets without orders are returned too, so the series has no gaps.
+func (r *postgresRepository) GetSalesBuckets(ctx context.Context, from time.Time, to time.Time, interval ReportInterval) ([]SalesBucket, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT
+			b.start,
+			COUNT(o.id),
+			COALESCE(SUM((o.total_price - o.tax_total)::numeric), 0)::float8
+		FROM generate_series(
+			date_trunc($3, $1::timestamptz AT TIME ZONE 'UTC'),
+			($2::timestamptz AT TIME ZONE 'UTC') - interval '1 microsecond',
+			('1 ' || $3)::interval
+		) AS b(start)
+		LEFT JOIN orders o
+			ON date_trunc($3, o.created_at AT TIME ZONE 'UTC') = b.start
+			AND o.created_at >= $1
+			AND o.created_at < $2
+			AND o.payment_status <> 'refunded'
+		GROUP BY b.start
+		ORDER BY b.start
+		`,
+		from,
+		to,
+		string(interval),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	buckets := []SalesBucket{}
+	for rows.Next() {
+		b := SalesBucket{}
+		if err := rows.Scan(&b.Start, &b.OrderCount, &b.Revenue); err != nil {
+			return nil, err
+		}
+		b.Start = b.Start.UTC()
+		buckets = append(buckets, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
+
+// GetTopProducts ranks the products sold in the range. The revenue of a
+// product in an order is the price times the quantity of its lines, one per
+// variant, less the discounts applied to it.
+func (r *postgresRepository) GetTopProducts(ctx context.Context, from time.Time, to time.Time, by ProductRanking, limit uint32) ([]ProductSales, error) {
+	// Ranking is chosen from a fixed set of columns, never from user input
+	orderBy := "quantity"
+	if by == RankByRevenue {
+		orderBy = "revenue"
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		fmt.Sprintf(`
+		SELECT
+			op.product_id,
+			SUM(op.quantity)::bigint AS quantity,
+			SUM(op.amount - COALESCE(d.amount, 0))::float8 AS revenue,
+			COUNT(*)
+		FROM orders o
+		JOIN (
+			SELECT order_id, product_id, SUM(quantity) AS quantity, SUM(price::numeric * quantity) AS amount
+			FROM order_products
+			GROUP BY order_id, product_id
+		) op
+			ON o.id = op.order_id
+		LEFT JOIN LATERAL (
+			SELECT SUM(od.amount::numeric) AS amount
+			FROM order_discounts od
+			WHERE od.order_id = op.order_id AND od.product_id = op.product_id
+		) d ON TRUE
+		WHERE o.created_at >= $1
+			AND o.created_at < $2
+			AND o.payment_status <> 'refunded'
+		GROUP BY op.product_id
+		ORDER BY %s DESC, op.product_id
+		LIMIT $3
+		`, orderBy),
+		from,
+		to,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	products := []ProductSales{}
+	for rows.Next() {
+		p := ProductSales{}
+		if err := rows.Scan(&p.ProductID, &p.Quantity, &p.Revenue, &p.OrderCount); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// GetAccountValues returns the lifetime value of the given accounts, or of
+// the most valuable accounts when none are given
+func (r *postgresRepository) GetAccountValues(ctx context.Context, accountIDs []string, limit uint32) ([]AccountValue, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT
+			o.account_id,
+			COUNT(*),
+			SUM((o.total_price - o.tax_total)::numeric)::float8 AS lifetime_value,
+			MIN(o.created_at),
+			MAX(o.created_at)
+		FROM orders o
+		WHERE o.payment_status <> 'refunded'
+			AND (cardinality($1::text[]) = 0 OR o.account_id = ANY($1))
+		GROUP BY o.account_id
+		ORDER BY lifetime_value DESC, o.account_id
+		LIMIT $2
+		`,
+		pq.Array(accountIDs),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	accounts := []AccountValue{}
+	for rows.Next() {
+		a := AccountValue{}
+		if err := rows.Scan(&a.AccountID, &a.OrderCount, &a.LifetimeValue, &a.FirstOrderAt, &a.LastOrderAt); err != nil {
+			return nil, err
+		}
+		a.AverageOrderValue = averageOrderValue(a.LifetimeValue, a.OrderCount)
+		accounts = append(accounts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// BackfillProductPairs computes the scores from every order when none have
+// been computed yet, e.g. on a database that already had orders. The queue
+// is emptied as the orders in it are counted too. It returns the number of
+// orders counted.
+func (r *postgresRepository) BackfillProductPairs(ctx context.Context) (n uint64, err error) {
+	// Orders placed during the backfill are outside of the snapshot and stay queued
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	var computed bool
+	if err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM product_pairs)").Scan(&computed); err != nil {
+		return 0, err
+	}
+	if computed {
+		return 0, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM recommendation_queue"); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`
+		INSERT INTO product_pairs(product_id, related_product_id, score)
+		SELECT a.product_id, b.product_id, COUNT(DISTINCT a.order_id)
+		FROM order_products a
+		JOIN order_products b
+			ON a.order_id = b.order_id AND a.product_id <> b.product_id
+		GROUP BY a.product_id, b.product_id
+		`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders").Scan(&n)
+	return n, err
+}
+
+// ProcessRecommendationQueue adds the pairs of up to batchSize queued orders
+// to the scores and removes them from the queue. It returns the number of
+// orders processed.
+func (r *postgresRepository) ProcessRecommendationQueue(ctx context.Context, batchSize int) (n int, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	// Several order services may run the job, each takes its own batch
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT order_id FROM recommendation_queue ORDER BY order_id LIMIT $1 FOR UPDATE SKIP LOCKED",
+		batchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	orderIDs := []string{}
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orderIDs = append(orderIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(orderIDs) == 0 {
+		return 0, nil
+	}
+
+	// Pairs are written in key order so concurrent batches can't deadlock
+	_, err = tx.ExecContext(
+		ctx,
+		`
+		INSERT INTO product_pairs(product_id, related_product_id, score)
+		SELECT a.product_id, b.product_id, COUNT(DISTINCT a.order_id)
+		FROM order_products a
+		JOIN order_products b
+			ON a.order_id = b.order_id AND a.product_id <> b.product_id
+		WHERE a.order_id = ANY($1)
+		GROUP BY a.product_id, b.product_id
+		ORDER BY a.product_id, b.product_id
+		ON CONFLICT (product_id, related_product_id)
+			DO UPDATE SET score = product_pairs.score + EXCLUDED.score
+		`,
+		pq.Array(orderIDs),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM recommendation_queue WHERE order_id = ANY($1)", pq.Array(orderIDs))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(orderIDs), nil
+}
+
+func (r *postgresRepository) GetProductPairs(ctx context.Context, productID string, limit uint32) ([]Recommendation, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT related_product_id, score
+		FROM product_pairs
+		WHERE product_id = $1
+		ORDER BY score DESC, related_product_id
+		LIMIT $2
+		`,
+		productID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	recommendations := []Recommendation{}
+	for rows.Next() {
+		rec := Recommendation{}
+		if err := rows.Scan(&rec.ProductID, &rec.Score); err != nil {
+			return nil, err
+		}
+		recommendations = append(recommendations, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return recommendations, nil
+}
+
+// putOutboxEvent stores e to be relayed to the broker once tx commits
+func putOutboxEvent(ctx context.Context, tx *sql.Tx, e OrderEvent) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO outbox_events(id, order_id, payload, created_at) VALUES ($1, $2, $3, $4)",
+		e.ID,
+		e.OrderID,
+		string(payload),
+		e.OccurredAt,
+	)
+	return err
+}
+
+// outboxRelayLock is the advisory lock key held by the relaying order service
+const outboxRelayLock = 0x6f7574626f78
+
+// RelayOutboxEvents passes up to batchSize events to publish, oldest first,
+// and deletes the ones published. It stops at the first event that fails, so
+// it is retried first on the next call. It returns the number published, zero
+// when another order service is relaying.
+func (r *postgresRepository) RelayOutboxEvents(ctx context.Context, batchSize int, publish func(OrderEvent) error) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// Committed below even when publishing fails, to delete what was published
+	defer tx.Rollback()
+
+	// Only one order service relays at a time, so events are published in
+	// outbox order. The others find the lock taken and wait for their next run.
+	var locked bool
+	err = tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", outboxRelayLock).Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT seq, payload FROM outbox_events ORDER BY seq LIMIT $1",
+		batchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	seqs := []int64{}
+	events := []OrderEvent{}
+	for rows.Next() {
+		var seq int64
+		var payload []byte
+		if err := rows.Scan(&seq, &payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		e := OrderEvent{}
+		if err := json.Unmarshal(payload, &e); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		seqs = append(seqs, seq)
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	var publishErr error
+	for _, e := range events {
+		if publishErr = publish(e); publishErr != nil {
+			break
+		}
+		n++
+	}
+
+	if n > 0 {
+		_, err = tx.ExecContext(ctx, "DELETE FROM outbox_events WHERE seq = ANY($1)", pq.Array(seqs[:n]))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if publishErr != nil {
+		return n, fmt.Errorf("publishing event %s: %w", events[n].ID, publishErr)
+	}
+	return n, nil
+}
+
+func (r *postgresRepository) PutWebhook(ctx context.Context, w Webhook) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO webhooks(id, url, event_types, secret, active, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		w.ID,
+		w.URL,
+		pq.Array(eventTypeNames(w.EventTypes)),
+		w.Secret,
+		w.Active,
+		w.CreatedAt,
+	)
+	return err
+}
+
+// UpdateWebhook keeps the current secret when w has none
+func (r *postgresRepository) UpdateWebhook(ctx context.Context, w Webhook) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		`
+		UPDATE webhooks
+		SET url = $2, event_types = $3, secret = COALESCE(NULLIF($4, ''), secret), active = $5
+		WHERE id = $1
+		`,
+		w.ID,
+		w.URL,
+		pq.Array(eventTypeNames(w.EventTypes)),
+		w.Secret,
+		w.Active,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) DeleteWebhook(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+const webhookQuery = `
+	SELECT id, url, event_types, secret, active, created_at
+	FROM webhooks
+	`
+
+func (r *postgresRepository) GetWebhookByID(ctx context.Context, id string) (*Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, webhookQuery+"WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := scanWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(webhooks) == 0 {
+		return nil, ErrWebhookNotFound
+	}
+
+	return &webhooks[0], nil
+}
+
+func (r *postgresRepository) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, webhookQuery+"ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+
+	return scanWebhooks(rows)
+}
+
+func scanWebhooks(rows *sql.Rows) ([]Webhook, error) {
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		w := Webhook{}
+		names := []string{}
+		if err := rows.Scan(&w.ID, &w.URL, pq.Array(&names), &w.Secret, &w.Active, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		types, err := ParseOrderEventTypes(names)
+		if err != nil {
+			return nil, err
+		}
+		w.EventTypes = types
+		webhooks = append(webhooks, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func eventTypeNames(types []OrderEventType) []string {
+	names := []string{}
+	for _, t := range types {
+		names = append(names, t.String())
+	}
+	return names
+}
+
+// PutWebhookDeliveries skips deliveries of an event already queued for the webhook
+func (r *postgresRepository) PutWebhookDeliveries(ctx context.Context, deliveries []WebhookDelivery) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	for _, d := range deliveries {
+		_, err = tx.ExecContext(
+			ctx,
+			`
+			INSERT INTO webhook_deliveries(id, webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (webhook_id, event_id) DO NOTHING
+			`,
+			d.ID,
+			d.WebhookID,
+			d.EventID,
+			d.EventType.String(),
+			string(d.Payload),
+			d.Status,
+			d.NextAttemptAt,
+			d.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries due at now, of
+// active webhooks, and postpones them by lease so no other dispatcher sends
+// them meanwhile
+func (r *postgresRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]ClaimedWebhookDelivery, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		WITH due AS (
+			SELECT d.id
+			FROM webhook_deliveries d
+			JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= $1 AND w.active
+			ORDER BY d.next_attempt_at
+			LIMIT $2
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = $3
+		FROM due, webhooks w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING
+			d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+			d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at,
+			w.id, w.url, w.secret
+		`,
+		now,
+		limit,
+		now.Add(lease),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	claimed := []ClaimedWebhookDelivery{}
+	for rows.Next() {
+		c := ClaimedWebhookDelivery{}
+		var eventType string
+		if err := rows.Scan(
+			&c.Delivery.ID,
+			&c.Delivery.WebhookID,
+			&c.Delivery.EventID,
+			&eventType,
+			&c.Delivery.Payload,
+			&c.Delivery.Status,
+			&c.Delivery.Attempts,
+			&c.Delivery.NextAttemptAt,
+			&c.Delivery.LastStatusCode,
+			&c.Delivery.LastError,
+			&c.Delivery.CreatedAt,
+			&c.Delivery.DeliveredAt,
+			&c.Webhook.ID,
+			&c.Webhook.URL,
+			&c.Webhook.Secret,
+		); err != nil {
+			return nil, err
+		}
+		if err := c.Delivery.EventType.UnmarshalText([]byte(eventType)); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return claimed, nil
+}
+
+// RecordWebhookAttempt adds a to the log of the delivery and saves its new state
+func (r *postgresRepository) RecordWebhookAttempt(ctx context.Context, d WebhookDelivery, a WebhookAttempt) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO webhook_attempts(delivery_id, attempted_at, status_code, error, duration_ms) VALUES ($1, $2, $3, $4, $5)",
+		d.ID,
+		a.AttemptedAt,
+		a.StatusCode,
+		a.Error,
+		a.Duration.Milliseconds(),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, next_attempt_at = $4, last_status_code = $5, last_error = $6, delivered_at = $7
+		WHERE id = $1
+		`,
+		d.ID,
+		d.Status,
+		d.Attempts,
+		d.NextAttemptAt,
+		d.LastStatusCode,
+		d.LastError,
+		d.DeliveredAt,
+	)
+	return err
+}
+
+// ResetWebhookDelivery makes a delivery pending and due at now, with no attempts made
+func (r *postgresRepository) ResetWebhookDelivery(ctx context.Context, id string, now time.Time) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		"UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = $2 WHERE id = $1",
+		id,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+
+	return nil
+}
+
+const webhookDeliveryQuery = `
+	SELECT
+		id,
+		webhook_id,
+		event_id,
+		event_type,
+		payload,
+		status,
+		attempts,
+		next_attempt_at,
+		last_status_code,
+		last_error,
+		created_at,
+		delivered_at
+	FROM webhook_deliveries
+	`
+
+func (r *postgresRepository) GetWebhookDeliveryByID(ctx context.Context, id string) (*WebhookDelivery, error) {
+	deliveries, err := r.getWebhookDeliveries(ctx, webhookDeliveryQuery+"WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deliveries) == 0 {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+
+	return &deliveries[0], nil
+}
+
+func (r *postgresRepository) GetWebhookDeliveries(ctx context.Context, webhookID string, skip uint64, take uint64) ([]WebhookDelivery, error) {
+	return r.getWebhookDeliveries(
+		ctx,
+		webhookDeliveryQuery+"WHERE webhook_id = $1 ORDER BY created_at DESC, id DESC OFFSET $2 LIMIT $3",
+		webhookID,
+		skip,
+		take,
+	)
+}
+
+// getWebhookDeliveries returns the deliveries found by query along with their attempts, oldest first
+func (r *postgresRepository) getWebhookDeliveries(ctx context.Context, query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	index := map[string]int{}
+	ids := []string{}
+	for rows.Next() {
+		d := WebhookDelivery{AttemptLog: []WebhookAttempt{}}
+		var eventType string
+		if err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.EventID,
+			&eventType,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.LastStatusCode,
+			&d.LastError,
+			&d.CreatedAt,
+			&d.DeliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := d.EventType.UnmarshalText([]byte(eventType)); err != nil {
+			return nil, err
+		}
+		index[d.ID] = len(deliveries)
+		ids = append(ids, d.ID)
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return deliveries, nil
+	}
+
+	attemptRows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT delivery_id, attempted_at, status_code, error, duration_ms
+		FROM webhook_attempts
+		WHERE delivery_id = ANY($1)
+		ORDER BY attempted_at
+		`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer attemptRows.Close()
+
+	for attemptRows.Next() {
+		var deliveryID string
+		var durationMs int64
+		a := WebhookAttempt{}
+		if err := attemptRows.Scan(&deliveryID, &a.AttemptedAt, &a.StatusCode, &a.Error, &durationMs); err != nil {
+			return nil, err
+		}
+		a.Duration = time.Duration(durationMs) * time.Millisecond
+		i := index[deliveryID]
+		deliveries[i].AttemptLog = append(deliveries[i].AttemptLog, a)
+	}
+
+	if err := attemptRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// PutNotification skips a notification of a kind already queued for the order
+func (r *postgresRepository) PutNotification(ctx context.Context, n Notification) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`
+		INSERT INTO order_notifications(id, order_id, kind, status, next_attempt_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (order_id, kind) DO NOTHING
+		`,
+		n.ID,
+		n.OrderID,
+		n.Kind,
+		n.Status,
+		n.NextAttemptAt,
+		n.CreatedAt,
+	)
+	return err
+}
+
+// ClaimNotifications returns up to limit pending notifications due at now,
+// and postpones them by lease so no other notifier sends them meanwhile
+func (r *postgresRepository) ClaimNotifications(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]Notification, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		WITH due AS (
+			SELECT id
+			FROM order_notifications
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE order_notifications n
+		SET next_attempt_at = $3
+		FROM due
+		WHERE n.id = due.id
+		RETURNING
+			n.id, n.order_id, n.kind, n.recipient, n.status, n.attempts,
+			n.next_attempt_at, n.last_error, n.created_at, n.sent_at
+		`,
+		now,
+		limit,
+		now.Add(lease),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	return scanNotifications(rows)
+}
+
+func (r *postgresRepository) UpdateNotification(ctx context.Context, n Notification) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`
+		UPDATE order_notifications
+		SET recipient = $2, status = $3, attempts = $4, next_attempt_at = $5, last_error = $6, sent_at = $7
+		WHERE id = $1
+		`,
+		n.ID,
+		n.Recipient,
+		n.Status,
+		n.Attempts,
+		n.NextAttemptAt,
+		n.LastError,
+		n.SentAt,
+	)
+	return err
+}
+
+const notificationQuery = `
+	SELECT
+		id,
+		order_id,
+		kind,
+		recipient,
+		status,
+		attempts,
+		next_attempt_at,
+		last_error,
+		created_at,
+		sent_at
+	FROM order_notifications
+	`
+
+func (r *postgresRepository) GetNotificationsForOrder(ctx context.Context, orderID string) ([]Notification, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		notificationQuery+"WHERE order_id = $1 ORDER BY created_at, id",
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	return scanNotifications(rows)
+}
+
+func scanNotifications(rows *sql.Rows) ([]Notification, error) {
+	notifications := []Notification{}
+	for rows.Next() {
+		n := Notification{}
+		if err := rows.Scan(
+			&n.ID,
+			&n.OrderID,
+			&n.Kind,
+			&n.Recipient,
+			&n.Status,
+			&n.Attempts,
+			&n.NextAttemptAt,
+			&n.LastError,
+			&n.CreatedAt,
+			&n.SentAt,
+		); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// PutInvoice stores the invoice issue returns for the next number, unless the
+// order already has one. The number is taken in the transaction storing the
+// invoice, which keeps other invoices waiting, so numbers have no gaps.
+func (r *postgresRepository) PutInvoice(ctx context.Context, orderID string, issue func(seq uint64) (Invoice, error)) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// Only committed once the invoice is stored
+	defer tx.Rollback()
+
+	var seq uint64
+	if err := tx.QueryRowContext(ctx, "UPDATE invoice_numbers SET last_seq = last_seq + 1 RETURNING last_seq").Scan(&seq); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM invoices WHERE order_id = $1)", orderID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	inv, err := issue(seq)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO invoices(order_id, seq, number, issued_at, html, pdf) VALUES ($1, $2, $3, $4, $5, $6)",
+		inv.OrderID,
+		seq,
+		inv.Number,
+		inv.IssuedAt,
+		string(inv.HTML),
+		inv.PDF,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepository) GetInvoice(ctx context.Context, orderID string) (*Invoice, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT order_id, number, issued_at, html, pdf FROM invoices WHERE order_id = $1", orderID)
+
+	inv := &Invoice{}
+	if err := row.Scan(&inv.OrderID, &inv.Number, &inv.IssuedAt, &inv.HTML, &inv.PDF); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+func (r *postgresRepository) PutSubscription(ctx context.Context, s Subscription) error {
+	products, err := json.Marshal(s.Products)
+	if err != nil {
+		return err
+	}
+	var shippingAddress []byte
+	if s.ShippingAddress != nil {
+		shippingAddress, err = json.Marshal(s.ShippingAddress)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = r.db.ExecContext(
+		ctx,
+		`
+		INSERT INTO subscriptions(id, account_id, products, shipping_address, run_interval, interval_count, next_run_at, status, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`,
+		s.ID,
+		s.AccountID,
+		string(products),
+		shippingAddress,
+		s.Interval,
+		s.IntervalCount,
+		s.NextRunAt,
+		s.Status,
+		s.CreatedAt,
+	)
+	return err
+}
+
+const subscriptionQuery = `
+	SELECT
+		id,
+		account_id,
+		products,
+		shipping_address,
+		run_interval,
+		interval_count,
+		next_run_at,
+		status,
+		created_at
+	FROM subscriptions
+	`
+
+func (r *postgresRepository) GetSubscriptionByID(ctx context.Context, id string) (*Subscription, error) {
+	subscriptions, err := r.getSubscriptions(ctx, subscriptionQuery+"WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subscriptions) == 0 {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return &subscriptions[0], nil
+}
+
+func (r *postgresRepository) GetSubscriptionsForAccount(ctx context.Context, accountID string) ([]Subscription, error) {
+	return r.getSubscriptions(ctx, subscriptionQuery+"WHERE account_id = $1 ORDER BY created_at, id", accountID)
+}
+
+// GetDueSubscriptions returns the active subscriptions due at now, without their runs
+func (r *postgresRepository) GetDueSubscriptions(ctx context.Context, now time.Time) ([]Subscription, error) {
+	rows, err := r.db.QueryContext(ctx, subscriptionQuery+"WHERE status = 'active' AND next_run_at <= $1 ORDER BY next_run_at", now)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSubscriptions(rows)
+}
+
+// getSubscriptions returns the subscriptions query selects along with their
+// latest runs
+func (r *postgresRepository) getSubscriptions(ctx context.Context, query string, arg string) ([]Subscription, error) {
+	rows, err := r.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions, err := scanSubscriptions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.attachSubscriptionRuns(ctx, subscriptions); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// attachSubscriptionRuns sets the last 10 runs of each subscription, newest first
+func (r *postgresRepository) attachSubscriptionRuns(ctx context.Context, subscriptions []Subscription) error {
+	ids := []string{}
+	index := map[string]int{}
+	for i, s := range subscriptions {
+		subscriptions[i].Runs = []SubscriptionRun{}
+		ids = append(ids, s.ID)
+		index[s.ID] = i
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT id, subscription_id, scheduled_for, status, order_id, attempts, next_attempt_at, last_error, created_at
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY subscription_id ORDER BY scheduled_for DESC) AS n
+			FROM subscription_runs
+			WHERE subscription_id = ANY($1)
+		) latest
+		WHERE n <= 10
+		ORDER BY scheduled_for DESC
+		`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var run SubscriptionRun
+		if err := scanSubscriptionRun(rows, &run); err != nil {
+			return err
+		}
+		i := index[run.SubscriptionID]
+		subscriptions[i].Runs = append(subscriptions[i].Runs, run)
+	}
+
+	return rows.Err()
+}
+
+func scanSubscriptions(rows *sql.Rows) ([]Subscription, error) {
+	defer rows.Close()
+
+	subscriptions := []Subscription{}
+	for rows.Next() {
+		var s Subscription
+		if err := scanSubscription(rows, &s); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// scanSubscription scans the columns of subscriptionQuery, and then dest
+func scanSubscription(rows *sql.Rows, s *Subscription, dest ...any) error {
+	var products, shippingAddress []byte
+	if err := rows.Scan(append([]any{
+		&s.ID,
+		&s.AccountID,
+		&products,
+		&shippingAddress,
+		&s.Interval,
+		&s.IntervalCount,
+		&s.NextRunAt,
+		&s.Status,
+		&s.CreatedAt,
+	}, dest...)...); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(products, &s.Products); err != nil {
+		return err
+	}
+	if shippingAddress != nil {
+		s.ShippingAddress = &Address{}
+		if err := json.Unmarshal(shippingAddress, s.ShippingAddress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanSubscriptionRun scans the columns of a run, and then dest
+func scanSubscriptionRun(rows *sql.Rows, run *SubscriptionRun, dest ...any) error {
+	return rows.Scan(append([]any{
+		&run.ID,
+		&run.SubscriptionID,
+		&run.ScheduledFor,
+		&run.Status,
+		&run.OrderID,
+		&run.Attempts,
+		&run.NextAttemptAt,
+		&run.LastError,
+		&run.CreatedAt,
+	}, dest...)...)
+}
+
+// UpdateSubscriptionStatus changes the status of a subscription still in
+// status from. Pending runs of subscriptions that are no longer active are
+// skipped.
+func (r *postgresRepository) UpdateSubscriptionStatus(ctx context.Context, id string, from SubscriptionStatus, to SubscriptionStatus, nextRunAt time.Time) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"UPDATE subscriptions SET status = $3, next_run_at = $4 WHERE id = $1 AND status = $2",
+		id,
+		from,
+		to,
+		nextRunAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%w: subscription is no longer %s", ErrInvalidSubscriptionStatus, from)
+	}
+
+	if to == SubscriptionActive {
+		return nil
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE subscription_runs SET status = $2, next_attempt_at = NULL, last_error = $3 WHERE subscription_id = $1 AND status = 'pending'",
+		id,
+		RunSkipped,
+		"subscription "+string(to),
+	)
+	return err
+}
+
+// PutSubscriptionRun skips a run of a subscription already queued for the same time
+func (r *postgresRepository) PutSubscriptionRun(ctx context.Context, run SubscriptionRun) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`
+		INSERT INTO subscription_runs(id, subscription_id, scheduled_for, status, next_attempt_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (subscription_id, scheduled_for) DO NOTHING
+		`,
+		run.ID,
+		run.SubscriptionID,
+		run.ScheduledFor,
+		run.Status,
+		run.NextAttemptAt,
+		run.CreatedAt,
+	)
+	return err
+}
+
+// ClaimSubscriptionRuns returns up to limit pending runs due at now, of
+// active subscriptions, and postpones them by lease so no other scheduler
+// places them meanwhile
+func (r *postgresRepository) ClaimSubscriptionRuns(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]ClaimedSubscriptionRun, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		WITH due AS (
+			SELECT sr.id
+			FROM subscription_runs sr
+			JOIN subscriptions s ON s.id = sr.subscription_id
+			WHERE sr.status = 'pending' AND sr.next_attempt_at <= $1 AND s.status = 'active'
+			ORDER BY sr.next_attempt_at
+			LIMIT $2
+			FOR UPDATE OF sr SKIP LOCKED
+		)
+		UPDATE subscription_runs sr
+		SET next_attempt_at = $3
+		FROM due, subscriptions s
+		WHERE sr.id = due.id AND s.id = sr.subscription_id
+		RETURNING
+			s.id, s.account_id, s.products, s.shipping_address, s.run_interval, s.interval_count,
+			s.next_run_at, s.status, s.created_at,
+			sr.id, sr.subscription_id, sr.scheduled_for, sr.status, sr.order_id, sr.attempts,
+			sr.next_attempt_at, sr.last_error, sr.created_at
+		`,
+		now,
+		limit,
+		now.Add(lease),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	claimed := []ClaimedSubscriptionRun{}
+	for rows.Next() {
+		c := ClaimedSubscriptionRun{}
+		if err := scanSubscription(
+			rows,
+			&c.Subscription,
+			&c.Run.ID,
+			&c.Run.SubscriptionID,
+			&c.Run.ScheduledFor,
+			&c.Run.Status,
+			&c.Run.OrderID,
+			&c.Run.Attempts,
+			&c.Run.NextAttemptAt,
+			&c.Run.LastError,
+			&c.Run.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return claimed, nil
+}
+
+// RecordSubscriptionRun saves the new state of a run. A subscription is only
+// moved on to nextRunAt while still active and scheduled for the run.
+func (r *postgresRepository) RecordSubscriptionRun(ctx context.Context, run SubscriptionRun, nextRunAt *time.Time) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`
+		UPDATE subscription_runs
+		SET status = $2, order_id = $3, attempts = $4, next_attempt_at = $5, last_error = $6
+		WHERE id = $1
+		`,
+		run.ID,
+		run.Status,
+		run.OrderID,
+		run.Attempts,
+		run.NextAttemptAt,
+		run.LastError,
+	)
+	if err != nil {
+		return err
+	}
+
+	if nextRunAt == nil {
+		return nil
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE subscriptions SET next_run_at = $2 WHERE id = $1 AND next_run_at = $3 AND status = 'active'",
+		run.SubscriptionID,
+		*nextRunAt,
+		run.ScheduledFor,
+	)
+	return err
 }
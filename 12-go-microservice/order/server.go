@@ -2,33 +2,40 @@ package order
 
 import (
 	"context"
+	_ "embed"
 	"errors"
 	"fmt"
 	"log"
 	"net"
+	"time"
 
 	"github.com/leminkhoa/go-grpc-graphql-microservice/account"
 	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
 	"github.com/leminkhoa/go-grpc-graphql-microservice/order/pb"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/rest"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type grpcServer struct {
 	pb.UnimplementedOrderServiceServer
 	service       Service
 	accountClient *account.Client
-	catalogClient *catalog.Client
+	productCache  *ProductCache
 }
 
-func ListenGRPC(s Service, accountURL, catalogURL string, port int) error {
+func ListenGRPC(s Service, accountURL, catalogURL string, rpc resilience.Config, cache ProductCacheConfig, port int) error {
 
-	accountClient, err := account.NewClient(accountURL)
+	accountClient, err := account.NewClient(accountURL, rpc)
 	if err != nil {
 		return err
 	}
 
-	catalogClient, err := catalog.NewClient(catalogURL)
+	catalogClient, err := catalog.NewClient(catalogURL, rpc)
 	if err != nil {
 		accountClient.Close()
 		return err
@@ -41,17 +48,30 @@ func ListenGRPC(s Service, accountURL, catalogURL string, port int) error {
 		return err
 	}
 
+	productCache := NewProductCache(catalogClient, cache)
+	productCache.Publish("product_cache")
+	go productCache.WatchInvalidations(context.Background())
+
 	serv := grpc.NewServer()
 	pb.RegisterOrderServiceServer(serv, &grpcServer{
 		service:       s,
 		accountClient: accountClient,
-		catalogClient: catalogClient,
+		productCache:  productCache,
 	})
 	reflection.Register(serv)
 	return serv.Serve(lis)
 
 }
 
+//go:embed pb/order.swagger.json
+var openAPI []byte
+
+// ListenHTTP serves the REST/JSON API, forwarding each request to the gRPC
+// server listening on grpcPort
+func ListenHTTP(grpcPort int, port int) error {
+	return rest.Listen(port, fmt.Sprintf("localhost:%d", grpcPort), openAPI, pb.RegisterOrderServiceHandlerFromEndpoint)
+}
+
 func (s *grpcServer) PostOrder(
 	ctx context.Context,
 	r *pb.PostOrderRequest,
@@ -76,8 +96,8 @@ func (s *grpcServer) PostOrder(
 
 	log.Printf("Fetching products with IDs: %v", productIDs)
 
-	// Retrieve product information from catalog client
-	products, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "")
+	// Retrieve product information from catalog
+	products, err := s.productCache.GetProducts(ctx, productIDs)
 	if err != nil {
 		log.Printf("Error getting products from catalog: %v", err)
 		return nil, errors.New("products not found")
@@ -88,43 +108,47 @@ func (s *grpcServer) PostOrder(
 		log.Printf("Catalog product: ID='%s', Name='%s', Price=%f", p.ID, p.Name, p.Price)
 	}
 
-	// Construct ordered products
-	orderedProducts := []OrderedProduct{}
+	productMap := map[string]catalog.Product{}
 	for _, p := range products {
-		log.Printf("Processing catalog product: '%s'", p.ID)
-
-		orderedProduct := OrderedProduct{
-			ID:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			Quantity:    0, // Place holder
-		}
-
-		for _, rp := range r.Products {
-			if rp.ProductId == p.ID {
-				orderedProduct.Quantity = rp.Quantity
-				log.Printf("Match found! Setting quantity to %d", rp.Quantity)
-				break
-			} else {
-				log.Printf("No match for product ID: '%s'", rp.ProductId)
-			}
+		productMap[p.ID] = p
+	}
+
+	// Construct ordered products, one line per product and variant
+	orderedProducts := []OrderedProduct{}
+	lines := map[lineKey]int{}
+	for _, rp := range r.Products {
+		p, ok := productMap[rp.ProductId]
+		if !ok || rp.Quantity == 0 {
+			log.Printf("Product '%s' is not in the catalog or has quantity 0, skipping", rp.ProductId)
+			continue
+		}
+
+		orderedProduct, err := newOrderedProduct(p, rp.VariantId)
+		if err != nil {
+			log.Printf("Error ordering product '%s': %v", p.ID, err)
+			return nil, orderError(err)
 		}
 
-		if orderedProduct.Quantity != 0 {
-			orderedProducts = append(orderedProducts, orderedProduct)
-			log.Printf("Added product '%s' with quantity %d", p.Name, orderedProduct.Quantity)
-		} else {
-			log.Printf("Product '%s' has quantity 0, skipping", p.Name)
+		key := lineKey{orderedProduct.ID, orderedProduct.VariantID}
+		if i, ok := lines[key]; ok {
+			orderedProducts[i].Quantity += rp.Quantity
+			continue
 		}
+		orderedProduct.Quantity = rp.Quantity
+		lines[key] = len(orderedProducts)
+		orderedProducts = append(orderedProducts, orderedProduct)
+		log.Printf("Added product '%s' variant '%s' with quantity %d", p.Name, orderedProduct.VariantID, rp.Quantity)
 	}
 
 	log.Printf("Final ordered products count: %d", len(orderedProducts))
 
 	// Call order service implementation
-	order, err := s.service.PostOrder(ctx, r.AccountId, orderedProducts)
+	order, err := s.service.PostOrder(ctx, r.AccountId, orderedProducts, addressFromProto(r.ShippingAddress), r.CouponCode, r.IdempotencyKey)
 	if err != nil {
 		log.Printf("Error posting order: %v", err)
+		if errors.Is(err, ErrCouponNotApplicable) || errors.Is(err, ErrCouponUsageLimitExceeded) {
+			return nil, orderError(err)
+		}
 		return nil, errors.New("could not post order")
 	}
 
@@ -136,20 +160,23 @@ func (s *grpcServer) PostOrder(
 
 	// Make response order
 	orderProto := &pb.Order{
-		Id:         order.ID,
-		AccountId:  order.AccountID,
-		TotalPrice: order.TotalPrice,
-		Products:   []*pb.Order_OrderProduct{},
+		Id:              order.ID,
+		AccountId:       order.AccountID,
+		TotalPrice:      order.TotalPrice,
+		PaymentStatus:   string(order.PaymentStatus),
+		ShippingAddress: addressToProto(order.ShippingAddress),
+		Products:        []*pb.Order_OrderProduct{},
+		Discounts:       discountsToProto(order.Discounts),
+		Subtotal:        order.Subtotal,
+		TaxTotal:        order.TaxTotal,
+		TaxInclusive:    order.TaxInclusive,
+		TaxJurisdiction: order.TaxJurisdiction,
+		Taxes:           taxesToProto(order.Taxes),
+		Shipments:       []*pb.Shipment{},
 	}
 	orderProto.CreatedAt, _ = order.CreatedAt.MarshalBinary()
 	for _, p := range order.Products {
-		orderProto.Products = append(orderProto.Products, &pb.Order_OrderProduct{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			Quantity:    p.Quantity,
-		})
+		orderProto.Products = append(orderProto.Products, orderedProductToProto(p))
 	}
 
 	log.Printf("Final response has %d products", len(orderProto.Products))
@@ -160,6 +187,466 @@ func (s *grpcServer) PostOrder(
 
 }
 
+func (s *grpcServer) GetOrder(ctx context.Context, r *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {
+	o, err := s.service.GetOrder(ctx, r.Id)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	orders, err := s.enrichOrders(ctx, []Order{*o})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetOrderResponse{
+		Order: orders[0],
+	}, nil
+}
+
+// UpdatePaymentStatus is called by the payment service as payments are captured and refunded
+func (s *grpcServer) UpdatePaymentStatus(ctx context.Context, r *pb.UpdatePaymentStatusRequest) (*pb.UpdatePaymentStatusResponse, error) {
+	o, err := s.service.UpdatePaymentStatus(ctx, r.OrderId, PaymentStatus(r.PaymentStatus))
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	orders, err := s.enrichOrders(ctx, []Order{*o})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdatePaymentStatusResponse{
+		Order: orders[0],
+	}, nil
+}
+
+func (s *grpcServer) CreateShipment(ctx context.Context, r *pb.CreateShipmentRequest) (*pb.CreateShipmentResponse, error) {
+	items := []ShipmentItem{}
+	for _, item := range r.Items {
+		items = append(items, ShipmentItem{
+			ProductID: item.ProductId,
+			VariantID: item.VariantId,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	shipment, err := s.service.CreateShipment(ctx, r.OrderId, r.Carrier, r.TrackingNumber, items)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.CreateShipmentResponse{
+		Shipment: shipmentToProto(shipment),
+	}, nil
+}
+
+func (s *grpcServer) UpdateShipment(ctx context.Context, r *pb.UpdateShipmentRequest) (*pb.UpdateShipmentResponse, error) {
+	shipment, err := s.service.UpdateShipment(ctx, r.ShipmentId, r.Carrier, r.TrackingNumber, ShipmentStatus(r.Status))
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.UpdateShipmentResponse{
+		Shipment: shipmentToProto(shipment),
+	}, nil
+}
+
+func (s *grpcServer) CreatePromotion(ctx context.Context, r *pb.CreatePromotionRequest) (*pb.CreatePromotionResponse, error) {
+	p, err := s.service.CreatePromotion(ctx, *promotionFromProto(r.Promotion))
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.CreatePromotionResponse{
+		Promotion: promotionToProto(p),
+	}, nil
+}
+
+func (s *grpcServer) UpdatePromotion(ctx context.Context, r *pb.UpdatePromotionRequest) (*pb.UpdatePromotionResponse, error) {
+	p, err := s.service.UpdatePromotion(ctx, *promotionFromProto(r.Promotion))
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.UpdatePromotionResponse{
+		Promotion: promotionToProto(p),
+	}, nil
+}
+
+func (s *grpcServer) GetPromotions(ctx context.Context, r *pb.GetPromotionsRequest) (*pb.GetPromotionsResponse, error) {
+	promotions, err := s.service.GetPromotions(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	res := &pb.GetPromotionsResponse{Promotions: []*pb.Promotion{}}
+	for i := range promotions {
+		res.Promotions = append(res.Promotions, promotionToProto(&promotions[i]))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) GetSalesReport(ctx context.Context, r *pb.GetSalesReportRequest) (*pb.GetSalesReportResponse, error) {
+	from, to := time.Time{}, time.Time{}
+	from.UnmarshalBinary(r.From)
+	to.UnmarshalBinary(r.To)
+
+	report, err := s.service.GetSalesReport(ctx, from, to, ReportInterval(r.Interval))
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	res := &pb.GetSalesReportResponse{
+		Buckets:           []*pb.SalesBucket{},
+		OrderCount:        report.OrderCount,
+		Revenue:           report.Revenue,
+		AverageOrderValue: report.AverageOrderValue,
+	}
+	for _, b := range report.Buckets {
+		bucket := &pb.SalesBucket{
+			OrderCount:        b.OrderCount,
+			Revenue:           b.Revenue,
+			AverageOrderValue: b.AverageOrderValue,
+		}
+		bucket.Start, _ = b.Start.MarshalBinary()
+		res.Buckets = append(res.Buckets, bucket)
+	}
+	return res, nil
+}
+
+func (s *grpcServer) GetTopProducts(ctx context.Context, r *pb.GetTopProductsRequest) (*pb.GetTopProductsResponse, error) {
+	from, to := time.Time{}, time.Time{}
+	from.UnmarshalBinary(r.From)
+	to.UnmarshalBinary(r.To)
+
+	products, err := s.service.GetTopProducts(ctx, from, to, ProductRanking(r.OrderBy), r.Limit)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	// Names come from the catalog, a report is still useful without them
+	productIDs := []string{}
+	for _, p := range products {
+		productIDs = append(productIDs, p.ProductID)
+	}
+	names := map[string]string{}
+	if len(productIDs) > 0 {
+		catalogProducts, err := s.productCache.GetProducts(ctx, productIDs)
+		if err != nil {
+			log.Printf("Error getting products from catalog: %v", err)
+		}
+		for _, p := range catalogProducts {
+			names[p.ID] = p.Name
+		}
+	}
+
+	res := &pb.GetTopProductsResponse{Products: []*pb.ProductSales{}}
+	for _, p := range products {
+		res.Products = append(res.Products, &pb.ProductSales{
+			ProductId:  p.ProductID,
+			Name:       names[p.ProductID],
+			Quantity:   p.Quantity,
+			Revenue:    p.Revenue,
+			OrderCount: p.OrderCount,
+		})
+	}
+	return res, nil
+}
+
+func (s *grpcServer) GetAccountValues(ctx context.Context, r *pb.GetAccountValuesRequest) (*pb.GetAccountValuesResponse, error) {
+	accounts, err := s.service.GetAccountValues(ctx, r.AccountIds, r.Limit)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	res := &pb.GetAccountValuesResponse{Accounts: []*pb.AccountValue{}}
+	for _, a := range accounts {
+		account := &pb.AccountValue{
+			AccountId:         a.AccountID,
+			OrderCount:        a.OrderCount,
+			LifetimeValue:     a.LifetimeValue,
+			AverageOrderValue: a.AverageOrderValue,
+		}
+		account.FirstOrderAt, _ = a.FirstOrderAt.MarshalBinary()
+		account.LastOrderAt, _ = a.LastOrderAt.MarshalBinary()
+		res.Accounts = append(res.Accounts, account)
+	}
+	return res, nil
+}
+
+func (s *grpcServer) GetRecommendations(ctx context.Context, r *pb.GetRecommendationsRequest) (*pb.GetRecommendationsResponse, error) {
+	recommendations, err := s.service.GetRecommendations(ctx, r.ProductId, r.Limit)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	res := &pb.GetRecommendationsResponse{Recommendations: []*pb.Recommendation{}}
+	for _, rec := range recommendations {
+		res.Recommendations = append(res.Recommendations, &pb.Recommendation{
+			ProductId: rec.ProductID,
+			Score:     rec.Score,
+		})
+	}
+	return res, nil
+}
+
+func (s *grpcServer) CreateWebhook(ctx context.Context, r *pb.CreateWebhookRequest) (*pb.CreateWebhookResponse, error) {
+	w, err := webhookFromProto(r.Webhook)
+	if err != nil {
+		return nil, orderError(err)
+	}
+
+	w, err = s.service.CreateWebhook(ctx, *w)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.CreateWebhookResponse{Webhook: webhookToProto(w)}, nil
+}
+
+func (s *grpcServer) UpdateWebhook(ctx context.Context, r *pb.UpdateWebhookRequest) (*pb.UpdateWebhookResponse, error) {
+	w, err := webhookFromProto(r.Webhook)
+	if err != nil {
+		return nil, orderError(err)
+	}
+
+	w, err = s.service.UpdateWebhook(ctx, *w)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.UpdateWebhookResponse{Webhook: webhookToProto(w)}, nil
+}
+
+func (s *grpcServer) DeleteWebhook(ctx context.Context, r *pb.DeleteWebhookRequest) (*pb.DeleteWebhookResponse, error) {
+	if err := s.service.DeleteWebhook(ctx, r.Id); err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.DeleteWebhookResponse{}, nil
+}
+
+func (s *grpcServer) GetWebhooks(ctx context.Context, r *pb.GetWebhooksRequest) (*pb.GetWebhooksResponse, error) {
+	webhooks, err := s.service.GetWebhooks(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	res := &pb.GetWebhooksResponse{Webhooks: []*pb.Webhook{}}
+	for i := range webhooks {
+		res.Webhooks = append(res.Webhooks, webhookToProto(&webhooks[i]))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) GetWebhookDeliveries(ctx context.Context, r *pb.GetWebhookDeliveriesRequest) (*pb.GetWebhookDeliveriesResponse, error) {
+	deliveries, err := s.service.GetWebhookDeliveries(ctx, r.WebhookId, r.Skip, r.Take)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	res := &pb.GetWebhookDeliveriesResponse{Deliveries: []*pb.WebhookDelivery{}}
+	for i := range deliveries {
+		res.Deliveries = append(res.Deliveries, webhookDeliveryToProto(&deliveries[i]))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) RedeliverWebhook(ctx context.Context, r *pb.RedeliverWebhookRequest) (*pb.RedeliverWebhookResponse, error) {
+	d, err := s.service.RedeliverWebhook(ctx, r.DeliveryId)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.RedeliverWebhookResponse{Delivery: webhookDeliveryToProto(d)}, nil
+}
+
+func (s *grpcServer) GetOrderNotifications(ctx context.Context, r *pb.GetOrderNotificationsRequest) (*pb.GetOrderNotificationsResponse, error) {
+	notifications, err := s.service.GetOrderNotifications(ctx, r.OrderId)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	res := &pb.GetOrderNotificationsResponse{Notifications: []*pb.OrderNotification{}}
+	for i := range notifications {
+		res.Notifications = append(res.Notifications, notificationToProto(&notifications[i]))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) GetInvoice(ctx context.Context, r *pb.GetInvoiceRequest) (*pb.GetInvoiceResponse, error) {
+	inv, err := s.service.GetInvoice(ctx, r.OrderId)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	res := &pb.Invoice{
+		OrderId: inv.OrderID,
+		Number:  inv.Number,
+		Html:    string(inv.HTML),
+		Pdf:     inv.PDF,
+	}
+	res.IssuedAt, _ = inv.IssuedAt.MarshalBinary()
+
+	return &pb.GetInvoiceResponse{Invoice: res}, nil
+}
+
+func (s *grpcServer) CreateSubscription(ctx context.Context, r *pb.CreateSubscriptionRequest) (*pb.CreateSubscriptionResponse, error) {
+	sub := subscriptionFromProto(r.GetSubscription())
+	if _, err := s.accountClient.GetAccount(ctx, sub.AccountID); err != nil {
+		log.Printf("Error getting account %s: %v", sub.AccountID, err)
+		return nil, status.Error(codes.NotFound, "account not found")
+	}
+
+	// Orders are priced when placed, the products only need to be orderable now
+	productIDs := []string{}
+	for _, p := range sub.Products {
+		productIDs = append(productIDs, p.ProductID)
+	}
+	products, err := s.productCache.GetProducts(ctx, productIDs)
+	if err != nil {
+		log.Printf("Error getting products from catalog: %v", err)
+		return nil, err
+	}
+	productMap := map[string]catalog.Product{}
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+	for _, item := range sub.Products {
+		p, ok := productMap[item.ProductID]
+		if !ok {
+			return nil, orderError(fmt.Errorf("%w: product %s is not in the catalog", ErrInvalidSubscription, item.ProductID))
+		}
+		if _, err := newOrderedProduct(p, item.VariantID); err != nil {
+			return nil, orderError(err)
+		}
+	}
+
+	created, err := s.service.CreateSubscription(ctx, sub)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.CreateSubscriptionResponse{Subscription: subscriptionToProto(created)}, nil
+}
+
+func (s *grpcServer) GetSubscription(ctx context.Context, r *pb.GetSubscriptionRequest) (*pb.GetSubscriptionResponse, error) {
+	sub, err := s.service.GetSubscription(ctx, r.Id)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.GetSubscriptionResponse{Subscription: subscriptionToProto(sub)}, nil
+}
+
+func (s *grpcServer) GetSubscriptionsForAccount(ctx context.Context, r *pb.GetSubscriptionsForAccountRequest) (*pb.GetSubscriptionsForAccountResponse, error) {
+	subscriptions, err := s.service.GetSubscriptionsForAccount(ctx, r.AccountId)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	res := &pb.GetSubscriptionsForAccountResponse{Subscriptions: []*pb.OrderSubscription{}}
+	for _, sub := range subscriptions {
+		res.Subscriptions = append(res.Subscriptions, subscriptionToProto(&sub))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) PauseSubscription(ctx context.Context, r *pb.UpdateSubscriptionStatusRequest) (*pb.UpdateSubscriptionStatusResponse, error) {
+	return updateSubscriptionStatus(ctx, r.Id, s.service.PauseSubscription)
+}
+
+func (s *grpcServer) ResumeSubscription(ctx context.Context, r *pb.UpdateSubscriptionStatusRequest) (*pb.UpdateSubscriptionStatusResponse, error) {
+	return updateSubscriptionStatus(ctx, r.Id, s.service.ResumeSubscription)
+}
+
+func (s *grpcServer) CancelSubscription(ctx context.Context, r *pb.UpdateSubscriptionStatusRequest) (*pb.UpdateSubscriptionStatusResponse, error) {
+	return updateSubscriptionStatus(ctx, r.Id, s.service.CancelSubscription)
+}
+
+func updateSubscriptionStatus(ctx context.Context, id string, update func(ctx context.Context, id string) (*Subscription, error)) (*pb.UpdateSubscriptionStatusResponse, error) {
+	sub, err := update(ctx, id)
+	if err != nil {
+		log.Println(err)
+		return nil, orderError(err)
+	}
+
+	return &pb.UpdateSubscriptionStatusResponse{Subscription: subscriptionToProto(sub)}, nil
+}
+
+func (s *grpcServer) WatchOrderEvents(r *pb.WatchOrderEventsRequest, stream pb.OrderService_WatchOrderEventsServer) error {
+	events, unsubscribe := s.service.SubscribeOrderEvents()
+	defer unsubscribe()
+
+	// Tell the client it is subscribed, so it knows no later event is missed
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "subscriber fell behind")
+			}
+			if r.AccountId != "" && e.AccountID != r.AccountId {
+				continue
+			}
+
+			event := &pb.OrderEvent{
+				Type:           pb.OrderEvent_Type(e.Type),
+				OrderId:        e.OrderID,
+				AccountId:      e.AccountID,
+				TotalPrice:     e.TotalPrice,
+				PaymentStatus:  string(e.PaymentStatus),
+				ShipmentId:     e.ShipmentID,
+				ShipmentStatus: string(e.ShipmentStatus),
+			}
+			event.OccurredAt, _ = e.OccurredAt.MarshalBinary()
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func orderError(err error) error {
+	switch {
+	case errors.Is(err, ErrOrderNotFound), errors.Is(err, ErrShipmentNotFound), errors.Is(err, ErrPromotionNotFound), errors.Is(err, ErrWebhookNotFound), errors.Is(err, ErrWebhookDeliveryNotFound), errors.Is(err, ErrInvoiceNotFound), errors.Is(err, ErrSubscriptionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidPaymentStatus), errors.Is(err, ErrInvalidShipmentItem), errors.Is(err, ErrInvalidShipmentStatus), errors.Is(err, ErrInvalidPromotion), errors.Is(err, ErrInvalidReport), errors.Is(err, ErrInvalidVariant), errors.Is(err, ErrInvalidWebhook), errors.Is(err, ErrInvalidSubscription):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrOrderNotPaid), errors.Is(err, ErrNothingToShip), errors.Is(err, ErrCouponNotApplicable), errors.Is(err, ErrCouponUsageLimitExceeded), errors.Is(err, ErrInvalidSubscriptionStatus), errors.Is(err, ErrPaymentStatusChange):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return err
+	}
+}
+
 func (s *grpcServer) GetOrdersForAccount(ctx context.Context, r *pb.GetOrdersForAccountRequest) (*pb.GetOrdersForAccountResponse, error) {
 	accountOrders, err := s.service.GetOrdersForAccount(ctx, r.AccountId)
 	if err != nil {
@@ -167,6 +654,38 @@ func (s *grpcServer) GetOrdersForAccount(ctx context.Context, r *pb.GetOrdersFor
 		return nil, err
 	}
 
+	orders, err := s.enrichOrders(ctx, accountOrders)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetOrdersForAccountResponse{
+		Orders: orders,
+	}, nil
+
+}
+
+func (s *grpcServer) GetOrdersForAccountPage(ctx context.Context, r *pb.GetOrdersForAccountPageRequest) (*pb.GetOrdersForAccountPageResponse, error) {
+	page, err := s.service.GetOrdersForAccountPage(ctx, r.AccountId, r.After, r.First)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	orders, err := s.enrichOrders(ctx, page.Orders)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetOrdersForAccountPageResponse{
+		Orders:      orders,
+		TotalCount:  page.TotalCount,
+		HasNextPage: page.HasNextPage,
+	}, nil
+}
+
+// enrichOrders fills in product details from the catalog, as the order database only keeps product IDs
+func (s *grpcServer) enrichOrders(ctx context.Context, accountOrders []Order) ([]*pb.Order, error) {
 	// Construct a map to find unique product id only
 	productIDMap := map[string]bool{}
 	for _, o := range accountOrders {
@@ -181,47 +700,301 @@ func (s *grpcServer) GetOrdersForAccount(ctx context.Context, r *pb.GetOrdersFor
 		productIDs = append(productIDs, id)
 	}
 
-	// Retrieve product information from the product client
-	products, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "")
+	// Retrieve product information from the catalog
+	products, err := s.productCache.GetProducts(ctx, productIDs)
 	if err != nil {
 		log.Println("Error getting account products ", err)
 		return nil, err
 	}
 
-	order := []*pb.Order{}
+	orders := []*pb.Order{}
 	for _, o := range accountOrders {
 		op := &pb.Order{
-			Id:         o.ID,
-			TotalPrice: o.TotalPrice,
-			Products:   []*pb.Order_OrderProduct{},
+			Id:              o.ID,
+			AccountId:       o.AccountID,
+			TotalPrice:      o.TotalPrice,
+			PaymentStatus:   string(o.PaymentStatus),
+			ShippingAddress: addressToProto(o.ShippingAddress),
+			Products:        []*pb.Order_OrderProduct{},
+			Discounts:       discountsToProto(o.Discounts),
+			Subtotal:        o.Subtotal,
+			TaxTotal:        o.TaxTotal,
+			TaxInclusive:    o.TaxInclusive,
+			TaxJurisdiction: o.TaxJurisdiction,
+			Taxes:           taxesToProto(o.Taxes),
+			Shipments:       []*pb.Shipment{},
+		}
+		for i := range o.Shipments {
+			op.Shipments = append(op.Shipments, shipmentToProto(&o.Shipments[i]))
 		}
 		op.CreatedAt, _ = o.CreatedAt.MarshalBinary()
 
-		// Mapping
+		// Names come from the catalog, the price and variant were stored with the order
 		for _, product := range o.Products {
 			for _, p := range products {
 				if product.ID == p.ID {
 					product.Name = p.Name
 					product.Description = p.Description
-					product.Price = p.Price
 				}
 			}
-			op.Products = append(op.Products, &pb.Order_OrderProduct{
-				Id:          product.ID,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				Quantity:    product.Quantity,
-			})
+			op.Products = append(op.Products, orderedProductToProto(product))
 		}
 
 		// Append each order protobuf to the list
-		order = append(order, op)
+		orders = append(orders, op)
 
 	}
 
-	return &pb.GetOrdersForAccountResponse{
-		Orders: order,
-	}, nil
+	return orders, nil
+}
+
+func addressToProto(a *Address) *pb.Address {
+	if a == nil {
+		return nil
+	}
+
+	return &pb.Address{
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		State:      a.State,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+// newOrderedProduct snapshots the product, or its variant when it has
+// variants, into an order line
+func newOrderedProduct(p catalog.Product, variantID string) (OrderedProduct, error) {
+	res := OrderedProduct{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		TaxCategory: p.TaxCategory,
+	}
+
+	if len(p.Variants) == 0 {
+		if variantID != "" {
+			return res, fmt.Errorf("%w: %s has no variants", ErrInvalidVariant, p.ID)
+		}
+		return res, nil
+	}
+
+	v, ok := p.Variant(variantID)
+	if !ok {
+		return res, fmt.Errorf("%w: %q is not a variant of %s", ErrInvalidVariant, variantID, p.ID)
+	}
+	res.VariantID = v.ID
+	res.SKU = v.SKU
+	res.Price = v.Price
+	for _, o := range v.Options {
+		res.Options = append(res.Options, VariantOption{Name: o.Name, Value: o.Value})
+	}
+	return res, nil
+}
+
+func orderedProductToProto(p OrderedProduct) *pb.Order_OrderProduct {
+	res := &pb.Order_OrderProduct{
+		Id:          p.ID,
+		VariantId:   p.VariantID,
+		Sku:         p.SKU,
+		Options:     []*pb.Order_OrderProduct_VariantOption{},
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		Quantity:    p.Quantity,
+	}
+	for _, o := range p.Options {
+		res.Options = append(res.Options, &pb.Order_OrderProduct_VariantOption{Name: o.Name, Value: o.Value})
+	}
+	return res
+}
+
+func shipmentToProto(s *Shipment) *pb.Shipment {
+	res := &pb.Shipment{
+		Id:             s.ID,
+		OrderId:        s.OrderID,
+		Carrier:        s.Carrier,
+		TrackingNumber: s.TrackingNumber,
+		Status:         string(s.Status),
+		Items:          []*pb.Shipment_ShipmentItem{},
+	}
+	res.CreatedAt, _ = s.CreatedAt.MarshalBinary()
+	if s.ShippedAt != nil {
+		res.ShippedAt, _ = s.ShippedAt.MarshalBinary()
+	}
+	if s.DeliveredAt != nil {
+		res.DeliveredAt, _ = s.DeliveredAt.MarshalBinary()
+	}
+
+	for _, item := range s.Items {
+		res.Items = append(res.Items, &pb.Shipment_ShipmentItem{
+			ProductId: item.ProductID,
+			VariantId: item.VariantID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	return res
+}
+
+func discountsToProto(discounts []Discount) []*pb.Discount {
+	res := []*pb.Discount{}
+	for _, d := range discounts {
+		res = append(res, &pb.Discount{
+			PromotionId: d.PromotionID,
+			Code:        d.Code,
+			ProductId:   d.ProductID,
+			Description: d.Description,
+			Amount:      d.Amount,
+		})
+	}
+	return res
+}
+
+func taxesToProto(taxes []TaxLine) []*pb.TaxLine {
+	res := []*pb.TaxLine{}
+	for _, t := range taxes {
+		res = append(res, &pb.TaxLine{
+			ProductId:     t.ProductID,
+			Category:      t.Category,
+			Rate:          t.Rate,
+			TaxableAmount: t.TaxableAmount,
+			Amount:        t.Amount,
+		})
+	}
+	return res
+}
+
+func promotionToProto(p *Promotion) *pb.Promotion {
+	res := &pb.Promotion{
+		Id:                   p.ID,
+		Code:                 p.Code,
+		Description:          p.Description,
+		Type:                 string(p.Type),
+		Value:                p.Value,
+		BuyQuantity:          p.BuyQuantity,
+		GetQuantity:          p.GetQuantity,
+		ProductIds:           p.ProductIDs,
+		MinSpend:             p.MinSpend,
+		UsageLimitPerAccount: p.UsageLimitPerAccount,
+		Active:               p.Active,
+	}
+	res.CreatedAt, _ = p.CreatedAt.MarshalBinary()
+	if p.StartsAt != nil {
+		res.StartsAt, _ = p.StartsAt.MarshalBinary()
+	}
+	if p.EndsAt != nil {
+		res.EndsAt, _ = p.EndsAt.MarshalBinary()
+	}
+
+	return res
+}
+
+func webhookToProto(w *Webhook) *pb.Webhook {
+	res := &pb.Webhook{
+		Id:         w.ID,
+		Url:        w.URL,
+		EventTypes: eventTypeNames(w.EventTypes),
+		Secret:     w.Secret,
+		Active:     w.Active,
+	}
+	res.CreatedAt, _ = w.CreatedAt.MarshalBinary()
+
+	return res
+}
+
+func webhookDeliveryToProto(d *WebhookDelivery) *pb.WebhookDelivery {
+	res := &pb.WebhookDelivery{
+		Id:             d.ID,
+		WebhookId:      d.WebhookID,
+		EventId:        d.EventID,
+		EventType:      d.EventType.String(),
+		Payload:        string(d.Payload),
+		Status:         string(d.Status),
+		Attempts:       d.Attempts,
+		LastStatusCode: int32(d.LastStatusCode),
+		LastError:      d.LastError,
+		AttemptLog:     []*pb.WebhookDelivery_Attempt{},
+	}
+	res.CreatedAt, _ = d.CreatedAt.MarshalBinary()
+	if d.NextAttemptAt != nil {
+		res.NextAttemptAt, _ = d.NextAttemptAt.MarshalBinary()
+	}
+	if d.DeliveredAt != nil {
+		res.DeliveredAt, _ = d.DeliveredAt.MarshalBinary()
+	}
+	for _, a := range d.AttemptLog {
+		attempt := &pb.WebhookDelivery_Attempt{
+			StatusCode: int32(a.StatusCode),
+			Error:      a.Error,
+			DurationMs: uint32(a.Duration.Milliseconds()),
+		}
+		attempt.AttemptedAt, _ = a.AttemptedAt.MarshalBinary()
+		res.AttemptLog = append(res.AttemptLog, attempt)
+	}
+
+	return res
+}
+
+func notificationToProto(n *Notification) *pb.OrderNotification {
+	res := &pb.OrderNotification{
+		Id:        n.ID,
+		OrderId:   n.OrderID,
+		Kind:      string(n.Kind),
+		Recipient: n.Recipient,
+		Status:    string(n.Status),
+		Attempts:  n.Attempts,
+		LastError: n.LastError,
+	}
+	res.CreatedAt, _ = n.CreatedAt.MarshalBinary()
+	if n.NextAttemptAt != nil {
+		res.NextAttemptAt, _ = n.NextAttemptAt.MarshalBinary()
+	}
+	if n.SentAt != nil {
+		res.SentAt, _ = n.SentAt.MarshalBinary()
+	}
+
+	return res
+}
+
+func subscriptionToProto(sub *Subscription) *pb.OrderSubscription {
+	res := &pb.OrderSubscription{
+		Id:              sub.ID,
+		AccountId:       sub.AccountID,
+		Products:        []*pb.OrderSubscription_Item{},
+		ShippingAddress: addressToProto(sub.ShippingAddress),
+		Interval:        string(sub.Interval),
+		IntervalCount:   sub.IntervalCount,
+		Status:          string(sub.Status),
+		Runs:            []*pb.OrderSubscription_Run{},
+	}
+	res.NextRunAt, _ = sub.NextRunAt.MarshalBinary()
+	res.CreatedAt, _ = sub.CreatedAt.MarshalBinary()
+	for _, p := range sub.Products {
+		res.Products = append(res.Products, &pb.OrderSubscription_Item{
+			ProductId: p.ProductID,
+			VariantId: p.VariantID,
+			Quantity:  p.Quantity,
+		})
+	}
+	for _, run := range sub.Runs {
+		r := &pb.OrderSubscription_Run{
+			Id:        run.ID,
+			Status:    string(run.Status),
+			OrderId:   run.OrderID,
+			Attempts:  run.Attempts,
+			LastError: run.LastError,
+		}
+		r.ScheduledFor, _ = run.ScheduledFor.MarshalBinary()
+		r.CreatedAt, _ = run.CreatedAt.MarshalBinary()
+		if run.NextAttemptAt != nil {
+			r.NextAttemptAt, _ = run.NextAttemptAt.MarshalBinary()
+		}
+		res.Runs = append(res.Runs, r)
+	}
 
+	return res
 }
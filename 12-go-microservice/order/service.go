@@ -2,59 +2,749 @@ package order
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/segmentio/ksuid"
 )
 
 type Service interface {
-	PostOrder(ctx context.Context, accountID string, products []OrderedProduct) (*Order, error)
+	PostOrder(ctx context.Context, accountID string, products []OrderedProduct, shippingAddress *Address, couponCode string, idempotencyKey string) (*Order, error)
+	GetOrder(ctx context.Context, id string) (*Order, error)
+	UpdatePaymentStatus(ctx context.Context, id string, status PaymentStatus) (*Order, error)
 	GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error)
+	GetOrdersForAccountPage(ctx context.Context, accountID string, after string, first uint64) (*OrderPage, error)
+	CreateShipment(ctx context.Context, orderID string, carrier string, trackingNumber string, items []ShipmentItem) (*Shipment, error)
+	UpdateShipment(ctx context.Context, id string, carrier string, trackingNumber string, status ShipmentStatus) (*Shipment, error)
+	CreatePromotion(ctx context.Context, p Promotion) (*Promotion, error)
+	UpdatePromotion(ctx context.Context, p Promotion) (*Promotion, error)
+	GetPromotions(ctx context.Context) ([]Promotion, error)
+	GetSalesReport(ctx context.Context, from time.Time, to time.Time, interval ReportInterval) (*SalesReport, error)
+	GetTopProducts(ctx context.Context, from time.Time, to time.Time, by ProductRanking, limit uint32) ([]ProductSales, error)
+	GetAccountValues(ctx context.Context, accountIDs []string, limit uint32) ([]AccountValue, error)
+	GetRecommendations(ctx context.Context, productID string, limit uint32) ([]Recommendation, error)
+	CreateWebhook(ctx context.Context, w Webhook) (*Webhook, error)
+	UpdateWebhook(ctx context.Context, w Webhook) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	GetWebhooks(ctx context.Context) ([]Webhook, error)
+	GetWebhookDeliveries(ctx context.Context, webhookID string, skip uint64, take uint64) ([]WebhookDelivery, error)
+	RedeliverWebhook(ctx context.Context, deliveryID string) (*WebhookDelivery, error)
+	GetOrderNotifications(ctx context.Context, orderID string) ([]Notification, error)
+	GetInvoice(ctx context.Context, orderID string) (*Invoice, error)
+	CreateSubscription(ctx context.Context, sub Subscription) (*Subscription, error)
+	GetSubscription(ctx context.Context, id string) (*Subscription, error)
+	GetSubscriptionsForAccount(ctx context.Context, accountID string) ([]Subscription, error)
+	PauseSubscription(ctx context.Context, id string) (*Subscription, error)
+	ResumeSubscription(ctx context.Context, id string) (*Subscription, error)
+	CancelSubscription(ctx context.Context, id string) (*Subscription, error)
+	SubscribeOrderEvents() (<-chan OrderEvent, func())
 }
 
+var (
+	ErrInvalidPaymentStatus  = errors.New("invalid payment status")
+	ErrPaymentStatusChange   = errors.New("payment status only moves from pending to paid to refunded")
+	ErrOrderNotPaid          = errors.New("order is not paid")
+	ErrNothingToShip         = errors.New("every item of the order was already shipped")
+	ErrInvalidShipmentItem   = errors.New("shipment item is repeated, not part of the order or exceeds its unshipped quantity")
+	ErrInvalidShipmentStatus = errors.New("invalid shipment status")
+	ErrInvalidVariant        = errors.New("products with variants are ordered through one of their variants, other products without one")
+)
+
+// PaymentStatus tracks the payment of an order. An order is only paid once
+// the payment service has captured its payment.
+type PaymentStatus string
+
+const (
+	PaymentPending  PaymentStatus = "pending"
+	PaymentPaid     PaymentStatus = "paid"
+	PaymentRefunded PaymentStatus = "refunded"
+)
+
+func (s PaymentStatus) Valid() bool {
+	switch s {
+	case PaymentPending, PaymentPaid, PaymentRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
+// next reports whether an order may move from s to status, which is only
+// ever the following status
+func (s PaymentStatus) next(status PaymentStatus) bool {
+	switch s {
+	case PaymentPending:
+		return status == PaymentPaid
+	case PaymentPaid:
+		return status == PaymentRefunded
+	default:
+		return false
+	}
+}
+
+// Order amounts: Subtotal is the price of the products before discounts,
+// TotalPrice what is charged. TaxTotal is added to the discounted subtotal
+// unless TaxInclusive, in which case it is the part of it that is tax.
 type Order struct {
-	ID         string
-	CreatedAt  time.Time
-	TotalPrice float64
-	AccountID  string
-	Products   []OrderedProduct
+	ID              string
+	CreatedAt       time.Time
+	Subtotal        float64
+	TaxTotal        float64
+	TaxInclusive    bool
+	TaxJurisdiction string
+	TotalPrice      float64
+	AccountID       string
+	PaymentStatus   PaymentStatus
+	ShippingAddress *Address
+	Products        []OrderedProduct
+	Discounts       []Discount
+	Taxes           []TaxLine
+	Shipments       []Shipment
+}
+
+type Address struct {
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postalCode"`
+	Country    string `json:"country"`
 }
 
+// ShipmentStatus only moves forward, from pending to shipped to delivered
+type ShipmentStatus string
+
+const (
+	ShipmentPending   ShipmentStatus = "pending"
+	ShipmentShipped   ShipmentStatus = "shipped"
+	ShipmentDelivered ShipmentStatus = "delivered"
+)
+
+func (s ShipmentStatus) rank() int {
+	switch s {
+	case ShipmentPending:
+		return 1
+	case ShipmentShipped:
+		return 2
+	case ShipmentDelivered:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Shipment is a parcel holding some or all of the items of an order
+type Shipment struct {
+	ID             string
+	OrderID        string
+	Carrier        string
+	TrackingNumber string
+	Status         ShipmentStatus
+	CreatedAt      time.Time
+	ShippedAt      *time.Time
+	DeliveredAt    *time.Time
+	Items          []ShipmentItem
+}
+
+type ShipmentItem struct {
+	ProductID string
+	VariantID string
+	Quantity  uint32
+}
+
+// OrderedProduct is a line of an order. The variant, its SKU and options, and
+// the unit price are a snapshot taken when the order was placed.
 type OrderedProduct struct {
 	ID          string
+	VariantID   string
+	SKU         string
+	Options     []VariantOption
 	Name        string
 	Description string
 	Price       float64
 	Quantity    uint32
+	// TaxCategory is the catalog tax category of the product when the order
+	// is placed, the taxes of the order keep the category they were computed with
+	TaxCategory string
+}
+
+type VariantOption struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// lineKey identifies a line of an order, a product may be ordered in several variants
+type lineKey struct {
+	productID string
+	variantID string
+}
+
+// OrderPage is a cursor based page of orders, the cursor of an order is its ID
+type OrderPage struct {
+	Orders      []Order
+	TotalCount  uint64
+	HasNextPage bool
 }
 
 type orderService struct {
 	repository Repository
+	tax        *TaxCalculator
+	events     *eventHub
 }
 
-func NewService(r Repository) Service {
-	return &orderService{r}
+// NewService creates the order service, orders are not taxed when tax is nil
+func NewService(r Repository, tax *TaxCalculator) Service {
+	return &orderService{r, tax, newEventHub()}
 }
 
-func (s orderService) PostOrder(ctx context.Context, accountID string, products []OrderedProduct) (*Order, error) {
+// PostOrder places an order. Placing an order again with the idempotency key
+// of an earlier order of the account returns that order instead.
+func (s orderService) PostOrder(ctx context.Context, accountID string, products []OrderedProduct, shippingAddress *Address, couponCode string, idempotencyKey string) (*Order, error) {
+	if idempotencyKey != "" {
+		o, err := s.orderForIdempotencyKey(ctx, accountID, idempotencyKey)
+		if !errors.Is(err, ErrOrderNotFound) {
+			return o, err
+		}
+	}
+
 	o := &Order{
-		ID:        ksuid.New().String(),
-		CreatedAt: time.Now().UTC(),
-		AccountID: accountID,
-		Products:  products,
+		ID:              ksuid.New().String(),
+		CreatedAt:       time.Now().UTC(),
+		AccountID:       accountID,
+		PaymentStatus:   PaymentPending,
+		ShippingAddress: shippingAddress,
+		Products:        products,
+		Shipments:       []Shipment{},
 	}
-	// Calculate total price
-	o.TotalPrice = 0.0
+	// Calculate the subtotal, and the amount charged for each product
+	o.Subtotal = 0.0
+	amounts := map[string]float64{}
+	categories := map[string]string{}
+	productIDs := []string{}
 	for _, p := range products {
-		o.TotalPrice += p.Price * float64(p.Quantity)
+		o.Subtotal += p.Price * float64(p.Quantity)
+		if _, ok := amounts[p.ID]; !ok {
+			productIDs = append(productIDs, p.ID)
+		}
+		amounts[p.ID] += p.Price * float64(p.Quantity)
+		categories[p.ID] = p.TaxCategory
+	}
+	o.Subtotal = roundCents(o.Subtotal)
+
+	promotions, err := s.orderPromotions(ctx, accountID, o.Subtotal, couponCode, o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	o.TotalPrice = o.Subtotal
+	o.Discounts = applyPromotions(products, promotions)
+	for i, d := range o.Discounts {
+		o.Discounts[i].OrderID = o.ID
+		o.TotalPrice -= d.Amount
+		amounts[d.ProductID] -= d.Amount
+	}
+
+	// Tax applies to what is charged, after discounts
+	tax := s.tax.Calculate(shippingAddress, amounts, categories, productIDs)
+	o.TaxTotal = tax.Total
+	o.TaxInclusive = tax.Inclusive
+	o.TaxJurisdiction = tax.Jurisdiction
+	o.Taxes = tax.Lines
+	for i := range o.Taxes {
+		o.Taxes[i].OrderID = o.ID
+	}
+	if !tax.Inclusive {
+		o.TotalPrice += tax.Total
+	}
+	o.TotalPrice = roundCents(o.TotalPrice)
+
+	// The event is stored with the order and relayed to the broker from the outbox
+	e := OrderEvent{
+		ID:            ksuid.New().String(),
+		Type:          OrderCreated,
+		OrderID:       o.ID,
+		AccountID:     o.AccountID,
+		TotalPrice:    o.TotalPrice,
+		PaymentStatus: o.PaymentStatus,
+		OccurredAt:    o.CreatedAt,
+	}
+	err = s.repository.PutOrder(ctx, *o, idempotencyKey, e)
+	if errors.Is(err, ErrDuplicateOrder) {
+		// Placed concurrently with the same key
+		return s.orderForIdempotencyKey(ctx, accountID, idempotencyKey)
 	}
-	err := s.repository.PutOrder(ctx, *o)
 	if err != nil {
 		return nil, err
 	}
+
+	s.events.publish(e)
+	return o, nil
+}
+
+func (s orderService) orderForIdempotencyKey(ctx context.Context, accountID string, idempotencyKey string) (*Order, error) {
+	id, err := s.repository.GetOrderIDByIdempotencyKey(ctx, accountID, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetOrder(ctx, id)
+}
+
+func (s orderService) GetOrder(ctx context.Context, id string) (*Order, error) {
+	o, err := s.repository.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []Order{*o}
+	if err := s.attachDetails(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	return &orders[0], nil
+}
+
+func (s orderService) UpdatePaymentStatus(ctx context.Context, id string, status PaymentStatus) (*Order, error) {
+	if !status.Valid() {
+		return nil, ErrInvalidPaymentStatus
+	}
+
+	// The account and total of an order never change, the event can be built ahead
+	o, err := s.repository.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The payment service may repeat an update, or send them out of order
+	if status == o.PaymentStatus {
+		return s.GetOrder(ctx, id)
+	}
+	if !o.PaymentStatus.next(status) {
+		return nil, fmt.Errorf("%w: order is %s", ErrPaymentStatusChange, o.PaymentStatus)
+	}
+
+	e := OrderEvent{
+		ID:            ksuid.New().String(),
+		Type:          OrderPaymentStatusChanged,
+		OrderID:       o.ID,
+		AccountID:     o.AccountID,
+		TotalPrice:    o.TotalPrice,
+		PaymentStatus: status,
+		OccurredAt:    time.Now().UTC(),
+	}
+	if err := s.repository.UpdatePaymentStatus(ctx, id, o.PaymentStatus, status, e); err != nil {
+		return nil, err
+	}
+
+	o, err = s.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.events.publish(e)
 	return o, nil
 }
 
 func (s orderService) GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error) {
-	return s.repository.GetOrdersForAccount(ctx, accountID)
+	orders, err := s.repository.GetOrdersForAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attachDetails(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (s orderService) GetOrdersForAccountPage(ctx context.Context, accountID string, after string, first uint64) (*OrderPage, error) {
+	if first == 0 || first > 100 {
+		first = 100
+	}
+
+	// Fetch one extra order to find out whether there is a next page
+	orders, err := s.repository.GetOrdersForAccountAfter(ctx, accountID, after, first+1)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.repository.CountOrdersForAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &OrderPage{
+		Orders:     orders,
+		TotalCount: count,
+	}
+	if uint64(len(orders)) > first {
+		page.Orders = orders[:first]
+		page.HasNextPage = true
+	}
+
+	if err := s.attachDetails(ctx, page.Orders); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// orderPromotions selects the promotions that apply to an order: every eligible
+// automatic promotion, then the promotion of the coupon code. Unlike automatic
+// promotions, a coupon that cannot be applied fails the order.
+func (s orderService) orderPromotions(ctx context.Context, accountID string, subtotal float64, couponCode string, now time.Time) ([]Promotion, error) {
+	automatic, err := s.repository.GetAutomaticPromotions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	promotions := []Promotion{}
+	for _, p := range automatic {
+		if !p.eligible(now, subtotal) {
+			continue
+		}
+		if err := s.checkUsage(ctx, p, accountID); err != nil {
+			if errors.Is(err, ErrCouponUsageLimitExceeded) {
+				continue
+			}
+			return nil, err
+		}
+		promotions = append(promotions, p)
+	}
+
+	couponCode = NormalizeCouponCode(couponCode)
+	if couponCode == "" {
+		return promotions, nil
+	}
+
+	coupon, err := s.repository.GetPromotionByCode(ctx, couponCode)
+	if errors.Is(err, ErrPromotionNotFound) {
+		return nil, ErrCouponNotApplicable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !coupon.eligible(now, subtotal) {
+		return nil, ErrCouponNotApplicable
+	}
+	if err := s.checkUsage(ctx, *coupon, accountID); err != nil {
+		return nil, err
+	}
+
+	return append(promotions, *coupon), nil
+}
+
+func (s orderService) checkUsage(ctx context.Context, p Promotion, accountID string) error {
+	if p.UsageLimitPerAccount == 0 {
+		return nil
+	}
+
+	uses, err := s.repository.CountPromotionUses(ctx, p.ID, accountID)
+	if err != nil {
+		return err
+	}
+	if uses >= p.UsageLimitPerAccount {
+		return ErrCouponUsageLimitExceeded
+	}
+	return nil
+}
+
+func (s orderService) CreatePromotion(ctx context.Context, p Promotion) (*Promotion, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	p.ID = ksuid.New().String()
+	p.CreatedAt = time.Now().UTC()
+	if err := s.repository.PutPromotion(ctx, p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// UpdatePromotion replaces every field of the promotion, orders already placed keep their discounts
+func (s orderService) UpdatePromotion(ctx context.Context, p Promotion) (*Promotion, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.UpdatePromotion(ctx, p); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetPromotionByID(ctx, p.ID)
+}
+
+func (s orderService) GetPromotions(ctx context.Context) ([]Promotion, error) {
+	return s.repository.GetPromotions(ctx)
+}
+
+func (s orderService) GetSalesReport(ctx context.Context, from time.Time, to time.Time, interval ReportInterval) (*SalesReport, error) {
+	if err := validateReportRange(from, to, interval); err != nil {
+		return nil, err
+	}
+
+	buckets, err := s.repository.GetSalesBuckets(ctx, from, to, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SalesReport{
+		From:     from,
+		To:       to,
+		Interval: interval,
+		Buckets:  buckets,
+	}
+	for i, b := range buckets {
+		buckets[i].Revenue = roundCents(b.Revenue)
+		buckets[i].AverageOrderValue = averageOrderValue(b.Revenue, b.OrderCount)
+		report.OrderCount += b.OrderCount
+		report.Revenue += b.Revenue
+	}
+	report.Revenue = roundCents(report.Revenue)
+	report.AverageOrderValue = averageOrderValue(report.Revenue, report.OrderCount)
+
+	return report, nil
+}
+
+func (s orderService) GetTopProducts(ctx context.Context, from time.Time, to time.Time, by ProductRanking, limit uint32) ([]ProductSales, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: range must end after it starts", ErrInvalidReport)
+	}
+	if by != RankByQuantity && by != RankByRevenue {
+		return nil, fmt.Errorf("%w: unknown ranking %q", ErrInvalidReport, by)
+	}
+	if limit == 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	products, err := s.repository.GetTopProducts(ctx, from, to, by, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range products {
+		products[i].Revenue = roundCents(products[i].Revenue)
+	}
+
+	return products, nil
+}
+
+func (s orderService) GetAccountValues(ctx context.Context, accountIDs []string, limit uint32) ([]AccountValue, error) {
+	if len(accountIDs) > 100 {
+		return nil, fmt.Errorf("%w: at most 100 accounts can be requested", ErrInvalidReport)
+	}
+	if len(accountIDs) > 0 {
+		limit = uint32(len(accountIDs))
+	}
+	if limit == 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	accounts, err := s.repository.GetAccountValues(ctx, accountIDs, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range accounts {
+		accounts[i].LifetimeValue = roundCents(accounts[i].LifetimeValue)
+	}
+
+	return accounts, nil
+}
+
+// attachDetails loads the discounts, taxes and shipments of all orders, with a single query each
+func (s orderService) attachDetails(ctx context.Context, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	orderIDs := []string{}
+	for _, o := range orders {
+		orderIDs = append(orderIDs, o.ID)
+	}
+
+	discounts, err := s.repository.GetDiscountsForOrders(ctx, orderIDs)
+	if err != nil {
+		return err
+	}
+
+	taxes, err := s.repository.GetTaxesForOrders(ctx, orderIDs)
+	if err != nil {
+		return err
+	}
+
+	shipments, err := s.repository.GetShipmentsForOrders(ctx, orderIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range orders {
+		orders[i].Discounts = []Discount{}
+		for _, d := range discounts {
+			if d.OrderID == orders[i].ID {
+				orders[i].Discounts = append(orders[i].Discounts, d)
+			}
+		}
+
+		orders[i].Taxes = []TaxLine{}
+		for _, t := range taxes {
+			if t.OrderID == orders[i].ID {
+				orders[i].Taxes = append(orders[i].Taxes, t)
+			}
+		}
+
+		orders[i].Shipments = []Shipment{}
+		for _, shipment := range shipments {
+			if shipment.OrderID == orders[i].ID {
+				orders[i].Shipments = append(orders[i].Shipments, shipment)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CreateShipment ships items of a paid order. Without items, every quantity
+// that is not part of an earlier shipment is shipped.
+func (s orderService) CreateShipment(ctx context.Context, orderID string, carrier string, trackingNumber string, items []ShipmentItem) (*Shipment, error) {
+	o, err := s.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.PaymentStatus != PaymentPaid {
+		return nil, ErrOrderNotPaid
+	}
+
+	// Quantities of each line that are left to ship
+	unshipped := map[lineKey]uint32{}
+	for _, p := range o.Products {
+		unshipped[lineKey{p.ID, p.VariantID}] += p.Quantity
+	}
+	for _, shipment := range o.Shipments {
+		for _, item := range shipment.Items {
+			unshipped[lineKey{item.ProductID, item.VariantID}] -= item.Quantity
+		}
+	}
+
+	if len(items) == 0 {
+		for _, p := range o.Products {
+			key := lineKey{p.ID, p.VariantID}
+			if unshipped[key] > 0 {
+				items = append(items, ShipmentItem{ProductID: p.ID, VariantID: p.VariantID, Quantity: unshipped[key]})
+				unshipped[key] = 0
+			}
+		}
+		if len(items) == 0 {
+			return nil, ErrNothingToShip
+		}
+	} else {
+		seen := map[lineKey]bool{}
+		for _, item := range items {
+			key := lineKey{item.ProductID, item.VariantID}
+			if seen[key] || item.Quantity == 0 || item.Quantity > unshipped[key] {
+				return nil, ErrInvalidShipmentItem
+			}
+			seen[key] = true
+			unshipped[key] -= item.Quantity
+		}
+	}
+
+	shipment := &Shipment{
+		ID:             ksuid.New().String(),
+		OrderID:        orderID,
+		Carrier:        carrier,
+		TrackingNumber: trackingNumber,
+		Status:         ShipmentPending,
+		CreatedAt:      time.Now().UTC(),
+		Items:          items,
+	}
+	e := OrderEvent{
+		ID:             ksuid.New().String(),
+		Type:           OrderShipmentCreated,
+		OrderID:        o.ID,
+		AccountID:      o.AccountID,
+		TotalPrice:     o.TotalPrice,
+		PaymentStatus:  o.PaymentStatus,
+		ShipmentID:     shipment.ID,
+		ShipmentStatus: shipment.Status,
+		OccurredAt:     shipment.CreatedAt,
+	}
+	if err := s.repository.PutShipment(ctx, *shipment, e); err != nil {
+		return nil, err
+	}
+
+	s.events.publish(e)
+	return shipment, nil
+}
+
+// UpdateShipment changes the tracking details and moves the status forward,
+// recording when the shipment was shipped and delivered. Empty values are left unchanged.
+func (s orderService) UpdateShipment(ctx context.Context, id string, carrier string, trackingNumber string, status ShipmentStatus) (*Shipment, error) {
+	shipment, err := s.repository.GetShipmentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account of the order is part of the event published below
+	o, err := s.repository.GetOrderByID(ctx, shipment.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if carrier != "" {
+		shipment.Carrier = carrier
+	}
+	if trackingNumber != "" {
+		shipment.TrackingNumber = trackingNumber
+	}
+
+	if status != "" && status != shipment.Status {
+		if status.rank() == 0 || status.rank() < shipment.Status.rank() {
+			return nil, ErrInvalidShipmentStatus
+		}
+
+		now := time.Now().UTC()
+		if shipment.ShippedAt == nil {
+			shipment.ShippedAt = &now
+		}
+		if status == ShipmentDelivered {
+			shipment.DeliveredAt = &now
+		}
+		shipment.Status = status
+	}
+
+	e := OrderEvent{
+		ID:             ksuid.New().String(),
+		Type:           OrderShipmentUpdated,
+		OrderID:        o.ID,
+		AccountID:      o.AccountID,
+		TotalPrice:     o.TotalPrice,
+		PaymentStatus:  o.PaymentStatus,
+		ShipmentID:     shipment.ID,
+		ShipmentStatus: shipment.Status,
+		OccurredAt:     time.Now().UTC(),
+	}
+	if err := s.repository.UpdateShipment(ctx, *shipment, e); err != nil {
+		return nil, err
+	}
+
+	s.events.publish(e)
+	return shipment, nil
+}
+
+func (s orderService) SubscribeOrderEvents() (<-chan OrderEvent, func()) {
+	return s.events.subscribe()
 }
@@ -0,0 +1,25 @@
+package order
+
+import "testing"
+
+func TestPaymentStatusNext(t *testing.T) {
+	tests := []struct {
+		from PaymentStatus
+		to   PaymentStatus
+		want bool
+	}{
+		{PaymentPending, PaymentPaid, true},
+		{PaymentPaid, PaymentRefunded, true},
+		{PaymentPending, PaymentRefunded, false},
+		{PaymentPaid, PaymentPending, false},
+		{PaymentRefunded, PaymentPaid, false},
+		{PaymentRefunded, PaymentPending, false},
+		{PaymentPaid, PaymentPaid, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.from.next(tt.to); got != tt.want {
+			t.Errorf("%s.next(%s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/segmentio/ksuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrInvalidSubscription       = errors.New("invalid subscription")
+	ErrSubscriptionNotFound      = errors.New("subscription not found")
+	ErrInvalidSubscriptionStatus = errors.New("subscription cannot be changed from its status")
+)
+
+// SubscriptionStatus of a subscription. Only active subscriptions place
+// orders, cancelled ones never do again.
+type SubscriptionStatus string
+
+const (
+	SubscriptionActive    SubscriptionStatus = "active"
+	SubscriptionPaused    SubscriptionStatus = "paused"
+	SubscriptionCancelled SubscriptionStatus = "cancelled"
+)
+
+type SubscriptionInterval string
+
+const (
+	IntervalDay   SubscriptionInterval = "day"
+	IntervalWeek  SubscriptionInterval = "week"
+	IntervalMonth SubscriptionInterval = "month"
+)
+
+// after returns the time count intervals after t. Months keep the day of t,
+// or end on the last day of shorter months.
+func (i SubscriptionInterval) after(t time.Time, count uint32) time.Time {
+	switch i {
+	case IntervalDay:
+		return t.AddDate(0, 0, int(count))
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7*int(count))
+	default:
+		y, m, d := t.Date()
+		month := m + time.Month(count)
+		if last := time.Date(y, month+1, 0, 0, 0, 0, 0, t.Location()).Day(); d > last {
+			d = last
+		}
+		return time.Date(y, month, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	}
+}
+
+// Subscription places the same order every IntervalCount intervals, the next
+// one at NextRunAt. Prices are those of the catalog when each order is placed.
+type Subscription struct {
+	ID              string
+	AccountID       string
+	Products        []SubscriptionItem
+	ShippingAddress *Address
+	Interval        SubscriptionInterval
+	IntervalCount   uint32
+	NextRunAt       time.Time
+	Status          SubscriptionStatus
+	CreatedAt       time.Time
+	// The latest runs, newest first
+	Runs []SubscriptionRun
+}
+
+type SubscriptionItem struct {
+	ProductID string `json:"productId"`
+	VariantID string `json:"variantId,omitempty"`
+	Quantity  uint32 `json:"quantity"`
+}
+
+type SubscriptionRunStatus string
+
+const (
+	RunPending SubscriptionRunStatus = "pending"
+	RunPlaced  SubscriptionRunStatus = "placed"
+	// RunFailed runs ran out of attempts or can never succeed, the
+	// subscription moves on to its next run
+	RunFailed SubscriptionRunStatus = "failed"
+	// RunSkipped runs were pending when their subscription was paused or cancelled
+	RunSkipped SubscriptionRunStatus = "skipped"
+)
+
+// SubscriptionRun is the order of a subscription for one scheduled time. A
+// subscription has at most one run per scheduled time, and its ID is the
+// idempotency key of the order, so a run places at most one order.
+type SubscriptionRun struct {
+	ID             string
+	SubscriptionID string
+	ScheduledFor   time.Time
+	Status         SubscriptionRunStatus
+	OrderID        string
+	Attempts       uint32
+	NextAttemptAt  *time.Time
+	LastError      string
+	CreatedAt      time.Time
+}
+
+// ClaimedSubscriptionRun is a due run along with its subscription
+type ClaimedSubscriptionRun struct {
+	Subscription Subscription
+	Run          SubscriptionRun
+}
+
+func (s *Subscription) validate(now time.Time) error {
+	if s.AccountID == "" {
+		return fmt.Errorf("%w: accountId is required", ErrInvalidSubscription)
+	}
+	if len(s.Products) == 0 {
+		return fmt.Errorf("%w: at least one product is required", ErrInvalidSubscription)
+	}
+	for _, p := range s.Products {
+		if p.ProductID == "" || p.Quantity == 0 {
+			return fmt.Errorf("%w: every product needs an id and a positive quantity", ErrInvalidSubscription)
+		}
+	}
+	switch s.Interval {
+	case IntervalDay, IntervalWeek, IntervalMonth:
+	default:
+		return fmt.Errorf("%w: interval %q must be day, week or month", ErrInvalidSubscription, s.Interval)
+	}
+	if s.IntervalCount == 0 {
+		s.IntervalCount = 1
+	}
+	if s.IntervalCount > 365 {
+		return fmt.Errorf("%w: intervalCount is above 365", ErrInvalidSubscription)
+	}
+	if s.NextRunAt.IsZero() {
+		s.NextRunAt = s.Interval.after(now, s.IntervalCount)
+	}
+	if s.NextRunAt.Before(now.Add(-time.Minute)) {
+		return fmt.Errorf("%w: nextRunAt is in the past", ErrInvalidSubscription)
+	}
+	return nil
+}
+
+// nextRun returns the first run after now of a subscription scheduled at
+// from. Runs missed while the subscription was paused or the service down
+// are skipped rather than placed all at once.
+func (s Subscription) nextRun(from time.Time, now time.Time) time.Time {
+	next := s.Interval.after(from, s.IntervalCount)
+	for !next.After(now) {
+		next = s.Interval.after(next, s.IntervalCount)
+	}
+	return next
+}
+
+// CreateSubscription schedules the first order one interval from now, unless
+// NextRunAt is set
+func (s orderService) CreateSubscription(ctx context.Context, sub Subscription) (*Subscription, error) {
+	now := time.Now().UTC()
+	if err := sub.validate(now); err != nil {
+		return nil, err
+	}
+
+	sub.ID = ksuid.New().String()
+	sub.Status = SubscriptionActive
+	sub.CreatedAt = now
+	sub.NextRunAt = sub.NextRunAt.UTC()
+	sub.Runs = []SubscriptionRun{}
+	if err := s.repository.PutSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+func (s orderService) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	return s.repository.GetSubscriptionByID(ctx, id)
+}
+
+func (s orderService) GetSubscriptionsForAccount(ctx context.Context, accountID string) ([]Subscription, error) {
+	return s.repository.GetSubscriptionsForAccount(ctx, accountID)
+}
+
+// PauseSubscription stops placing orders until the subscription is resumed
+func (s orderService) PauseSubscription(ctx context.Context, id string) (*Subscription, error) {
+	return s.changeSubscriptionStatus(ctx, id, SubscriptionPaused, func(sub *Subscription, now time.Time) bool {
+		return sub.Status == SubscriptionActive
+	})
+}
+
+// ResumeSubscription places orders again. Runs missed while paused are
+// skipped, the next one is the first scheduled after now.
+func (s orderService) ResumeSubscription(ctx context.Context, id string) (*Subscription, error) {
+	return s.changeSubscriptionStatus(ctx, id, SubscriptionActive, func(sub *Subscription, now time.Time) bool {
+		if sub.Status != SubscriptionPaused {
+			return false
+		}
+		if !sub.NextRunAt.After(now) {
+			sub.NextRunAt = sub.nextRun(sub.NextRunAt, now)
+		}
+		return true
+	})
+}
+
+// CancelSubscription stops the subscription for good
+func (s orderService) CancelSubscription(ctx context.Context, id string) (*Subscription, error) {
+	return s.changeSubscriptionStatus(ctx, id, SubscriptionCancelled, func(sub *Subscription, now time.Time) bool {
+		return sub.Status != SubscriptionCancelled
+	})
+}
+
+// changeSubscriptionStatus moves a subscription to status to when allowed
+// reports it may, which can also reschedule it. The change only applies if
+// the subscription was not changed meanwhile.
+func (s orderService) changeSubscriptionStatus(ctx context.Context, id string, to SubscriptionStatus, allowed func(sub *Subscription, now time.Time) bool) (*Subscription, error) {
+	sub, err := s.repository.GetSubscriptionByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	from := sub.Status
+	if !allowed(sub, time.Now().UTC()) {
+		return nil, fmt.Errorf("%w: subscription is %s", ErrInvalidSubscriptionStatus, from)
+	}
+
+	if err := s.repository.UpdateSubscriptionStatus(ctx, id, from, to, sub.NextRunAt); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetSubscriptionByID(ctx, id)
+}
+
+type SubscriptionConfig struct {
+	Interval  time.Duration `envconfig:"INTERVAL" default:"10s"`
+	BatchSize int           `envconfig:"BATCH_SIZE" default:"20"`
+	// Retries wait InitialBackoff, then twice as long each time up to MaxBackoff
+	MaxAttempts    uint32        `envconfig:"MAX_ATTEMPTS" default:"5"`
+	InitialBackoff time.Duration `envconfig:"INITIAL_BACKOFF" default:"5m"`
+	MaxBackoff     time.Duration `envconfig:"MAX_BACKOFF" default:"6h"`
+	// OrderTimeout bounds each PostOrder call of a run, retries included
+	OrderTimeout time.Duration `envconfig:"ORDER_TIMEOUT" default:"10s"`
+	// Lease is how long a claimed batch of runs is held. It must cover
+	// placing every run of the batch, or a run could be placed twice at once.
+	Lease time.Duration `envconfig:"LEASE" default:"5m"`
+}
+
+func (c SubscriptionConfig) Validate() error {
+	if c.Interval <= 0 || c.BatchSize < 1 || c.MaxAttempts < 1 || c.InitialBackoff <= 0 || c.OrderTimeout <= 0 {
+		return fmt.Errorf("%w: SUBSCRIPTIONS_INTERVAL, SUBSCRIPTIONS_BATCH_SIZE, SUBSCRIPTIONS_MAX_ATTEMPTS, SUBSCRIPTIONS_INITIAL_BACKOFF and SUBSCRIPTIONS_ORDER_TIMEOUT must be positive", bootstrap.ErrInvalidConfig)
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		return fmt.Errorf("%w: SUBSCRIPTIONS_MAX_BACKOFF is below SUBSCRIPTIONS_INITIAL_BACKOFF", bootstrap.ErrInvalidConfig)
+	}
+	if c.Lease <= time.Duration(c.BatchSize)*c.OrderTimeout {
+		return fmt.Errorf("%w: SUBSCRIPTIONS_LEASE must exceed SUBSCRIPTIONS_BATCH_SIZE times SUBSCRIPTIONS_ORDER_TIMEOUT", bootstrap.ErrInvalidConfig)
+	}
+	return nil
+}
+
+// RunSubscriptionScheduler places the orders of due subscriptions through
+// client, like any other order, until ctx is done
+func RunSubscriptionScheduler(ctx context.Context, r Repository, client *Client, cfg SubscriptionConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := queueSubscriptionRuns(ctx, r); err != nil {
+			log.Printf("Error queueing subscription runs: %v", err)
+		}
+
+		for {
+			n, err := placeSubscriptionOrders(ctx, r, client, cfg)
+			if err != nil {
+				log.Printf("Error placing subscription orders: %v", err)
+				break
+			}
+			if n < cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// queueSubscriptionRuns adds a pending run for every due subscription. A
+// subscription stays due until its run is placed or fails, queueing it again
+// meanwhile is skipped.
+func queueSubscriptionRuns(ctx context.Context, r Repository) error {
+	now := time.Now().UTC()
+	due, err := r.GetDueSubscriptions(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range due {
+		scheduledFor := sub.NextRunAt
+		err := r.PutSubscriptionRun(ctx, SubscriptionRun{
+			ID:             ksuid.New().String(),
+			SubscriptionID: sub.ID,
+			ScheduledFor:   scheduledFor,
+			Status:         RunPending,
+			NextAttemptAt:  &scheduledFor,
+			CreatedAt:      now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// placeSubscriptionOrders places the orders of a batch of due runs, returning
+// how many were attempted
+func placeSubscriptionOrders(ctx context.Context, r Repository, client *Client, cfg SubscriptionConfig) (int, error) {
+	// Claimed runs are not due again until the lease is over, in case this
+	// process stops before recording them
+	claimed, err := r.ClaimSubscriptionRuns(ctx, cfg.BatchSize, time.Now().UTC(), cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, c := range claimed {
+		sub, run := c.Subscription, c.Run
+
+		products := []OrderedProduct{}
+		for _, p := range sub.Products {
+			products = append(products, OrderedProduct{ID: p.ProductID, VariantID: p.VariantID, Quantity: p.Quantity})
+		}
+		// Placing a run again returns the order it already placed
+		orderCtx, cancel := context.WithTimeout(ctx, cfg.OrderTimeout)
+		o, err := client.PostOrder(orderCtx, sub.AccountID, products, sub.ShippingAddress, "", run.ID)
+		cancel()
+		now := time.Now().UTC()
+
+		run.Attempts++
+		var nextRunAt *time.Time
+		switch {
+		case err == nil:
+			run.Status = RunPlaced
+			run.OrderID = o.ID
+			run.NextAttemptAt = nil
+			run.LastError = ""
+		case rejected(err) || run.Attempts >= cfg.MaxAttempts:
+			run.Status = RunFailed
+			run.NextAttemptAt = nil
+			run.LastError = err.Error()
+		default:
+			next := now.Add(backoff(cfg.InitialBackoff, cfg.MaxBackoff, run.Attempts))
+			run.NextAttemptAt = &next
+			run.LastError = err.Error()
+		}
+		if run.Status != RunPending {
+			next := sub.nextRun(run.ScheduledFor, now)
+			nextRunAt = &next
+		}
+		if err != nil {
+			log.Printf("Error placing order of subscription %s: %v", sub.ID, err)
+		}
+
+		if err := r.RecordSubscriptionRun(ctx, run, nextRunAt); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(claimed), nil
+}
+
+// rejected reports whether the order service refused an order for a reason
+// that retrying does not change, such as a product that no longer exists
+func rejected(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.FailedPrecondition:
+		return true
+	default:
+		return false
+	}
+}
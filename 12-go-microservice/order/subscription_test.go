@@ -0,0 +1,94 @@
+package order
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscriptionIntervalAfter(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		interval SubscriptionInterval
+		from     time.Time
+		count    uint32
+		want     time.Time
+	}{
+		{"days", IntervalDay, date(2025, 1, 30), 3, date(2025, 2, 2)},
+		{"weeks", IntervalWeek, date(2025, 12, 29), 2, date(2026, 1, 12)},
+		{"month", IntervalMonth, date(2025, 1, 15), 1, date(2025, 2, 15)},
+		{"month from the 31st", IntervalMonth, date(2025, 1, 31), 1, date(2025, 2, 28)},
+		{"month from the 31st in a leap year", IntervalMonth, date(2024, 1, 31), 1, date(2024, 2, 29)},
+		{"month from the 31st to a 30 day month", IntervalMonth, date(2025, 3, 31), 1, date(2025, 4, 30)},
+		{"months across a year", IntervalMonth, date(2025, 11, 30), 3, date(2026, 2, 28)},
+		{"twelve months", IntervalMonth, date(2024, 2, 29), 12, date(2025, 2, 28)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.interval.after(tt.from, tt.count); !got.Equal(tt.want) {
+				t.Errorf("after() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionNextRun(t *testing.T) {
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	sub := Subscription{Interval: IntervalWeek, IntervalCount: 1}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"next interval", from, from.AddDate(0, 0, 7)},
+		{"skips missed intervals", from.AddDate(0, 0, 20), from.AddDate(0, 0, 21)},
+		{"never now", from.AddDate(0, 0, 14), from.AddDate(0, 0, 21)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sub.nextRun(from, tt.now); !got.Equal(tt.want) {
+				t.Errorf("nextRun() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionConfigValidate(t *testing.T) {
+	valid := SubscriptionConfig{
+		Interval:       10 * time.Second,
+		BatchSize:      20,
+		MaxAttempts:    5,
+		InitialBackoff: 5 * time.Minute,
+		MaxBackoff:     6 * time.Hour,
+		OrderTimeout:   10 * time.Second,
+		Lease:          5 * time.Minute,
+	}
+
+	tests := []struct {
+		name    string
+		change  func(*SubscriptionConfig)
+		wantErr bool
+	}{
+		{"defaults", func(*SubscriptionConfig) {}, false},
+		{"no order timeout", func(c *SubscriptionConfig) { c.OrderTimeout = 0 }, true},
+		{"lease shorter than a batch", func(c *SubscriptionConfig) { c.Lease = 3 * time.Minute }, true},
+		{"lease as long as a batch", func(c *SubscriptionConfig) { c.Lease = 200 * time.Second }, true},
+		{"max backoff below initial", func(c *SubscriptionConfig) { c.MaxBackoff = time.Minute }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.change(&cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package order
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TaxConfig is read from a JSON file, for example:
+//
+//	{
+//	  "defaultJurisdiction": "US-CA",
+//	  "defaultCategory": "standard",
+//	  "productCategories": {"<product id>": "food"},
+//	  "jurisdictions": [
+//	    {"code": "US-CA", "country": "US", "region": "CA", "rates": {"standard": 7.25, "food": 0}},
+//	    {"code": "DE", "country": "DE", "pricesIncludeTax": true, "rates": {"standard": 19, "food": 7}}
+//	  ]
+//	}
+type TaxConfig struct {
+	// DefaultJurisdiction is used for orders without a shipping address or
+	// whose address matches no jurisdiction, empty means they are not taxed
+	DefaultJurisdiction string `json:"defaultJurisdiction"`
+	// DefaultCategory is the tax category of products without one in the catalog
+	DefaultCategory string `json:"defaultCategory"`
+	// ProductCategories overrides the catalog tax category of some products
+	ProductCategories map[string]string `json:"productCategories"`
+	Jurisdictions     []Jurisdiction    `json:"jurisdictions"`
+}
+
+// Jurisdiction matches addresses by country, and by region when one is set.
+// Rates are percentages per tax category.
+type Jurisdiction struct {
+	Code    string `json:"code"`
+	Country string `json:"country"`
+	Region  string `json:"region"`
+	// PricesIncludeTax tells whether catalog prices already include the tax
+	PricesIncludeTax bool               `json:"pricesIncludeTax"`
+	Rates            map[string]float64 `json:"rates"`
+}
+
+// TaxLine is the tax of one line of an order
+type TaxLine struct {
+	OrderID       string
+	ProductID     string
+	Category      string
+	Rate          float64
+	TaxableAmount float64
+	Amount        float64
+}
+
+// TaxResult is the tax of a whole order
+type TaxResult struct {
+	Jurisdiction string
+	Inclusive    bool
+	Total        float64
+	Lines        []TaxLine
+}
+
+// TaxCalculator computes order taxes from a TaxConfig. A nil calculator computes no tax.
+type TaxCalculator struct {
+	cfg TaxConfig
+}
+
+func NewTaxCalculator(cfg TaxConfig) (*TaxCalculator, error) {
+	if cfg.DefaultCategory == "" {
+		cfg.DefaultCategory = "standard"
+	}
+
+	codes := map[string]bool{}
+	for _, j := range cfg.Jurisdictions {
+		if j.Code == "" || j.Country == "" {
+			return nil, fmt.Errorf("tax jurisdiction needs a code and a country")
+		}
+		if codes[j.Code] {
+			return nil, fmt.Errorf("tax jurisdiction %s is defined twice", j.Code)
+		}
+		codes[j.Code] = true
+
+		for category, rate := range j.Rates {
+			if rate < 0 {
+				return nil, fmt.Errorf("tax rate of %s in %s is negative", category, j.Code)
+			}
+		}
+	}
+
+	if cfg.DefaultJurisdiction != "" && !codes[cfg.DefaultJurisdiction] {
+		return nil, fmt.Errorf("default tax jurisdiction %s is not defined", cfg.DefaultJurisdiction)
+	}
+
+	return &TaxCalculator{cfg}, nil
+}
+
+// LoadTaxCalculator reads the tax configuration from a JSON file
+func LoadTaxCalculator(path string) (*TaxCalculator, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := TaxConfig{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return NewTaxCalculator(cfg)
+}
+
+// jurisdiction picks the most specific jurisdiction for the address
+func (c *TaxCalculator) jurisdiction(a *Address) *Jurisdiction {
+	if a != nil {
+		var match *Jurisdiction
+		for i, j := range c.cfg.Jurisdictions {
+			if !strings.EqualFold(j.Country, a.Country) {
+				continue
+			}
+			if j.Region == "" && match == nil {
+				match = &c.cfg.Jurisdictions[i]
+			}
+			if j.Region != "" && strings.EqualFold(j.Region, a.State) {
+				return &c.cfg.Jurisdictions[i]
+			}
+		}
+		if match != nil {
+			return match
+		}
+	}
+
+	for i, j := range c.cfg.Jurisdictions {
+		if j.Code == c.cfg.DefaultJurisdiction {
+			return &c.cfg.Jurisdictions[i]
+		}
+	}
+	return nil
+}
+
+// category picks the tax category of a product, given the one set in the catalog
+func (c *TaxCalculator) category(productID string, catalogCategory string) string {
+	if category, ok := c.cfg.ProductCategories[productID]; ok {
+		return category
+	}
+	if catalogCategory != "" {
+		return catalogCategory
+	}
+	return c.cfg.DefaultCategory
+}
+
+// Calculate computes the tax of each line, amounts are what is charged per
+// product once discounts are taken off and categories the catalog tax
+// category of each product
+func (c *TaxCalculator) Calculate(a *Address, amounts map[string]float64, categories map[string]string, productIDs []string) TaxResult {
+	res := TaxResult{Lines: []TaxLine{}}
+	if c == nil {
+		return res
+	}
+
+	j := c.jurisdiction(a)
+	if j == nil {
+		return res
+	}
+	res.Jurisdiction = j.Code
+	res.Inclusive = j.PricesIncludeTax
+
+	for _, id := range productIDs {
+		category := c.category(id, categories[id])
+		rate := j.Rates[category]
+
+		taxable := roundCents(amounts[id])
+		tax := taxable * rate / 100
+		if j.PricesIncludeTax {
+			// The price is gross, the tax is the part of it above the net price
+			tax = taxable - taxable/(1+rate/100)
+		}
+		tax = roundCents(tax)
+
+		res.Total += tax
+		res.Lines = append(res.Lines, TaxLine{
+			ProductID:     id,
+			Category:      category,
+			Rate:          rate,
+			TaxableAmount: taxable,
+			Amount:        tax,
+		})
+	}
+	res.Total = roundCents(res.Total)
+
+	return res
+}
@@ -0,0 +1,131 @@
+package order
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestTaxCalculator(t *testing.T) *TaxCalculator {
+	t.Helper()
+	c, err := NewTaxCalculator(TaxConfig{
+		DefaultJurisdiction: "US-CA",
+		ProductCategories:   map[string]string{"gift-card": "exempt"},
+		Jurisdictions: []Jurisdiction{
+			{Code: "US", Country: "US", Rates: map[string]float64{"standard": 5}},
+			{Code: "US-CA", Country: "US", Region: "CA", Rates: map[string]float64{"standard": 7.25, "food": 0}},
+			{Code: "DE", Country: "DE", PricesIncludeTax: true, Rates: map[string]float64{"standard": 19, "food": 7}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestTaxCalculatorCalculate(t *testing.T) {
+	c := newTestTaxCalculator(t)
+
+	tests := []struct {
+		name       string
+		address    *Address
+		amounts    map[string]float64
+		categories map[string]string
+		want       TaxResult
+	}{
+		{
+			name:    "region",
+			address: &Address{Country: "US", State: "CA"},
+			amounts: map[string]float64{"shirt": 100},
+			want: TaxResult{Jurisdiction: "US-CA", Total: 7.25, Lines: []TaxLine{
+				{ProductID: "shirt", Category: "standard", Rate: 7.25, TaxableAmount: 100, Amount: 7.25},
+			}},
+		},
+		{
+			name:    "country without a matching region",
+			address: &Address{Country: "us", State: "NY"},
+			amounts: map[string]float64{"shirt": 100},
+			want: TaxResult{Jurisdiction: "US", Total: 5, Lines: []TaxLine{
+				{ProductID: "shirt", Category: "standard", Rate: 5, TaxableAmount: 100, Amount: 5},
+			}},
+		},
+		{
+			name:    "default jurisdiction without an address",
+			amounts: map[string]float64{"shirt": 10},
+			want: TaxResult{Jurisdiction: "US-CA", Total: 0.73, Lines: []TaxLine{
+				{ProductID: "shirt", Category: "standard", Rate: 7.25, TaxableAmount: 10, Amount: 0.73},
+			}},
+		},
+		{
+			name:       "catalog category",
+			address:    &Address{Country: "DE"},
+			amounts:    map[string]float64{"bread": 10.7, "shirt": 11.9},
+			categories: map[string]string{"bread": "food"},
+			want: TaxResult{Jurisdiction: "DE", Inclusive: true, Total: 2.6, Lines: []TaxLine{
+				{ProductID: "bread", Category: "food", Rate: 7, TaxableAmount: 10.7, Amount: 0.7},
+				{ProductID: "shirt", Category: "standard", Rate: 19, TaxableAmount: 11.9, Amount: 1.9},
+			}},
+		},
+		{
+			name:       "configured category overrides the catalog",
+			address:    &Address{Country: "US", State: "CA"},
+			amounts:    map[string]float64{"gift-card": 50},
+			categories: map[string]string{"gift-card": "standard"},
+			want: TaxResult{Jurisdiction: "US-CA", Total: 0, Lines: []TaxLine{
+				{ProductID: "gift-card", Category: "exempt", Rate: 0, TaxableAmount: 50, Amount: 0},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			productIDs := []string{}
+			for _, id := range []string{"bread", "gift-card", "shirt"} {
+				if _, ok := tt.amounts[id]; ok {
+					productIDs = append(productIDs, id)
+				}
+			}
+
+			got := c.Calculate(tt.address, tt.amounts, tt.categories, productIDs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Calculate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaxCalculatorWithoutTax(t *testing.T) {
+	amounts := map[string]float64{"shirt": 100}
+
+	var none *TaxCalculator
+	if got := none.Calculate(&Address{Country: "US"}, amounts, nil, []string{"shirt"}); got.Total != 0 || len(got.Lines) != 0 {
+		t.Errorf("nil calculator computed %+v", got)
+	}
+
+	c, err := NewTaxCalculator(TaxConfig{Jurisdictions: []Jurisdiction{{Code: "DE", Country: "DE"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Calculate(&Address{Country: "FR"}, amounts, nil, []string{"shirt"}); got.Jurisdiction != "" || len(got.Lines) != 0 {
+		t.Errorf("address outside every jurisdiction computed %+v", got)
+	}
+}
+
+func TestNewTaxCalculatorRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TaxConfig
+	}{
+		{"missing country", TaxConfig{Jurisdictions: []Jurisdiction{{Code: "DE"}}}},
+		{"duplicate code", TaxConfig{Jurisdictions: []Jurisdiction{{Code: "DE", Country: "DE"}, {Code: "DE", Country: "DE"}}}},
+		{"negative rate", TaxConfig{Jurisdictions: []Jurisdiction{{Code: "DE", Country: "DE", Rates: map[string]float64{"standard": -1}}}}},
+		{"unknown default", TaxConfig{DefaultJurisdiction: "FR", Jurisdictions: []Jurisdiction{{Code: "DE", Country: "DE"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTaxCalculator(tt.cfg); err == nil {
+				t.Error("NewTaxCalculator() succeeded")
+			}
+		})
+	}
+}
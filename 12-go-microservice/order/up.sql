@@ -2,12 +2,234 @@ CREATE TABLE IF NOT EXISTS orders (
   id CHAR(27) PRIMARY KEY,
   created_at TIMESTAMP WITH TIME ZONE NOT NULL,
   account_id CHAR(27) NOT NULL,
-  total_price MONEY NOT NULL
+  subtotal MONEY NOT NULL DEFAULT 0,
+  tax_total MONEY NOT NULL DEFAULT 0,
+  tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+  tax_jurisdiction VARCHAR(32) NOT NULL DEFAULT '',
+  total_price MONEY NOT NULL,
+  payment_status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  shipping_address JSONB,
+  -- Set by clients placing an order again after a lost reply, such as subscriptions
+  idempotency_key VARCHAR(64)
 );
 
 CREATE TABLE IF NOT EXISTS order_products (
   order_id CHAR(27) REFERENCES orders (id) ON DELETE CASCADE,
   product_id CHAR(27),
+  -- Empty for products without variants
+  variant_id VARCHAR(27) NOT NULL DEFAULT '',
   quantity INT NOT NULL,
-  PRIMARY KEY (product_id, order_id)
-);
\ No newline at end of file
+  -- Unit price, SKU and options of the variant when the order was placed
+  price MONEY NOT NULL DEFAULT 0,
+  sku VARCHAR(64) NOT NULL DEFAULT '',
+  options JSONB NOT NULL DEFAULT '[]',
+  PRIMARY KEY (product_id, order_id, variant_id)
+);
+
+CREATE INDEX IF NOT EXISTS orders_account_id_idx ON orders (account_id, id);
+CREATE INDEX IF NOT EXISTS orders_created_at_idx ON orders (created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS orders_idempotency_key_idx ON orders (account_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS promotions (
+  id CHAR(27) PRIMARY KEY,
+  code VARCHAR(64) NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT '',
+  type VARCHAR(16) NOT NULL,
+  value DOUBLE PRECISION NOT NULL DEFAULT 0,
+  buy_quantity INT NOT NULL DEFAULT 0,
+  get_quantity INT NOT NULL DEFAULT 0,
+  product_ids TEXT[] NOT NULL DEFAULT '{}',
+  min_spend MONEY NOT NULL DEFAULT 0,
+  usage_limit_per_account INT NOT NULL DEFAULT 0,
+  starts_at TIMESTAMP WITH TIME ZONE,
+  ends_at TIMESTAMP WITH TIME ZONE,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Promotions without a code apply automatically, codes of the others must be unique
+CREATE UNIQUE INDEX IF NOT EXISTS promotions_code_idx ON promotions (code) WHERE code <> '';
+
+-- Line level breakdown of the promotions applied to an order
+CREATE TABLE IF NOT EXISTS order_discounts (
+  order_id CHAR(27) REFERENCES orders (id) ON DELETE CASCADE,
+  promotion_id CHAR(27) REFERENCES promotions (id),
+  code VARCHAR(64) NOT NULL DEFAULT '',
+  product_id CHAR(27) NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  amount MONEY NOT NULL,
+  PRIMARY KEY (order_id, promotion_id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS order_discounts_promotion_id_idx ON order_discounts (promotion_id);
+
+-- Tax of each line of an order, rates are percentages
+CREATE TABLE IF NOT EXISTS order_taxes (
+  order_id CHAR(27) REFERENCES orders (id) ON DELETE CASCADE,
+  product_id CHAR(27) NOT NULL,
+  category VARCHAR(32) NOT NULL,
+  rate DOUBLE PRECISION NOT NULL,
+  taxable_amount MONEY NOT NULL,
+  amount MONEY NOT NULL,
+  PRIMARY KEY (order_id, product_id)
+);
+
+CREATE TABLE IF NOT EXISTS shipments (
+  id CHAR(27) PRIMARY KEY,
+  order_id CHAR(27) NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+  carrier VARCHAR(64) NOT NULL DEFAULT '',
+  tracking_number VARCHAR(64) NOT NULL DEFAULT '',
+  status VARCHAR(16) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  shipped_at TIMESTAMP WITH TIME ZONE,
+  delivered_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS shipments_order_id_idx ON shipments (order_id, created_at);
+
+-- The line items of an order that are part of a shipment, an order may be shipped in several parts
+CREATE TABLE IF NOT EXISTS shipment_items (
+  shipment_id CHAR(27) REFERENCES shipments (id) ON DELETE CASCADE,
+  product_id CHAR(27),
+  variant_id VARCHAR(27) NOT NULL DEFAULT '',
+  quantity INT NOT NULL CHECK (quantity > 0),
+  PRIMARY KEY (shipment_id, product_id, variant_id)
+);
+
+-- Orders whose products are not yet counted in product_pairs
+CREATE TABLE IF NOT EXISTS recommendation_queue (
+  order_id CHAR(27) PRIMARY KEY REFERENCES orders (id) ON DELETE CASCADE
+);
+
+-- Number of orders that contain both products, every pair is stored both ways
+CREATE TABLE IF NOT EXISTS product_pairs (
+  product_id CHAR(27) NOT NULL,
+  related_product_id CHAR(27) NOT NULL,
+  score BIGINT NOT NULL,
+  PRIMARY KEY (product_id, related_product_id)
+);
+
+CREATE INDEX IF NOT EXISTS product_pairs_score_idx ON product_pairs (product_id, score DESC);
+
+-- Order events waiting to be relayed to the broker, written in the transaction
+-- of the change they describe and deleted once published
+CREATE TABLE IF NOT EXISTS outbox_events (
+  seq BIGSERIAL PRIMARY KEY,
+  id CHAR(27) NOT NULL UNIQUE,
+  order_id CHAR(27) NOT NULL,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Partner endpoints notified of order events, an empty event_types means every event
+CREATE TABLE IF NOT EXISTS webhooks (
+  id CHAR(27) PRIMARY KEY,
+  url TEXT NOT NULL,
+  event_types TEXT[] NOT NULL DEFAULT '{}',
+  secret TEXT NOT NULL,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- An order event to send to a webhook. The payload is kept as text so every
+-- attempt signs and sends the same bytes.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id CHAR(27) PRIMARY KEY,
+  webhook_id CHAR(27) NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+  event_id CHAR(27) NOT NULL,
+  event_type VARCHAR(32) NOT NULL,
+  payload TEXT NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP WITH TIME ZONE,
+  last_status_code INT NOT NULL DEFAULT 0,
+  last_error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  delivered_at TIMESTAMP WITH TIME ZONE,
+  UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at DESC);
+
+-- Every request made for a delivery, status_code is 0 when no response was received
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+  delivery_id CHAR(27) NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+  attempted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  status_code INT NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT '',
+  duration_ms INT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS webhook_attempts_delivery_id_idx ON webhook_attempts (delivery_id, attempted_at);
+
+-- An email about an order, at most one of each kind. The recipient is the
+-- email of the account when it was last attempted.
+CREATE TABLE IF NOT EXISTS order_notifications (
+  id CHAR(27) PRIMARY KEY,
+  order_id CHAR(27) NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+  kind VARCHAR(32) NOT NULL,
+  recipient VARCHAR(254) NOT NULL DEFAULT '',
+  status VARCHAR(16) NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP WITH TIME ZONE,
+  last_error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  sent_at TIMESTAMP WITH TIME ZONE,
+  UNIQUE (order_id, kind)
+);
+
+CREATE INDEX IF NOT EXISTS order_notifications_due_idx ON order_notifications (next_attempt_at) WHERE status = 'pending';
+
+-- The last invoice number. It is taken in the transaction storing an invoice,
+-- so a failed invoice gives its number back.
+CREATE TABLE IF NOT EXISTS invoice_numbers (
+  id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+  last_seq BIGINT NOT NULL
+);
+
+INSERT INTO invoice_numbers (id, last_seq) VALUES (TRUE, 0) ON CONFLICT DO NOTHING;
+
+-- Invoices are kept as issued, deleting an order with an invoice fails
+CREATE TABLE IF NOT EXISTS invoices (
+  order_id CHAR(27) PRIMARY KEY REFERENCES orders (id),
+  seq BIGINT NOT NULL UNIQUE,
+  number VARCHAR(32) NOT NULL UNIQUE,
+  issued_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  html TEXT NOT NULL,
+  pdf BYTEA NOT NULL
+);
+
+-- Orders placed again every interval_count intervals. Products are kept as
+-- JSON like shipping addresses, they are only read along with the subscription.
+CREATE TABLE IF NOT EXISTS subscriptions (
+  id CHAR(27) PRIMARY KEY,
+  account_id CHAR(27) NOT NULL,
+  products JSONB NOT NULL,
+  shipping_address JSONB,
+  run_interval VARCHAR(8) NOT NULL,
+  interval_count INT NOT NULL DEFAULT 1,
+  next_run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS subscriptions_account_id_idx ON subscriptions (account_id, created_at);
+CREATE INDEX IF NOT EXISTS subscriptions_due_idx ON subscriptions (next_run_at) WHERE status = 'active';
+
+-- The order of a subscription for one scheduled time, its id is the
+-- idempotency key of the order
+CREATE TABLE IF NOT EXISTS subscription_runs (
+  id CHAR(27) PRIMARY KEY,
+  subscription_id CHAR(27) NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+  scheduled_for TIMESTAMP WITH TIME ZONE NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  order_id CHAR(27) NOT NULL DEFAULT '',
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP WITH TIME ZONE,
+  last_error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  UNIQUE (subscription_id, scheduled_for)
+);
+
+CREATE INDEX IF NOT EXISTS subscription_runs_due_idx ON subscription_runs (next_attempt_at) WHERE status = 'pending';
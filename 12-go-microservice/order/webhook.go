@@ -0,0 +1,515 @@
+package order
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/broker"
+	"github.com/segmentio/ksuid"
+)
+
+var (
+	ErrInvalidWebhook          = errors.New("invalid webhook")
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	errWebhookHostNotPublic    = errors.New("webhook host is not a public address")
+)
+
+// Webhook headers. The signature is the hex HMAC-SHA256 of the timestamp, a
+// dot and the body, keyed with the secret of the webhook, prefixed with v1=.
+// Receivers should reject timestamps that are too old to prevent replays.
+const (
+	WebhookIDHeader        = "Webhook-Id"
+	WebhookEventHeader     = "Webhook-Event"
+	WebhookTimestampHeader = "Webhook-Timestamp"
+	WebhookSignatureHeader = "Webhook-Signature"
+)
+
+// Webhook posts order events to URL. EventTypes restricts the events sent,
+// empty means every event.
+type Webhook struct {
+	ID         string
+	URL        string
+	EventTypes []OrderEventType
+	Secret     string
+	Active     bool
+	CreatedAt  time.Time
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	// DeliveryFailed deliveries ran out of attempts, they are only sent again when redelivered
+	DeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an order event sent to a webhook, Payload is the body
+// posted on every attempt
+type WebhookDelivery struct {
+	ID             string
+	WebhookID      string
+	EventID        string
+	EventType      OrderEventType
+	Payload        []byte
+	Status         WebhookDeliveryStatus
+	Attempts       uint32
+	NextAttemptAt  *time.Time
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+	AttemptLog     []WebhookAttempt
+}
+
+// WebhookAttempt is one request of a delivery. StatusCode is 0 when no
+// response was received, Error is set for every failure.
+type WebhookAttempt struct {
+	AttemptedAt time.Time
+	StatusCode  int
+	Error       string
+	Duration    time.Duration
+}
+
+// ClaimedWebhookDelivery is a due delivery along with the webhook it is sent to
+type ClaimedWebhookDelivery struct {
+	Webhook  Webhook
+	Delivery WebhookDelivery
+}
+
+// NewWebhookSecret returns a random secret for signing webhook payloads
+func NewWebhookSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// SignWebhook returns the signature header of body sent at timestamp
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp.Unix())
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature of a received webhook and that it was
+// sent less than tolerance ago
+func VerifyWebhook(secret string, timestampHeader string, signatureHeader string, body []byte, tolerance time.Duration) bool {
+	unix, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	timestamp := time.Unix(unix, 0)
+	if age := time.Since(timestamp); age > tolerance || age < -tolerance {
+		return false
+	}
+
+	expected := SignWebhook(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signatureHeader))
+}
+
+// nonPublicPrefixes are the special purpose ranges not covered by the
+// netip.Addr checks in isPublicAddr
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// isPublicAddr tells whether ip is reachable on the internet, so webhooks
+// cannot be pointed at the order service itself, its network or cloud
+// metadata endpoints
+func isPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPublicHost resolves host and fails unless all its addresses are public
+func checkPublicHost(ctx context.Context, host string) error {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !isPublicAddr(ip) {
+			return errWebhookHostNotPublic
+		}
+		return nil
+	}
+
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !isPublicAddr(ip) {
+			return errWebhookHostNotPublic
+		}
+	}
+	return nil
+}
+
+// dialPublic refuses connections to non-public addresses. It runs once the
+// host is resolved, so a DNS record changed after the webhook was validated
+// cannot point it at an internal address either.
+func dialPublic(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddr(ip) {
+		return fmt.Errorf("%w: %s", errWebhookHostNotPublic, ip)
+	}
+	return nil
+}
+
+func (w *Webhook) validate(ctx context.Context) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if err := checkPublicHost(ctx, u.Hostname()); err != nil {
+		return fmt.Errorf("%w: url host %s: %v", ErrInvalidWebhook, u.Hostname(), err)
+	}
+
+	seen := map[OrderEventType]bool{}
+	types := []OrderEventType{}
+	for _, t := range w.EventTypes {
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	w.EventTypes = types
+
+	return nil
+}
+
+func (w Webhook) subscribes(t OrderEventType) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, et := range w.EventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseOrderEventTypes reads event type names such as created, as used in the
+// API and on the broker
+func ParseOrderEventTypes(names []string) ([]OrderEventType, error) {
+	types := []OrderEventType{}
+	for _, name := range names {
+		var t OrderEventType
+		if err := t.UnmarshalText([]byte(name)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// CreateWebhook generates a secret when none is given. The secret is only
+// returned when the webhook is created or its secret changed.
+func (s orderService) CreateWebhook(ctx context.Context, w Webhook) (*Webhook, error) {
+	if err := w.validate(ctx); err != nil {
+		return nil, err
+	}
+
+	w.ID = ksuid.New().String()
+	w.CreatedAt = time.Now().UTC()
+	if w.Secret == "" {
+		w.Secret = NewWebhookSecret()
+	}
+	if err := s.repository.PutWebhook(ctx, w); err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// UpdateWebhook replaces the URL, event types and active flag of the webhook.
+// The secret is only changed when one is given.
+func (s orderService) UpdateWebhook(ctx context.Context, w Webhook) (*Webhook, error) {
+	if err := w.validate(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.UpdateWebhook(ctx, w); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repository.GetWebhookByID(ctx, w.ID)
+	if err != nil {
+		return nil, err
+	}
+	if w.Secret == "" {
+		updated.Secret = ""
+	}
+	return updated, nil
+}
+
+// DeleteWebhook removes the webhook along with its deliveries
+func (s orderService) DeleteWebhook(ctx context.Context, id string) error {
+	return s.repository.DeleteWebhook(ctx, id)
+}
+
+func (s orderService) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	webhooks, err := s.repository.GetWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// GetWebhookDeliveries returns the deliveries of a webhook with their
+// attempts, newest first
+func (s orderService) GetWebhookDeliveries(ctx context.Context, webhookID string, skip uint64, take uint64) ([]WebhookDelivery, error) {
+	if take > 100 || (skip == 0 && take == 0) {
+		take = 100
+	}
+
+	if _, err := s.repository.GetWebhookByID(ctx, webhookID); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetWebhookDeliveries(ctx, webhookID, skip, take)
+}
+
+// RedeliverWebhook sends a delivery again as soon as possible, with a new
+// round of attempts. Earlier attempts stay in its log.
+func (s orderService) RedeliverWebhook(ctx context.Context, deliveryID string) (*WebhookDelivery, error) {
+	if err := s.repository.ResetWebhookDelivery(ctx, deliveryID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetWebhookDeliveryByID(ctx, deliveryID)
+}
+
+type WebhookConfig struct {
+	Interval  time.Duration `envconfig:"INTERVAL" default:"1s"`
+	BatchSize int           `envconfig:"BATCH_SIZE" default:"20"`
+	// Timeout of a single request, a slower endpoint counts as a failure
+	Timeout time.Duration `envconfig:"TIMEOUT" default:"10s"`
+	// Retries wait InitialBackoff, then twice as long each time up to MaxBackoff
+	MaxAttempts    uint32        `envconfig:"MAX_ATTEMPTS" default:"8"`
+	InitialBackoff time.Duration `envconfig:"INITIAL_BACKOFF" default:"30s"`
+	MaxBackoff     time.Duration `envconfig:"MAX_BACKOFF" default:"1h"`
+}
+
+func (c WebhookConfig) Validate() error {
+	if c.Interval <= 0 || c.BatchSize < 1 || c.Timeout <= 0 || c.MaxAttempts < 1 || c.InitialBackoff <= 0 {
+		return fmt.Errorf("%w: WEBHOOKS_INTERVAL, WEBHOOKS_BATCH_SIZE, WEBHOOKS_TIMEOUT, WEBHOOKS_MAX_ATTEMPTS and WEBHOOKS_INITIAL_BACKOFF must be positive", bootstrap.ErrInvalidConfig)
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		return fmt.Errorf("%w: WEBHOOKS_MAX_BACKOFF is below WEBHOOKS_INITIAL_BACKOFF", bootstrap.ErrInvalidConfig)
+	}
+	return nil
+}
+
+// backoff is the delay before the attempt following the given number of
+// attempts, doubling from initial up to max
+func backoff(initial time.Duration, max time.Duration, attempts uint32) time.Duration {
+	d := initial
+	for i := uint32(1); i < attempts && d < max; i++ {
+		d *= 2
+	}
+	return min(d, max)
+}
+
+// RunWebhookDispatcher turns the order events on b into deliveries of the
+// webhooks subscribed to them, and sends due deliveries until ctx is done.
+func RunWebhookDispatcher(ctx context.Context, r Repository, b broker.Broker, cfg WebhookConfig) {
+	consumed := make(chan struct{})
+	defer func() { <-consumed }()
+	go func() {
+		defer close(consumed)
+		consumeOrderEvents(ctx, b, "webhooks", cfg.Interval, func(ctx context.Context, e OrderEvent) error {
+			return queueWebhookDeliveries(ctx, r, e)
+		})
+	}()
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout, Control: dialPublic}
+	client := &http.Client{
+		// Requests go straight to the webhook, a proxy would be dialed instead of it
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: cfg.Timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		Timeout: cfg.Timeout,
+		// A redirect is a failure, the webhook URL should be updated instead
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := sendWebhookDeliveries(ctx, r, client, cfg)
+			if err != nil {
+				log.Printf("Error sending webhooks: %v", err)
+				break
+			}
+			if n < cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// queueWebhookDeliveries creates a delivery of e for every active webhook
+// subscribed to its type. A redelivered event is only queued once per webhook.
+func queueWebhookDeliveries(ctx context.Context, r Repository, e OrderEvent) error {
+	webhooks, err := r.GetWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	deliveries := []WebhookDelivery{}
+	for _, w := range webhooks {
+		if !w.Active || !w.subscribes(e.Type) {
+			continue
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			ID:            ksuid.New().String(),
+			WebhookID:     w.ID,
+			EventID:       e.ID,
+			EventType:     e.Type,
+			Payload:       payload,
+			Status:        DeliveryPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.PutWebhookDeliveries(ctx, deliveries)
+}
+
+// sendWebhookDeliveries sends a batch of due deliveries, returning how many
+// were sent
+func sendWebhookDeliveries(ctx context.Context, r Repository, client *http.Client, cfg WebhookConfig) (int, error) {
+	// Claimed deliveries are not due again until the lease is over, in case
+	// this process stops before recording the attempts
+	lease := time.Duration(cfg.BatchSize)*cfg.Timeout + time.Minute
+	claimed, err := r.ClaimWebhookDeliveries(ctx, cfg.BatchSize, time.Now().UTC(), lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, c := range claimed {
+		attempt := sendWebhook(ctx, client, c.Webhook, c.Delivery)
+
+		c.Delivery.Attempts++
+		c.Delivery.LastStatusCode = attempt.StatusCode
+		c.Delivery.LastError = attempt.Error
+		switch {
+		case attempt.Error == "":
+			c.Delivery.Status = DeliverySucceeded
+			c.Delivery.NextAttemptAt = nil
+			c.Delivery.DeliveredAt = &attempt.AttemptedAt
+		case c.Delivery.Attempts >= cfg.MaxAttempts:
+			c.Delivery.Status = DeliveryFailed
+			c.Delivery.NextAttemptAt = nil
+		default:
+			next := attempt.AttemptedAt.Add(backoff(cfg.InitialBackoff, cfg.MaxBackoff, c.Delivery.Attempts))
+			c.Delivery.NextAttemptAt = &next
+		}
+
+		if err := r.RecordWebhookAttempt(ctx, c.Delivery, attempt); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(claimed), nil
+}
+
+// sendWebhook posts a delivery once, any response other than 2xx is a failure
+func sendWebhook(ctx context.Context, client *http.Client, w Webhook, d WebhookDelivery) WebhookAttempt {
+	attempt := WebhookAttempt{AttemptedAt: time.Now().UTC()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "order-webhooks/1")
+	req.Header.Set(WebhookIDHeader, d.ID)
+	req.Header.Set(WebhookEventHeader, d.EventType.String())
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(attempt.AttemptedAt.Unix(), 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(w.Secret, attempt.AttemptedAt, d.Payload))
+
+	res, err := client.Do(req)
+	attempt.Duration = time.Since(attempt.AttemptedAt)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	// Drained so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %s", res.Status)
+	}
+	return attempt
+}
@@ -0,0 +1,158 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"type":"created"}`)
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := SignWebhook(secret, now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		want      bool
+	}{
+		{"valid", secret, timestamp, signature, body, true},
+		{"other secret", "whsec_other", timestamp, signature, body, false},
+		{"other body", secret, timestamp, signature, []byte(`{"type":"paid"}`), false},
+		{"other timestamp", secret, strconv.FormatInt(now.Unix()-1, 10), signature, body, false},
+		{"too old", secret, strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10), SignWebhook(secret, now.Add(-10*time.Minute), body), body, false},
+		{"too far ahead", secret, strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10), SignWebhook(secret, now.Add(10*time.Minute), body), body, false},
+		{"malformed timestamp", secret, "now", signature, body, false},
+		{"missing signature", secret, timestamp, "", body, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyWebhook(tt.secret, tt.timestamp, tt.signature, tt.body, 5*time.Minute); got != tt.want {
+				t.Errorf("VerifyWebhook() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts uint32
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{7, 30 * time.Minute},
+		{100, 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(30*time.Second, 30*time.Minute, tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.5", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://93.184.216.34/hooks", false},
+		{"http://[2606:2800:220:1:248:1893:25c8:1946]:8080/hooks", false},
+		{"ftp://93.184.216.34/hooks", true},
+		{"/hooks", true},
+		{"https:///hooks", true},
+		{"http://127.0.0.1:8080/hooks", true},
+		{"http://localhost/hooks", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://10.1.2.3/hooks", true},
+		{"http://[::1]/hooks", true},
+		{"http://user@192.168.0.1/hooks", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := Webhook{URL: tt.url}
+			err := w.validate(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidWebhook) {
+				t.Errorf("validate() = %v, want ErrInvalidWebhook", err)
+			}
+		})
+	}
+}
+
+func TestWebhookValidateDeduplicatesEventTypes(t *testing.T) {
+	w := Webhook{URL: "https://93.184.216.34/hooks", EventTypes: []OrderEventType{OrderCreated, OrderPaymentStatusChanged, OrderCreated}}
+	if err := w.validate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.EventTypes) != 2 || w.EventTypes[0] != OrderCreated || w.EventTypes[1] != OrderPaymentStatusChanged {
+		t.Errorf("EventTypes = %v", w.EventTypes)
+	}
+}
+
+func TestDialPublicRefusesInternalAddresses(t *testing.T) {
+	// The URL passed validation, but the host now resolves to this machine
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback address")
+	}))
+	defer server.Close()
+
+	dialer := &net.Dialer{Timeout: time.Second, Control: dialPublic}
+	client := &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+
+	attempt := sendWebhook(context.Background(), client, Webhook{URL: server.URL, Secret: "whsec_test"}, WebhookDelivery{ID: "d", Payload: []byte("{}")})
+	if attempt.Error == "" || attempt.StatusCode != 0 {
+		t.Errorf("attempt = %+v, want a connection error", attempt)
+	}
+}
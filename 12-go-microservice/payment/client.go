@@ -0,0 +1,149 @@
+package payment
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/payment/pb"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+	"google.golang.org/grpc"
+)
+
+// Only idempotent calls are retried. Capture and void are idempotent, but authorize and refund are not.
+var retryableMethods = []string{
+	"CapturePayment",
+	"VoidPayment",
+	"GetPayment",
+	"GetPaymentsForOrder",
+}
+
+type Client struct {
+	conn    *grpc.ClientConn
+	service pb.PaymentServiceClient
+}
+
+func NewClient(url string, cfg resilience.Config) (*Client, error) {
+	conn, err := resilience.Dial(url, pb.PaymentService_ServiceDesc.ServiceName, retryableMethods, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := pb.NewPaymentServiceClient(conn)
+	return &Client{conn, c}, nil
+}
+
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+func (c *Client) AuthorizePayment(ctx context.Context, orderID string, source string) (*Payment, error) {
+	r, err := c.service.AuthorizePayment(ctx, &pb.AuthorizePaymentRequest{
+		OrderId: orderID,
+		Source:  source,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return paymentFromProto(r.Payment), nil
+}
+
+func (c *Client) CapturePayment(ctx context.Context, paymentID string) (*Payment, error) {
+	r, err := c.service.CapturePayment(ctx, &pb.CapturePaymentRequest{
+		PaymentId: paymentID,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return paymentFromProto(r.Payment), nil
+}
+
+// RefundPayment refunds amount of the payment, or what is left of it when amount is 0
+func (c *Client) RefundPayment(ctx context.Context, paymentID string, amount float64) (*Payment, error) {
+	r, err := c.service.RefundPayment(ctx, &pb.RefundPaymentRequest{
+		PaymentId: paymentID,
+		Amount:    amount,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return paymentFromProto(r.Payment), nil
+}
+
+// VoidPayment releases the authorization of a payment that was not captured
+func (c *Client) VoidPayment(ctx context.Context, paymentID string) (*Payment, error) {
+	r, err := c.service.VoidPayment(ctx, &pb.VoidPaymentRequest{
+		PaymentId: paymentID,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return paymentFromProto(r.Payment), nil
+}
+
+func (c *Client) GetPayment(ctx context.Context, id string) (*Payment, error) {
+	r, err := c.service.GetPayment(ctx, &pb.GetPaymentRequest{
+		Id: id,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return paymentFromProto(r.Payment), nil
+}
+
+func (c *Client) GetPaymentsForOrder(ctx context.Context, orderID string) ([]Payment, error) {
+	r, err := c.service.GetPaymentsForOrder(ctx, &pb.GetPaymentsForOrderRequest{
+		OrderId: orderID,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	payments := []Payment{}
+	for _, p := range r.Payments {
+		payments = append(payments, *paymentFromProto(p))
+	}
+	return payments, nil
+}
+
+func paymentFromProto(p *pb.Payment) *Payment {
+	payment := &Payment{
+		ID:                p.Id,
+		OrderID:           p.OrderId,
+		AccountID:         p.AccountId,
+		Amount:            p.Amount,
+		RefundedAmount:    p.RefundedAmount,
+		Status:            PaymentStatus(p.Status),
+		Provider:          p.Provider,
+		ProviderReference: p.ProviderReference,
+		FailureReason:     p.FailureReason,
+		Attempts:          []Attempt{},
+	}
+	payment.CreatedAt = time.Time{}
+	payment.CreatedAt.UnmarshalBinary(p.CreatedAt)
+	payment.UpdatedAt = time.Time{}
+	payment.UpdatedAt.UnmarshalBinary(p.UpdatedAt)
+
+	for _, a := range p.Attempts {
+		attempt := Attempt{
+			Operation: a.Operation,
+			Amount:    a.Amount,
+			Succeeded: a.Succeeded,
+			Error:     a.Error,
+		}
+		attempt.CreatedAt.UnmarshalBinary(a.CreatedAt)
+		payment.Attempts = append(payment.Attempts, attempt)
+	}
+
+	return payment
+}
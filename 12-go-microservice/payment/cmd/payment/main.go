@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/payment"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+)
+
+type Config struct {
+	bootstrap.Config
+	Database bootstrap.DatabaseConfig `envconfig:"DATABASE"`
+	OrderURL string                   `envconfig:"ORDER_SERVICE_URL" required:"true"`
+	Provider string                   `envconfig:"PAYMENT_PROVIDER" default:"fake"`
+
+	RPC          resilience.Config          `envconfig:"RPC"`
+	FakeProvider payment.FakeProviderConfig `envconfig:"FAKE_PAYMENT"`
+}
+
+func main() {
+	var cfg Config
+	if err := bootstrap.Load(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	bootstrap.Banner("payment", &cfg)
+
+	// Provider
+	var p payment.Provider
+	switch cfg.Provider {
+	case "fake":
+		p = payment.NewFakeProvider(cfg.FakeProvider)
+	default:
+		log.Fatalf("Unknown payment provider %q", cfg.Provider)
+	}
+
+	// Repository
+	r, err := bootstrap.WaitFor(cfg.Startup, "database", func() (payment.Repository, error) {
+		return payment.NewPostgresRepository(cfg.Database)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+	log.Printf("Listening on port %d...", cfg.Port)
+
+	// Service
+	s := payment.NewService(r, p)
+	log.Fatal(payment.ListenGRPC(s, cfg.OrderURL, cfg.RPC, cfg.Port))
+}
@@ -0,0 +1,91 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FakeProviderConfig controls how the fake provider behaves, so failures can
+// be reproduced locally without a real processor
+type FakeProviderConfig struct {
+	// Delay is added to every call, to simulate a slow processor
+	Delay time.Duration `envconfig:"DELAY" default:"0s"`
+	// DeclineSources are sources whose authorizations are declined
+	DeclineSources []string `envconfig:"DECLINE_SOURCES" default:"tok_decline"`
+	// CaptureFailSources are sources that can be authorized but not captured
+	CaptureFailSources []string `envconfig:"CAPTURE_FAIL_SOURCES" default:"tok_capture_fail"`
+	// DeclineAbove declines authorizations over this amount, 0 disables it
+	DeclineAbove float64 `envconfig:"DECLINE_ABOVE" default:"0"`
+}
+
+// FakeProvider is a deterministic in-process provider: the outcome of a call
+// only depends on its input and the configuration
+type FakeProvider struct {
+	cfg FakeProviderConfig
+}
+
+func NewFakeProvider(cfg FakeProviderConfig) *FakeProvider {
+	return &FakeProvider{cfg}
+}
+
+func (f *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *FakeProvider) Authorize(ctx context.Context, p Payment, source string) (string, error) {
+	if err := f.wait(ctx); err != nil {
+		return "", err
+	}
+
+	if contains(f.cfg.DeclineSources, source) {
+		return "", fmt.Errorf("%w: source %s was declined", ErrDeclined, source)
+	}
+	if f.cfg.DeclineAbove > 0 && p.Amount > f.cfg.DeclineAbove {
+		return "", fmt.Errorf("%w: amount %.2f is over the limit", ErrDeclined, p.Amount)
+	}
+
+	return "fake_" + p.ID, nil
+}
+
+func (f *FakeProvider) Capture(ctx context.Context, p Payment) error {
+	if err := f.wait(ctx); err != nil {
+		return err
+	}
+
+	if contains(f.cfg.CaptureFailSources, p.Source) {
+		return fmt.Errorf("%w: capture was refused for source %s", ErrDeclined, p.Source)
+	}
+
+	return nil
+}
+
+func (f *FakeProvider) Refund(ctx context.Context, p Payment, amount float64) error {
+	return f.wait(ctx)
+}
+
+func (f *FakeProvider) Void(ctx context.Context, p Payment) error {
+	return f.wait(ctx)
+}
+
+func (f *FakeProvider) wait(ctx context.Context) error {
+	if f.cfg.Delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(f.cfg.Delay):
+		return nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
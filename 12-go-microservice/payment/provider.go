@@ -0,0 +1,26 @@
+package payment
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrDeclined is returned, possibly wrapped, when a provider refuses a payment
+	ErrDeclined = errors.New("payment declined")
+)
+
+// Provider is the payment processor that actually moves the money. A payment
+// is authorized first, which reserves the amount, and captured later.
+type Provider interface {
+	Name() string
+	// Authorize reserves the payment amount on source and returns the
+	// provider's reference for it
+	Authorize(ctx context.Context, p Payment, source string) (string, error)
+	Capture(ctx context.Context, p Payment) error
+	Refund(ctx context.Context, p Payment, amount float64) error
+	// Void releases the amount reserved for an authorization that is not
+	// captured. Pending payments have no reference yet, their ID identifies
+	// the authorization, and voiding one that was never made succeeds.
+	Void(ctx context.Context, p Payment) error
+}
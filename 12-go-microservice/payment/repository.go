@@ -0,0 +1,258 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPaymentNotFound  = errors.New("payment not found")
+	ErrOrderHasPayment  = errors.New("order already has an active payment")
+	ErrConcurrentUpdate = errors.New("payment was updated concurrently")
+)
+
+const uniqueViolation = pq.ErrorCode("23505")
+
+type Repository interface {
+	Close()
+	PutPayment(ctx context.Context, p Payment) error
+	UpdatePayment(ctx context.Context, p Payment, a Attempt) error
+	GetPaymentByID(ctx context.Context, id string) (*Payment, error)
+	GetPaymentsForOrder(ctx context.Context, orderID string) ([]Payment, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func (r *postgresRepository) Close() {
+	r.db.Close()
+}
+
+// PutPayment stores a new payment. It fails with ErrOrderHasPayment when the
+// order already has a pending or active payment.
+func (r *postgresRepository) PutPayment(ctx context.Context, p Payment) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`
+		INSERT INTO payments(id, order_id, account_id, amount, refunded_amount, status, source, provider, provider_reference, failure_reason, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`,
+		p.ID,
+		p.OrderID,
+		p.AccountID,
+		p.Amount,
+		p.RefundedAmount,
+		p.Status,
+		p.Source,
+		p.Provider,
+		p.ProviderReference,
+		p.FailureReason,
+		p.CreatedAt,
+		p.UpdatedAt,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrOrderHasPayment
+		}
+	}
+
+	return err
+}
+
+// UpdatePayment saves the payment and records the attempt. It fails with
+// ErrConcurrentUpdate when the payment changed since it was read.
+func (r *postgresRepository) UpdatePayment(ctx context.Context, p Payment, a Attempt) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	res, err := tx.ExecContext(
+		ctx,
+		`
+		UPDATE payments
+		SET refunded_amount = $3, status = $4, failure_reason = $5, updated_at = $6, version = version + 1
+		WHERE id = $1 AND version = $2
+		`,
+		p.ID,
+		p.version,
+		p.RefundedAmount,
+		p.Status,
+		p.FailureReason,
+		p.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrConcurrentUpdate
+	}
+
+	return putAttempt(ctx, tx, p.ID, a)
+}
+
+func putAttempt(ctx context.Context, tx *sql.Tx, paymentID string, a Attempt) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`
+		INSERT INTO payment_attempts(payment_id, operation, amount, succeeded, error, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`,
+		paymentID,
+		a.Operation,
+		a.Amount,
+		a.Succeeded,
+		a.Error,
+		a.CreatedAt,
+	)
+
+	return err
+}
+
+const paymentColumns = `
+	id,
+	order_id,
+	account_id,
+	amount::numeric::float8,
+	refunded_amount::numeric::float8,
+	status,
+	source,
+	provider,
+	provider_reference,
+	failure_reason,
+	created_at,
+	updated_at,
+	version
+`
+
+func (r *postgresRepository) GetPaymentByID(ctx context.Context, id string) (*Payment, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := r.scanPayments(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payments) == 0 {
+		return nil, ErrPaymentNotFound
+	}
+
+	return &payments[0], nil
+}
+
+func (r *postgresRepository) GetPaymentsForOrder(ctx context.Context, orderID string) ([]Payment, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE order_id = $1 ORDER BY created_at", orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanPayments(ctx, rows)
+}
+
+// scanPayments reads payments selected with paymentColumns and loads their attempts
+func (r *postgresRepository) scanPayments(ctx context.Context, rows *sql.Rows) ([]Payment, error) {
+	defer rows.Close()
+
+	payments := []Payment{}
+	for rows.Next() {
+		p := Payment{}
+		if err := rows.Scan(
+			&p.ID,
+			&p.OrderID,
+			&p.AccountID,
+			&p.Amount,
+			&p.RefundedAmount,
+			&p.Status,
+			&p.Source,
+			&p.Provider,
+			&p.ProviderReference,
+			&p.FailureReason,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.version,
+		); err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range payments {
+		attempts, err := r.getAttempts(ctx, payments[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		payments[i].Attempts = attempts
+	}
+
+	return payments, nil
+}
+
+func (r *postgresRepository) getAttempts(ctx context.Context, paymentID string) ([]Attempt, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`
+		SELECT
+			operation,
+			amount::numeric::float8,
+			succeeded,
+			error,
+			created_at
+		FROM payment_attempts
+		WHERE payment_id = $1
+		ORDER BY id
+		`,
+		paymentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	attempts := []Attempt{}
+	for rows.Next() {
+		a := Attempt{}
+		if err := rows.Scan(&a.Operation, &a.Amount, &a.Succeeded, &a.Error, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+
+	return attempts, rows.Err()
+}
+
+func NewPostgresRepository(cfg bootstrap.DatabaseConfig) (Repository, error) {
+	db, err := cfg.Open("postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresRepository{db}, nil
+}
@@ -0,0 +1,197 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/payment/pb"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrOrderNotPayable = errors.New("order is not awaiting payment")
+)
+
+type grpcServer struct {
+	pb.UnimplementedPaymentServiceServer
+	service     Service
+	orderClient *order.Client
+}
+
+func ListenGRPC(s Service, orderURL string, rpc resilience.Config, port int) error {
+	orderClient, err := order.NewClient(orderURL, rpc)
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		orderClient.Close()
+		return err
+	}
+
+	serv := grpc.NewServer()
+	pb.RegisterPaymentServiceServer(serv, &grpcServer{
+		service:     s,
+		orderClient: orderClient,
+	})
+	reflection.Register(serv)
+	return serv.Serve(lis)
+}
+
+// AuthorizePayment authorizes the total of the order, the amount is never taken from the caller.
+// Orders with a total of 0 are captured and marked paid at once.
+func (s *grpcServer) AuthorizePayment(ctx context.Context, r *pb.AuthorizePaymentRequest) (*pb.AuthorizePaymentResponse, error) {
+	o, err := s.orderClient.GetOrder(ctx, r.OrderId)
+	if err != nil {
+		log.Printf("Error getting order %s: %v", r.OrderId, err)
+		return nil, err
+	}
+
+	if o.PaymentStatus != order.PaymentPending {
+		return nil, paymentError(ErrOrderNotPayable)
+	}
+
+	p, err := s.service.Authorize(ctx, o.ID, o.AccountID, o.TotalPrice, r.Source)
+	if err != nil {
+		log.Println(err)
+		return nil, paymentError(err)
+	}
+
+	// Free orders are paid as soon as they are authorized
+	if p.Captured() {
+		if err := s.syncOrder(ctx, p); err != nil {
+			return nil, err
+		}
+	}
+
+	return &pb.AuthorizePaymentResponse{Payment: paymentToProto(p)}, nil
+}
+
+// CapturePayment captures the payment and only then marks the order as paid.
+// If marking the order fails the capture can be retried, it is idempotent.
+func (s *grpcServer) CapturePayment(ctx context.Context, r *pb.CapturePaymentRequest) (*pb.CapturePaymentResponse, error) {
+	p, err := s.service.Capture(ctx, r.PaymentId)
+	if err != nil {
+		log.Println(err)
+		return nil, paymentError(err)
+	}
+
+	if err := s.syncOrder(ctx, p); err != nil {
+		return nil, err
+	}
+
+	return &pb.CapturePaymentResponse{Payment: paymentToProto(p)}, nil
+}
+
+func (s *grpcServer) RefundPayment(ctx context.Context, r *pb.RefundPaymentRequest) (*pb.RefundPaymentResponse, error) {
+	p, err := s.service.Refund(ctx, r.PaymentId, r.Amount)
+	if err != nil {
+		log.Println(err)
+		return nil, paymentError(err)
+	}
+
+	if err := s.syncOrder(ctx, p); err != nil {
+		return nil, err
+	}
+
+	return &pb.RefundPaymentResponse{Payment: paymentToProto(p)}, nil
+}
+
+// VoidPayment releases an authorization, the order stays pending and can be
+// paid with another payment
+func (s *grpcServer) VoidPayment(ctx context.Context, r *pb.VoidPaymentRequest) (*pb.VoidPaymentResponse, error) {
+	p, err := s.service.Void(ctx, r.PaymentId)
+	if err != nil {
+		log.Println(err)
+		return nil, paymentError(err)
+	}
+
+	return &pb.VoidPaymentResponse{Payment: paymentToProto(p)}, nil
+}
+
+func (s *grpcServer) GetPayment(ctx context.Context, r *pb.GetPaymentRequest) (*pb.GetPaymentResponse, error) {
+	p, err := s.service.GetPayment(ctx, r.Id)
+	if err != nil {
+		log.Println(err)
+		return nil, paymentError(err)
+	}
+
+	return &pb.GetPaymentResponse{Payment: paymentToProto(p)}, nil
+}
+
+func (s *grpcServer) GetPaymentsForOrder(ctx context.Context, r *pb.GetPaymentsForOrderRequest) (*pb.GetPaymentsForOrderResponse, error) {
+	payments, err := s.service.GetPaymentsForOrder(ctx, r.OrderId)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	res := &pb.GetPaymentsForOrderResponse{Payments: []*pb.Payment{}}
+	for i := range payments {
+		res.Payments = append(res.Payments, paymentToProto(&payments[i]))
+	}
+	return res, nil
+}
+
+// syncOrder updates the payment status of the order to match the payment
+func (s *grpcServer) syncOrder(ctx context.Context, p *Payment) error {
+	_, err := s.orderClient.UpdatePaymentStatus(ctx, p.OrderID, p.OrderStatus())
+	if err != nil {
+		log.Printf("Error marking order %s as %s: %v", p.OrderID, p.OrderStatus(), err)
+	}
+	return err
+}
+
+func paymentError(err error) error {
+	switch {
+	case errors.Is(err, ErrPaymentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidAmount):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrInvalidState), errors.Is(err, ErrOrderHasPayment), errors.Is(err, ErrOrderNotPayable), errors.Is(err, ErrDeclined):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrConcurrentUpdate):
+		return status.Error(codes.Aborted, err.Error())
+	default:
+		return err
+	}
+}
+
+func paymentToProto(p *Payment) *pb.Payment {
+	res := &pb.Payment{
+		Id:                p.ID,
+		OrderId:           p.OrderID,
+		AccountId:         p.AccountID,
+		Amount:            p.Amount,
+		RefundedAmount:    p.RefundedAmount,
+		Status:            string(p.Status),
+		Provider:          p.Provider,
+		ProviderReference: p.ProviderReference,
+		FailureReason:     p.FailureReason,
+		Attempts:          []*pb.PaymentAttempt{},
+	}
+	res.CreatedAt, _ = p.CreatedAt.MarshalBinary()
+	res.UpdatedAt, _ = p.UpdatedAt.MarshalBinary()
+
+	for _, a := range p.Attempts {
+		attempt := &pb.PaymentAttempt{
+			Operation: a.Operation,
+			Amount:    a.Amount,
+			Succeeded: a.Succeeded,
+			Error:     a.Error,
+		}
+		attempt.CreatedAt, _ = a.CreatedAt.MarshalBinary()
+		res.Attempts = append(res.Attempts, attempt)
+	}
+
+	return res
+}
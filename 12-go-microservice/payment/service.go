@@ -0,0 +1,329 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+	"github.com/segmentio/ksuid"
+)
+
+var (
+	ErrInvalidAmount = errors.New("invalid payment amount")
+	ErrInvalidState  = errors.New("operation not allowed in the current payment status")
+)
+
+type Service interface {
+	Authorize(ctx context.Context, orderID string, accountID string, amount float64, source string) (*Payment, error)
+	Capture(ctx context.Context, id string) (*Payment, error)
+	Refund(ctx context.Context, id string, amount float64) (*Payment, error)
+	Void(ctx context.Context, id string) (*Payment, error)
+	GetPayment(ctx context.Context, id string) (*Payment, error)
+	GetPaymentsForOrder(ctx context.Context, orderID string) ([]Payment, error)
+}
+
+type PaymentStatus string
+
+const (
+	// PaymentPending payments are stored before the provider is asked to
+	// authorize them, so the order has a single payment in flight
+	PaymentPending           PaymentStatus = "pending"
+	PaymentAuthorized        PaymentStatus = "authorized"
+	PaymentDeclined          PaymentStatus = "declined"
+	PaymentFailed            PaymentStatus = "failed"
+	PaymentCaptured          PaymentStatus = "captured"
+	PaymentPartiallyRefunded PaymentStatus = "partially_refunded"
+	PaymentRefunded          PaymentStatus = "refunded"
+	// PaymentVoided payments had their authorization released without being
+	// captured, the order can be paid with another payment
+	PaymentVoided PaymentStatus = "voided"
+)
+
+// noProvider is the provider of payments settled without calling one
+const noProvider = "none"
+
+type Payment struct {
+	ID                string
+	OrderID           string
+	AccountID         string
+	Amount            float64
+	RefundedAmount    float64
+	Status            PaymentStatus
+	Source            string
+	Provider          string
+	ProviderReference string
+	FailureReason     string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Attempts          []Attempt
+
+	// version guards against concurrent updates of the same payment
+	version int
+}
+
+// Attempt is a single call made to the provider for a payment
+type Attempt struct {
+	Operation string
+	Amount    float64
+	Succeeded bool
+	Error     string
+	CreatedAt time.Time
+}
+
+// Captured tells whether the money of the payment was taken, even if it was refunded since
+func (p Payment) Captured() bool {
+	switch p.Status {
+	case PaymentCaptured, PaymentPartiallyRefunded, PaymentRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
+// OrderStatus is the payment status of the order that follows from this payment
+func (p Payment) OrderStatus() order.PaymentStatus {
+	switch p.Status {
+	case PaymentCaptured, PaymentPartiallyRefunded:
+		return order.PaymentPaid
+	case PaymentRefunded:
+		return order.PaymentRefunded
+	default:
+		return order.PaymentPending
+	}
+}
+
+type paymentService struct {
+	repository Repository
+	provider   Provider
+}
+
+func NewService(r Repository, p Provider) Service {
+	return &paymentService{r, p}
+}
+
+// Authorize reserves amount for the order. A declined or failed authorization
+// is kept as a payment in that status rather than returned as an error.
+//
+// The payment is stored as pending before the provider is called, so of two
+// concurrent authorizations of an order only one reaches the provider, and
+// money is never held without a payment recording it.
+//
+// Nothing is charged for orders whose discounts cover their total, their
+// payment is captured right away without calling the provider.
+func (s *paymentService) Authorize(ctx context.Context, orderID string, accountID string, amount float64, source string) (*Payment, error) {
+	amount = roundAmount(amount)
+	if amount < 0 {
+		return nil, ErrInvalidAmount
+	}
+	if amount == 0 {
+		return s.settleFree(ctx, orderID, accountID, source)
+	}
+
+	now := time.Now().UTC()
+	p := Payment{
+		ID:        ksuid.New().String(),
+		OrderID:   orderID,
+		AccountID: accountID,
+		Amount:    amount,
+		Status:    PaymentPending,
+		Source:    source,
+		Provider:  s.provider.Name(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		version:   1,
+	}
+	if err := s.repository.PutPayment(ctx, p); err != nil {
+		return nil, err
+	}
+
+	reference, err := s.provider.Authorize(ctx, p, source)
+	attempt := newAttempt("authorize", amount, err)
+	switch {
+	case errors.Is(err, ErrDeclined):
+		p.Status = PaymentDeclined
+		p.FailureReason = err.Error()
+	case err != nil:
+		p.Status = PaymentFailed
+		p.FailureReason = err.Error()
+	default:
+		p.Status = PaymentAuthorized
+		p.ProviderReference = reference
+	}
+	p.UpdatedAt = time.Now().UTC()
+
+	// Recorded even when the caller went away, the provider may hold the money
+	if err := s.repository.UpdatePayment(context.WithoutCancel(ctx), p, attempt); err != nil {
+		log.Printf("Could not record authorization of payment %s, it stays pending: %v", p.ID, err)
+		return nil, err
+	}
+
+	return s.repository.GetPaymentByID(ctx, p.ID)
+}
+
+// settleFree records a captured payment of nothing
+func (s *paymentService) settleFree(ctx context.Context, orderID string, accountID string, source string) (*Payment, error) {
+	now := time.Now().UTC()
+	p := Payment{
+		ID:        ksuid.New().String(),
+		OrderID:   orderID,
+		AccountID: accountID,
+		Status:    PaymentCaptured,
+		Source:    source,
+		Provider:  noProvider,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Attempts:  []Attempt{},
+		version:   1,
+	}
+	if err := s.repository.PutPayment(ctx, p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Capture takes the authorized amount. Capturing a payment that was already
+// captured is a no-op, so a capture can safely be retried.
+func (s *paymentService) Capture(ctx context.Context, id string) (*Payment, error) {
+	p, err := s.repository.GetPaymentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Captured() {
+		return p, nil
+	}
+	if p.Status != PaymentAuthorized {
+		return nil, ErrInvalidState
+	}
+
+	err = s.provider.Capture(ctx, *p)
+	attempt := newAttempt("capture", p.Amount, err)
+	if err != nil {
+		p.FailureReason = err.Error()
+		s.recordFailure(ctx, p, attempt)
+		return nil, err
+	}
+
+	p.Status = PaymentCaptured
+	p.FailureReason = ""
+	p.UpdatedAt = time.Now().UTC()
+	if err := s.repository.UpdatePayment(ctx, *p, attempt); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetPaymentByID(ctx, id)
+}
+
+// Refund gives back amount of a captured payment, or all of what is left when amount is 0
+func (s *paymentService) Refund(ctx context.Context, id string, amount float64) (*Payment, error) {
+	p, err := s.repository.GetPaymentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Status != PaymentCaptured && p.Status != PaymentPartiallyRefunded {
+		return nil, ErrInvalidState
+	}
+
+	remaining := roundAmount(p.Amount - p.RefundedAmount)
+	amount = roundAmount(amount)
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount <= 0 || amount > remaining {
+		return nil, ErrInvalidAmount
+	}
+
+	err = s.provider.Refund(ctx, *p, amount)
+	attempt := newAttempt("refund", amount, err)
+	if err != nil {
+		p.FailureReason = err.Error()
+		s.recordFailure(ctx, p, attempt)
+		return nil, err
+	}
+
+	p.RefundedAmount = roundAmount(p.RefundedAmount + amount)
+	p.Status = PaymentPartiallyRefunded
+	if p.RefundedAmount >= p.Amount {
+		p.Status = PaymentRefunded
+	}
+	p.FailureReason = ""
+	p.UpdatedAt = time.Now().UTC()
+	if err := s.repository.UpdatePayment(ctx, *p, attempt); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetPaymentByID(ctx, id)
+}
+
+// Void releases the authorization of a payment that cannot be captured, for
+// example because it expired at the provider, so the order can be paid again.
+// Voiding a payment that was already voided is a no-op.
+func (s *paymentService) Void(ctx context.Context, id string) (*Payment, error) {
+	p, err := s.repository.GetPaymentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Status == PaymentVoided {
+		return p, nil
+	}
+	if p.Status != PaymentPending && p.Status != PaymentAuthorized {
+		return nil, ErrInvalidState
+	}
+
+	err = s.provider.Void(ctx, *p)
+	attempt := newAttempt("void", p.Amount, err)
+	if err != nil {
+		p.FailureReason = err.Error()
+		s.recordFailure(ctx, p, attempt)
+		return nil, err
+	}
+
+	p.Status = PaymentVoided
+	p.FailureReason = ""
+	p.UpdatedAt = time.Now().UTC()
+	if err := s.repository.UpdatePayment(ctx, *p, attempt); err != nil {
+		return nil, err
+	}
+
+	return s.repository.GetPaymentByID(ctx, id)
+}
+
+// recordFailure keeps track of a failed provider call, the payment itself is left unchanged
+func (s *paymentService) recordFailure(ctx context.Context, p *Payment, attempt Attempt) {
+	p.UpdatedAt = time.Now().UTC()
+	if err := s.repository.UpdatePayment(ctx, *p, attempt); err != nil {
+		log.Printf("Could not record failed %s of payment %s: %v", attempt.Operation, p.ID, err)
+	}
+}
+
+func (s *paymentService) GetPayment(ctx context.Context, id string) (*Payment, error) {
+	return s.repository.GetPaymentByID(ctx, id)
+}
+
+func (s *paymentService) GetPaymentsForOrder(ctx context.Context, orderID string) ([]Payment, error) {
+	return s.repository.GetPaymentsForOrder(ctx, orderID)
+}
+
+func newAttempt(operation string, amount float64, err error) Attempt {
+	a := Attempt{
+		Operation: operation,
+		Amount:    amount,
+		Succeeded: err == nil,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	return a
+}
+
+// roundAmount rounds to cents, the precision the database keeps
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
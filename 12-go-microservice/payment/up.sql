@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS payments (
+  id CHAR(27) PRIMARY KEY,
+  order_id CHAR(27) NOT NULL,
+  account_id CHAR(27) NOT NULL,
+  amount MONEY NOT NULL,
+  refunded_amount MONEY NOT NULL DEFAULT 0,
+  status VARCHAR(24) NOT NULL,
+  source VARCHAR(64) NOT NULL,
+  provider VARCHAR(24) NOT NULL,
+  provider_reference VARCHAR(64) NOT NULL DEFAULT '',
+  failure_reason TEXT NOT NULL DEFAULT '',
+  version INT NOT NULL DEFAULT 1,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS payments_order_id_idx ON payments (order_id, created_at);
+
+-- An order can only have one payment that is being authorized, holds or took
+-- money at a time
+CREATE UNIQUE INDEX IF NOT EXISTS payments_active_order_id_idx ON payments (order_id)
+  WHERE status IN ('pending', 'authorized', 'captured', 'partially_refunded');
+
+-- Every call made to the payment provider, successful or not
+CREATE TABLE IF NOT EXISTS payment_attempts (
+  id SERIAL PRIMARY KEY,
+  payment_id CHAR(27) NOT NULL REFERENCES payments (id) ON DELETE CASCADE,
+  operation VARCHAR(16) NOT NULL,
+  amount MONEY NOT NULL,
+  succeeded BOOLEAN NOT NULL,
+  error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS payment_attempts_payment_id_idx ON payment_attempts (payment_id, id);
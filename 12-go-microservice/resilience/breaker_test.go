@@ -0,0 +1,77 @@
+package resilience
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errUnavailable = status.Error(codes.Unavailable, "unavailable")
+	errNotFound    = status.Error(codes.NotFound, "not found")
+)
+
+func TestBreaker(t *testing.T) {
+	tests := []struct {
+		name      string
+		results   []error
+		wantAllow bool
+	}{
+		{"closed", nil, true},
+		{"below threshold", []error{errUnavailable, errUnavailable}, true},
+		{"opens at threshold", []error{errUnavailable, errUnavailable, errUnavailable}, false},
+		{"deadlines count", []error{errUnavailable, status.Error(codes.DeadlineExceeded, ""), errUnavailable}, false},
+		{"success resets failures", []error{errUnavailable, errUnavailable, nil, errUnavailable}, true},
+		{"rejected requests are not failures", []error{errNotFound, errNotFound, errNotFound}, true},
+		{"other errors are not failures", []error{errors.New("x"), errors.New("y"), errors.New("z")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker(3, time.Hour)
+			for _, err := range tt.results {
+				b.record(err)
+			}
+			if got := b.allow(); got != tt.wantAllow {
+				t.Errorf("allow() = %v, want %v", got, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		trial     error
+		wantAllow bool
+	}{
+		{"trial succeeds", nil, true},
+		{"trial fails", errUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker(1, time.Millisecond)
+			b.record(errUnavailable)
+			if b.allow() {
+				t.Fatal("allowed a call during the cooldown")
+			}
+
+			time.Sleep(2 * time.Millisecond)
+			if !b.allow() {
+				t.Fatal("trial call not allowed after the cooldown")
+			}
+			if b.allow() {
+				t.Fatal("allowed a second call while the trial is in flight")
+			}
+
+			b.record(tt.trial)
+			if got := b.allow(); got != tt.wantAllow {
+				t.Errorf("allow() after the trial = %v, want %v", got, tt.wantAllow)
+			}
+		})
+	}
+}
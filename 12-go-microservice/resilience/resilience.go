@@ -0,0 +1,164 @@
+package resilience
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// Config controls how clients talk to an upstream service. Zero values fall
+// back to the defaults below, so an empty Config is usable.
+type Config struct {
+	Timeout          time.Duration            `envconfig:"TIMEOUT" default:"3s"`
+	MethodTimeouts   map[string]time.Duration `envconfig:"METHOD_TIMEOUTS"`
+	MaxAttempts      int                      `envconfig:"MAX_ATTEMPTS" default:"3"`
+	InitialBackoff   time.Duration            `envconfig:"INITIAL_BACKOFF" default:"100ms"`
+	MaxBackoff       time.Duration            `envconfig:"MAX_BACKOFF" default:"1s"`
+	BreakerThreshold int                      `envconfig:"BREAKER_THRESHOLD" default:"5"`
+	BreakerCooldown  time.Duration            `envconfig:"BREAKER_COOLDOWN" default:"10s"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.Timeout <= 0 {
+		c.Timeout = 3 * time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	// gRPC caps retry attempts at 5
+	if c.MaxAttempts > 5 {
+		c.MaxAttempts = 5
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 100 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Second
+	}
+	if c.BreakerThreshold <= 0 {
+		c.BreakerThreshold = 5
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = 10 * time.Second
+	}
+	return c
+}
+
+var schemeCounter atomic.Uint64
+
+// Dial connects to url, which may be a comma separated list of addresses that
+// requests are balanced across. Only the methods listed in retryable are
+// retried, so they must be idempotent.
+func Dial(url string, service string, retryable []string, cfg Config) (*grpc.ClientConn, error) {
+	cfg = cfg.withDefaults()
+
+	serviceConfig, err := buildServiceConfig(service, retryable, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithChainUnaryInterceptor(
+			deadlineInterceptor(cfg),
+			NewBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown).UnaryClientInterceptor(),
+		),
+	}
+
+	// A single address goes through the default DNS resolver, which already
+	// returns every instance behind a name
+	target := url
+	addrs := strings.Split(url, ",")
+	if len(addrs) > 1 {
+		r := manual.NewBuilderWithScheme(fmt.Sprintf("resilience%d", schemeCounter.Add(1)))
+		state := resolver.State{}
+		for _, a := range addrs {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: strings.TrimSpace(a)})
+		}
+		r.InitialState(state)
+
+		opts = append(opts, grpc.WithResolvers(r))
+		target = r.Scheme() + ":///" + service
+	}
+
+	return grpc.NewClient(target, opts...)
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+// buildServiceConfig enables round robin balancing and gRPC's built-in retries,
+// which already apply randomized jitter to the exponential backoff
+func buildServiceConfig(service string, retryable []string, cfg Config) (string, error) {
+	sc := map[string]interface{}{
+		"loadBalancingConfig": []map[string]interface{}{
+			{"round_robin": map[string]interface{}{}},
+		},
+	}
+
+	if len(retryable) > 0 && cfg.MaxAttempts > 1 {
+		mc := methodConfig{
+			RetryPolicy: &retryPolicy{
+				MaxAttempts:          cfg.MaxAttempts,
+				InitialBackoff:       durationString(cfg.InitialBackoff),
+				MaxBackoff:           durationString(cfg.MaxBackoff),
+				BackoffMultiplier:    2,
+				RetryableStatusCodes: []string{"UNAVAILABLE"},
+			},
+		}
+		for _, m := range retryable {
+			mc.Name = append(mc.Name, methodName{Service: service, Method: m})
+		}
+		sc["methodConfig"] = []methodConfig{mc}
+	}
+
+	b, err := json.Marshal(sc)
+	return string(b), err
+}
+
+func durationString(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// deadlineInterceptor applies a default deadline to calls made without one
+func deadlineInterceptor(cfg Config) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			timeout := cfg.Timeout
+			if t, ok := cfg.MethodTimeouts[method[strings.LastIndex(method, "/")+1:]]; ok {
+				timeout = t
+			}
+
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
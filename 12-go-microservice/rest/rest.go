@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// RegisterFunc registers the routes of a generated gateway, such as
+// pb.RegisterAccountServiceHandlerFromEndpoint
+type RegisterFunc func(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error
+
+// Listen serves a REST/JSON gateway on port. Every request is transcoded into
+// a call to the gRPC server at grpcAddr, so both APIs share one implementation.
+// The OpenAPI document of the routes is served on /openapi.json.
+func Listen(port int, grpcAddr string, openAPI []byte, register RegisterFunc) error {
+	gateway := runtime.NewServeMux(
+		// Zero values are written out so clients always see every field
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+	)
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if err := register(context.Background(), gateway, grpcAddr, opts); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", gateway)
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPI)
+	})
+
+	return http.ListenAndServe(fmt.Sprintf(":%d", port), mux)
+}
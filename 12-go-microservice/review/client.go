@@ -0,0 +1,78 @@
+package review
+
+import (
+	"context"
+	"time"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/review/pb"
+	"google.golang.org/grpc"
+)
+
+// Only idempotent reads are retried, retrying a review could post it twice
+var retryableMethods = []string{
+	"GetReviewsForProduct",
+}
+
+type Client struct {
+	conn    *grpc.ClientConn
+	service pb.ReviewServiceClient
+}
+
+func NewClient(url string, cfg resilience.Config) (*Client, error) {
+	conn, err := resilience.Dial(url, pb.ReviewService_ServiceDesc.ServiceName, retryableMethods, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := pb.NewReviewServiceClient(conn)
+	return &Client{conn, c}, nil
+}
+
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+func (c *Client) CreateReview(ctx context.Context, productID string, accountID string, rating uint32, text string) (*Review, error) {
+	r, err := c.service.CreateReview(ctx, &pb.CreateReviewRequest{
+		ProductId: productID,
+		AccountId: accountID,
+		Rating:    rating,
+		Text:      text,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := reviewFromProto(r.Review)
+	return &res, nil
+}
+
+func (c *Client) GetReviewsForProduct(ctx context.Context, productID string, skip uint64, take uint64) ([]Review, error) {
+	r, err := c.service.GetReviewsForProduct(ctx, &pb.GetReviewsForProductRequest{
+		ProductId: productID,
+		Skip:      skip,
+		Take:      take,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reviews := []Review{}
+	for _, review := range r.Reviews {
+		reviews = append(reviews, reviewFromProto(review))
+	}
+	return reviews, nil
+}
+
+func reviewFromProto(r *pb.Review) Review {
+	res := Review{
+		ID:        r.Id,
+		ProductID: r.ProductId,
+		AccountID: r.AccountId,
+		Rating:    r.Rating,
+		Text:      r.Text,
+	}
+	res.CreatedAt = time.Time{}
+	res.CreatedAt.UnmarshalBinary(r.CreatedAt)
+	return res
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/review"
+)
+
+type Config struct {
+	bootstrap.Config
+	Database   bootstrap.DatabaseConfig `envconfig:"DATABASE"`
+	OrderURL   string                   `envconfig:"ORDER_SERVICE_URL" required:"true"`
+	CatalogURL string                   `envconfig:"CATALOG_SERVICE_URL" required:"true"`
+
+	RPC resilience.Config `envconfig:"RPC"`
+}
+
+func main() {
+	var cfg Config
+	if err := bootstrap.Load(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	bootstrap.Banner("review", &cfg)
+
+	// Repository
+	r, err := bootstrap.WaitFor(cfg.Startup, "database", func() (review.Repository, error) {
+		return review.NewPostgresRepository(cfg.Database)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+	log.Printf("Listening on port %d...", cfg.Port)
+
+	// Service
+	s := review.NewService(r)
+	log.Fatal(review.ListenGRPC(s, cfg.OrderURL, cfg.CatalogURL, cfg.RPC, cfg.Port))
+}
@@ -0,0 +1,113 @@
+package review
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/bootstrap"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAlreadyReviewed = errors.New("account already reviewed this product")
+)
+
+const uniqueViolation = pq.ErrorCode("23505")
+
+type Repository interface {
+	Close()
+	PutReview(ctx context.Context, r Review) error
+	ListReviewsForProduct(ctx context.Context, productID string, skip uint64, take uint64) ([]Review, error)
+	GetProductRating(ctx context.Context, productID string) (*Rating, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func (r *postgresRepository) Close() {
+	r.db.Close()
+}
+
+func (r *postgresRepository) PutReview(ctx context.Context, review Review) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO reviews(id, product_id, account_id, rating, text, created_at) VALUES($1, $2, $3, $4, $5, $6)",
+		review.ID,
+		review.ProductID,
+		review.AccountID,
+		review.Rating,
+		review.Text,
+		review.CreatedAt,
+	)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrAlreadyReviewed
+	}
+	return err
+}
+
+func (r *postgresRepository) ListReviewsForProduct(ctx context.Context, productID string, skip uint64, take uint64) ([]Review, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT
+			id,
+			product_id,
+			account_id,
+			rating,
+			text,
+			created_at
+		FROM reviews
+		WHERE product_id = $1
+		ORDER BY created_at DESC, id DESC OFFSET $2 LIMIT $3
+		`,
+		productID,
+		skip,
+		take,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	reviews := []Review{}
+	for rows.Next() {
+		review := Review{}
+		if err = rows.Scan(&review.ID, &review.ProductID, &review.AccountID, &review.Rating, &review.Text, &review.CreatedAt); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+func (r *postgresRepository) GetProductRating(ctx context.Context, productID string) (*Rating, error) {
+	rating := &Rating{}
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT COALESCE(AVG(rating), 0)::float8, COUNT(*) FROM reviews WHERE product_id = $1",
+		productID,
+	).Scan(&rating.Average, &rating.Count)
+	if err != nil {
+		return nil, err
+	}
+
+	return rating, nil
+}
+
+func NewPostgresRepository(cfg bootstrap.DatabaseConfig) (Repository, error) {
+	db, err := cfg.Open("postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresRepository{db}, nil
+}
@@ -0,0 +1,158 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/leminkhoa/go-grpc-graphql-microservice/catalog"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/order"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/resilience"
+	"github.com/leminkhoa/go-grpc-graphql-microservice/review/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrNotPurchased = errors.New("only accounts that bought the product can review it")
+)
+
+type grpcServer struct {
+	pb.UnimplementedReviewServiceServer
+	service       Service
+	orderClient   *order.Client
+	catalogClient *catalog.Client
+}
+
+func ListenGRPC(s Service, orderURL, catalogURL string, rpc resilience.Config, port int) error {
+	orderClient, err := order.NewClient(orderURL, rpc)
+	if err != nil {
+		return err
+	}
+
+	catalogClient, err := catalog.NewClient(catalogURL, rpc)
+	if err != nil {
+		orderClient.Close()
+		return err
+	}
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		orderClient.Close()
+		catalogClient.Close()
+		return err
+	}
+
+	serv := grpc.NewServer()
+	pb.RegisterReviewServiceServer(serv, &grpcServer{
+		service:       s,
+		orderClient:   orderClient,
+		catalogClient: catalogClient,
+	})
+	reflection.Register(serv)
+	return serv.Serve(lis)
+}
+
+// CreateReview only takes reviews of accounts with a paid order of the
+// product, then updates the rating of the product in the catalog
+func (s *grpcServer) CreateReview(ctx context.Context, r *pb.CreateReviewRequest) (*pb.CreateReviewResponse, error) {
+	purchased, err := s.purchased(ctx, r.AccountId, r.ProductId)
+	if err != nil {
+		log.Printf("Error getting orders of account %s: %v", r.AccountId, err)
+		return nil, err
+	}
+	if !purchased {
+		return nil, reviewError(ErrNotPurchased)
+	}
+
+	review, err := s.service.PostReview(ctx, r.ProductId, r.AccountId, r.Rating, r.Text)
+	if err != nil {
+		log.Println(err)
+		return nil, reviewError(err)
+	}
+
+	// The review is kept even if the catalog is not updated, the next review of
+	// the product recomputes the rating from all of them
+	if err := s.syncRating(ctx, r.ProductId); err != nil {
+		log.Printf("Review %s was saved but the rating of product %s could not be updated: %v", review.ID, r.ProductId, err)
+	}
+
+	return &pb.CreateReviewResponse{Review: reviewToProto(*review)}, nil
+}
+
+func (s *grpcServer) GetReviewsForProduct(ctx context.Context, r *pb.GetReviewsForProductRequest) (*pb.GetReviewsForProductResponse, error) {
+	reviews, err := s.service.GetReviewsForProduct(ctx, r.ProductId, r.Skip, r.Take)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	res := &pb.GetReviewsForProductResponse{Reviews: []*pb.Review{}}
+	for _, review := range reviews {
+		res.Reviews = append(res.Reviews, reviewToProto(review))
+	}
+
+	return res, nil
+}
+
+// purchased tells whether the account has a paid order with the product.
+// Refunded orders don't count.
+func (s *grpcServer) purchased(ctx context.Context, accountID string, productID string) (bool, error) {
+	orders, err := s.orderClient.GetOrdersForAccount(ctx, accountID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, o := range orders {
+		if o.PaymentStatus != order.PaymentPaid {
+			continue
+		}
+		for _, p := range o.Products {
+			if p.ID == productID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// syncRating copies the rating of the product to the catalog. Concurrent
+// reviews may sync out of order, the catalog keeps the rating computed from
+// the most reviews.
+func (s *grpcServer) syncRating(ctx context.Context, productID string) error {
+	rating, err := s.service.GetProductRating(ctx, productID)
+	if err != nil {
+		return err
+	}
+
+	return s.catalogClient.UpdateProductRating(ctx, productID, rating.Average, rating.Count)
+}
+
+func reviewError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidReview):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrAlreadyReviewed):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrNotPurchased):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return err
+	}
+}
+
+func reviewToProto(r Review) *pb.Review {
+	res := &pb.Review{
+		Id:        r.ID,
+		ProductId: r.ProductID,
+		AccountId: r.AccountID,
+		Rating:    r.Rating,
+		Text:      r.Text,
+	}
+	res.CreatedAt, _ = r.CreatedAt.MarshalBinary()
+	return res
+}
@@ -0,0 +1,93 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/segmentio/ksuid"
+)
+
+var (
+	ErrInvalidReview = errors.New("invalid review")
+)
+
+const maxTextLength = 2000
+
+type Service interface {
+	PostReview(ctx context.Context, productID string, accountID string, rating uint32, text string) (*Review, error)
+	GetReviewsForProduct(ctx context.Context, productID string, skip uint64, take uint64) ([]Review, error)
+	GetProductRating(ctx context.Context, productID string) (*Rating, error)
+}
+
+type Review struct {
+	ID        string
+	ProductID string
+	AccountID string
+	Rating    uint32
+	Text      string
+	CreatedAt time.Time
+}
+
+// Rating aggregates the reviews of a product. Average is 0 without reviews.
+type Rating struct {
+	Average float64
+	Count   uint32
+}
+
+type reviewService struct {
+	repository Repository
+}
+
+func NewService(r Repository) Service {
+	return &reviewService{r}
+}
+
+// PostReview saves the review of an account, checking whether the account
+// bought the product is left to the caller
+func (s *reviewService) PostReview(ctx context.Context, productID string, accountID string, rating uint32, text string) (*Review, error) {
+	r := &Review{
+		ID:        ksuid.New().String(),
+		ProductID: productID,
+		AccountID: accountID,
+		Rating:    rating,
+		Text:      strings.TrimSpace(text),
+		CreatedAt: time.Now().UTC(),
+	}
+	if r.Rating < 1 || r.Rating > 5 {
+		return nil, fmt.Errorf("%w: rating must be between 1 and 5", ErrInvalidReview)
+	}
+	if utf8.RuneCountInString(r.Text) > maxTextLength {
+		return nil, fmt.Errorf("%w: text must be at most %d characters", ErrInvalidReview, maxTextLength)
+	}
+
+	if err := s.repository.PutReview(ctx, *r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetReviewsForProduct returns the reviews of the product, newest first
+func (s *reviewService) GetReviewsForProduct(ctx context.Context, productID string, skip uint64, take uint64) ([]Review, error) {
+	if take > 100 || (skip == 0 && take == 0) {
+		take = 100
+	}
+
+	return s.repository.ListReviewsForProduct(ctx, productID, skip, take)
+}
+
+// GetProductRating averages the ratings of the product, rounded to two decimals
+func (s *reviewService) GetProductRating(ctx context.Context, productID string) (*Rating, error) {
+	r, err := s.repository.GetProductRating(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Average = math.Round(r.Average*100) / 100
+	return r, nil
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS reviews (
+  id CHAR(27) PRIMARY KEY,
+  product_id CHAR(27) NOT NULL,
+  account_id CHAR(27) NOT NULL,
+  rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+  text TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  -- An account reviews a product once
+  UNIQUE (product_id, account_id)
+);
+
+CREATE INDEX IF NOT EXISTS reviews_product_id_idx ON reviews (product_id, created_at DESC);